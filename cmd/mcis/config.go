@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// applyConfigFile sets the flags of fs from a YAML file mapping flag names
+// (without dashes) to values, e.g.
+//
+//	cidr-file: ipv4cidr.txt
+//	budget: 4000
+//	timeout: 2s
+//	port: [443, 8443]
+//
+// A list sets a repeatable flag once per element. Flags given on the
+// command line win: their file values are ignored.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	onCommandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { onCommandLine[f.Name] = true })
+
+	for name, v := range values {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("%s: unknown flag %q", path, name)
+		}
+		if onCommandLine[name] {
+			continue
+		}
+		items, isList := v.([]any)
+		if !isList {
+			items = []any{v}
+		}
+		for _, item := range items {
+			switch item.(type) {
+			case map[string]any, []any:
+				return fmt.Errorf("%s: %s: want a value or a list of values", path, name)
+			}
+			s := fmt.Sprint(item)
+			if item == nil {
+				s = ""
+			}
+			if err := fs.Set(name, s); err != nil {
+				return fmt.Errorf("%s: %s: %w", path, name, err)
+			}
+		}
+	}
+	return nil
+}
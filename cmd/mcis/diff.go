@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+)
+
+// ipDiff is an IP of a diff with its rank (1-based, 0 = absent) and score
+// in the old and the new run.
+type ipDiff struct {
+	IP       netip.Addr   `json:"ip"`
+	Prefix   netip.Prefix `json:"prefix"`
+	OldRank  int          `json:"old_rank,omitempty"`
+	NewRank  int          `json:"new_rank,omitempty"`
+	OldScore float64      `json:"old_score_ms,omitempty"`
+	NewScore float64      `json:"new_score_ms,omitempty"`
+	DeltaMS  float64      `json:"delta_ms,omitempty"`
+}
+
+// prefixDiff compares the IPs of one prefix in the old and the new run.
+type prefixDiff struct {
+	Prefix  netip.Prefix `json:"prefix"`
+	OldIPs  int          `json:"old_ips"`
+	NewIPs  int          `json:"new_ips"`
+	OldBest float64      `json:"old_best_ms,omitempty"`
+	NewBest float64      `json:"new_best_ms,omitempty"`
+	DeltaMS float64      `json:"delta_ms,omitempty"`
+}
+
+// resultDiff is the comparison of two runs. Worse and Better hold the IPs
+// (prefixes) of both runs whose score changed by more than the threshold,
+// largest change first.
+type resultDiff struct {
+	New            []ipDiff     `json:"new"`
+	Dropped        []ipDiff     `json:"dropped"`
+	Worse          []ipDiff     `json:"worse"`
+	Better         []ipDiff     `json:"better"`
+	Unchanged      int          `json:"unchanged"`
+	PrefixesNew    []prefixDiff `json:"prefixes_new"`
+	PrefixesGone   []prefixDiff `json:"prefixes_dropped"`
+	PrefixesWorse  []prefixDiff `json:"prefixes_worse"`
+	PrefixesBetter []prefixDiff `json:"prefixes_better"`
+}
+
+// runDiff implements "mcis diff": compare the top results of two runs.
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("mcis diff", flag.ExitOnError)
+	format := fs.String("out", "text", "Output format: text|json")
+	top := fs.Int("top", 0, "Compare only the best N results of each file (0 = all)")
+	minDelta := fs.Float64("min-delta", 1, "Score change (ms) below which an IP or prefix counts as unchanged")
+	bits4 := fs.Int("prefix-v4", 24, "Prefix length IPv4 results are grouped by for the per-prefix comparison")
+	bits6 := fs.Int("prefix-v6", 48, "Prefix length IPv6 results are grouped by for the per-prefix comparison")
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, commandUsage("diff"))
+		os.Exit(2)
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "error: unknown -out %q (want text|json)\n", *format)
+		os.Exit(2)
+	}
+	if *bits4 < 0 || *bits4 > 32 || *bits6 < 0 || *bits6 > 128 {
+		fmt.Fprintln(os.Stderr, "error: -prefix-v4 must be 0-32 and -prefix-v6 0-128")
+		os.Exit(2)
+	}
+
+	var runs [2][]engine.TopResult
+	for i := range runs {
+		res, err := readResults(fs.Arg(i))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		runs[i] = okResults(res, *top)
+	}
+	d := diffResults(runs[0], runs[1], *minDelta, func(ip netip.Addr) netip.Prefix {
+		if ip.Is4() {
+			return netip.PrefixFrom(ip, *bits4).Masked()
+		}
+		return netip.PrefixFrom(ip, *bits6).Masked()
+	})
+
+	var err error
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(d)
+	} else {
+		err = writeDiffText(os.Stdout, d, *minDelta)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// okResults keeps the successful results, at most top of them (0 = all).
+func okResults(res []engine.TopResult, top int) []engine.TopResult {
+	out := res[:0]
+	for _, r := range res {
+		if r.OK && (top <= 0 || len(out) < top) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// diffResults compares the old and the new top results (best first),
+// grouping IPs into prefixes with group.
+func diffResults(old, cur []engine.TopResult, minDelta float64, group func(netip.Addr) netip.Prefix) resultDiff {
+	d := resultDiff{
+		New: []ipDiff{}, Dropped: []ipDiff{}, Worse: []ipDiff{}, Better: []ipDiff{},
+		PrefixesNew: []prefixDiff{}, PrefixesGone: []prefixDiff{}, PrefixesWorse: []prefixDiff{}, PrefixesBetter: []prefixDiff{},
+	}
+
+	ips := make(map[netip.Addr]*ipDiff)
+	var order []netip.Addr
+	entry := func(r engine.TopResult) *ipDiff {
+		e, ok := ips[r.IP]
+		if !ok {
+			e = &ipDiff{IP: r.IP, Prefix: group(r.IP)}
+			ips[r.IP] = e
+			order = append(order, r.IP)
+		}
+		return e
+	}
+	for i, r := range old {
+		if e := entry(r); e.OldRank == 0 {
+			e.OldRank, e.OldScore = i+1, r.ScoreMS
+		}
+	}
+	for i, r := range cur {
+		if e := entry(r); e.NewRank == 0 {
+			e.NewRank, e.NewScore = i+1, r.ScoreMS
+		}
+	}
+
+	prefixes := make(map[netip.Prefix]*prefixDiff)
+	var porder []netip.Prefix
+	for _, ip := range order {
+		e := ips[ip]
+		p, ok := prefixes[e.Prefix]
+		if !ok {
+			p = &prefixDiff{Prefix: e.Prefix, OldBest: math.Inf(1), NewBest: math.Inf(1)}
+			prefixes[e.Prefix] = p
+			porder = append(porder, e.Prefix)
+		}
+		if e.OldRank > 0 {
+			p.OldIPs++
+			p.OldBest = min(p.OldBest, e.OldScore)
+		}
+		if e.NewRank > 0 {
+			p.NewIPs++
+			p.NewBest = min(p.NewBest, e.NewScore)
+		}
+
+		switch {
+		case e.OldRank == 0:
+			d.New = append(d.New, *e)
+		case e.NewRank == 0:
+			d.Dropped = append(d.Dropped, *e)
+		default:
+			e.DeltaMS = e.NewScore - e.OldScore
+			switch {
+			case e.DeltaMS > minDelta:
+				d.Worse = append(d.Worse, *e)
+			case e.DeltaMS < -minDelta:
+				d.Better = append(d.Better, *e)
+			default:
+				d.Unchanged++
+			}
+		}
+	}
+	for _, pfx := range porder {
+		p := prefixes[pfx]
+		switch {
+		case p.OldIPs == 0:
+			p.OldBest = 0
+			d.PrefixesNew = append(d.PrefixesNew, *p)
+		case p.NewIPs == 0:
+			p.NewBest = 0
+			d.PrefixesGone = append(d.PrefixesGone, *p)
+		default:
+			p.DeltaMS = p.NewBest - p.OldBest
+			if p.DeltaMS > minDelta {
+				d.PrefixesWorse = append(d.PrefixesWorse, *p)
+			} else if p.DeltaMS < -minDelta {
+				d.PrefixesBetter = append(d.PrefixesBetter, *p)
+			}
+		}
+	}
+
+	sort.SliceStable(d.New, func(i, j int) bool { return d.New[i].NewRank < d.New[j].NewRank })
+	sort.SliceStable(d.Dropped, func(i, j int) bool { return d.Dropped[i].OldRank < d.Dropped[j].OldRank })
+	sort.SliceStable(d.Worse, func(i, j int) bool { return d.Worse[i].DeltaMS > d.Worse[j].DeltaMS })
+	sort.SliceStable(d.Better, func(i, j int) bool { return d.Better[i].DeltaMS < d.Better[j].DeltaMS })
+	sort.SliceStable(d.PrefixesWorse, func(i, j int) bool { return d.PrefixesWorse[i].DeltaMS > d.PrefixesWorse[j].DeltaMS })
+	sort.SliceStable(d.PrefixesBetter, func(i, j int) bool { return d.PrefixesBetter[i].DeltaMS < d.PrefixesBetter[j].DeltaMS })
+	return d
+}
+
+// writeDiffText writes d for people, one line per IP or prefix.
+func writeDiffText(w io.Writer, d resultDiff, minDelta float64) error {
+	var err error
+	printf := func(format string, args ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	for _, e := range d.New {
+		printf("new\t%s\t%.1fms\trank=%d\tprefix=%s\n", e.IP, e.NewScore, e.NewRank, e.Prefix)
+	}
+	for _, e := range d.Dropped {
+		printf("dropped\t%s\twas %.1fms\trank=%d\tprefix=%s\n", e.IP, e.OldScore, e.OldRank, e.Prefix)
+	}
+	for _, e := range d.Worse {
+		printf("worse\t%s\t%.1fms -> %.1fms (%+.1fms)\trank=%d->%d\n", e.IP, e.OldScore, e.NewScore, e.DeltaMS, e.OldRank, e.NewRank)
+	}
+	for _, e := range d.Better {
+		printf("better\t%s\t%.1fms -> %.1fms (%+.1fms)\trank=%d->%d\n", e.IP, e.OldScore, e.NewScore, e.DeltaMS, e.OldRank, e.NewRank)
+	}
+	for _, p := range d.PrefixesNew {
+		printf("prefix new\t%s\tbest=%.1fms\tips=%d\n", p.Prefix, p.NewBest, p.NewIPs)
+	}
+	for _, p := range d.PrefixesGone {
+		printf("prefix dropped\t%s\tbest was %.1fms\tips=%d\n", p.Prefix, p.OldBest, p.OldIPs)
+	}
+	for _, p := range d.PrefixesWorse {
+		printf("prefix worse\t%s\tbest=%.1fms -> %.1fms (%+.1fms)\tips=%d->%d\n", p.Prefix, p.OldBest, p.NewBest, p.DeltaMS, p.OldIPs, p.NewIPs)
+	}
+	for _, p := range d.PrefixesBetter {
+		printf("prefix better\t%s\tbest=%.1fms -> %.1fms (%+.1fms)\tips=%d->%d\n", p.Prefix, p.OldBest, p.NewBest, p.DeltaMS, p.OldIPs, p.NewIPs)
+	}
+	printf("summary: %d new, %d dropped, %d worse, %d better, %d unchanged (±%gms)\n",
+		len(d.New), len(d.Dropped), len(d.Worse), len(d.Better), d.Unchanged, minDelta)
+	return err
+}
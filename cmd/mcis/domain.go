@@ -0,0 +1,92 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/cidrsrc"
+)
+
+// applyTargetDomain derives the search inputs from the addresses of
+// domain (-target-domain): every answer adds the CDN prefix covering it,
+// if a preset knows one, or else its /24 (IPv4) or /48 (IPv6). Unless set,
+// -host becomes domain, and a CDN recognised from the answers fills in
+// the rest of its preset when -preset is not given.
+func applyTargetDomain(ctx context.Context, fs *flag.FlagSet, f *cidrsrc.Fetcher, domain string, resolvers []string, verbose bool) error {
+	addrs, err := f.Resolve(ctx, domain, resolvers)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	var (
+		seeds []string
+		seen  = make(map[string]bool)
+		cdns  = make(map[string]int)
+	)
+	for _, a := range addrs {
+		name, seed := coveringPreset(a)
+		if name != "" {
+			cdns[name]++
+		} else {
+			bits := 24
+			if a.Is6() {
+				bits = 48
+			}
+			seed = netip.PrefixFrom(a, bits).Masked()
+		}
+		if s := seed.String(); !seen[s] {
+			seen[s] = true
+			seeds = append(seeds, s)
+		}
+	}
+
+	if !set["host"] {
+		if err := fs.Set("host", domain); err != nil {
+			return err
+		}
+	}
+	for _, s := range seeds {
+		if err := fs.Set("cidr", s); err != nil {
+			return err
+		}
+	}
+	cdn := ""
+	for name, n := range cdns {
+		if n > cdns[cdn] || (n == cdns[cdn] && name < cdn) {
+			cdn = name
+		}
+	}
+	if cdn != "" && !set["preset"] {
+		if err := applyPreset(fs, cdn); err != nil {
+			return err
+		}
+	}
+
+	if verbose {
+		sort.Strings(seeds)
+		fmt.Fprintf(os.Stderr, "target-domain: %s -> %d addresses, cdn=%s, cidrs=%s\n",
+			domain, len(addrs), cmp.Or(cdn, "unknown"), strings.Join(seeds, ","))
+	}
+	return nil
+}
+
+// coveringPreset returns the preset whose built-in CIDRs contain a, and
+// the covering CIDR.
+func coveringPreset(a netip.Addr) (string, netip.Prefix) {
+	for name, p := range presets {
+		for _, c := range p.cidrs {
+			if pfx, err := netip.ParsePrefix(c); err == nil && pfx.Contains(a) {
+				return name, pfx
+			}
+		}
+	}
+	return "", netip.Prefix{}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/cidrsrc"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/output"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/publish"
+)
+
+// searchFlags are the flags of the search commands (search, replay,
+// resume, probe, validate and watch).
+type searchFlags struct {
+	cidrs     repeatStringFlag
+	excludes  repeatStringFlag
+	exclFile  string
+	cidrFile  string
+	cidrSrcs  repeatStringFlag
+	asns      repeatStringFlag
+	tgtDomain string
+	resolvers repeatStringFlag
+	cidrCache string
+	cidrTTL   time.Duration
+	budget    int
+	topN      int
+	concur    int
+	heads     int
+	beam      int
+	timeout   time.Duration
+	host      string
+	sni       string
+	hostHdr   string
+	path      string
+	probeMode string
+	scheme    string
+	method    string
+	headers   repeatStringFlag
+	expBody   string
+	expStatus string
+	traceP    string
+	presetN   string
+	ports     repeatStringFlag
+	samples   int
+	sampleSt  string
+	sampleGap time.Duration
+	retries   int
+	retryWait time.Duration
+	probeKind string
+	warpKey   string
+	dohName   string
+	timingMod string
+	noKeepAlv bool
+	tlsFinger string
+	dohType   string
+	warpPeer  string
+	warpRsv   string
+	simFile   string
+	dlTop     int
+	hopsTop   int
+	maxHops   int
+	fullPath  bool
+	dlBytes   int64
+	dlTimeout time.Duration
+	dlURL     string
+	outFmts   repeatStringFlag
+	outPaths  repeatStringFlag
+	probeLog  string
+	capBody   int
+	bodyLimit int64
+	h2Streams int
+	fwmark    int
+	dscp      string
+	sockOpts  probe.SocketOptions
+	noDelay   bool
+	v6Source  string
+	sourceIP  string
+	caFile    string
+	insecure  bool
+	pinSPKI   repeatStringFlag
+	clientCrt string
+	proxyURL  string
+	clientKey string
+	failFile  string
+	saveTree  string
+	ckptFile  string
+	ckptEvery time.Duration
+	resume    string
+	warmFile  string
+	loadTree  string
+	splitV4   int
+	splitV6   int
+	minSplit  int
+	maxBitsV4 int
+	maxBitsV6 int
+	seed      int64
+	verbose   bool
+	explain   bool
+
+	// DNS upload flags
+	dnsProvider    string
+	dnsToken       string
+	dnsZone        string
+	dnsSubdomain   string
+	dnsUploadCount int
+	dnsTeamID      string
+	dnsDryRun      bool
+
+	// Webhook flags
+	publishURL     string
+	publishMethod  string
+	publishHeaders repeatStringFlag
+	publishTmpl    string
+	publishTimeout time.Duration
+
+	// Notification flags
+	notifySlack   string
+	notifyTGToken string
+	notifyTGChat  string
+	notifyOn      string
+	notifyState   string
+
+	// New engine parameters
+	diversityWeight float64
+	splitInterval   int
+	headAffinity    string
+	sharedStats     bool
+	strategy        string
+	budgetSplit     string
+	variancePen     float64
+	weights         engine.PhaseWeights
+	objective       engine.Objective
+	annealTemp      float64
+	annealMin       float64
+	annealSched     string
+	annealRestart   int
+	hedge           bool
+	deterministic   bool
+	hedgeBudget     float64
+	icmpFastFail    bool
+	verifySamples   int
+	reliabilityW    float64
+	verifyMinOK     float64
+	sweepHosts      int
+	mergeSiblings   bool
+
+	// Calibration flags
+	calibrate    bool
+	calibrateIPs repeatStringFlag
+	calibrateSub bool
+
+	// GeoIP flags
+	geoipDB        string
+	asnDB          string
+	requireASN     repeatStringFlag
+	requireCountry repeatStringFlag
+
+	// Colo targeting flags
+	preferColo  repeatStringFlag
+	requireColo repeatStringFlag
+	coloBonus   float64
+	coloTop     int
+
+	// Output format flags
+	xrayUUID  string
+	xrayPath  string
+	hostsName string
+	hostsBest bool
+	zoneName  string
+	zoneTTL   int
+	tmplFile  string
+	policyTpl string
+	csvCols   string
+	sortBy    string
+	filterExp string
+	outAppend bool
+	compress  string
+
+	// Streaming and live display flags
+	stream     bool
+	streamMode string
+	tui        bool
+	noProgress bool
+
+	// Watch mode flags
+	interval time.Duration
+	schedule string
+	decay    float64
+
+	dryRun     bool
+	configFile string
+}
+
+// register defines the flags of cmd on fs. probe and validate measure the
+// IPs they are given: the search flags are not offered and keep their
+// defaults.
+func (f *searchFlags) register(fs *flag.FlagSet, cmd string) {
+	search := fs
+	if cmd == "probe" || cmd == "validate" {
+		search = flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	}
+	f.registerSearch(search)
+	f.registerProbe(fs)
+	f.registerFollowUps(fs)
+	f.registerOutput(fs)
+	if cmd == "watch" {
+		f.registerWatch(fs)
+	}
+	fs.BoolVar(&f.dryRun, "dry-run", false, "Check the inputs, download the --cidr-source/--asn lists and print the planned CIDRs, head layout, budget allocation and estimated run time, then exit without probing")
+	fs.StringVar(&f.configFile, "config", "", "YAML file of flag values keyed by flag name (lists for repeatable flags); command-line flags override it")
+}
+
+// registerSearch defines the flags of the searched CIDRs and of the
+// search itself.
+func (f *searchFlags) registerSearch(fs *flag.FlagSet) {
+	fs.Var(&f.cidrs, "cidr", "CIDR to search (repeatable). Example: 1.1.0.0/16 or 2606:4700::/32")
+	fs.StringVar(&f.cidrFile, "cidr-file", "", "Path to a file containing CIDRs (one per line, # comment supported)")
+	fs.Var(&f.cidrSrcs, "cidr-source", "Download the CIDRs of a public list (repeatable or comma-separated): "+strings.Join(cidrsrc.Sources(), "|")+"; cached, see --cidr-cache-ttl")
+	fs.Var(&f.asns, "asn", "Search the prefixes announced by this ASN (repeatable or comma-separated), from RIPEstat or BGPView; cached like --cidr-source. Example: AS13335")
+	fs.StringVar(&f.tgtDomain, "target-domain", "", "Derive the search from this domain: resolve it, search the CDN prefixes (or /24s and /48s) around the answers, use it as --host and apply the preset of a recognised CDN")
+	fs.Var(&f.resolvers, "target-resolver", "Resolver of --target-domain (repeatable): system, a DNS server ip[:port] or a DoH URL (default: system and the Cloudflare and Google DoH services)")
+	fs.StringVar(&f.cidrCache, "cidr-cache-dir", "", "Directory of the downloaded --cidr-source and --asn lists (default: <user cache dir>/mcis)")
+	fs.DurationVar(&f.cidrTTL, "cidr-cache-ttl", cidrsrc.DefaultTTL, "Age after which a cached --cidr-source/--asn list is downloaded again; an outdated list is still used when the download fails")
+	fs.IntVar(&f.budget, "budget", 2000, "Total probe budget (number of IPs to probe)")
+	fs.IntVar(&f.topN, "top", 20, "Top N IPs to output")
+	fs.IntVar(&f.heads, "heads", 4, "Number of search heads (diversification)")
+	fs.IntVar(&f.beam, "beam", 32, "Beam width per head (kept candidate prefixes)")
+	fs.StringVar(&f.saveTree, "save-tree", "", "Save the search tree (per-prefix statistics and splits) to this file after the run")
+	fs.StringVar(&f.loadTree, "load-tree", "", "Continue refining a search tree saved with -save-tree instead of starting cold")
+	fs.StringVar(&f.warmFile, "warm-start", "", "Seed prefix statistics and the first probes from a previous run's jsonl output (or -probe-log)")
+	fs.StringVar(&f.ckptFile, "checkpoint", "", "Periodically save the full search state to this file (also on exit and on Ctrl-C/SIGTERM)")
+	fs.DurationVar(&f.ckptEvery, "checkpoint-interval", 30*time.Second, "How often to write -checkpoint")
+	fs.StringVar(&f.resume, "resume", "", "Continue an interrupted run from this checkpoint (keeps checkpointing to it unless -checkpoint is set)")
+	fs.IntVar(&f.splitV4, "split-step-v4", 2, "When splitting an IPv4 prefix, increase prefix bits by this step")
+	fs.IntVar(&f.splitV6, "split-step-v6", 4, "When splitting an IPv6 prefix, increase prefix bits by this step")
+	fs.IntVar(&f.minSplit, "min-samples-split", 5, "Minimum samples on a prefix before it can be split")
+	fs.IntVar(&f.maxBitsV4, "max-bits-v4", 24, "Maximum IPv4 prefix bits to drill down to")
+	fs.IntVar(&f.maxBitsV6, "max-bits-v6", 56, "Maximum IPv6 prefix bits to drill down to")
+	fs.BoolVar(&f.mergeSiblings, "merge-siblings", true, "Merge split prefixes back when all children perform the same, and stop drilling into them")
+	fs.IntVar(&f.sweepHosts, "sweep-hosts", 256, "Probe every address once in prefixes with at most this many addresses (0 = always sample at random)")
+	fs.Int64Var(&f.seed, "seed", 0, "Random seed (0 = time-based)")
+	fs.BoolVar(&f.deterministic, "deterministic", false, "Process probe results in submission order so runs with the same --seed probe identical IPs")
+	fs.Float64Var(&f.diversityWeight, "diversity-weight", 0.3, "Weight for head diversity (0-1, higher = more exploration)")
+	fs.IntVar(&f.splitInterval, "split-interval", 20, "Check for split opportunities every N samples")
+	fs.StringVar(&f.headAffinity, "head-affinity", "none", "Pin heads to disjoint subsets of input CIDRs: none|round-robin|weight")
+	fs.BoolVar(&f.sharedStats, "shared-stats", false, "Heads rank prefixes from one shared posterior draw (with per-head noise) instead of independent draws")
+	fs.Float64Var(&f.variancePen, "variance-penalty", 0, "Penalize erratic prefixes: add N standard deviations of a prefix's latency to its mean when selecting and splitting (0 = off)")
+	fs.StringVar(&f.budgetSplit, "budget-split", "none", "Allocate the first quarter of --budget across input CIDRs: none|even|size|list (list = weights in the second column of --cidr-file)")
+	fs.StringVar(&f.strategy, "strategy", "thompson", "Prefix selection strategy: thompson|anneal (anneal = decaying share of random exploration per head)")
+	fs.Float64Var(&f.annealTemp, "anneal-temp", 0.5, "Initial exploration probability of -strategy anneal (0-1)")
+	fs.Float64Var(&f.annealMin, "anneal-min-temp", 0.02, "Final exploration probability of -strategy anneal")
+	fs.StringVar(&f.annealSched, "anneal-schedule", "exp", "Temperature decay of -strategy anneal: exp|linear")
+	fs.IntVar(&f.annealRestart, "anneal-restart", 0, "Reheat a head after N probes without improving its best score (random restart, 0 = off)")
+}
+
+// registerProbe defines the flags of how IPs are probed and scored.
+func (f *searchFlags) registerProbe(fs *flag.FlagSet) {
+	fs.Var(&f.excludes, "exclude-cidr", "CIDR never to probe, even inside the searched CIDRs (repeatable or comma-separated)")
+	fs.StringVar(&f.exclFile, "exclude-file", "", "Path to a file of CIDRs never to probe (same format as --cidr-file)")
+	fs.IntVar(&f.concur, "concurrency", 200, "Probe concurrency")
+	fs.DurationVar(&f.timeout, "timeout", 3*time.Second, "Per-probe timeout")
+	fs.StringVar(&f.host, "host", "example.com", "Host name used for BOTH TLS SNI and HTTP Host header (recommended)")
+	fs.StringVar(&f.sni, "sni", "", "TLS SNI server name (deprecated: use --host)")
+	fs.StringVar(&f.hostHdr, "host-header", "", "HTTP Host header (deprecated: use --host)")
+	fs.StringVar(&f.path, "path", "/cdn-cgi/trace", "HTTP path to request")
+	fs.StringVar(&f.probeKind, "probe", "http", "Probe backend: http|h2mux|icmp|warp|doh|sim (h2mux = concurrent streams on one h2 connection, icmp = ping latency only, warp = WireGuard handshake on UDP, doh = DNS-over-HTTPS query, sim = offline synthetic model)")
+	fs.StringVar(&f.timingMod, "timing", probe.TimingPooled, "Timing mode for -probe http/doh: pooled (http.Client + httptrace) | accurate (dedicated dial/TLS/request per probe)")
+	fs.BoolVar(&f.noKeepAlv, "no-keepalive", false, "Disable connection pooling: every probe makes a fresh TCP+TLS connection (slower, but repeat probes never skip handshakes)")
+	fs.StringVar(&f.tlsFinger, "tls-fingerprint", "", "Mimic a browser ClientHello (uTLS): "+strings.Join(probe.TLSFingerprints(), "|")+" (implies -timing accurate)")
+	fs.StringVar(&f.dohName, "doh-name", probe.DefaultDoHName, "Name queried by -probe doh")
+	fs.StringVar(&f.dohType, "doh-type", "A", "Record type queried by -probe doh: A|AAAA")
+	fs.StringVar(&f.warpKey, "warp-private-key", "", "Private key of a WARP registration (base64, e.g. from a wgcf profile) for -probe warp")
+	fs.StringVar(&f.warpPeer, "warp-public-key", probe.WarpPublicKey, "WireGuard public key of the WARP endpoints for -probe warp")
+	fs.StringVar(&f.warpRsv, "warp-reserved", "", "Reserved header bytes (WARP client_id) for -probe warp: a,b,c or base64")
+	fs.IntVar(&f.samples, "samples-per-ip", 1, "Measure each probed IP N times and score it by -sample-stat")
+	fs.StringVar(&f.sampleSt, "sample-stat", probe.SampleP50, "Statistic of the per-IP samples used for scoring: p50|p90|max")
+	fs.IntVar(&f.retries, "retries", 0, "Retry transient probe failures (timeout, reset, EOF) up to N times before counting the IP as failed")
+	fs.DurationVar(&f.retryWait, "retry-backoff", probe.DefaultRetryBackoff, "Pause before the first retry; doubles for every further retry")
+	fs.DurationVar(&f.sampleGap, "sample-interval", 0, "Pause between the samples of one IP (spaced probes for loss/jitter)")
+	fs.Var(&f.ports, "port", "Port to probe (repeatable or comma-separated, e.g. 443,2053,8443; best port per IP wins; default 443)")
+	fs.StringVar(&f.method, "method", http.MethodGet, "HTTP method of probe requests, e.g. HEAD")
+	fs.Var(&f.headers, "header", "Extra probe request header \"Key: Value\" (repeatable)")
+	fs.StringVar(&f.expBody, "expect-body-regex", "", "Regexp the (body-limit truncated) response body must match for a probe to succeed")
+	fs.StringVar(&f.expStatus, "expect-status", "", "Acceptable status codes, e.g. 200,204,301-308 (default: any 2xx; redirects are not followed when set)")
+	fs.StringVar(&f.traceP, "trace-parser", "", "How the colo is read from responses: "+strings.Join(probe.TraceParsers(), "|")+" (default: cloudflare, the key=value body of /cdn-cgi/trace)")
+	fs.StringVar(&f.presetN, "preset", "", "CDN defaults for --host, --path, --trace-parser, --expect-status and, without --cidr/--cidr-file, the CIDRs: "+presetNames())
+	fs.StringVar(&f.scheme, "scheme", probe.SchemeHTTPS, "Probe URL scheme: https|http (http = no TLS, default port 80)")
+	fs.StringVar(&f.probeMode, "probe-mode", probe.ModeHTTPS, "HTTP transport for -probe http: https (TCP+TLS, h1/h2) | h3 (QUIC)")
+	fs.StringVar(&f.simFile, "sim-scenario", "", "Scenario file (JSON) for --probe sim (default: built-in synthetic landscape)")
+	fs.Int64Var(&f.bodyLimit, "body-limit", probe.DefaultBodyLimit, "Max response body bytes read per probe (0 = headers only, no trace data)")
+	fs.IntVar(&f.fwmark, "fwmark", 0, "Set SO_MARK on probe sockets for policy routing, e.g. 0x100 (linux only)")
+	fs.StringVar(&f.dscp, "dscp", "", "DSCP for probe packets: 0-63 or a class name like ef/af41/cs1")
+	fs.BoolVar(&f.noDelay, "tcp-nodelay", true, "Set TCP_NODELAY on probe sockets (false = enable Nagle)")
+	fs.DurationVar(&f.sockOpts.KeepAlive, "tcp-keepalive", 30*time.Second, "TCP keep-alive period for probe sockets (negative = off)")
+	fs.DurationVar(&f.sockOpts.UserTimeout, "tcp-user-timeout", 0, "TCP_USER_TIMEOUT for probe sockets (linux only, 0 = OS default)")
+	fs.IntVar(&f.sockOpts.RecvBuf, "so-rcvbuf", 0, "SO_RCVBUF for probe sockets in bytes (0 = OS default)")
+	fs.IntVar(&f.sockOpts.SendBuf, "so-sndbuf", 0, "SO_SNDBUF for probe sockets in bytes (0 = OS default)")
+	fs.StringVar(&f.sockOpts.IPv6Prefer, "ipv6-prefer", "", "Preferred IPv6 source address type: temporary|stable (linux only)")
+	fs.StringVar(&f.v6Source, "ipv6-source", "", "Use a local IPv6 source address inside this prefix, e.g. 2001:db8:1::/64")
+	fs.StringVar(&f.sourceIP, "source-ip", "", "Local source address for probe sockets (multi-homed hosts; targets of the other address family fail)")
+	fs.StringVar(&f.sockOpts.Interface, "interface", "", "Bind probe sockets to this network interface, e.g. wan2 (linux and macOS)")
+	fs.StringVar(&f.sockOpts.Zone, "ipv6-zone", "", "Interface for link-local IPv6 targets without a zone, e.g. eth0")
+	fs.StringVar(&f.caFile, "ca-file", "", "PEM bundle of CA certificates to trust instead of the system roots")
+	fs.BoolVar(&f.insecure, "insecure", false, "Skip TLS certificate verification (results are marked tls_verify=skipped)")
+	fs.StringVar(&f.proxyURL, "proxy", "", "Probe through this upstream proxy, e.g. socks5://host:1080 or http://host:3128 (default: always direct)")
+	fs.StringVar(&f.clientCrt, "client-cert", "", "PEM client certificate for mTLS-protected endpoints (requires -client-key)")
+	fs.StringVar(&f.clientKey, "client-key", "", "PEM private key for -client-cert")
+	fs.Var(&f.pinSPKI, "pin-spki", "Only accept IPs whose leaf certificate has this base64 SHA-256 SPKI hash (repeatable or comma-separated)")
+	fs.IntVar(&f.h2Streams, "h2-streams", probe.DefaultH2Streams, "Concurrent streams per probe for -probe h2mux")
+	fs.IntVar(&f.capBody, "capture-body", 0, "Store up to N bytes of each response body in the probe log (0 = off)")
+	fs.BoolVar(&f.hedge, "hedge", false, "Race a second probe when the first exceeds the recent p95 latency")
+	fs.Float64Var(&f.hedgeBudget, "hedge-budget", 0.1, "Maximum hedge probes as a fraction of --budget (0-1; 0 = none)")
+	fs.BoolVar(&f.icmpFastFail, "icmp-fast-fail", false, "Fail probes immediately on ICMP destination-unreachable (needs root/CAP_NET_RAW)")
+	fs.BoolVar(&f.calibrate, "calibrate", false, "Before searching, run a short burst against known-good anycast IPs and auto-set --concurrency")
+	fs.Var(&f.calibrateIPs, "calibrate-ip", "IP used for calibration (repeatable; default 1.1.1.1 and 1.0.0.1 with SNI/Host one.one.one.one)")
+	fs.BoolVar(&f.calibrateSub, "calibrate-subtract", false, "Subtract the calibrated baseline latency from scores")
+
+	fs.IntVar(&f.verifySamples, "verify-samples", 0, "After search, re-probe each top IP N times and re-rank by reliability+verified median latency (0 to disable)")
+	fs.Float64Var(&f.verifyMinOK, "verify-min-success", 0.5, "Drop top IPs whose verified success rate is below this fraction (0 = keep all)")
+	fs.Float64Var(&f.reliabilityW, "reliability-weight", 0.5, "Weight of verified reliability in the final ranking (0-1; 0 = rank by latency alone)")
+	fs.Float64Var(&f.weights.Connect, "w-connect", 1, "Score weight of the TCP connect time")
+	fs.Float64Var(&f.weights.TLS, "w-tls", 1, "Score weight of the TLS handshake time")
+	fs.Float64Var(&f.weights.TTFB, "w-ttfb", 1, "Score weight of the wait for the first response byte after the handshakes")
+	fs.Float64Var(&f.weights.Transfer, "w-transfer", 1, "Score weight of reading the response body")
+	fs.Float64Var(&f.objective.Latency, "w-latency", 1, "Composite score weight of the (phase-weighted) latency")
+	fs.Float64Var(&f.objective.Tail, "w-tail", 0, "Composite score weight of the p90 latency of -samples-per-ip (or -verify-samples)")
+	fs.Float64Var(&f.objective.Loss, "w-loss", 1, "Composite score weight of the sample loss rate (x 2x timeout)")
+	fs.Float64Var(&f.objective.Bandwidth, "w-bandwidth", 0, "Composite score weight of the download time per MB; re-ranks the -download-top IPs after the download test")
+	fs.StringVar(&f.geoipDB, "geoip-db", "", "GeoIP country/city database (.mmdb) for annotation and --require-country")
+	fs.StringVar(&f.asnDB, "asn-db", "", "GeoIP ASN database (.mmdb) for annotation and --require-asn")
+	fs.Var(&f.requireASN, "require-asn", "Only accept IPs in this ASN during the search (repeatable). Example: 13335 or AS13335")
+	fs.Var(&f.requireCountry, "require-country", "Only accept IPs in this country during the search (repeatable). Example: JP")
+	fs.Var(&f.preferColo, "prefer-colo", "Favor IPs whose trace reports one of these colos (repeatable or comma-separated). Example: HKG,NRT")
+	fs.Var(&f.requireColo, "require-colo", "Only accept IPs whose trace reports one of these colos (repeatable or comma-separated)")
+	fs.Float64Var(&f.coloBonus, "colo-bonus", 0.3, "Latency discount (0-1; 0 = none) for probes landing on a --prefer-colo colo")
+}
+
+// registerFollowUps defines the flags of the steps after the search: the
+// download test, hop count, DNS upload, webhook and notifications.
+func (f *searchFlags) registerFollowUps(fs *flag.FlagSet) {
+	fs.IntVar(&f.dlTop, "download-top", 5, "After search, run download speed test for top N IPs (0 to disable)")
+	fs.IntVar(&f.hopsTop, "hops-top", 0, "After search, measure the hop count to the top N IPs with TTL-limited ICMP echoes (needs root/CAP_NET_RAW; 0 to disable)")
+	fs.IntVar(&f.maxHops, "max-hops", probe.DefaultMaxHops, "TTL limit for -hops-top")
+	fs.BoolVar(&f.fullPath, "traceroute", false, "With -hops-top, also include every answering hop (ttl, addr, rtt) in jsonl output")
+	fs.Int64Var(&f.dlBytes, "download-bytes", 50_000_000, "Download test size in bytes (speed.cloudflare.com/__down?bytes=...)")
+	fs.Int64Var(&f.dlBytes, "speedtest-bytes", 50_000_000, "Alias of -download-bytes")
+	fs.StringVar(&f.dlURL, "speedtest-url", "", "Custom download test URL (host is replaced by each IP; default speed.cloudflare.com/__down)")
+	fs.DurationVar(&f.dlTimeout, "download-timeout", 45*time.Second, "Per-IP download test timeout")
+	fs.StringVar(&f.dnsProvider, "dns-provider", "", "DNS provider for uploading results (cloudflare|vercel)")
+	fs.StringVar(&f.dnsToken, "dns-token", "", "DNS provider API token (or use CF_API_TOKEN/VERCEL_TOKEN env)")
+	fs.StringVar(&f.dnsZone, "dns-zone", "", "DNS zone ID (Cloudflare) or domain (Vercel) (or use CF_ZONE_ID env)")
+	fs.StringVar(&f.dnsSubdomain, "dns-subdomain", "", "Subdomain to update (e.g., 'cf' for cf.example.com)")
+	fs.IntVar(&f.dnsUploadCount, "dns-upload-count", 0, "Number of IPs to upload (default: same as --download-top)")
+	fs.StringVar(&f.dnsTeamID, "dns-team-id", "", "Vercel Team ID (optional, or use VERCEL_TEAM_ID env)")
+	fs.BoolVar(&f.dnsDryRun, "dns-dry-run", false, "Show the DNS record changes instead of making them")
+	fs.StringVar(&f.publishURL, "publish-url", "", "Send the final results to this URL after the run (JSON {top, stats} unless -publish-template is set)")
+	fs.StringVar(&f.publishMethod, "publish-method", http.MethodPost, "HTTP method of the -publish-url request")
+	fs.Var(&f.publishHeaders, "publish-header", "Extra -publish-url request header \"Key: Value\" (repeatable), e.g. \"Authorization: Bearer TOKEN\"")
+	fs.StringVar(&f.publishTmpl, "publish-template", "", "Go text/template file building the -publish-url request body (same data and helpers as -template-file)")
+	fs.DurationVar(&f.publishTimeout, "publish-timeout", 30*time.Second, "Timeout of the -publish-url and -notify-* requests")
+	fs.StringVar(&f.notifySlack, "notify-slack", "", "Slack incoming webhook URL to send a run summary to (or use SLACK_WEBHOOK_URL env)")
+	fs.StringVar(&f.notifyTGToken, "notify-telegram-token", "", "Telegram bot token to send a run summary with (or use TELEGRAM_BOT_TOKEN env; requires -notify-telegram-chat)")
+	fs.StringVar(&f.notifyTGChat, "notify-telegram-chat", "", "Telegram chat id or @channel receiving the run summary (or use TELEGRAM_CHAT_ID env)")
+	fs.StringVar(&f.notifyOn, "notify-on", "always", "When to notify: always (every run) | change (the best IP changed)")
+	fs.StringVar(&f.notifyState, "notify-state", "", "File remembering the previous best IP, for the change reported by separate runs")
+}
+
+// registerOutput defines the flags of the outputs and of progress display.
+func (f *searchFlags) registerOutput(fs *flag.FlagSet) {
+	fs.Var(&f.outFmts, "out", "Output format (repeatable, default jsonl; the n-th -out writes to the n-th -out-file, or stdout): jsonl|csv|text|md|colo|prom|sqlite|xray|hosts|zone|surge|quanx|summary|template|text-colo|latency|prefixes (surge/quanx = Surge or Quantumult X proxy lines, see -policy-line, zone = A/AAAA resource records, prefixes = every explored prefix as JSON Lines, latency = histogram and per-prefix percentiles of all probes, text-colo = top results grouped by colo, template = -template-file, summary = run statistics, config and top results as JSON, md = Markdown table, xray = Xray outbounds, hosts = hosts-file lines, colo = best -colo-top IPs of every colo seen, prom = Prometheus text format, sqlite = append to the -out-file database)")
+	fs.Var(&f.outPaths, "out-file", "Write the matching -out to this file (repeatable; default: stdout); {{ts}}, {{date}} and {{unix}} expand to the run's start time")
+	fs.StringVar(&f.failFile, "fail-report", "", "Write failed probes grouped by prefix (error kinds, counts, IPs) as JSON Lines to this file")
+	fs.StringVar(&f.probeLog, "probe-log", "", "Record every probe result, including -verify-samples re-probes, as JSON Lines to this file (replayable with 'mcis replay'; {{ts}} etc. expand as in -out-file)")
+	fs.BoolVar(&f.verbose, "v", false, "Verbose progress to stderr")
+	fs.BoolVar(&f.explain, "explain", false, "Include a per-result score breakdown in jsonl/debug output")
+	fs.IntVar(&f.coloTop, "colo-top", 3, "Best IPs listed per colo by -out colo")
+	fs.StringVar(&f.xrayUUID, "xray-uuid", "", "VLESS/VMess user id written by -out xray, surge and quanx (default: a placeholder to replace)")
+	fs.StringVar(&f.xrayPath, "xray-path", "/", "WebSocket path written by -out xray, surge and quanx")
+	fs.StringVar(&f.hostsName, "hosts-domain", "", "Domain mapped to the top IPs by -out hosts (default: --host)")
+	fs.BoolVar(&f.hostsBest, "hosts-best", false, "With -out hosts, write only the best IPv4 and the best IPv6 address")
+	fs.StringVar(&f.zoneName, "zone-name", "", "Owner name of the records written by -out zone (default: --host as an absolute name)")
+	fs.IntVar(&f.zoneTTL, "zone-ttl", 300, "TTL in seconds of the records written by -out zone")
+	fs.StringVar(&f.csvCols, "csv-columns", "", "Comma-separated columns (and order) written by -out csv, e.g. ip,score_ms,colo,trace.loc (default: all)")
+	fs.StringVar(&f.compress, "out-compress", "none", "Compress -out-file (or stdout), -probe-log and -fail-report output: none|gzip")
+	fs.BoolVar(&f.outAppend, "out-append", false, "Append to -out-file instead of truncating it")
+	fs.StringVar(&f.sortBy, "sort", "score", "Order of the written results: score|total|connect|tls|ttfb|colo|download")
+	fs.StringVar(&f.filterExp, "filter", "", "Only write results matching this expression, e.g. 'ok && status==200 && score_ms<80'")
+	fs.StringVar(&f.policyTpl, "policy-line", "", "Template of each line written by -out surge or quanx (text/template over Name, Rank, IP, Port, SNI, UUID, Path, Colo, ScoreMS; default: a VMess+WebSocket+TLS proxy)")
+	fs.StringVar(&f.tmplFile, "template-file", "", "Go text/template file executed over the results by -out template")
+	fs.BoolVar(&f.stream, "stream", false, "Write results as JSON Lines while the search runs (see -stream-mode), before the final -out output")
+	fs.BoolVar(&f.noProgress, "no-progress", false, "Disable the progress bar shown on stderr when it is a terminal and -v is off")
+	fs.BoolVar(&f.tui, "tui", false, "Show a live dashboard on stderr (top results, probes/sec, budget used, head beams, errors)")
+	fs.StringVar(&f.streamMode, "stream-mode", "probes", "What -stream writes: probes (every probe result) | top (the current top-N as a JSON array whenever it improves)")
+}
+
+// registerWatch defines the flags of "mcis watch".
+func (f *searchFlags) registerWatch(fs *flag.FlagSet) {
+	fs.DurationVar(&f.interval, "interval", 30*time.Minute, "Time between the starts of two searches")
+	fs.StringVar(&f.schedule, "schedule", "", "Cron expression of the search start times, e.g. '0 */4 * * *' (local time; replaces -interval)")
+	fs.Float64Var(&f.decay, "decay", 0.1, "Score penalty (fraction) per cycle for best IPs not found again, so stale winners drop out")
+}
+
+// webhook returns the webhook of the -publish-* flags, nil without
+// -publish-url.
+func (f *searchFlags) webhook() (*publish.Webhook, error) {
+	if f.publishURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(f.publishURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid -publish-url: %s", f.publishURL)
+	}
+	w := &publish.Webhook{URL: f.publishURL, Method: strings.ToUpper(f.publishMethod), Header: make(http.Header), Timeout: f.publishTimeout}
+	for _, h := range f.publishHeaders {
+		k, v, err := probe.ParseHeader(h)
+		if err != nil {
+			return nil, fmt.Errorf("-publish-header: %w", err)
+		}
+		w.Header.Add(k, v)
+	}
+	if f.publishTmpl != "" {
+		t, err := output.ParseTemplate(f.publishTmpl)
+		if err != nil {
+			return nil, err
+		}
+		w.Body = t
+	}
+	return w, nil
+}
+
+// notifier returns the notifier of the -notify-* flags (or their
+// environment variables), nil without a Slack or Telegram target.
+func (f *searchFlags) notifier() (*publish.Notifier, error) {
+	slack := cmp.Or(f.notifySlack, os.Getenv("SLACK_WEBHOOK_URL"))
+	token := cmp.Or(f.notifyTGToken, os.Getenv("TELEGRAM_BOT_TOKEN"))
+	chat := cmp.Or(f.notifyTGChat, os.Getenv("TELEGRAM_CHAT_ID"))
+	if slack == "" && token == "" {
+		return nil, nil
+	}
+	if token != "" && chat == "" {
+		return nil, errors.New("-notify-telegram-token requires -notify-telegram-chat")
+	}
+	if f.notifyOn != "always" && f.notifyOn != "change" {
+		return nil, fmt.Errorf("unknown -notify-on: %s", f.notifyOn)
+	}
+	return &publish.Notifier{
+		SlackWebhook:  slack,
+		TelegramToken: token,
+		TelegramChat:  chat,
+		OnChange:      f.notifyOn == "change",
+		StatePath:     f.notifyState,
+		Timeout:       f.publishTimeout,
+	}, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/pkg/mcis"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/pkg/mcispb"
+)
+
+// grpcServer implements the Searcher service of "mcis grpc" on top of
+// package mcis.
+type grpcServer struct {
+	mcispb.UnimplementedSearcherServer
+}
+
+func (grpcServer) Search(req *mcispb.SearchRequest, stream grpc.ServerStreamingServer[mcispb.Event]) error {
+	if len(req.GetCidrs()) == 0 {
+		return status.Error(codes.InvalidArgument, "cidrs required")
+	}
+	cfg, err := probeOptionsConfig(req.GetProbe())
+	if err != nil {
+		return err
+	}
+	cfg.CIDRs, cfg.Exclude = req.GetCidrs(), req.GetExclude()
+	if req.GetBudget() > 0 {
+		cfg.Budget = int(req.GetBudget())
+	}
+	if req.GetTop() > 0 {
+		cfg.TopN = int(req.GetTop())
+	}
+	if req.GetHeads() > 0 {
+		cfg.Heads = int(req.GetHeads())
+	}
+	cfg.Seed = req.GetSeed()
+	return streamSearch(stream, cfg)
+}
+
+func (grpcServer) Probe(req *mcispb.ProbeRequest, stream grpc.ServerStreamingServer[mcispb.Event]) error {
+	if len(req.GetIps()) == 0 {
+		return status.Error(codes.InvalidArgument, "ips required")
+	}
+	cfg, err := probeOptionsConfig(req.GetProbe())
+	if err != nil {
+		return err
+	}
+	for _, s := range req.GetIps() {
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "bad ip %q", s)
+		}
+		cfg.IPs = append(cfg.IPs, ip)
+	}
+	return streamSearch(stream, cfg)
+}
+
+// probeOptionsConfig returns the default configuration with the non-zero
+// options of o.
+func probeOptionsConfig(o *mcispb.ProbeOptions) (mcis.Config, error) {
+	cfg := mcis.DefaultConfig()
+	if o.GetHost() != "" {
+		cfg.Host = o.GetHost()
+	}
+	if o.GetPath() != "" {
+		cfg.Path = o.GetPath()
+	}
+	if o.GetPort() > 0xffff {
+		return cfg, status.Errorf(codes.InvalidArgument, "bad port %d", o.GetPort())
+	}
+	cfg.Port = uint16(o.GetPort())
+	if o.GetTimeoutMs() < 0 {
+		return cfg, status.Errorf(codes.InvalidArgument, "bad timeout_ms %d", o.GetTimeoutMs())
+	}
+	if o.GetTimeoutMs() > 0 {
+		cfg.Timeout = time.Duration(o.GetTimeoutMs()) * time.Millisecond
+	}
+	if o.GetMethod() != "" {
+		cfg.Method = o.GetMethod()
+	}
+	if o.GetConcurrency() > 0 {
+		cfg.Concurrency = int(o.GetConcurrency())
+	}
+	return cfg, nil
+}
+
+// streamSearch runs the search of cfg, sending its probe and top events
+// to stream and then the result. The events are sent from the search's
+// scheduling goroutine, so a slow client slows the search down; a client
+// that goes away cancels it.
+func streamSearch(stream grpc.ServerStreamingServer[mcispb.Event], cfg mcis.Config) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	var sendErr error
+	send := func(ev *mcispb.Event) {
+		if sendErr != nil {
+			return
+		}
+		if sendErr = stream.Send(ev); sendErr != nil {
+			cancel()
+		}
+	}
+	cfg.OnProbe = func(pr mcis.ProbeResult) {
+		send(&mcispb.Event{Event: &mcispb.Event_Probe{Probe: toPBProbe(pr)}})
+	}
+	cfg.OnTopChange = func(top []mcis.IP) {
+		send(&mcispb.Event{Event: &mcispb.Event_Top{Top: &mcispb.TopUpdate{Top: toPBTop(top)}}})
+	}
+
+	res, err := mcis.Search(ctx, cfg)
+	switch {
+	case sendErr != nil:
+		return sendErr
+	case err != nil:
+		return searchStatus(err)
+	}
+	return stream.Send(&mcispb.Event{Event: &mcispb.Event_Result{Result: &mcispb.Result{
+		Top: toPBTop(res.Top),
+		Stats: &mcispb.Stats{
+			Probes:     res.Stats.Probes,
+			Successes:  res.Stats.Successes,
+			Failures:   res.Stats.Failures,
+			DurationMs: res.Stats.DurationMS,
+		},
+	}}})
+}
+
+// searchStatus maps a search error to a gRPC status: settings the search
+// rejects are invalid arguments, context errors keep their own codes and
+// everything else (I/O, probe log, backend setup) is internal.
+func searchStatus(err error) error {
+	if errors.Is(err, mcis.ErrInvalidConfig) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if st := status.FromContextError(err); st.Code() != codes.Unknown {
+		return st.Err()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func toPBProbe(pr mcis.ProbeResult) *mcispb.ProbeResult {
+	return &mcispb.ProbeResult{
+		Ip:         pr.IP.String(),
+		Prefix:     pr.Prefix.String(),
+		Port:       uint32(pr.Port),
+		Ok:         pr.OK,
+		Status:     int32(pr.Status),
+		Error:      pr.Error,
+		ConnectMs:  pr.ConnectMS,
+		TlsMs:      pr.TLSMS,
+		TtfbMs:     pr.TTFBMS,
+		TotalMs:    pr.TotalMS,
+		Trace:      pr.Trace,
+		WhenUnixMs: pr.When.UnixMilli(),
+	}
+}
+
+func toPBTop(top []mcis.IP) []*mcispb.IP {
+	out := make([]*mcispb.IP, len(top))
+	for i, r := range top {
+		out[i] = &mcispb.IP{
+			Ip:        r.IP.String(),
+			Prefix:    r.Prefix.String(),
+			Port:      uint32(r.Port),
+			Ok:        r.OK,
+			Status:    int32(r.Status),
+			Error:     r.Error,
+			ConnectMs: r.ConnectMS,
+			TlsMs:     r.TLSMS,
+			TtfbMs:    r.TTFBMS,
+			TotalMs:   r.TotalMS,
+			ScoreMs:   r.ScoreMS,
+			Colo:      r.Colo,
+			Trace:     r.Trace,
+		}
+	}
+	return out
+}
+
+// runGRPC runs the gRPC API of "mcis grpc" until interrupted.
+func runGRPC(args []string) {
+	fs := flag.NewFlagSet("mcis grpc", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:9090", "Address the gRPC API listens on")
+	_ = fs.Parse(args)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	lis, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	srv := grpc.NewServer()
+	mcispb.RegisterSearcherServer(srv, grpcServer{})
+	go func() {
+		<-ctx.Done()
+		// Running searches are cancelled rather than waited for.
+		srv.Stop()
+	}()
+	fmt.Fprintln(os.Stderr, "grpc: listening on", *listen)
+	if err := srv.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
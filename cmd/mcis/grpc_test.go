@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/pkg/mcis"
+)
+
+func TestSearchStatus(t *testing.T) {
+	search := func(mod func(*mcis.Config)) error {
+		cfg := mcis.DefaultConfig()
+		cfg.CIDRs, cfg.Method, cfg.Budget = []string{"10.0.0.0/24"}, mcis.MethodSim, 10
+		mod(&cfg)
+		_, err := mcis.Search(context.Background(), cfg)
+		return err
+	}
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"bad cidr", search(func(c *mcis.Config) { c.CIDRs = []string{"10.0.0.0/33"} }), codes.InvalidArgument},
+		{"no cidrs", search(func(c *mcis.Config) { c.CIDRs = nil }), codes.InvalidArgument},
+		{"unknown method", search(func(c *mcis.Config) { c.Method = "carrier-pigeon" }), codes.InvalidArgument},
+		{"canceled", fmt.Errorf("probe: %w", context.Canceled), codes.Canceled},
+		{"deadline", context.DeadlineExceeded, codes.DeadlineExceeded},
+		{"other", errors.New("probe log: disk full"), codes.Internal},
+	}
+	for _, tt := range tests {
+		if tt.err == nil {
+			t.Errorf("%s: search succeeded", tt.name)
+			continue
+		}
+		if got := status.Code(searchStatus(tt.err)); got != tt.want {
+			t.Errorf("%s: %v -> %s, want %s", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
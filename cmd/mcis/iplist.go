@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/input"
+)
+
+// readIPList reads the addresses for "mcis probe" and "mcis validate" from
+// path ("" or "-" for stdin): the "ip" of JSON lines, otherwise the first
+// whitespace- or comma-separated field of each line that is an address, so
+// plain lists as well as the jsonl, text and CSV output of earlier runs
+// work, gzip-compressed or not. Blank lines, "#" comments and lines without
+// an address (such as a CSV header) are skipped.
+func readIPList(path string) ([]netip.Addr, error) {
+	if path == "" {
+		path = "-"
+	}
+	r, err := input.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	var ips []netip.Addr
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			var r struct {
+				IP netip.Addr `json:"ip"`
+			}
+			if json.Unmarshal([]byte(line), &r) == nil && r.IP.IsValid() {
+				ips = append(ips, r.IP.Unmap())
+			}
+			continue
+		}
+		for _, field := range strings.FieldsFunc(line, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' }) {
+			if ip, err := netip.ParseAddr(field); err == nil {
+				ips = append(ips, ip.Unmap())
+				break
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP addresses in %s", displayPath(path))
+	}
+	return ips, nil
+}
+
+func displayPath(path string) string {
+	if path == "" || path == "-" {
+		return "stdin"
+	}
+	return path
+}
@@ -1,20 +1,35 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"net/netip"
+	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/cidrsrc"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/cron"
 	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/dns"
 	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/geoip"
 	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/output"
 	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
 )
@@ -27,281 +42,1196 @@ func (r *repeatStringFlag) Set(v string) error {
 	return nil
 }
 
+// writeFile creates path and writes it with fn.
+func writeFile(path string, fn func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compressWriter wraps w for -out-compress (none|gzip). The returned
+// close function finishes the compressed stream but does not close w.
+func compressWriter(w io.Writer, kind string) (io.Writer, func() error, error) {
+	switch kind {
+	case "", "none":
+		return w, func() error { return nil }, nil
+	case "gzip":
+		gz := gzip.NewWriter(w)
+		return gz, gz.Close, nil
+	}
+	return nil, nil, fmt.Errorf("unknown -out-compress: %s", kind)
+}
+
+// expandOutPath fills the placeholders of an output file name with the
+// run's start time: {{ts}} (20060102-150405), {{date}} (2006-01-02) and
+// {{unix}} (Unix seconds), so periodic runs write separate files.
+func expandOutPath(path string, now time.Time) string {
+	return strings.NewReplacer(
+		"{{ts}}", now.Format("20060102-150405"),
+		"{{date}}", now.Format("2006-01-02"),
+		"{{unix}}", strconv.FormatInt(now.Unix(), 10),
+	).Replace(path)
+}
+
+// splitColos flattens repeated/comma-separated colo codes to upper case.
+func splitColos(vals []string) []string {
+	var out []string
+	for _, v := range vals {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, strings.ToUpper(part))
+			}
+		}
+	}
+	return out
+}
+
+// orNone maps a 0 fraction flag to the engine's negative "none", since
+// engine.Config.ApplyDefaults replaces a 0.
+func orNone(v float64) float64 {
+	if v == 0 {
+		return -1
+	}
+	return v
+}
+
+// runCalibration measures this uplink and adjusts cfg accordingly.
+func runCalibration(ctx context.Context, cfg *engine.Config, probeCfg probe.Config, ipStrs []string, subtract, verbose bool) error {
+	ips := engine.DefaultCalibrationIPs
+	if len(ipStrs) > 0 {
+		ips = nil
+		for _, s := range ipStrs {
+			ip, err := netip.ParseAddr(strings.TrimSpace(s))
+			if err != nil {
+				return fmt.Errorf("parse --calibrate-ip %q: %w", s, err)
+			}
+			ips = append(ips, ip)
+		}
+	} else {
+		probeCfg.SNI = engine.CalibrationHost
+		probeCfg.HostHeader = engine.CalibrationHost
+	}
+	// Calibration measures single round trips.
+	probeCfg.Samples = 0
+
+	backend, err := probe.NewBackend(probeCfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if c, ok := backend.(io.Closer); ok {
+			_ = c.Close()
+		}
+	}()
+	maxConc := cfg.Concurrency * 2
+	if maxConc < 1024 {
+		maxConc = 1024
+	}
+	cal, err := engine.Calibrate(ctx, backend, probeCfg.Timeout, ips, maxConc)
+	if err != nil {
+		return err
+	}
+
+	cfg.Concurrency = cal.Concurrency
+	if subtract {
+		cfg.BaselineMS = cal.BaselineMS
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "calibrate: concurrency=%d probes/s=%.1f baseline=%.1fms jitter=%.1fms success=%.0f%%\n",
+			cal.Concurrency, cal.ProbesPerSec, cal.BaselineMS, cal.JitterMS, cal.SuccessRate*100)
+	}
+	return nil
+}
+
+// commands are the subcommands of mcis; without one, mcis runs "search".
+var commands = []struct{ name, args, help string }{
+	{"search", "[flags]", "search the CIDRs for the fastest IPs (the default)"},
+	{"replay", "<probes.jsonl> [flags]", "search against a recorded -probe-log instead of the network"},
+	{"resume", "<checkpoint> [flags]", "continue an interrupted search from its -checkpoint"},
+	{"probe", "[flags] [ips.txt]", "probe a list of IPs (file or stdin) once each, without searching"},
+	{"validate", "[flags] <results>", "re-probe the IPs of a previous output several times and mark the stale ones"},
+	{"watch", "[flags]", "search again every -interval and keep the rolling best IPs in the -out-file"},
+	{"serve", "[flags]", "run searches as jobs of an HTTP API"},
+	{"grpc", "[flags]", "serve the search and probe APIs over gRPC, streaming probe events"},
+	{"diff", "[flags] <old.jsonl> <new.jsonl>", "compare the results of two runs: new and dropped IPs, score changes per IP and prefix"},
+	{"merge", "[flags] <results.jsonl>...", "merge the results of several runs (e.g. vantage points) into one ranking"},
+}
+
 func main() {
-	var (
-		cidrs     repeatStringFlag
-		cidrFile  string
-		budget    int
-		topN      int
-		concur    int
-		heads     int
-		beam      int
-		timeout   time.Duration
-		host      string
-		sni       string
-		hostHdr   string
-		path      string
-		dlTop     int
-		dlBytes   int64
-		dlTimeout time.Duration
-		outFmt    string
-		outPath   string
-		splitV4   int
-		splitV6   int
-		minSplit  int
-		maxBitsV4 int
-		maxBitsV6 int
-		seed      int64
-		verbose   bool
-
-		// DNS upload flags
-		dnsProvider    string
-		dnsToken       string
-		dnsZone        string
-		dnsSubdomain   string
-		dnsUploadCount int
-		dnsTeamID      string
-
-		// New engine parameters
-		diversityWeight float64
-		splitInterval   int
-	)
-
-	flag.Var(&cidrs, "cidr", "CIDR to search (repeatable). Example: 1.1.0.0/16 or 2606:4700::/32")
-	flag.StringVar(&cidrFile, "cidr-file", "", "Path to a file containing CIDRs (one per line, # comment supported)")
-	flag.IntVar(&budget, "budget", 2000, "Total probe budget (number of IPs to probe)")
-	flag.IntVar(&topN, "top", 20, "Top N IPs to output")
-	flag.IntVar(&concur, "concurrency", 200, "Probe concurrency")
-	flag.IntVar(&heads, "heads", 4, "Number of search heads (diversification)")
-	flag.IntVar(&beam, "beam", 32, "Beam width per head (kept candidate prefixes)")
-	flag.DurationVar(&timeout, "timeout", 3*time.Second, "Per-probe timeout")
-	flag.StringVar(&host, "host", "example.com", "Host name used for BOTH TLS SNI and HTTP Host header (recommended)")
-	flag.StringVar(&sni, "sni", "", "TLS SNI server name (deprecated: use --host)")
-	flag.StringVar(&hostHdr, "host-header", "", "HTTP Host header (deprecated: use --host)")
-	flag.StringVar(&path, "path", "/cdn-cgi/trace", "HTTP path to request")
-	flag.IntVar(&dlTop, "download-top", 5, "After search, run download speed test for top N IPs (0 to disable)")
-	flag.Int64Var(&dlBytes, "download-bytes", 50_000_000, "Download test size in bytes (speed.cloudflare.com/__down?bytes=...)")
-	flag.DurationVar(&dlTimeout, "download-timeout", 45*time.Second, "Per-IP download test timeout")
-	flag.StringVar(&outFmt, "out", "jsonl", "Output format: jsonl|csv|text")
-	flag.StringVar(&outPath, "out-file", "", "Write output to file (default: stdout)")
-	flag.IntVar(&splitV4, "split-step-v4", 2, "When splitting an IPv4 prefix, increase prefix bits by this step")
-	flag.IntVar(&splitV6, "split-step-v6", 4, "When splitting an IPv6 prefix, increase prefix bits by this step")
-	flag.IntVar(&minSplit, "min-samples-split", 5, "Minimum samples on a prefix before it can be split")
-	flag.IntVar(&maxBitsV4, "max-bits-v4", 24, "Maximum IPv4 prefix bits to drill down to")
-	flag.IntVar(&maxBitsV6, "max-bits-v6", 56, "Maximum IPv6 prefix bits to drill down to")
-	flag.Int64Var(&seed, "seed", 0, "Random seed (0 = time-based)")
-	flag.BoolVar(&verbose, "v", false, "Verbose progress to stderr")
-
-	// DNS upload flags
-	flag.StringVar(&dnsProvider, "dns-provider", "", "DNS provider for uploading results (cloudflare|vercel)")
-	flag.StringVar(&dnsToken, "dns-token", "", "DNS provider API token (or use CF_API_TOKEN/VERCEL_TOKEN env)")
-	flag.StringVar(&dnsZone, "dns-zone", "", "DNS zone ID (Cloudflare) or domain (Vercel) (or use CF_ZONE_ID env)")
-	flag.StringVar(&dnsSubdomain, "dns-subdomain", "", "Subdomain to update (e.g., 'cf' for cf.example.com)")
-	flag.IntVar(&dnsUploadCount, "dns-upload-count", 0, "Number of IPs to upload (default: same as --download-top)")
-	flag.StringVar(&dnsTeamID, "dns-team-id", "", "Vercel Team ID (optional, or use VERCEL_TEAM_ID env)")
-
-	// New engine parameters
-	flag.Float64Var(&diversityWeight, "diversity-weight", 0.3, "Weight for head diversity (0-1, higher = more exploration)")
-	flag.IntVar(&splitInterval, "split-interval", 20, "Check for split opportunities every N samples")
-
-	flag.Parse()
+	args := os.Args[1:]
+	cmd := "search"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case "search", "replay", "resume", "probe", "validate", "watch":
+		runSearch(cmd, args)
+	case "serve":
+		runServe(args)
+	case "grpc":
+		runGRPC(args)
+	case "diff":
+		runDiff(args)
+	case "merge":
+		runMerge(args)
+	case "help":
+		usage(os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "mcis: unknown command %q\n\n", cmd)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+}
+
+// usage lists the subcommands; "mcis <command> -h" lists their flags.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: mcis <command> [arguments]")
+	fmt.Fprintln(w)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  mcis %s %s\n    \t%s\n", c.name, c.args, c.help)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'mcis <command> -h' for the flags of a command.")
+}
+
+// commandUsage returns the usage line of a subcommand.
+func commandUsage(name string) string {
+	for _, c := range commands {
+		if c.name == name {
+			return fmt.Sprintf("usage: mcis %s %s", c.name, c.args)
+		}
+	}
+	return "usage: mcis <command> [arguments]"
+}
+
+// runSearch runs a search: cmd is "search", "replay" (args start with the
+// probe log), "resume" (args start with the checkpoint), "probe" (the
+// listed IPs are measured instead of searched), "validate" (the IPs of
+// a previous output are measured and verified) or "watch" (searches are
+// repeated until interrupted).
+func runSearch(cmd string, args []string) {
+	fs := flag.NewFlagSet("mcis "+cmd, flag.ExitOnError)
+	var flags searchFlags
+	flags.register(fs, cmd)
+
+	// replay and resume take their file before the flags
+	operand := ""
+	if cmd == "replay" || cmd == "resume" {
+		if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+			fmt.Fprintln(os.Stderr, commandUsage(cmd))
+			os.Exit(2)
+		}
+		operand, args = args[0], args[1:]
+	}
+	_ = fs.Parse(args)
+	if flags.configFile != "" {
+		if err := applyConfigFile(fs, flags.configFile); err != nil {
+			fmt.Fprintln(os.Stderr, "error: -config:", err)
+			os.Exit(2)
+		}
+	}
+	// What a watch reload compares the re-read flags with
+	loaded := flagValues(fs)
+	replayFile := ""
+	switch cmd {
+	case "replay":
+		// Re-run the search against a recorded probe log instead of the
+		// network
+		replayFile = operand
+		flags.probeKind = probe.BackendReplay
+	case "resume":
+		flags.resume = operand
+	case "probe":
+		if fs.NArg() > 1 {
+			fmt.Fprintln(os.Stderr, commandUsage(cmd))
+			os.Exit(2)
+		}
+	case "validate":
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, commandUsage(cmd))
+			os.Exit(2)
+		}
+		// Every IP is re-probed; the ones failing -verify-min-success are
+		// reported as stale instead of dropped
+		if flags.verifySamples <= 0 {
+			flags.verifySamples = 5
+		}
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
+	// The first signal stops the search and its partial results are
+	// written; restore the default handling so a second one exits at once
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+
+	fetcher := &cidrsrc.Fetcher{CacheDir: flags.cidrCache, TTL: flags.cidrTTL, Log: os.Stderr}
+	if flags.tgtDomain != "" {
+		if err := applyTargetDomain(ctx, fs, fetcher, flags.tgtDomain, flags.resolvers, flags.verbose); err != nil {
+			fmt.Fprintln(os.Stderr, "error: -target-domain:", err)
+			os.Exit(1)
+		}
+	}
+	// After -target-domain, so that its -host wins over the preset's
+	if flags.presetN != "" {
+		if err := applyPreset(fs, flags.presetN); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(2)
+		}
+	}
+
+	if flags.probeKind == probe.BackendDoH {
+		pathSet := false
+		fs.Visit(func(f *flag.Flag) { pathSet = pathSet || f.Name == "path" })
+		if !pathSet {
+			flags.path = probe.DoHPath
+		}
+	}
 
 	// Unify host: by default use --host for both SNI and Host header.
-	if sni == "" {
-		sni = host
+	if flags.sni == "" {
+		flags.sni = flags.host
 	}
-	if hostHdr == "" {
-		hostHdr = host
+	if flags.hostHdr == "" {
+		flags.hostHdr = flags.host
 	}
 
 	// Build engine config
 	cfg := engine.Config{
-		Budget:          budget,
-		TopN:            topN,
-		Concurrency:     concur,
-		Heads:           heads,
-		Beam:            beam,
-		SplitStepV4:     splitV4,
-		SplitStepV6:     splitV6,
-		MinSamplesSplit: minSplit,
-		MaxBitsV4:       maxBitsV4,
-		MaxBitsV6:       maxBitsV6,
-		Seed:            seed,
-		Verbose:         verbose,
-		DiversityWeight: diversityWeight,
-		SplitInterval:   splitInterval,
-	}
+		Budget:          flags.budget,
+		TopN:            flags.topN,
+		Concurrency:     flags.concur,
+		Heads:           flags.heads,
+		Beam:            flags.beam,
+		SplitStepV4:     flags.splitV4,
+		SplitStepV6:     flags.splitV6,
+		MinSamplesSplit: flags.minSplit,
+		MaxBitsV4:       flags.maxBitsV4,
+		MaxBitsV6:       flags.maxBitsV6,
+		Seed:            flags.seed,
+		Verbose:         flags.verbose,
+		DiversityWeight: flags.diversityWeight,
+		SplitInterval:   flags.splitInterval,
+		HeadAffinity:    flags.headAffinity,
+		SharedStats:     flags.sharedStats,
+		Strategy:        flags.strategy,
+		BudgetSplit:     flags.budgetSplit,
+		VariancePenalty: flags.variancePen,
+		Scorer:          flags.weights,
+		Objective:       flags.objective,
+		AnnealTemp:      flags.annealTemp,
+		AnnealMinTemp:   flags.annealMin,
+		AnnealSchedule:  flags.annealSched,
+		AnnealRestart:   flags.annealRestart,
+		Hedge:           flags.hedge,
+		Deterministic:   flags.deterministic,
+		HedgeBudget:     orNone(flags.hedgeBudget),
+		ICMPFastFail:    flags.icmpFastFail,
 
-	probeCfg := probe.Config{
-		Timeout:    timeout,
-		SNI:        sni,
-		HostHeader: hostHdr,
-		Path:       path,
+		VerifySamples:     flags.verifySamples,
+		ReliabilityWeight: orNone(flags.reliabilityW),
+		VerifyMinSuccess:  flags.verifyMinOK,
+		VerifyKeepStale:   cmd == "validate",
+		SweepHosts:        flags.sweepHosts,
+		MergeSiblings:     flags.mergeSiblings,
+
+		FailureReport: flags.failFile != "",
+		Explain:       flags.explain,
 	}
 
-	req := engine.Request{
-		CIDRs:    []string(cidrs),
-		CIDRFile: cidrFile,
-		Probe:    probeCfg,
+	for _, a := range flags.requireASN {
+		for _, part := range strings.Split(a, ",") {
+			asn, err := geoip.ParseASN(part)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			cfg.RequireASN = append(cfg.RequireASN, asn)
+		}
+	}
+	for _, c := range flags.requireCountry {
+		for _, part := range strings.Split(c, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				cfg.RequireCountry = append(cfg.RequireCountry, strings.ToUpper(part))
+			}
+		}
 	}
 
-	// Create and run engine
-	eng := engine.New(cfg, probeCfg)
-	res, err := eng.Run(ctx, req)
+	cfg.PreferColo = splitColos(flags.preferColo)
+	cfg.RequireColo = splitColos(flags.requireColo)
+	cfg.ColoBonus = orNone(flags.coloBonus)
+	targets, err := pairOutputs(flags.outFmts, flags.outPaths)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		os.Exit(1)
 	}
-
-	// Download speed test
-	if dlTop < 0 {
-		dlTop = 0
+	if hasOutput(targets, "colo") {
+		cfg.ColoTopN = flags.coloTop
+	}
+	cfg.LatencyReport = hasOutput(targets, "latency")
+	cfg.PrefixReport = hasOutput(targets, "prefixes")
+	if _, _, err := compressWriter(nil, flags.compress); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	// Files are replaced atomically once there are results to write, so a
+	// failed or interrupted run keeps the previous ones; only the -stream
+	// target, written during the run, and -out-append files are not.
+	for i, t := range targets {
+		t.atomic = !flags.outAppend && !(flags.stream && i == 0)
 	}
-	if dlTop > 0 && dlBytes > 0 {
-		if dlTop > len(res.Top) {
-			dlTop = len(res.Top)
+	var cronSched *cron.Schedule
+	if cmd == "watch" {
+		if flags.stream || flags.tui || flags.outAppend {
+			fmt.Fprintln(os.Stderr, "error: watch does not support -stream, -tui or -out-append")
+			os.Exit(1)
 		}
-		dlp := probe.NewDownloadProber(probe.DownloadConfig{
-			Timeout:  dlTimeout,
-			Bytes:    dlBytes,
-			SNI:      "speed.cloudflare.com",
-			HostName: "speed.cloudflare.com",
-			Path:     "/__down",
-		})
-		for i := 0; i < dlTop; i++ {
-			r := &res.Top[i]
-			dctx, dcancel := context.WithTimeout(ctx, dlTimeout)
-			dr := dlp.Download(dctx, r.IP)
-			dcancel()
-			r.DownloadOK = dr.OK
-			r.DownloadBytes = dr.Bytes
-			r.DownloadMS = dr.TotalMS
-			r.DownloadMbps = dr.Mbps
-			r.DownloadError = dr.Error
-			if verbose {
-				fmt.Fprintf(os.Stderr, "download: rank=%d ip=%s ok=%v mbps=%.2f ms=%d bytes=%d err=%s\n",
-					i+1, r.IP.String(), dr.OK, dr.Mbps, dr.TotalMS, dr.Bytes, dr.Error)
-			}
+		sched, err := watchSchedule(flags.interval, flags.schedule, flags.decay)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
 		}
+		cronSched = sched
+	}
+	// watch expands the placeholders anew for every cycle
+	runStart := time.Now()
+	outPatterns := make([]string, len(targets))
+	for i, t := range targets {
+		outPatterns[i] = t.path
+		t.path = expandOutPath(t.path, runStart)
+		if t.format == "sqlite" && t.path == "" {
+			fmt.Fprintln(os.Stderr, "error: -out sqlite requires -out-file (the database path)")
+			os.Exit(1)
+		}
+	}
+	flags.probeLog = expandOutPath(flags.probeLog, runStart)
+	if hasOutput(targets, "zone") && flags.zoneTTL <= 0 {
+		fmt.Fprintln(os.Stderr, "error: -zone-ttl must be positive")
+		os.Exit(1)
+	}
+	var csvColumns []output.CSVColumn
+	if flags.csvCols != "" {
+		cols, err := output.CSVColumns(strings.Split(flags.csvCols, ","))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		csvColumns = cols
+	}
+	var rowFilter output.Filter
+	if flags.filterExp != "" {
+		f, err := output.ParseFilter(flags.filterExp)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		rowFilter = f
+	}
+	if err := output.SortRows(nil, flags.sortBy); err != nil {
+		fmt.Fprintln(os.Stderr, "error: -sort:", err)
+		os.Exit(1)
+	}
+	// Parse the template before the run so mistakes surface immediately
+	var tmpl *template.Template
+	if hasOutput(targets, "template") {
+		if flags.tmplFile == "" {
+			fmt.Fprintln(os.Stderr, "error: -out template requires -template-file")
+			os.Exit(1)
+		}
+		t, err := output.ParseTemplate(flags.tmplFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		tmpl = t
+	}
+	// Proxy policy lines use the built-in template of their format unless
+	// -policy-line is given
+	policyLines := make(map[string]*template.Template)
+	for _, format := range []string{"surge", "quanx"} {
+		if !hasOutput(targets, format) {
+			continue
+		}
+		text := flags.policyTpl
+		if text == "" {
+			text = output.PolicyTemplates[format]
+		}
+		t, err := output.ParsePolicyLine(text)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: -policy-line:", err)
+			os.Exit(1)
+		}
+		policyLines[format] = t
+	}
+
+	webhook, err := flags.webhook()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	notifier, err := flags.notifier()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
 	}
 
-	// DNS upload
-	if dnsProvider != "" {
-		if dnsSubdomain == "" {
-			fmt.Fprintln(os.Stderr, "error: --dns-subdomain is required when --dns-provider is set")
+	var geoDB *geoip.DB
+	if flags.geoipDB != "" || flags.asnDB != "" {
+		db, err := geoip.Open(flags.geoipDB, flags.asnDB)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
 			os.Exit(1)
 		}
-		if dlTop <= 0 {
-			fmt.Fprintln(os.Stderr, "error: --download-top must be > 0 when using DNS upload")
+		defer func() { _ = db.Close() }()
+		geoDB = db
+	}
+
+	var tos int
+	if flags.dscp != "" {
+		v, err := probe.ParseDSCP(flags.dscp)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
 			os.Exit(1)
 		}
+		tos = v << 2
+	}
+	flags.sockOpts.FwMark = flags.fwmark
+	flags.sockOpts.TOS = tos
+	flags.sockOpts.Nagle = !flags.noDelay
+	if flags.v6Source != "" {
+		p, err := netip.ParsePrefix(flags.v6Source)
+		if err != nil {
+			a, aerr := netip.ParseAddr(flags.v6Source)
+			if aerr != nil {
+				fmt.Fprintln(os.Stderr, "error: invalid -ipv6-source:", err)
+				os.Exit(1)
+			}
+			p = netip.PrefixFrom(a, a.BitLen())
+		}
+		flags.sockOpts.IPv6Source = p.Masked()
+	}
+	if flags.sourceIP != "" {
+		a, err := netip.ParseAddr(flags.sourceIP)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: invalid -source-ip:", err)
+			os.Exit(1)
+		}
+		flags.sockOpts.SourceIP = a.Unmap()
+	}
+	if err := flags.sockOpts.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
 
-		dnsCfg := dns.Config{
-			Provider:    dnsProvider,
-			Token:       dnsToken,
-			Zone:        dnsZone,
-			Subdomain:   dnsSubdomain,
-			UploadCount: dnsUploadCount,
-			TeamID:      dnsTeamID,
+	var probePorts []uint16
+	for _, list := range flags.ports {
+		for _, s := range strings.Split(list, ",") {
+			p, err := probe.ParsePort(strings.TrimSpace(s))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			probePorts = append(probePorts, p)
 		}
+	}
 
-		provider, err := dns.NewProvider(dnsCfg)
+	hdr := make(http.Header)
+	for _, h := range flags.headers {
+		k, v, err := probe.ParseHeader(h)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
 			os.Exit(1)
 		}
+		hdr.Add(k, v)
+	}
 
-		// Collect IPs from download-tested results only
-		type dlResult struct {
-			IP   netip.Addr
-			Mbps float64
+	var bodyRe *regexp.Regexp
+	if flags.expBody != "" {
+		re, err := regexp.Compile(flags.expBody)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: invalid -expect-body-regex:", err)
+			os.Exit(1)
 		}
-		var candidates []dlResult
-		for i := 0; i < dlTop && i < len(res.Top); i++ {
-			r := res.Top[i]
-			if r.DownloadOK {
-				candidates = append(candidates, dlResult{IP: r.IP, Mbps: r.DownloadMbps})
-			}
+		bodyRe = re
+	}
+
+	var statusSet probe.StatusSet
+	if flags.expStatus != "" {
+		set, err := probe.ParseStatusSet(flags.expStatus)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: invalid -expect-status:", err)
+			os.Exit(1)
 		}
+		statusSet = set
+	}
 
-		// Sort by download speed (highest first)
-		sort.Slice(candidates, func(i, j int) bool {
-			return candidates[i].Mbps > candidates[j].Mbps
-		})
+	sources, err := newCIDRSources(fetcher, flags.cidrSrcs, flags.asns)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
 
-		// Determine how many IPs to upload
-		uploadN := dnsCfg.UploadCount
-		if uploadN <= 0 {
-			uploadN = dlTop
+	if err := probe.CheckTraceParser(flags.traceP); err != nil {
+		fmt.Fprintln(os.Stderr, "error: -trace-parser:", err)
+		os.Exit(1)
+	}
+
+	var speedURL *url.URL
+	if flags.dlURL != "" {
+		u, err := url.Parse(flags.dlURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			fmt.Fprintln(os.Stderr, "error: invalid -speedtest-url:", flags.dlURL)
+			os.Exit(1)
 		}
-		if uploadN > len(candidates) {
-			uploadN = len(candidates)
+		speedURL = u
+	}
+
+	var reserved []byte
+	if flags.warpRsv != "" {
+		b, err := probe.ParseWarpReserved(flags.warpRsv)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
 		}
+		reserved = b
+	}
 
-		// Collect IPs to upload
-		var ipsToUpload []netip.Addr
-		for i := 0; i < uploadN; i++ {
-			ipsToUpload = append(ipsToUpload, candidates[i].IP)
+	var proxy *url.URL
+	if flags.proxyURL != "" {
+		u, err := probe.ParseProxy(flags.proxyURL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
 		}
+		proxy = u
+	}
 
-		if len(ipsToUpload) > 0 {
-			if verbose {
-				fmt.Fprintf(os.Stderr, "dns: uploading %d IPs to %s (subdomain: %s), sorted by download speed...\n",
-					len(ipsToUpload), provider.Name(), dnsSubdomain)
-				for i, ip := range ipsToUpload {
-					fmt.Fprintf(os.Stderr, "  %d. %s (%.2f Mbps)\n", i+1, ip.String(), candidates[i].Mbps)
-				}
-			}
-			if err := dns.Upload(ctx, provider, dnsSubdomain, ipsToUpload, verbose); err != nil {
-				fmt.Fprintln(os.Stderr, "dns upload error:", err)
+	var clientCert *tls.Certificate
+	if flags.clientCrt != "" || flags.clientKey != "" {
+		if flags.clientCrt == "" || flags.clientKey == "" {
+			fmt.Fprintln(os.Stderr, "error: -client-cert and -client-key must be used together")
+			os.Exit(1)
+		}
+		cert, err := probe.LoadClientCert(flags.clientCrt, flags.clientKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		clientCert = cert
+	}
+
+	var pins []string
+	for _, list := range flags.pinSPKI {
+		for _, s := range strings.Split(list, ",") {
+			pin, err := probe.ParseSPKIPin(s)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
 				os.Exit(1)
 			}
-		} else {
-			if verbose {
-				fmt.Fprintln(os.Stderr, "dns: no successful download-tested IPs to upload")
-			}
+			pins = append(pins, pin)
 		}
 	}
 
-	// Output
-	var w *os.File = os.Stdout
-	if outPath != "" {
-		f, err := os.Create(outPath)
+	var rootCAs *x509.CertPool
+	if flags.caFile != "" {
+		pool, err := probe.LoadCAFile(flags.caFile)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
 			os.Exit(1)
 		}
-		defer func() {
-			_ = f.Close()
-		}()
-		w = f
+		rootCAs = pool
+	}
+
+	probeCfg := probe.Config{
+		Timeout:      flags.timeout,
+		SNI:          flags.sni,
+		HostHeader:   flags.hostHdr,
+		Path:         flags.path,
+		Method:       strings.ToUpper(flags.method),
+		Headers:      hdr,
+		ExpectBody:   bodyRe,
+		ExpectStatus: statusSet,
+		Scheme:       flags.scheme,
+		Ports:        probePorts,
+
+		Backend:        flags.probeKind,
+		Mode:           flags.probeMode,
+		Samples:        flags.samples,
+		SampleStat:     flags.sampleSt,
+		SampleInterval: flags.sampleGap,
+		Retries:        flags.retries,
+		RetryBackoff:   flags.retryWait,
+		SimScenario:    flags.simFile,
+		ReplayFile:     replayFile,
+		BodyLimit:      flags.bodyLimit,
+		H2Streams:      flags.h2Streams,
+		RootCAs:        rootCAs,
+		Insecure:       flags.insecure,
+		PinSPKI:        pins,
+		ClientCert:     clientCert,
+		Proxy:          proxy,
+		WarpPrivateKey: flags.warpKey,
+		WarpPeerKey:    flags.warpPeer,
+		WarpReserved:   reserved,
+		DoHName:        flags.dohName,
+		Timing:         flags.timingMod,
+		NoKeepAlive:    flags.noKeepAlv,
+		TLSFingerprint: flags.tlsFinger,
+		DoHType:        flags.dohType,
+		Socket:         flags.sockOpts,
+		CaptureBody:    flags.capBody,
+		TraceParser:    flags.traceP,
 	}
 
-	switch outFmt {
-	case "jsonl":
-		if err := output.WriteJSONL(w, res.Top); err != nil {
+	req := engine.Request{
+		CIDRs:       []string(flags.cidrs),
+		ExcludeFile: flags.exclFile,
+		CIDRFile:    flags.cidrFile,
+		Probe:       probeCfg,
+		GeoIP:       geoDB,
+	}
+	if cmd == "probe" || cmd == "validate" {
+		ips, err := readIPList(fs.Arg(0))
+		if err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
 			os.Exit(1)
 		}
-	case "csv":
-		if err := output.WriteCSV(w, res.Top); err != nil {
+		req.IPs = ips
+	}
+
+	for _, ex := range flags.excludes {
+		req.ExcludeCIDRs = append(req.ExcludeCIDRs, strings.Split(ex, ",")...)
+	}
+
+	if flags.dryRun {
+		if !sources.empty() && len(req.IPs) == 0 {
+			srcCIDRs, err := sources.expand(ctx)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			req.CIDRs = append(req.CIDRs, srcCIDRs...)
+		}
+		plan, err := engine.PlanRun(cfg, req)
+		if err == nil {
+			err = writePlan(os.Stdout, plan, probeCfg, flags.verbose)
+		}
+		if err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
 			os.Exit(1)
 		}
-	case "text":
-		if err := output.WriteText(w, res.Top); err != nil {
+		return
+	}
+
+	var probes []engine.ProbeResult
+	if hasOutput(targets, "sqlite") {
+		req.OnProbe = func(pr engine.ProbeResult) { probes = append(probes, pr) }
+	}
+	// exit runs the finish functions, which finish the compressed
+	// -probe-log and -stream outputs, before exiting: os.Exit skips the
+	// deferred calls
+	var finish []func()
+	finishAll := func() {
+		for i := len(finish) - 1; i >= 0; i-- {
+			finish[i]()
+		}
+	}
+	defer finishAll()
+	exit := func(code int) {
+		finishAll()
+		os.Exit(code)
+	}
+	if flags.probeLog != "" {
+		f, err := os.Create(flags.probeLog)
+		if err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
 			os.Exit(1)
 		}
-	case "debug":
+		pw, closeLog, _ := compressWriter(f, flags.compress)
+		finish = append(finish, func() {
+			if err := closeLog(); err != nil {
+				fmt.Fprintln(os.Stderr, "probe log error:", err)
+			}
+			_ = f.Close()
+		})
+		req.ProbeLog = pw
+	}
+	if flags.loadTree != "" {
+		f, err := os.Open(flags.loadTree)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			exit(1)
+		}
+		defer func() { _ = f.Close() }()
+		req.Tree = f
+	}
+	if flags.warmFile != "" {
+		f, err := os.Open(flags.warmFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			exit(1)
+		}
+		defer func() { _ = f.Close() }()
+		req.WarmStart = f
+	}
+	if flags.resume != "" {
+		f, err := os.Open(flags.resume)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			exit(1)
+		}
+		defer func() { _ = f.Close() }()
+		req.Resume = f
+		if flags.ckptFile == "" {
+			flags.ckptFile = flags.resume
+		}
+	}
+	req.Checkpoint = flags.ckptFile
+	req.CheckpointInterval = flags.ckptEvery
+
+	if flags.calibrate {
+		if err := runCalibration(ctx, &cfg, probeCfg, flags.calibrateIPs, flags.calibrateSub, flags.verbose); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			exit(1)
+		}
+	}
+
+	// The -stream target is opened before the run to be written during it,
+	// the other outputs after it (after every cycle for watch).
+	if flags.stream {
+		if err := targets[0].open(flags.outAppend, flags.compress); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			exit(1)
+		}
+		finish = append(finish, func() { _ = targets[0].close() })
+		w := targets[0].w
 		enc := json.NewEncoder(w)
-		enc.SetIndent("", "  ")
-		_ = enc.Encode(res)
-	default:
-		fmt.Fprintln(os.Stderr, "error: unknown -out:", outFmt)
-		os.Exit(1)
+		// Push every streamed line through the compressor right away
+		flush := func() {
+			if fl, ok := w.(interface{ Flush() error }); ok {
+				_ = fl.Flush()
+			}
+		}
+		switch flags.streamMode {
+		case "probes":
+			prev := req.OnProbe
+			req.OnProbe = func(pr engine.ProbeResult) {
+				if prev != nil {
+					prev(pr)
+				}
+				_ = enc.Encode(pr)
+				flush()
+			}
+		case "top":
+			req.OnTopChange = func(top []engine.TopResult) {
+				_ = enc.Encode(top)
+				flush()
+			}
+		default:
+			fmt.Fprintln(os.Stderr, "error: unknown -stream-mode:", flags.streamMode)
+			exit(1)
+		}
+	}
+
+	var dash *dashboard
+	if flags.tui {
+		dash = newDashboard(os.Stderr)
+		dash.attach(&req)
+		dash.start()
+	}
+	var bar *progressBar
+	if !flags.tui && !flags.verbose && !flags.noProgress && cmd != "watch" && isTerminal(os.Stderr) {
+		bar = &progressBar{out: os.Stderr}
+		bar.attach(&req)
+	}
+
+	// search runs the engine, then the download test, hop count and DNS
+	// upload of the top results
+	search := func(ctx context.Context) (engine.Response, error) {
+		req := req
+		if !sources.empty() && len(req.IPs) == 0 {
+			srcCIDRs, err := sources.expand(ctx)
+			if err != nil {
+				return engine.Response{}, err
+			}
+			req.CIDRs = append(slices.Clip(req.CIDRs), srcCIDRs...)
+		}
+		eng := engine.New(cfg, probeCfg)
+		res, err := eng.Run(ctx, req)
+		if dash != nil {
+			dash.close()
+		}
+		if bar != nil {
+			bar.clear()
+		}
+		if err != nil {
+			return res, err
+		}
+
+		if flags.saveTree != "" {
+			if err := writeFile(flags.saveTree, res.Tree.Save); err != nil {
+				return res, err
+			}
+		}
+
+		if flags.failFile != "" {
+			if err := writeFile(flags.failFile, func(w io.Writer) error {
+				cw, closeFn, _ := compressWriter(w, flags.compress)
+				if err := output.WriteFailures(cw, res.Failures); err != nil {
+					return err
+				}
+				return closeFn()
+			}); err != nil {
+				return res, err
+			}
+		}
+
+		// An interrupted run keeps what it learned but skips the follow-up
+		// network steps, and never pushes an unfinished result to DNS
+		if res.Stats.Partial {
+			return res, nil
+		}
+
+		// Download speed test
+		dlN := min(max(flags.dlTop, 0), len(res.Top))
+		if dlN > 0 && flags.dlBytes > 0 {
+			dlCfg := probe.DownloadConfig{
+				Timeout:    flags.dlTimeout,
+				Bytes:      flags.dlBytes,
+				SNI:        "speed.cloudflare.com",
+				HostName:   "speed.cloudflare.com",
+				Path:       "/__down",
+				RootCAs:    probeCfg.RootCAs,
+				Insecure:   probeCfg.Insecure,
+				ClientCert: probeCfg.ClientCert,
+				Proxy:      probeCfg.Proxy,
+				Socket:     probeCfg.Socket,
+			}
+			if speedURL != nil {
+				dlCfg.URL = speedURL
+				dlCfg.SNI, dlCfg.HostName, dlCfg.Path = "", "", ""
+			}
+			dlp := probe.NewDownloadProber(dlCfg)
+			for i := 0; i < dlN; i++ {
+				r := &res.Top[i]
+				dctx, dcancel := context.WithTimeout(ctx, flags.dlTimeout)
+				dr := dlp.Download(dctx, r.IP)
+				dcancel()
+				r.DownloadOK = dr.OK
+				r.DownloadBytes = dr.Bytes
+				r.DownloadMS = dr.TotalMS
+				r.DownloadMbps = dr.Mbps
+				r.DownloadMBps = dr.MBps
+				r.DownloadError = dr.Error
+				if flags.verbose {
+					fmt.Fprintf(os.Stderr, "download: rank=%d ip=%s ok=%v mbps=%.2f ms=%d bytes=%d err=%s\n",
+						i+1, r.IP.String(), dr.OK, dr.Mbps, dr.TotalMS, dr.Bytes, dr.Error)
+				}
+			}
+		}
+
+		if dlN > 0 {
+			engine.ApplyBandwidth(res.Top[:dlN], flags.objective.Bandwidth, float64(flags.dlTimeout.Milliseconds()))
+		}
+
+		if flags.hopsTop > 0 {
+			runHopCount(ctx, res.Top[:min(flags.hopsTop, len(res.Top))], flags.maxHops, flags.timeout, flags.sockOpts.SourceIP, flags.fullPath, flags.verbose)
+		}
+
+		// DNS upload
+		if flags.dnsProvider != "" {
+			if flags.dnsSubdomain == "" {
+				return res, errors.New("--dns-subdomain is required when --dns-provider is set")
+			}
+			if dlN <= 0 {
+				return res, errors.New("--download-top must be > 0 when using DNS upload")
+			}
+
+			dnsCfg := dns.Config{
+				Provider:    flags.dnsProvider,
+				Token:       flags.dnsToken,
+				Zone:        flags.dnsZone,
+				Subdomain:   flags.dnsSubdomain,
+				UploadCount: flags.dnsUploadCount,
+				TeamID:      flags.dnsTeamID,
+			}
+
+			provider, err := dns.NewProvider(dnsCfg)
+			if err != nil {
+				return res, err
+			}
+
+			// Collect IPs from download-tested results only
+			type dlResult struct {
+				IP   netip.Addr
+				Mbps float64
+			}
+			var candidates []dlResult
+			for i := 0; i < dlN; i++ {
+				r := res.Top[i]
+				if r.DownloadOK {
+					candidates = append(candidates, dlResult{IP: r.IP, Mbps: r.DownloadMbps})
+				}
+			}
+
+			// Sort by download speed (highest first)
+			sort.Slice(candidates, func(i, j int) bool {
+				return candidates[i].Mbps > candidates[j].Mbps
+			})
+
+			// Determine how many IPs to upload
+			uploadN := dnsCfg.UploadCount
+			if uploadN <= 0 {
+				uploadN = dlN
+			}
+			if uploadN > len(candidates) {
+				uploadN = len(candidates)
+			}
+
+			// Collect IPs to upload
+			var ipsToUpload []netip.Addr
+			for i := 0; i < uploadN; i++ {
+				ipsToUpload = append(ipsToUpload, candidates[i].IP)
+			}
+
+			if len(ipsToUpload) > 0 {
+				if flags.verbose {
+					fmt.Fprintf(os.Stderr, "dns: uploading %d IPs to %s (subdomain: %s), sorted by download speed...\n",
+						len(ipsToUpload), provider.Name(), flags.dnsSubdomain)
+					for i, ip := range ipsToUpload {
+						fmt.Fprintf(os.Stderr, "  %d. %s (%.2f Mbps)\n", i+1, ip.String(), candidates[i].Mbps)
+					}
+				}
+				if err := dns.Upload(ctx, provider, flags.dnsSubdomain, ipsToUpload, dns.UploadOptions{DryRun: flags.dnsDryRun, Verbose: flags.verbose}); err != nil {
+					return res, fmt.Errorf("dns upload: %w", err)
+				}
+			} else {
+				if flags.verbose {
+					fmt.Fprintln(os.Stderr, "dns: no successful download-tested IPs to upload")
+				}
+			}
+		}
+		return res, nil
+	}
+
+	if flags.hostsName == "" {
+		flags.hostsName = flags.host
+	}
+	if flags.zoneName == "" {
+		flags.zoneName = flags.host
+		if !strings.HasSuffix(flags.zoneName, ".") {
+			flags.zoneName += "."
+		}
+	}
+	// writeOutputs filters and sorts res and writes every target; a failed
+	// output does not keep the others from being written
+	writeOutputs := func(res engine.Response) bool {
+		if rowFilter != nil {
+			res.Top = output.FilterRows(res.Top, rowFilter)
+			for colo, rows := range res.ByColo {
+				res.ByColo[colo] = output.FilterRows(rows, rowFilter)
+			}
+		}
+		_ = output.SortRows(res.Top, flags.sortBy)
+		for _, rows := range res.ByColo {
+			_ = output.SortRows(rows, flags.sortBy)
+		}
+
+		opts := outputOptions{
+			csvColumns:  csvColumns,
+			xray:        output.XrayOptions{SNI: flags.sni, UUID: flags.xrayUUID, Path: flags.xrayPath},
+			hostsName:   flags.hostsName,
+			hostsBest:   flags.hostsBest,
+			zoneName:    flags.zoneName,
+			zoneTTL:     flags.zoneTTL,
+			tmpl:        tmpl,
+			policyLines: policyLines,
+			probes:      probes,
+		}
+		ok := true
+		for _, t := range targets {
+			if err := t.write(res, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "error: -out %s: %v\n", t.format, err)
+				ok = false
+			}
+		}
+		if res.Stats.Partial {
+			return ok
+		}
+		if webhook != nil {
+			if err := webhook.Publish(ctx, res); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				ok = false
+			} else if flags.verbose {
+				fmt.Fprintf(os.Stderr, "publish: sent %d results to %s\n", len(res.Top), flags.publishURL)
+			}
+		}
+		if notifier != nil {
+			if err := notifier.Notify(ctx, res); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				ok = false
+			}
+		}
+		return ok
+	}
+
+	if cmd == "watch" {
+		w := &watcher{
+			interval: flags.interval,
+			schedule: cronSched,
+			best:     newRollingBest(flags.topN, flags.decay),
+			search: func(ctx context.Context) (engine.Response, error) {
+				probes = nil
+				return search(ctx)
+			},
+			write: func(res engine.Response, start time.Time) bool {
+				for i, t := range targets {
+					t.path = expandOutPath(outPatterns[i], start)
+				}
+				if err := openOutputs(targets, false, flags.compress); err != nil {
+					fmt.Fprintln(os.Stderr, "error:", err)
+					return false
+				}
+				return writeOutputs(res)
+			},
+			// Later cycles start from the rolling best set instead of the
+			// -load-tree, -warm-start and -resume inputs of the first
+			next: func(warm io.Reader) {
+				req.Tree, req.Resume, req.WarmStart = nil, nil, warm
+			},
+			reload:  reloads(ctx, flags.configFile),
+			verbose: flags.verbose,
+		}
+		// A reload applies the changed watchReloadable flags to the next
+		// cycles, keeping the rolling best set; it is all or nothing
+		w.onReload = func() {
+			nf, values, err := reloadSearchFlags(cmd, args)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "watch: reload:", err)
+				return
+			}
+			var apply, ignore []string
+			for _, name := range changedFlags(loaded, values) {
+				if watchReloadable[name] {
+					apply = append(apply, name)
+				} else {
+					ignore = append(ignore, name)
+				}
+			}
+			if len(ignore) > 0 {
+				fmt.Fprintf(os.Stderr, "watch: reload: -%s need a restart, keeping the old values\n", strings.Join(ignore, ", -"))
+			}
+			if len(apply) == 0 {
+				return
+			}
+
+			next := cfg
+			next.Budget, next.TopN, next.Concurrency = nf.budget, nf.topN, nf.concur
+			check := next
+			check.ApplyDefaults()
+			err = check.Validate()
+			var sched *cron.Schedule
+			if err == nil {
+				sched, err = watchSchedule(nf.interval, nf.schedule, nf.decay)
+			}
+			var outs []*outputTarget
+			if err == nil {
+				outs, err = pairOutputs(flags.outFmts, nf.outPaths)
+			}
+			for _, t := range outs {
+				if err == nil && t.format == "sqlite" && t.path == "" {
+					err = errors.New("-out sqlite requires -out-file (the database path)")
+				}
+			}
+			hook, err2 := nf.webhook()
+			n, err3 := nf.notifier()
+			if err = errors.Join(err, err2, err3); err != nil {
+				fmt.Fprintln(os.Stderr, "watch: reload: keeping the previous settings:", err)
+				return
+			}
+
+			cfg = next
+			w.interval, w.schedule = nf.interval, sched
+			w.best.size, w.best.decay = max(nf.topN, 1), nf.decay
+			for i, t := range outs {
+				outPatterns[i] = t.path
+			}
+			webhook = hook
+			if n == nil || notifier == nil {
+				notifier = n
+			} else {
+				// Keep the previous best IP the running notifier compares with
+				notifier.SlackWebhook, notifier.TelegramToken, notifier.TelegramChat = n.SlackWebhook, n.TelegramToken, n.TelegramChat
+				notifier.OnChange, notifier.StatePath, notifier.Timeout = n.OnChange, n.StatePath, n.Timeout
+			}
+			for _, name := range apply {
+				loaded[name] = values[name]
+			}
+			fmt.Fprintf(os.Stderr, "watch: reload: applied -%s\n", strings.Join(apply, ", -"))
+		}
+		w.run(ctx)
+		return
+	}
+
+	res, err := search(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		exit(1)
+	}
+	if res.Stats.Partial {
+		fmt.Fprintf(os.Stderr, "interrupted after %d probes: writing the partial results\n", res.Stats.Probes)
+	}
+	if cmd == "validate" {
+		stale := 0
+		for _, r := range res.Top {
+			if r.Stale {
+				stale++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "validate: %d good, %d stale\n", len(res.Top)-stale, stale)
+	}
+	rest := targets
+	if flags.stream {
+		rest = targets[1:]
+	}
+	if err := openOutputs(rest, flags.outAppend, flags.compress); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		exit(1)
+	}
+	if !writeOutputs(res) {
+		exit(1)
+	}
+	if res.Stats.Partial {
+		exit(130)
+	}
+}
+
+// runHopCount fills the hop count (and with full, the path) of top.
+func runHopCount(ctx context.Context, top []engine.TopResult, maxHops int, timeout time.Duration, source netip.Addr, full, verbose bool) {
+	var wg sync.WaitGroup
+	for i := range top {
+		wg.Add(1)
+		go func(r *engine.TopResult) {
+			defer wg.Done()
+			hctx, cancel := context.WithTimeout(ctx, timeout)
+			hr := probe.TraceHops(hctx, r.IP, maxHops, source)
+			cancel()
+			r.Hops = hr.Count
+			if full {
+				r.Path = hr.Hops
+			}
+			if verbose {
+				fmt.Fprintf(os.Stderr, "hops: ip=%s hops=%d answered=%d err=%s\n", r.IP, hr.Count, len(hr.Hops), hr.Error)
+			}
+		}(&top[i])
 	}
+	wg.Wait()
 }
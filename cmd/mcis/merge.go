@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/atomicfile"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/output"
+)
+
+// runMerge implements "mcis merge": combine the results of several runs,
+// e.g. from different vantage points, into one ranking.
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("mcis merge", flag.ExitOnError)
+	stat := fs.String("stat", "median", "Merged score of an IP found in several files: best|median")
+	top := fs.Int("top", 20, "Top N IPs to output (0 = all)")
+	minSources := fs.Int("min-sources", 1, "Only keep IPs found in at least N of the files")
+	format := fs.String("out", "jsonl", "Output format: jsonl|text|csv")
+	outPath := fs.String("out-file", "", "Write the merged results to this file (replaced atomically) instead of stdout")
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, commandUsage("merge"))
+		os.Exit(2)
+	}
+	var write func(w io.Writer, rows []engine.TopResult) error
+	switch *format {
+	case "jsonl":
+		write = output.WriteJSONL
+	case "text":
+		write = output.WriteText
+	case "csv":
+		write = func(w io.Writer, rows []engine.TopResult) error { return output.WriteCSV(w, rows, nil) }
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown -out %q (want jsonl|text|csv)\n", *format)
+		os.Exit(2)
+	}
+	if *stat != "best" && *stat != "median" {
+		fmt.Fprintf(os.Stderr, "error: unknown -stat %q (want best|median)\n", *stat)
+		os.Exit(2)
+	}
+
+	files := make([][]engine.TopResult, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		res, err := readResults(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		files = append(files, okResults(res, 0))
+	}
+	rows := mergeResults(files, *stat == "median", *minSources)
+	if *top > 0 && len(rows) > *top {
+		rows = rows[:*top]
+	}
+
+	var err error
+	if *outPath != "" {
+		err = atomicfile.Write(*outPath, func(w io.Writer) error { return write(w, rows) })
+	} else {
+		err = write(os.Stdout, rows)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// mergeResults merges the results of several files by IP, ranked by the
+// merged score. An IP keeps the row of its best measurement, or with
+// median the row closest to the median score, with ScoreMS set to the
+// best or median score. IPs found in fewer than minSources files are
+// dropped; repeats of an IP within one file count once (its best row).
+func mergeResults(files [][]engine.TopResult, median bool, minSources int) []engine.TopResult {
+	byIP := make(map[netip.Addr][]engine.TopResult)
+	var order []netip.Addr
+	for _, rows := range files {
+		seen := make(map[netip.Addr]bool, len(rows))
+		for _, r := range rows {
+			if seen[r.IP] {
+				continue
+			}
+			seen[r.IP] = true
+			if _, ok := byIP[r.IP]; !ok {
+				order = append(order, r.IP)
+			}
+			byIP[r.IP] = append(byIP[r.IP], r)
+		}
+	}
+
+	merged := make([]engine.TopResult, 0, len(order))
+	for _, ip := range order {
+		rows := byIP[ip]
+		if len(rows) < minSources {
+			continue
+		}
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].ScoreMS < rows[j].ScoreMS })
+		r := rows[0]
+		if median {
+			n := len(rows)
+			score := rows[n/2].ScoreMS
+			if n%2 == 0 {
+				score = (rows[n/2-1].ScoreMS + rows[n/2].ScoreMS) / 2
+			}
+			best := math.Inf(1)
+			for _, row := range rows {
+				if d := math.Abs(row.ScoreMS - score); d < best {
+					best, r = d, row
+				}
+			}
+			r.ScoreMS = score
+		}
+		merged = append(merged, r)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].ScoreMS != merged[j].ScoreMS {
+			return merged[i].ScoreMS < merged[j].ScoreMS
+		}
+		return merged[i].IP.Less(merged[j].IP)
+	})
+	return merged
+}
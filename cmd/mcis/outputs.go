@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/atomicfile"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/output"
+)
+
+// outputFormats are the -out formats.
+var outputFormats = map[string]bool{
+	"jsonl": true, "csv": true, "text": true, "text-colo": true, "md": true,
+	"colo": true, "prom": true, "sqlite": true, "xray": true, "hosts": true,
+	"summary": true, "template": true, "latency": true, "prefixes": true,
+	"zone": true, "surge": true, "quanx": true, "debug": true,
+}
+
+// outputTarget is one -out format and its destination: the paired
+// -out-file, or stdout.
+type outputTarget struct {
+	format string
+	path   string
+	atomic bool // write a temporary file and rename it over path on success
+
+	w       io.Writer
+	close   func() error
+	discard func() // set for atomic targets: drops the temporary file
+}
+
+// pairOutputs pairs the i-th -out with the i-th -out-file; formats without
+// a file write to stdout, which at most one of them may do. No -out means
+// a single jsonl output.
+func pairOutputs(formats, paths []string) ([]*outputTarget, error) {
+	if len(formats) == 0 {
+		formats = []string{"jsonl"}
+	}
+	if len(paths) > len(formats) {
+		return nil, fmt.Errorf("%d -out-file for %d -out; pair every -out-file with an -out", len(paths), len(formats))
+	}
+	var targets []*outputTarget
+	stdout := ""
+	for i, format := range formats {
+		if !outputFormats[format] {
+			return nil, fmt.Errorf("unknown -out: %s", format)
+		}
+		t := &outputTarget{format: format}
+		if i < len(paths) {
+			t.path = paths[i]
+		}
+		if t.path == "" && format != "sqlite" {
+			if stdout != "" {
+				return nil, fmt.Errorf("-out %s and -out %s both write to stdout; give one an -out-file", stdout, format)
+			}
+			stdout = format
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// hasOutput reports whether one of targets has the given format.
+func hasOutput(targets []*outputTarget, format string) bool {
+	for _, t := range targets {
+		if t.format == format {
+			return true
+		}
+	}
+	return false
+}
+
+// open opens the target's file (truncated, or appended to with -out-append)
+// and wraps it for -out-compress. An atomic target is written to a
+// temporary file next to path, so readers never see a partial file. The
+// -out sqlite database is opened by output.WriteSQLite, not here.
+func (t *outputTarget) open(appendMode bool, compress string) error {
+	t.w, t.close, t.discard = os.Stdout, func() error { return nil }, nil
+	if t.format == "sqlite" {
+		return nil
+	}
+	closeFile := func() error { return nil }
+	switch {
+	case t.atomic && t.path != "":
+		f, err := atomicfile.Create(t.path)
+		if err != nil {
+			return err
+		}
+		t.w, closeFile, t.discard = f, f.Commit, f.Abort
+	case t.path != "":
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if appendMode {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(t.path, flags, 0o644)
+		if err != nil {
+			return err
+		}
+		t.w, closeFile = f, f.Close
+	}
+	w, closeCompress, err := compressWriter(t.w, compress)
+	if err != nil {
+		return err
+	}
+	t.w = w
+	closed := false
+	t.close = func() error {
+		if closed {
+			return nil
+		}
+		closed = true
+		if err := closeCompress(); err != nil {
+			if t.discard != nil {
+				t.discard()
+			} else {
+				_ = closeFile()
+			}
+			return err
+		}
+		return closeFile()
+	}
+	return nil
+}
+
+// openOutputs opens targets; when one fails, the temporary files of the
+// ones already opened are dropped.
+func openOutputs(targets []*outputTarget, appendMode bool, compress string) error {
+	for i, t := range targets {
+		if err := t.open(appendMode, compress); err != nil {
+			for _, o := range targets[:i] {
+				if o.discard != nil {
+					o.discard()
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// outputOptions are the format-specific settings of the writers.
+type outputOptions struct {
+	csvColumns  []output.CSVColumn
+	xray        output.XrayOptions
+	hostsName   string
+	hostsBest   bool
+	zoneName    string
+	zoneTTL     int
+	tmpl        *template.Template
+	policyLines map[string]*template.Template // by format: surge, quanx
+	probes      []engine.ProbeResult          // for -out sqlite
+}
+
+// write writes res in the target's format and closes the target.
+func (t *outputTarget) write(res engine.Response, opts outputOptions) error {
+	var err error
+	switch t.format {
+	case "jsonl":
+		err = output.WriteJSONL(t.w, res.Top)
+	case "csv":
+		err = output.WriteCSV(t.w, res.Top, opts.csvColumns)
+	case "text":
+		err = output.WriteText(t.w, res.Top)
+	case "text-colo":
+		err = output.WriteTextByColo(t.w, res.Top)
+	case "latency":
+		err = output.WriteLatency(t.w, res.Latency)
+	case "prefixes":
+		err = output.WritePrefixes(t.w, res.Prefixes)
+	case "colo":
+		err = output.WriteColoTop(t.w, res.ByColo)
+	case "md":
+		err = output.WriteMarkdown(t.w, res.Top)
+	case "xray":
+		err = output.WriteXray(t.w, res.Top, opts.xray)
+	case "hosts":
+		err = output.WriteHosts(t.w, res.Top, opts.hostsName, opts.hostsBest)
+	case "surge", "quanx":
+		err = output.WritePolicy(t.w, res.Top, opts.policyLines[t.format], opts.xray)
+	case "zone":
+		err = output.WriteZone(t.w, res.Top, opts.zoneName, opts.zoneTTL)
+	case "summary":
+		err = output.WriteSummary(t.w, res)
+	case "template":
+		err = output.WriteTemplate(t.w, opts.tmpl, res)
+	case "prom":
+		err = output.WritePrometheus(t.w, res.Top, res.Stats)
+	case "sqlite":
+		err = output.WriteSQLite(t.path, res.Stats, opts.probes, res.Top)
+	case "debug":
+		enc := json.NewEncoder(t.w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(res)
+	default:
+		err = fmt.Errorf("unknown -out: %s", t.format)
+	}
+	if err != nil && t.discard != nil {
+		t.discard()
+		return err
+	}
+	if cerr := t.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// planListMax is the number of input CIDRs -dry-run lists without -v.
+const planListMax = 20
+
+// writePlan writes the -dry-run plan of a run for people.
+func writePlan(w io.Writer, p engine.Plan, probeCfg probe.Config, all bool) error {
+	var err error
+	printf := func(format string, args ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	cfg := p.Config
+
+	var v4, v6 int
+	for _, pp := range p.Prefixes {
+		if pp.Prefix.Addr().Is4() {
+			v4++
+		} else {
+			v6++
+		}
+	}
+	printf("inputs:   %d CIDRs (%d IPv4, %d IPv6), %s addresses", len(p.Prefixes), v4, v6, fmtCount(p.Addresses))
+	if p.Excluded > 0 {
+		printf(", %d more CIDRs entirely excluded", p.Excluded)
+	}
+	printf("\n")
+
+	backend := cmp.Or(probeCfg.Backend, probe.BackendHTTP)
+	ports := "default"
+	if len(probeCfg.Ports) > 0 {
+		ps := make([]string, len(probeCfg.Ports))
+		for i, port := range probeCfg.Ports {
+			ps[i] = strconv.Itoa(int(port))
+		}
+		ports = strings.Join(ps, ",")
+	}
+	printf("probe:    %s host=%s path=%s port=%s timeout=%s samples=%d retries=%d\n",
+		backend, probeCfg.SNI, probeCfg.Path, ports, probeCfg.Timeout, max(probeCfg.Samples, 1), probeCfg.Retries)
+	printf("search:   budget=%d top=%d concurrency=%d strategy=%s\n", cfg.Budget, cfg.TopN, cfg.Concurrency, cfg.Strategy)
+	printf("heads:    %d heads x beam %d, affinity=%s, split step /+%d (v4) /+%d (v6) down to /%d (v4) /%d (v6)\n",
+		cfg.Heads, cfg.Beam, cfg.HeadAffinity, cfg.SplitStepV4, cfg.SplitStepV6, cfg.MaxBitsV4, cfg.MaxBitsV6)
+	for i, roots := range p.Heads {
+		var addrs float64
+		for _, r := range roots {
+			addrs += math.Exp2(float64(r.Addr().BitLen() - r.Bits()))
+		}
+		printf("  head %d: %d CIDRs, %s addresses\n", i+1, len(roots), fmtCount(addrs))
+	}
+	if p.SplitProbes > 0 {
+		printf("split:    first %d probes allocated by %s\n", p.SplitProbes, cfg.BudgetSplit)
+	}
+
+	heads := make(map[netip.Prefix][]string)
+	for i, roots := range p.Heads {
+		for _, r := range roots {
+			heads[r] = append(heads[r], strconv.Itoa(i+1))
+		}
+	}
+	for i, pp := range p.Prefixes {
+		if i == planListMax && !all {
+			printf("  ... %d more CIDRs (-v lists all)\n", len(p.Prefixes)-i)
+			break
+		}
+		printf("  %s\taddresses=%s", pp.Prefix, fmtCount(math.Exp2(float64(pp.Prefix.Addr().BitLen()-pp.Prefix.Bits()))))
+		if pp.Weight != 1 {
+			printf("\tweight=%g", pp.Weight)
+		}
+		if p.SplitProbes > 0 {
+			printf("\tsplit=%.1f", pp.SplitProbes)
+		}
+		if hs := heads[pp.Prefix]; len(hs) > 0 {
+			printf("\thead=%s", strings.Join(hs, ","))
+		}
+		printf("\n")
+	}
+
+	printf("estimate: up to %d probes, %s to %s at concurrency %d\n",
+		p.Probes, fmtDuration(p.MinDuration), fmtDuration(p.MaxDuration), cfg.Concurrency)
+	return err
+}
+
+// fmtCount formats an address count, as a power of two when it is too
+// large to read.
+func fmtCount(n float64) string {
+	if n < 1e12 {
+		return strconv.FormatFloat(n, 'f', 0, 64)
+	}
+	return fmt.Sprintf("~2^%.1f", math.Log2(n))
+}
+
+// fmtDuration rounds d for a run time estimate.
+func fmtDuration(d time.Duration) string {
+	if d >= time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// preset bundles the flag values that suit one CDN (-preset).
+type preset struct {
+	host         string
+	path         string
+	trace        string // -trace-parser
+	expectStatus string // -expect-status; redirects of a landing page count
+	cidrs        []string
+}
+
+// presets are the -preset values. Gcore and Bunny publish no stable list
+// of edge ranges, so their presets leave the CIDRs to -cidr/-cidr-file.
+var presets = map[string]preset{
+	"cloudflare": {
+		host:  "cloudflare.com",
+		path:  "/cdn-cgi/trace",
+		trace: probe.TraceCloudflare,
+		// www.cloudflare.com/ips-v4 and ips-v6
+		cidrs: []string{
+			"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+			"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+			"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+			"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+			"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32",
+			"2405:8100::/32", "2a06:98c0::/29", "2c0f:f248::/32",
+		},
+	},
+	"fastly": {
+		host:         "www.fastly.com",
+		path:         "/",
+		trace:        probe.TraceFastly,
+		expectStatus: "200-399",
+		// api.fastly.com/public-ip-list
+		cidrs: []string{
+			"23.235.32.0/20", "43.249.72.0/22", "103.244.50.0/24", "103.245.222.0/23",
+			"103.245.224.0/24", "104.156.80.0/20", "140.248.64.0/18", "140.248.128.0/17",
+			"146.75.0.0/17", "151.101.0.0/16", "157.52.64.0/18", "167.82.0.0/17",
+			"167.82.128.0/20", "167.82.160.0/20", "167.82.224.0/20", "172.111.64.0/18",
+			"185.31.16.0/22", "199.27.72.0/21", "199.232.0.0/16",
+			"2a04:4e40::/32", "2a04:4e42::/32",
+		},
+	},
+	"cloudfront": {
+		host:         "d1.awsstatic.com",
+		path:         "/",
+		trace:        probe.TraceCloudFront,
+		expectStatus: "200-399",
+		// The larger CLOUDFRONT_GLOBAL_IP_LIST ranges of
+		// d7uri8nf7uskq.cloudfront.net/tools/list-cloudfront-ips
+		cidrs: []string{
+			"13.32.0.0/15", "13.35.0.0/16", "13.224.0.0/14", "13.249.0.0/16",
+			"18.64.0.0/14", "18.154.0.0/15", "18.160.0.0/15", "18.164.0.0/15",
+			"18.172.0.0/15", "18.238.0.0/15", "18.244.0.0/15", "52.84.0.0/15",
+			"54.182.0.0/16", "54.192.0.0/16", "54.230.0.0/16", "54.239.128.0/18",
+			"99.84.0.0/16", "99.86.0.0/16", "108.138.0.0/15", "108.156.0.0/14",
+			"143.204.0.0/16", "204.246.164.0/22", "205.251.192.0/19", "216.137.32.0/19",
+			"2600:9000::/28",
+		},
+	},
+	"gcore": {
+		host:         "gcore.com",
+		path:         "/",
+		trace:        probe.TraceGcore,
+		expectStatus: "200-399",
+	},
+	"bunny": {
+		host:         "bunny.net",
+		path:         "/",
+		trace:        probe.TraceBunny,
+		expectStatus: "200-399",
+	},
+}
+
+// presetNames lists the -preset values.
+func presetNames() string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// applyPreset sets the flags of the named preset that are not set yet, on
+// the command line or by -config. Its CIDRs are used only if no other
+// input (-cidr, -cidr-file, -cidr-source, -asn, -target-domain) is set.
+func applyPreset(fs *flag.FlagSet, name string) error {
+	p, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown -preset %q (want %s)", name, presetNames())
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	values := map[string]string{
+		"host":          p.host,
+		"path":          p.path,
+		"trace-parser":  p.trace,
+		"expect-status": p.expectStatus,
+	}
+	for flagName, v := range values {
+		if v == "" || set[flagName] {
+			continue
+		}
+		if err := fs.Set(flagName, v); err != nil {
+			return err
+		}
+	}
+	// probe and validate measure given IPs and have no -cidr
+	if fs.Lookup("cidr") == nil || set["cidr"] || set["cidr-file"] || set["cidr-source"] || set["asn"] || set["target-domain"] {
+		return nil
+	}
+	if len(p.cidrs) == 0 {
+		return fmt.Errorf("-preset %s has no built-in CIDRs; give -cidr or -cidr-file", name)
+	}
+	for _, c := range p.cidrs {
+		if err := fs.Set("cidr", c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
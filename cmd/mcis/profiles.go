@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/atomicfile"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/cron"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/pkg/mcis"
+)
+
+// profile is a search that "mcis serve" runs as a job on a cron schedule
+// (-schedule-file), e.g.
+//
+//	# profiles.yaml
+//	- name: v4
+//	  schedule: "0 */4 * * *"
+//	  out: best-v4.jsonl
+//	  cidrs: [104.16.0.0/13]
+//	  host: your.domain.com
+//	  budget: 3000
+//
+// The other keys are the fields of a POST /jobs request.
+type profile struct {
+	Name       string `yaml:"name"`
+	Schedule   string `yaml:"schedule"`
+	Out        string `yaml:"out"` // JSON Lines of the top results, replaced after every run
+	jobRequest `yaml:",inline"`
+
+	sched *cron.Schedule
+	cfg   mcis.Config
+}
+
+// loadProfiles reads and checks a -schedule-file. Profiles must have
+// distinct names and output files.
+func loadProfiles(path string) ([]*profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []*profile
+	if err := yaml.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	names := make(map[string]bool)
+	outs := make(map[string]string)
+	for i, p := range profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("%s: profile %d has no name", path, i+1)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("%s: duplicate profile %q", path, p.Name)
+		}
+		names[p.Name] = true
+		if p.sched, err = cron.Parse(p.Schedule); err != nil {
+			return nil, fmt.Errorf("%s: profile %q: %w", path, p.Name, err)
+		}
+		if p.cfg, err = p.config(); err != nil {
+			return nil, fmt.Errorf("%s: profile %q: %w", path, p.Name, err)
+		}
+		if p.Out != "" {
+			out := filepath.Clean(p.Out)
+			if other, ok := outs[out]; ok {
+				return nil, fmt.Errorf("%s: profiles %q and %q both write %s", path, other, p.Name, p.Out)
+			}
+			outs[out] = p.Name
+		}
+	}
+	return profiles, nil
+}
+
+// runProfiles schedules the profiles of the -schedule-file path until the
+// server stops. On SIGHUP or when the file changes it is read again and
+// the schedules are replaced; running jobs and the job history are kept,
+// and a file that fails to load leaves the previous profiles in place.
+func (s *jobServer) runProfiles(path string, profiles []*profile) {
+	reload := reloads(s.ctx, path)
+	for {
+		ctx, cancel := context.WithCancel(s.ctx)
+		for _, p := range profiles {
+			go s.schedule(ctx, p)
+		}
+		for loaded := false; !loaded; {
+			select {
+			case <-s.ctx.Done():
+				cancel()
+				return
+			case <-reload:
+			}
+			ps, err := loadProfiles(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "serve: reload: keeping the previous profiles:", err)
+				continue
+			}
+			profiles, loaded = ps, true
+		}
+		cancel()
+		fmt.Fprintf(os.Stderr, "serve: reload: %d profiles from %s\n", len(profiles), path)
+	}
+}
+
+// schedule starts a job of p at every scheduled time until ctx is done. A
+// run is skipped while the previous job of the profile is still queued or
+// running, so runs of one profile never overlap, across reloads too.
+func (s *jobServer) schedule(ctx context.Context, p *profile) {
+	for next := p.sched.Next(time.Now()); !next.IsZero(); next = p.sched.Next(time.Now()) {
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		s.mu.Lock()
+		last := s.lastJob[p.Name]
+		s.mu.Unlock()
+		if s.busy(last) {
+			fmt.Fprintf(os.Stderr, "serve: profile %s: previous run (job %s) still active, skipping\n", p.Name, last)
+			continue
+		}
+		var done func(mcis.Result)
+		if p.Out != "" {
+			done = func(res mcis.Result) {
+				if err := atomicfile.Write(p.Out, func(w io.Writer) error { return writeResultJSONL(w, res) }); err != nil {
+					fmt.Fprintf(os.Stderr, "serve: profile %s: %v\n", p.Name, err)
+				}
+			}
+		}
+		id := s.start(p.jobRequest, p.cfg, p.Name, done).ID
+		s.mu.Lock()
+		s.lastJob[p.Name] = id
+		s.mu.Unlock()
+	}
+}
+
+// busy reports whether the job id is queued or running.
+func (s *jobServer) busy(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	return ok && (j.Status == jobQueued || j.Status == jobRunning)
+}
+
+// writeResultJSONL writes the top results of res, one JSON object per line.
+func writeResultJSONL(w io.Writer, res mcis.Result) error {
+	enc := json.NewEncoder(w)
+	for _, r := range res.Top {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
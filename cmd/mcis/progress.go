@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+)
+
+const progressBarLen = 30
+
+// progressBar shows budget consumption, success rate and the estimated
+// time to completion on one terminal line, redrawn in place.
+type progressBar struct {
+	out  io.Writer
+	drew bool
+}
+
+// isTerminal reports whether f is a character device (a terminal).
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// attach draws the bar from req's progress callback, keeping a callback
+// set earlier.
+func (b *progressBar) attach(req *engine.Request) {
+	prev := req.OnProgress
+	req.OnProgress = func(p engine.Progress) {
+		if prev != nil {
+			prev(p)
+		}
+		b.draw(p)
+	}
+}
+
+func (b *progressBar) draw(p engine.Progress) {
+	frac := 0.0
+	if p.Budget > 0 {
+		frac = min(float64(p.Completed)/float64(p.Budget), 1)
+	}
+	filled := int(frac * progressBarLen)
+	okRate := 0.0
+	if p.Probes > 0 {
+		okRate = float64(p.Successes) / float64(p.Probes)
+	}
+	eta := "?"
+	if p.Probes > 0 && p.Elapsed > 0 {
+		perProbe := p.Elapsed / time.Duration(p.Probes)
+		eta = (time.Duration(int64(p.Budget)-p.Completed) * perProbe).Round(time.Second).String()
+	}
+	fmt.Fprintf(b.out, "\r[%s%s] %d/%d (%.0f%%)  ok %.0f%%  ETA %s\x1b[K",
+		strings.Repeat("#", filled), strings.Repeat("-", progressBarLen-filled),
+		p.Completed, p.Budget, frac*100, okRate*100, eta)
+	b.drew = true
+}
+
+// clear erases the bar so later output starts on a clean line.
+func (b *progressBar) clear() {
+	if b.drew {
+		fmt.Fprint(b.out, "\r\x1b[K")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// reloadPoll is how often the files watched for a reload are checked.
+const reloadPoll = 2 * time.Second
+
+// watchReloadable are the flags "mcis watch" re-reads on a reload: the
+// ones that are safe to change between cycles. The others need a restart.
+var watchReloadable = map[string]bool{
+	"budget": true, "top": true, "concurrency": true,
+	"interval": true, "schedule": true, "decay": true, "out-file": true,
+	"notify-slack": true, "notify-telegram-token": true, "notify-telegram-chat": true,
+	"notify-on": true, "notify-state": true,
+	"publish-url": true, "publish-method": true, "publish-header": true,
+	"publish-template": true, "publish-timeout": true,
+}
+
+// reloads returns a channel that receives when the process gets SIGHUP or
+// one of the files (empty paths are skipped) changes, until ctx is done. A
+// reload not handled yet absorbs further ones.
+func reloads(ctx context.Context, paths ...string) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	var files []string
+	for _, p := range paths {
+		if p != "" {
+			files = append(files, p)
+		}
+	}
+	stamps := make([]fileStamp, len(files))
+	for i, p := range files {
+		stamps[i] = statFile(p)
+	}
+	go func() {
+		defer signal.Stop(sig)
+		tick := time.NewTicker(reloadPoll)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sig:
+				notify()
+			case <-tick.C:
+				for i, p := range files {
+					if s := statFile(p); s != stamps[i] {
+						stamps[i] = s
+						notify()
+					}
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// fileStamp tells versions of a file apart by size and modification time.
+type fileStamp struct {
+	size, mod int64
+}
+
+func statFile(path string) fileStamp {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{fi.Size(), fi.ModTime().UnixNano()}
+}
+
+// flagValues returns the values of the flags of fs by name.
+func flagValues(fs *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) { values[f.Name] = f.Value.String() })
+	return values
+}
+
+// changedFlags returns the names of the flags whose value differs between
+// old and cur, sorted.
+func changedFlags(old, cur map[string]string) []string {
+	var names []string
+	for name, v := range cur {
+		if old[name] != v {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reloadSearchFlags parses args and the -config file anew into the flags
+// of cmd, and returns them with their values by name.
+func reloadSearchFlags(cmd string, args []string) (*searchFlags, map[string]string, error) {
+	fs := flag.NewFlagSet("mcis "+cmd, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	f := new(searchFlags)
+	f.register(fs, cmd)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if f.configFile != "" {
+		if err := applyConfigFile(fs, f.configFile); err != nil {
+			return nil, nil, fmt.Errorf("-config: %w", err)
+		}
+	}
+	return f, flagValues(fs), nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/input"
+)
+
+// readResults reads the top results of a jsonl output (-out jsonl, the
+// watch -out-file or a serve profile's out), best first. Gzip-compressed
+// files are read as well. Path "-" is stdin.
+func readResults(path string) ([]engine.TopResult, error) {
+	r, err := input.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", displayPath(path), err)
+	}
+	defer func() { _ = r.Close() }()
+
+	var res []engine.TopResult
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var t engine.TopResult
+		if err := json.Unmarshal([]byte(text), &t); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", displayPath(path), line, err)
+		}
+		if !t.IP.IsValid() {
+			return nil, fmt.Errorf("%s: line %d: no ip", displayPath(path), line)
+		}
+		t.IP = t.IP.Unmap()
+		res = append(res, t)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", displayPath(path), err)
+	}
+	return res, nil
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/pkg/mcis"
+)
+
+// jobRequest is the body of POST /jobs: a search of CIDRs, or with IPs a
+// single probe of each listed address. Zero fields keep the defaults of
+// the mcis command.
+type jobRequest struct {
+	CIDRs       []string     `json:"cidrs,omitempty"`
+	Exclude     []string     `json:"exclude,omitempty"`
+	IPs         []netip.Addr `json:"ips,omitempty"`
+	Budget      int          `json:"budget,omitempty"`
+	Top         int          `json:"top,omitempty"`
+	Concurrency int          `json:"concurrency,omitempty"`
+	Heads       int          `json:"heads,omitempty"`
+	Seed        int64        `json:"seed,omitempty"`
+	Host        string       `json:"host,omitempty"`
+	Path        string       `json:"path,omitempty"`
+	Port        uint16       `json:"port,omitempty"`
+	Timeout     string       `json:"timeout,omitempty"` // e.g. "2s"
+	Method      string       `json:"method,omitempty"`  // http|h2mux|icmp|warp|doh|sim
+}
+
+// config converts the request to a search configuration.
+func (r jobRequest) config() (mcis.Config, error) {
+	cfg := mcis.DefaultConfig()
+	if len(r.CIDRs) == 0 && len(r.IPs) == 0 {
+		return cfg, errors.New("cidrs or ips required")
+	}
+	cfg.CIDRs, cfg.Exclude, cfg.IPs = r.CIDRs, r.Exclude, r.IPs
+	if r.Budget > 0 {
+		cfg.Budget = r.Budget
+	}
+	if r.Top > 0 {
+		cfg.TopN = r.Top
+	}
+	if r.Concurrency > 0 {
+		cfg.Concurrency = r.Concurrency
+	}
+	if r.Heads > 0 {
+		cfg.Heads = r.Heads
+	}
+	cfg.Seed = r.Seed
+	if r.Host != "" {
+		cfg.Host = r.Host
+	}
+	if r.Path != "" {
+		cfg.Path = r.Path
+	}
+	cfg.Port = r.Port
+	if r.Timeout != "" {
+		d, err := time.ParseDuration(r.Timeout)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("bad timeout %q", r.Timeout)
+		}
+		cfg.Timeout = d
+	}
+	if r.Method != "" {
+		cfg.Method = r.Method
+	}
+	return cfg, nil
+}
+
+// Job states.
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+// job is one search run by the server. Top holds the current best results
+// while it runs and the final ones afterwards.
+type job struct {
+	ID       string      `json:"id"`
+	Status   string      `json:"status"`
+	Created  time.Time   `json:"created"`
+	Finished *time.Time  `json:"finished,omitempty"`
+	Probes   int         `json:"probes"`
+	Top      []mcis.IP   `json:"top"`
+	Stats    *mcis.Stats `json:"stats,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Request  jobRequest  `json:"request"`
+	Profile  string      `json:"profile,omitempty"` // -schedule-file profile that started it
+
+	cancel context.CancelFunc
+	done   func(mcis.Result) // called with the result of a finished search
+}
+
+// maxJobRequest is the largest POST /jobs body accepted.
+const maxJobRequest = 1 << 20
+
+// jobServer runs the jobs of "mcis serve", at most cap(slots) at a time.
+// Finished jobs are forgotten after keepFor, and beyond the keepJobs most
+// recent ones.
+type jobServer struct {
+	ctx      context.Context
+	slots    chan struct{}
+	keepFor  time.Duration
+	keepJobs int
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	next    int
+	lastJob map[string]string // latest job id of each -schedule-file profile
+}
+
+func newJobServer(ctx context.Context, maxJobs int, keepFor time.Duration, keepJobs int) *jobServer {
+	return &jobServer{
+		ctx:      ctx,
+		slots:    make(chan struct{}, max(maxJobs, 1)),
+		keepFor:  keepFor,
+		keepJobs: keepJobs,
+		jobs:     make(map[string]*job),
+		lastJob:  make(map[string]string),
+	}
+}
+
+func (s *jobServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.create)
+	mux.HandleFunc("GET /jobs", s.list)
+	mux.HandleFunc("GET /jobs/{id}", s.get)
+	mux.HandleFunc("GET /jobs/{id}/result", s.result)
+	mux.HandleFunc("DELETE /jobs/{id}", s.stop)
+	return mux
+}
+
+// create starts a job from a jobRequest.
+func (s *jobServer) create(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJobRequest))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	cfg, err := req.config()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	snap := s.start(req, cfg, "", nil)
+	w.Header().Set("Location", "/jobs/"+snap.ID)
+	writeJSON(w, http.StatusCreated, snap)
+}
+
+// start queues a job and returns a copy of it.
+func (s *jobServer) start(req jobRequest, cfg mcis.Config, profile string, done func(mcis.Result)) job {
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	s.evictLocked(time.Now())
+	s.next++
+	j := &job{ID: strconv.Itoa(s.next), Status: jobQueued, Created: time.Now(), Request: req, Profile: profile, cancel: cancel, done: done}
+	s.jobs[j.ID] = j
+	snap := *j
+	s.mu.Unlock()
+
+	go s.run(ctx, j, cfg)
+	return snap
+}
+
+// run waits for a free slot, then runs the search of j.
+func (s *jobServer) run(ctx context.Context, j *job, cfg mcis.Config) {
+	defer j.cancel()
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		s.finish(j, nil, jobCanceled, "")
+		return
+	}
+	s.update(j, func() { j.Status = jobRunning })
+
+	cfg.OnProbe = func(mcis.ProbeResult) { s.update(j, func() { j.Probes++ }) }
+	cfg.OnTopChange = func(top []mcis.IP) { s.update(j, func() { j.Top = top }) }
+	res, err := mcis.Search(ctx, cfg)
+	switch {
+	case err != nil:
+		s.finish(j, nil, jobFailed, err.Error())
+	case ctx.Err() != nil:
+		s.finish(j, &res, jobCanceled, "")
+	default:
+		s.finish(j, &res, jobDone, "")
+		if j.done != nil {
+			j.done(res)
+		}
+	}
+}
+
+func (s *jobServer) update(j *job, fn func()) {
+	s.mu.Lock()
+	fn()
+	s.mu.Unlock()
+}
+
+func (s *jobServer) finish(j *job, res *mcis.Result, status, errMsg string) {
+	now := time.Now()
+	s.update(j, func() {
+		j.Status, j.Error, j.Finished = status, errMsg, &now
+		if res != nil {
+			j.Top, j.Stats = res.Top, &res.Stats
+		}
+		s.evictLocked(now)
+	})
+}
+
+// evictLocked forgets the finished jobs older than keepFor and the oldest
+// ones beyond keepJobs. Queued and running jobs are kept. Must be called
+// with s.mu held.
+func (s *jobServer) evictLocked(now time.Time) {
+	var finished []*job
+	for id, j := range s.jobs {
+		switch {
+		case j.Finished == nil:
+		case s.keepFor > 0 && now.Sub(*j.Finished) > s.keepFor:
+			delete(s.jobs, id)
+		default:
+			finished = append(finished, j)
+		}
+	}
+	if s.keepJobs <= 0 || len(finished) <= s.keepJobs {
+		return
+	}
+	sort.Slice(finished, func(i, k int) bool { return finished[i].Finished.Before(*finished[k].Finished) })
+	for _, j := range finished[:len(finished)-s.keepJobs] {
+		delete(s.jobs, j.ID)
+	}
+}
+
+// lookup returns a copy of the job named in the request path.
+func (s *jobServer) lookup(w http.ResponseWriter, r *http.Request) (job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[r.PathValue("id")]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, errors.New("no such job"))
+		return job{}, false
+	}
+	return *j, true
+}
+
+func (s *jobServer) list(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	out := make([]job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, *j)
+	}
+	s.mu.Unlock()
+	sort.Slice(out, func(i, k int) bool { return out[i].Created.Before(out[k].Created) })
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *jobServer) get(w http.ResponseWriter, r *http.Request) {
+	if j, ok := s.lookup(w, r); ok {
+		writeJSON(w, http.StatusOK, j)
+	}
+}
+
+// result returns the final results of a finished job.
+func (s *jobServer) result(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	if j.Stats == nil {
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("job is %s", j.Status))
+		return
+	}
+	writeJSON(w, http.StatusOK, mcis.Result{Top: j.Top, Stats: *j.Stats})
+}
+
+// stop cancels a queued or running job; a running search keeps the
+// results found so far.
+func (s *jobServer) stop(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	j.cancel()
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// runServe runs the HTTP API of "mcis serve" until interrupted.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("mcis serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8080", "Address the HTTP API listens on")
+	maxJobs := fs.Int("max-jobs", 1, "Jobs searching at the same time; further jobs wait in the queue")
+	keepFor := fs.Duration("job-retention", 24*time.Hour, "How long finished jobs stay listed by GET /jobs (0: no time limit)")
+	keepJobs := fs.Int("max-finished", 100, "Finished jobs kept at most, the oldest are dropped first (0: no limit)")
+	scheduleFile := fs.String("schedule-file", "", "YAML list of profiles searched as jobs on their cron schedule, each writing its own output file")
+	_ = fs.Parse(args)
+
+	var profiles []*profile
+	if *scheduleFile != "" {
+		ps, err := loadProfiles(*scheduleFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: -schedule-file:", err)
+			os.Exit(1)
+		}
+		profiles = ps
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if *keepFor < 0 || *keepJobs < 0 {
+		fmt.Fprintln(os.Stderr, "error: -job-retention and -max-finished must not be negative")
+		os.Exit(2)
+	}
+
+	js := newJobServer(ctx, *maxJobs, *keepFor, *keepJobs)
+	if *scheduleFile != "" {
+		go js.runProfiles(*scheduleFile, profiles)
+	}
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           js.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		sctx, scancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer scancel()
+		_ = srv.Shutdown(sctx)
+	}()
+	fmt.Fprintln(os.Stderr, "serve: listening on", *listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
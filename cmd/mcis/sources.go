@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/cidrsrc"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/geoip"
+)
+
+// cidrSources are the downloaded CIDR lists of a search (-cidr-source,
+// -asn). They are expanded before every search, so watch cycles pick up
+// list updates once the cache expires.
+type cidrSources struct {
+	fetcher *cidrsrc.Fetcher
+	names   []string
+	asns    []uint
+}
+
+// newCIDRSources checks the -cidr-source and -asn values (both repeatable
+// or comma-separated).
+func newCIDRSources(f *cidrsrc.Fetcher, vals, asnVals []string) (*cidrSources, error) {
+	s := &cidrSources{fetcher: f}
+	for _, v := range asnVals {
+		for _, part := range strings.Split(v, ",") {
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+			asn, err := geoip.ParseASN(part)
+			if err != nil {
+				return nil, err
+			}
+			s.asns = append(s.asns, asn)
+		}
+	}
+	for _, v := range vals {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+				continue
+			}
+			if err := cidrsrc.CheckSource(name); err != nil {
+				return nil, err
+			}
+			s.names = append(s.names, name)
+		}
+	}
+	return s, nil
+}
+
+// empty reports whether no source is configured.
+func (s *cidrSources) empty() bool { return len(s.names) == 0 && len(s.asns) == 0 }
+
+// expand returns the CIDRs of all sources.
+func (s *cidrSources) expand(ctx context.Context) ([]string, error) {
+	var out []string
+	for _, name := range s.names {
+		ps, err := s.fetcher.Source(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range ps {
+			out = append(out, p.String())
+		}
+	}
+	for _, asn := range s.asns {
+		ps, err := s.fetcher.ASN(ctx, asn)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range ps {
+			out = append(out, p.String())
+		}
+	}
+	return out, nil
+}
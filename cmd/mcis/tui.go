@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+)
+
+const (
+	dashboardRefresh = 250 * time.Millisecond
+	dashboardTopRows = 10
+	dashboardErrRows = 5
+	dashboardBarLen  = 30
+)
+
+// dashboard renders a live view of a running search (-tui): the current
+// top results, throughput, budget used, what every head is exploring and
+// the most common probe errors. It redraws the terminal in place with
+// ANSI escape sequences.
+type dashboard struct {
+	out io.Writer
+
+	mu       sync.Mutex
+	top      []engine.TopResult
+	progress engine.Progress
+	ok, fail int64
+	errors   map[string]int
+
+	// Throughput over the last refresh interval
+	rate          float64
+	lastCompleted int64
+	lastElapsed   time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newDashboard(out io.Writer) *dashboard {
+	return &dashboard{
+		out:    out,
+		errors: make(map[string]int),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// attach hooks the dashboard into req's live callbacks, keeping callbacks
+// set earlier.
+func (d *dashboard) attach(req *engine.Request) {
+	prevProbe, prevTop, prevProgress := req.OnProbe, req.OnTopChange, req.OnProgress
+	req.OnProbe = func(pr engine.ProbeResult) {
+		if prevProbe != nil {
+			prevProbe(pr)
+		}
+		d.mu.Lock()
+		if pr.OK {
+			d.ok++
+		} else {
+			d.fail++
+			d.errors[errorKind(pr)]++
+		}
+		d.mu.Unlock()
+	}
+	req.OnTopChange = func(top []engine.TopResult) {
+		if prevTop != nil {
+			prevTop(top)
+		}
+		d.mu.Lock()
+		d.top = top
+		d.mu.Unlock()
+	}
+	req.OnProgress = func(p engine.Progress) {
+		if prevProgress != nil {
+			prevProgress(p)
+		}
+		d.mu.Lock()
+		if dt := (p.Elapsed - d.lastElapsed).Seconds(); dt > 0 {
+			d.rate = float64(p.Completed-d.lastCompleted) / dt
+		}
+		d.lastCompleted, d.lastElapsed = p.Completed, p.Elapsed
+		d.progress = p
+		d.mu.Unlock()
+	}
+}
+
+// errorKind groups a failed probe by the last part of its error, which
+// drops the address from messages like "dial tcp 1.2.3.4:443: i/o timeout".
+func errorKind(pr engine.ProbeResult) string {
+	msg := pr.Error
+	if msg == "" {
+		return fmt.Sprintf("status %d", pr.Status)
+	}
+	if i := strings.LastIndex(msg, ": "); i >= 0 {
+		msg = msg[i+2:]
+	}
+	if len(msg) > 60 {
+		msg = msg[:60]
+	}
+	return msg
+}
+
+// start redraws the dashboard until close is called.
+func (d *dashboard) start() {
+	fmt.Fprint(d.out, "\x1b[?25l\x1b[2J") // hide cursor, clear screen
+	go func() {
+		defer close(d.done)
+		t := time.NewTicker(dashboardRefresh)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				d.render()
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close draws the final state and restores the cursor.
+func (d *dashboard) close() {
+	close(d.stop)
+	<-d.done
+	d.mu.Lock()
+	d.progress.Completed = max(d.progress.Completed, d.ok+d.fail)
+	d.mu.Unlock()
+	d.render()
+	fmt.Fprint(d.out, "\x1b[?25h")
+}
+
+func (d *dashboard) render() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b bytes.Buffer
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString("\x1b[K\n") // clear the rest of the line
+	}
+	b.WriteString("\x1b[H") // cursor home
+
+	p := d.progress
+	frac := 0.0
+	if p.Budget > 0 {
+		frac = min(float64(p.Completed)/float64(p.Budget), 1)
+	}
+	filled := int(frac * dashboardBarLen)
+	line("mcis  [%s%s] %d/%d probes (%.1f%%)  %.1f probes/s  elapsed %s",
+		strings.Repeat("#", filled), strings.Repeat("-", dashboardBarLen-filled),
+		p.Completed, p.Budget, frac*100, d.rate, p.Elapsed.Truncate(100*time.Millisecond))
+	line("ok %d  fail %d  hedges %d  tree %d nodes", d.ok, d.fail, p.Hedges, p.TreeNodes)
+	line("")
+
+	line("Top results")
+	line("  %-4s %-40s %9s  %-5s %s", "#", "IP", "score", "colo", "prefix")
+	for i, r := range d.top {
+		if i >= dashboardTopRows {
+			break
+		}
+		line("  %-4d %-40s %7.1fms  %-5s %s", i+1, r.IP, r.ScoreMS, r.Trace["colo"], r.Prefix)
+	}
+	line("")
+
+	line("Heads")
+	for _, h := range p.Heads {
+		recent := make([]string, len(h.Recent))
+		for i, pfx := range h.Recent {
+			recent[i] = pfx.String()
+		}
+		focus := "-"
+		if h.Focus.IsValid() {
+			focus = h.Focus.String()
+		}
+		line("  %-3d focus %-22s recent %s", h.ID, focus, strings.Join(recent, " "))
+	}
+	line("")
+
+	line("Errors")
+	kinds := make([]string, 0, len(d.errors))
+	for k := range d.errors {
+		kinds = append(kinds, k)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if d.errors[kinds[i]] != d.errors[kinds[j]] {
+			return d.errors[kinds[i]] > d.errors[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+	for i, k := range kinds {
+		if i >= dashboardErrRows {
+			break
+		}
+		line("  %6d  %s", d.errors[k], k)
+	}
+	b.WriteString("\x1b[J") // clear whatever the previous frame left below
+
+	_, _ = d.out.Write(b.Bytes())
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/cron"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/output"
+)
+
+// rollingBest is the best-IP set "mcis watch" keeps across its cycles. An
+// IP found again takes its fresh measurement; one that is not has its
+// score raised by decay per cycle, so winners that stopped winning drop
+// out of the set.
+type rollingBest struct {
+	size  int
+	decay float64
+	rows  map[netip.Addr]engine.TopResult
+}
+
+func newRollingBest(size int, decay float64) *rollingBest {
+	return &rollingBest{size: max(size, 1), decay: max(decay, 0), rows: make(map[netip.Addr]engine.TopResult)}
+}
+
+// update merges the top results of a cycle and returns the set, best
+// first. Failed results do not enter the set.
+func (b *rollingBest) update(top []engine.TopResult) []engine.TopResult {
+	fresh := make(map[netip.Addr]bool, len(top))
+	for _, r := range top {
+		if r.OK {
+			b.rows[r.IP] = r
+			fresh[r.IP] = true
+		}
+	}
+	for ip, r := range b.rows {
+		if !fresh[ip] {
+			r.ScoreMS *= 1 + b.decay
+			b.rows[ip] = r
+		}
+	}
+
+	out := make([]engine.TopResult, 0, len(b.rows))
+	for _, r := range b.rows {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ScoreMS < out[j].ScoreMS })
+	for _, r := range out[min(b.size, len(out)):] {
+		delete(b.rows, r.IP)
+	}
+	return out[:min(b.size, len(out))]
+}
+
+// watchSchedule checks the -interval, -schedule and -decay of watch and
+// returns the parsed -schedule, nil without one.
+func watchSchedule(interval time.Duration, schedule string, decay float64) (*cron.Schedule, error) {
+	if decay < 0 {
+		return nil, errors.New("-decay must not be negative")
+	}
+	if schedule != "" {
+		sched, err := cron.Parse(schedule)
+		if err != nil {
+			return nil, fmt.Errorf("-schedule: %w", err)
+		}
+		return sched, nil
+	}
+	if interval <= 0 {
+		return nil, errors.New("-interval must be positive")
+	}
+	return nil, nil
+}
+
+// watcher runs the cycles of "mcis watch": a search, then the rolling
+// best set written to the outputs, then a wait for the next interval or
+// scheduled time.
+type watcher struct {
+	interval time.Duration
+	schedule *cron.Schedule // replaces interval if set
+	best     *rollingBest
+	search   func(ctx context.Context) (engine.Response, error)
+	write    func(res engine.Response, start time.Time) bool
+	next     func(warm io.Reader) // prepares the request of the next cycle
+	// reload receives when the settings are to be re-read by onReload,
+	// which happens between cycles
+	reload   <-chan struct{}
+	onReload func()
+	verbose  bool
+}
+
+// run runs cycles until ctx is done. An error in the first cycle is fatal,
+// as it is most likely a configuration mistake; later ones are reported
+// and the next cycle runs as scheduled.
+func (w *watcher) run(ctx context.Context) {
+	var prev time.Time
+	start := w.nextStart(prev)
+	for cycle := 1; ; cycle++ {
+		for waiting := true; waiting; {
+			if start.IsZero() {
+				fmt.Fprintln(os.Stderr, "watch: -schedule has no further runs")
+				return
+			}
+			t := time.NewTimer(time.Until(start))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-w.reload:
+				t.Stop()
+				w.onReload()
+				start = w.nextStart(prev)
+			case <-t.C:
+				waiting = false
+			}
+		}
+
+		res, err := w.search(ctx)
+		switch {
+		case ctx.Err() != nil:
+			// An interrupted search is incomplete; keep the last written set
+			return
+		case err != nil && cycle == 1:
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "watch: cycle %d: %v\n", cycle, err)
+		default:
+			res.Top = w.best.update(res.Top)
+			w.write(res, start)
+			var warm bytes.Buffer
+			_ = output.WriteJSONL(&warm, res.Top)
+			w.next(&warm)
+			if w.verbose {
+				fmt.Fprintf(os.Stderr, "watch: cycle %d: %d probes, %d best IPs\n", cycle, res.Stats.Probes, len(res.Top))
+			}
+		}
+
+		prev, start = start, w.nextStart(start)
+	}
+}
+
+// nextStart returns the start of the cycle after the one started at prev
+// (zero for the first cycle). Runs missed while a cycle overran are
+// skipped, not made up.
+func (w *watcher) nextStart(prev time.Time) time.Time {
+	now := time.Now()
+	if w.schedule != nil {
+		return w.schedule.Next(now)
+	}
+	if prev.IsZero() {
+		return now
+	}
+	if next := prev.Add(w.interval); next.After(now) {
+		return next
+	}
+	return now
+}
@@ -0,0 +1,65 @@
+// Package atomicfile replaces files through a temporary file in the same
+// directory that is renamed over them, so readers never see a partial
+// file.
+package atomicfile
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// File is the temporary file that replaces its target path on Commit.
+type File struct {
+	*os.File
+	path string
+}
+
+// Create creates the temporary file for path, next to it.
+func Create(path string) (*File, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return &File{File: f, path: path}, nil
+}
+
+// Commit closes the temporary file and renames it over the target path.
+// If that fails the temporary file is removed and the target is left as
+// it was.
+func (f *File) Commit() error {
+	err := f.File.Close()
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// Abort closes and removes the temporary file, leaving the target as it
+// was.
+func (f *File) Abort() {
+	_ = f.File.Close()
+	_ = os.Remove(f.Name())
+}
+
+// Write replaces path with what fn writes; path is left as it was when fn
+// fails.
+func Write(path string, fn func(w io.Writer) error) error {
+	f, err := Create(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
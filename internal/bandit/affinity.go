@@ -0,0 +1,79 @@
+package bandit
+
+import (
+	"math"
+	"net/netip"
+	"sort"
+)
+
+// Head affinity modes.
+const (
+	AffinityNone       = "none"
+	AffinityRoundRobin = "round-robin"
+	AffinityWeight     = "weight"
+)
+
+// AssignRoots partitions root prefixes into disjoint per-head subsets.
+//
+// round-robin deals roots out in input order; weight assigns the largest
+// roots first to whichever head currently holds the least address space.
+// When there are fewer roots than heads, the remaining heads wrap around
+// and share roots so that no head is left without work.
+func AssignRoots(roots []netip.Prefix, numHeads int, mode string) [][]netip.Prefix {
+	if numHeads <= 0 || len(roots) == 0 {
+		return nil
+	}
+
+	out := make([][]netip.Prefix, numHeads)
+	switch mode {
+	case AffinityRoundRobin:
+		for i, root := range roots {
+			out[i%numHeads] = append(out[i%numHeads], root)
+		}
+
+	case AffinityWeight:
+		sorted := append([]netip.Prefix(nil), roots...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return prefixWeight(sorted[i]) > prefixWeight(sorted[j])
+		})
+		load := make([]float64, numHeads)
+		for _, root := range sorted {
+			best := 0
+			for h := 1; h < numHeads; h++ {
+				if load[h] < load[best] {
+					best = h
+				}
+			}
+			out[best] = append(out[best], root)
+			load[best] += prefixWeight(root)
+		}
+
+	default:
+		return nil
+	}
+
+	// Heads left empty share roots with the others.
+	for h := range out {
+		if len(out[h]) == 0 {
+			out[h] = []netip.Prefix{roots[h%len(roots)]}
+		}
+	}
+	return out
+}
+
+// AssignRoots pins each head to its subset of root prefixes.
+func (m *HeadManager) AssignRoots(assignment [][]netip.Prefix) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, head := range m.heads {
+		if i < len(assignment) {
+			head.SetRoots(assignment[i])
+		}
+	}
+}
+
+// prefixWeight returns the number of addresses covered by a prefix.
+func prefixWeight(p netip.Prefix) float64 {
+	return math.Exp2(float64(p.Addr().BitLen() - p.Bits()))
+}
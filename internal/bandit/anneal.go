@@ -0,0 +1,36 @@
+package bandit
+
+import "math"
+
+// Search strategies.
+const (
+	// StrategyThompson always selects prefixes by Thompson Sampling.
+	StrategyThompson = "thompson"
+	// StrategyAnneal spends a decaying share of each head's probes on
+	// uniformly random leaves (see Temperature).
+	StrategyAnneal = "anneal"
+)
+
+// Annealing temperature schedules.
+const (
+	ScheduleExp    = "exp"
+	ScheduleLinear = "linear"
+)
+
+// Temperature returns the exploration probability at progress (0 at the
+// start of a head's schedule, 1 at its end), decaying from t0 to tMin.
+//
+// exp decays geometrically (t0 * (tMin/t0)^progress), spending most of the
+// exploration early; linear decays at a constant rate.
+func Temperature(schedule string, t0, tMin, progress float64) float64 {
+	progress = math.Max(0, math.Min(1, progress))
+	if t0 <= 0 || tMin >= t0 {
+		return math.Max(t0, 0)
+	}
+	if schedule == ScheduleLinear {
+		return t0 - (t0-tMin)*progress
+	}
+	// Geometric decay needs a positive floor.
+	floor := math.Min(math.Max(tMin, 1e-3), t0)
+	return t0 * math.Pow(floor/t0, progress)
+}
@@ -38,9 +38,18 @@ type ArmNode struct {
 	Failures   int
 	SumLatency float64
 	SumSqDiff  float64 // Sum of squared differences from mean (for Welford)
+	SumSqLat   float64 // Sum of squared successful latencies
 
-	// Split state
+	// Monte Carlo tree statistics, backed up from every probe in this
+	// subtree (the node itself and all its descendants).
+	// Visits: number of probes; Value: sum of their rewards in [0,1]
+	Visits int
+	Value  float64
+
+	// Split state; Merged nodes had their children merged back
+	// (ArmTree.MergeUniform) and are not split again
 	IsSplit bool
+	Merged  bool
 
 	mu sync.RWMutex
 }
@@ -90,6 +99,7 @@ func (a *ArmNode) Update(success bool, latencyMS float64, timeoutMS float64) {
 
 		// Update sum of squared differences (for variance estimation)
 		a.SumLatency += latencyMS
+		a.SumSqLat += latencyMS * latencyMS
 		if a.Successes > 1 {
 			// Welford's online algorithm for variance with precision weighting
 			// For precision-weighted mean, we need to include the weight adjustment factor
@@ -119,6 +129,34 @@ func (a *ArmNode) Update(success bool, latencyMS float64, timeoutMS float64) {
 	}
 }
 
+// Penalize adds a pseudo-failure of the given weight to the success-rate
+// posterior without counting it as a sample. Used when out-of-band signals
+// (e.g. ICMP unreachable) indicate the prefix is filtered.
+func (a *ArmNode) Penalize(weight float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Beta += weight
+}
+
+// Backup adds a probe reward to this node and all its ancestors.
+func (a *ArmNode) Backup(reward float64) {
+	for n := a; n != nil; n = n.Parent {
+		n.mu.Lock()
+		n.Visits++
+		n.Value += reward
+		n.mu.Unlock()
+	}
+}
+
+// Reward maps a probe outcome to [0,1]: failures are 0 and successes fall
+// linearly from 1 (instant) to 0 at the failure penalty (2x timeout).
+func Reward(success bool, latencyMS, timeoutMS float64) float64 {
+	if !success || timeoutMS <= 0 {
+		return 0
+	}
+	return math.Max(0, 1-latencyMS/(2*timeoutMS))
+}
+
 // Stats returns a snapshot of the arm's statistics.
 func (a *ArmNode) Stats() ArmStats {
 	a.mu.RLock()
@@ -131,6 +169,11 @@ func (a *ArmNode) Stats() ArmStats {
 
 	successRate := a.Alpha / (a.Alpha + a.Beta)
 
+	var meanValue float64
+	if a.Visits > 0 {
+		meanValue = a.Value / float64(a.Visits)
+	}
+
 	return ArmStats{
 		Prefix:      a.Prefix,
 		Samples:     a.Samples,
@@ -139,7 +182,10 @@ func (a *ArmNode) Stats() ArmStats {
 		MeanLatency: a.Mu,
 		VarLatency:  variance,
 		SuccessRate: successRate,
+		Visits:      a.Visits,
+		MeanValue:   meanValue,
 		IsSplit:     a.IsSplit,
+		Merged:      a.Merged,
 	}
 }
 
@@ -169,7 +215,7 @@ func (a *ArmNode) CanSplit(minSamples int, maxBitsV4, maxBitsV6 int) bool {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	if a.IsSplit {
+	if a.IsSplit || a.Merged {
 		return false
 	}
 	if a.Samples < minSamples {
@@ -216,7 +262,10 @@ type ArmStats struct {
 	MeanLatency float64
 	VarLatency  float64
 	SuccessRate float64
+	Visits      int     // Probes in this subtree
+	MeanValue   float64 // Mean backed-up reward of the subtree
 	IsSplit     bool
+	Merged      bool
 }
 
 // Score returns a deterministic score for this arm (lower is better).
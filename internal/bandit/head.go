@@ -19,6 +19,9 @@ type SearchHead struct {
 	History     []netip.Prefix
 	historySize int
 
+	// Roots this head is pinned to (empty = may explore everything)
+	roots []netip.Prefix
+
 	mu sync.RWMutex
 }
 
@@ -62,6 +65,51 @@ func (h *SearchHead) GetHistory() []netip.Prefix {
 	return result
 }
 
+// SetRoots pins the head to the given root prefixes.
+// An empty list removes the restriction.
+func (h *SearchHead) SetRoots(roots []netip.Prefix) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.roots = append([]netip.Prefix(nil), roots...)
+}
+
+// Roots returns a copy of the root prefixes this head is pinned to.
+func (h *SearchHead) Roots() []netip.Prefix {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	result := make([]netip.Prefix, len(h.roots))
+	copy(result, h.roots)
+	return result
+}
+
+// Owns reports whether the prefix lies inside one of the head's roots.
+// Heads without assigned roots own every prefix.
+func (h *SearchHead) Owns(prefix netip.Prefix) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.roots) == 0 {
+		return true
+	}
+	for _, root := range h.roots {
+		if root.Bits() <= prefix.Bits() && root.Contains(prefix.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ownedLeaves filters leaves down to those the head owns.
+func (h *SearchHead) ownedLeaves(leaves []*ArmNode) []*ArmNode {
+	owned := leaves[:0:0]
+	for _, node := range leaves {
+		if h.Owns(node.Prefix) {
+			owned = append(owned, node)
+		}
+	}
+	return owned
+}
+
 // HeadManager manages multiple search heads with diversity preservation.
 type HeadManager struct {
 	heads []*SearchHead
@@ -70,6 +118,9 @@ type HeadManager struct {
 	// Diversity parameters
 	diversityWeight float64 // Weight for diversity penalty
 	repulsionDecay  float64 // Decay factor for distance-based repulsion
+
+	// Shared posterior draws (nil = heads sample independently)
+	shared *sharedDraws
 }
 
 // HeadManagerConfig holds configuration for the head manager.
@@ -80,6 +131,8 @@ type HeadManagerConfig struct {
 	HistorySize     int
 	DiversityWeight float64
 	RepulsionDecay  float64
+	VariancePenalty float64 // See ThompsonSampler.SetVariancePenalty
+	SharedStats     bool    // Heads rank leaves from one shared draw per round
 }
 
 // DefaultHeadManagerConfig returns sensible defaults.
@@ -101,13 +154,20 @@ func NewHeadManager(cfg HeadManagerConfig) *HeadManager {
 		// Each head gets a different seed for independent sampling
 		seed := cfg.BaseSeed + int64(i*9973)
 		heads[i] = NewSearchHead(i, seed, cfg.TimeoutMS, cfg.HistorySize)
+		heads[i].Sampler.SetVariancePenalty(cfg.VariancePenalty)
 	}
 
-	return &HeadManager{
+	m := &HeadManager{
 		heads:           heads,
 		diversityWeight: cfg.DiversityWeight,
 		repulsionDecay:  cfg.RepulsionDecay,
 	}
+	if cfg.SharedStats && cfg.NumHeads > 0 {
+		sampler := NewThompsonSampler(cfg.BaseSeed+int64(cfg.NumHeads*9973), cfg.TimeoutMS)
+		sampler.SetVariancePenalty(cfg.VariancePenalty)
+		m.shared = newSharedDraws(sampler, cfg.NumHeads)
+	}
+	return m
 }
 
 // NumHeads returns the number of search heads.
@@ -127,13 +187,16 @@ func (m *HeadManager) GetHead(idx int) *SearchHead {
 // considering both Thompson Sampling scores and diversity penalties.
 // It also gives a bonus to finer prefixes (children of good parents).
 func (m *HeadManager) SelectNextPrefix(head *SearchHead, tree *ArmTree, beamWidth int) netip.Prefix {
-	candidates := tree.LeafNodes()
+	candidates := head.ownedLeaves(tree.LeafNodes())
 	if len(candidates) == 0 {
 		return netip.Prefix{}
 	}
 
 	// Get what other heads are currently exploring
 	otherFocuses := m.getOtherHeadFocuses(head.ID)
+	if m.shared != nil {
+		m.shared.begin()
+	}
 
 	// Score each candidate with diversity penalty
 	type scoredCandidate struct {
@@ -144,7 +207,7 @@ func (m *HeadManager) SelectNextPrefix(head *SearchHead, tree *ArmTree, beamWidt
 	scored := make([]scoredCandidate, len(candidates))
 	for i, node := range candidates {
 		// Thompson Sampling score (lower is better)
-		tsScore := head.Sampler.SampleScore(node)
+		tsScore := m.sampleScore(head, node)
 
 		// Diversity penalty (repulsion from other heads)
 		penalty := m.computeDiversityPenalty(node.Prefix, otherFocuses)
@@ -191,12 +254,15 @@ func (m *HeadManager) SelectNextPrefix(head *SearchHead, tree *ArmTree, beamWidt
 
 // SelectBeam selects a beam of prefixes for a head to explore.
 func (m *HeadManager) SelectBeam(head *SearchHead, tree *ArmTree, beamWidth int) []netip.Prefix {
-	candidates := tree.LeafNodes()
+	candidates := head.ownedLeaves(tree.LeafNodes())
 	if len(candidates) == 0 {
 		return nil
 	}
 
 	otherFocuses := m.getOtherHeadFocuses(head.ID)
+	if m.shared != nil {
+		m.shared.begin()
+	}
 
 	// Score all candidates
 	type scoredCandidate struct {
@@ -206,7 +272,7 @@ func (m *HeadManager) SelectBeam(head *SearchHead, tree *ArmTree, beamWidth int)
 
 	scored := make([]scoredCandidate, len(candidates))
 	for i, node := range candidates {
-		tsScore := head.Sampler.SampleScore(node)
+		tsScore := m.sampleScore(head, node)
 		penalty := m.computeDiversityPenalty(node.Prefix, otherFocuses)
 
 		// Depth bonus: prefer drilling into finer prefixes
@@ -401,8 +467,12 @@ func (m *HeadManager) RebalanceHeads(tree *ArmTree) {
 
 		// Assign each head to a different part of the search space
 		for i, head := range m.heads {
-			idx := (i * len(leaves)) / len(m.heads)
-			head.SetFocus(leaves[idx].Prefix)
+			owned := head.ownedLeaves(leaves)
+			if len(owned) == 0 {
+				continue
+			}
+			idx := (i * len(owned)) / len(m.heads)
+			head.SetFocus(owned[idx].Prefix)
 		}
 	}
 }
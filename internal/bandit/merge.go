@@ -0,0 +1,219 @@
+package bandit
+
+import (
+	"math"
+	"net/netip"
+)
+
+// mergeZ is the number of standard errors within which two siblings'
+// success rates and mean latencies count as indistinguishable.
+const mergeZ = 2.0
+
+// MergeUniform merges split nodes back into leaves when their subtree is
+// uniform: every leaf has at least minSamples probes (or is merged, or at
+// the maximum prefix length), and at every level all children with at
+// least minSamples probes (at least two of them) are pairwise
+// statistically indistinguishable. Siblings that look the same thus merge
+// as soon as they are measured, at any level, instead of being drilled
+// down further. The node absorbs the statistics of its whole subtree,
+// becomes a leaf again and is never split again, which frees beam slots
+// on uniform ranges. It returns the merged nodes.
+func (t *ArmTree) MergeUniform(minSamples int) []*ArmNode {
+	var merged []*ArmNode
+	for _, node := range t.AllNodes() {
+		// Skip nodes removed by an earlier merge in this pass
+		if t.GetNode(node.Prefix) != node || !node.Stats().IsSplit {
+			continue
+		}
+		if _, ok := t.uniformSubtree(node, minSamples); !ok {
+			continue
+		}
+		t.mergeSubtree(node)
+		merged = append(merged, node)
+	}
+	return merged
+}
+
+// uniformSubtree returns the pooled observations of node's subtree and
+// whether the subtree is uniform (see MergeUniform).
+func (t *ArmTree) uniformSubtree(node *ArmNode, minSamples int) (observations, bool) {
+	obs := node.observations()
+	node.mu.RLock()
+	children := append([]*ArmNode(nil), node.Children...)
+	merged := node.Merged
+	node.mu.RUnlock()
+	if len(children) == 0 {
+		maxBits := t.maxBitsV6
+		if node.Prefix.Addr().Is4() {
+			maxBits = t.maxBitsV4
+		}
+		return obs, merged || node.Prefix.Bits() >= maxBits || obs.samples >= minSamples
+	}
+
+	var sampled []observations
+	for _, c := range children {
+		co, ok := t.uniformSubtree(c, minSamples)
+		if !ok {
+			return obs, false
+		}
+		obs = obs.pool(co)
+		if co.samples >= minSamples {
+			sampled = append(sampled, co)
+		}
+	}
+	if len(sampled) < 2 {
+		return obs, false
+	}
+	for i := range sampled {
+		for j := i + 1; j < len(sampled); j++ {
+			if !indistinguishable(sampled[i], sampled[j]) {
+				return obs, false
+			}
+		}
+	}
+	return obs, true
+}
+
+// observations summarizes the probes of a node (or pooled subtree): the
+// success rate and the plain mean and variance of successful latencies
+// (unlike Mu, not mixed with failure penalties).
+type observations struct {
+	samples, successes int
+	sumLat, sumSqLat   float64
+}
+
+func (a *ArmNode) observations() observations {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return observations{samples: a.Samples, successes: a.Successes, sumLat: a.SumLatency, sumSqLat: a.SumSqLat}
+}
+
+func (o observations) pool(other observations) observations {
+	o.samples += other.samples
+	o.successes += other.successes
+	o.sumLat += other.sumLat
+	o.sumSqLat += other.sumSqLat
+	return o
+}
+
+func (o observations) rate() float64 {
+	if o.samples == 0 {
+		return 0
+	}
+	return float64(o.successes) / float64(o.samples)
+}
+
+func (o observations) mean() float64 {
+	if o.successes == 0 {
+		return 0
+	}
+	return o.sumLat / float64(o.successes)
+}
+
+func (o observations) variance() float64 {
+	if o.successes < 2 {
+		return 0
+	}
+	n, m := float64(o.successes), o.mean()
+	return math.Max(0, (o.sumSqLat-n*m*m)/(n-1))
+}
+
+// indistinguishable reports whether two success rates and mean latencies
+// differ by at most mergeZ standard errors.
+func indistinguishable(a, b observations) bool {
+	na, nb := float64(a.samples), float64(b.samples)
+	p := (a.rate()*na + b.rate()*nb) / (na + nb)
+	if se := math.Sqrt(p * (1 - p) * (1/na + 1/nb)); math.Abs(a.rate()-b.rate()) > mergeZ*se {
+		return false
+	}
+	if a.successes < 2 || b.successes < 2 {
+		// Too few successes to compare latency; equal only if both failed
+		return a.successes == 0 && b.successes == 0
+	}
+	se := math.Sqrt(a.variance()/float64(a.successes) + b.variance()/float64(b.successes))
+	return math.Abs(a.mean()-b.mean()) <= mergeZ*se
+}
+
+// mergeSubtree folds the statistics of node's descendants into node and
+// removes them from the tree.
+func (t *ArmTree) mergeSubtree(node *ArmNode) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var descendants []*ArmNode
+	var collect func(n *ArmNode)
+	collect = func(n *ArmNode) {
+		n.mu.RLock()
+		children := append([]*ArmNode(nil), n.Children...)
+		n.mu.RUnlock()
+		for _, c := range children {
+			descendants = append(descendants, c)
+			collect(c)
+		}
+	}
+	collect(node)
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	// Pool the latency posteriors by precision-weighted mean
+	sumW := node.Lambda
+	sumWMu := node.Lambda * node.Mu
+	removed := make(map[netip.Prefix]struct{}, len(descendants))
+	for _, c := range descendants {
+		c.mu.RLock()
+		w := c.Lambda - 0.001 // without the descendant's prior
+		sumW += w
+		sumWMu += w * c.Mu
+		node.Samples += c.Samples
+		node.Successes += c.Successes
+		node.Failures += c.Failures
+		node.SumLatency += c.SumLatency
+		node.SumSqLat += c.SumSqLat
+		node.Alpha += c.Alpha - 1
+		node.Beta += c.Beta - 1
+		node.AlphaNG += c.AlphaNG - 1
+		node.BetaNG += c.BetaNG - 1
+		c.mu.RUnlock()
+
+		delete(t.nodeMap, c.Prefix)
+		removed[c.Prefix] = struct{}{}
+	}
+	node.Lambda = sumW
+	node.Mu = sumWMu / sumW
+	if n := float64(node.Successes); n > 0 {
+		mean := node.SumLatency / n
+		node.SumSqDiff = math.Max(0, node.SumSqLat-n*mean*mean)
+	}
+
+	node.Children = nil
+	node.IsSplit = false
+	node.Merged = true
+
+	kept := t.order[:0]
+	for _, n := range t.order {
+		if _, ok := removed[n.Prefix]; !ok {
+			kept = append(kept, n)
+		}
+	}
+	t.order = kept
+}
+
+// nodeFor returns the node that records observations of prefix: the node
+// itself, or the merged ancestor its subtree was folded into.
+func (t *ArmTree) nodeFor(prefix netip.Prefix) *ArmNode {
+	prefix = prefix.Masked()
+	if node := t.GetNode(prefix); node != nil {
+		return node
+	}
+	for bits := prefix.Bits() - 1; bits >= 0; bits-- {
+		p, _ := prefix.Addr().Prefix(bits)
+		if node := t.GetNode(p); node != nil {
+			if node.Stats().Merged {
+				return node
+			}
+			break
+		}
+	}
+	return t.GetOrCreateNode(prefix)
+}
@@ -0,0 +1,60 @@
+package bandit
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestMergeUniform(t *testing.T) {
+	tests := []struct {
+		name         string
+		latA, latB   float64 // mean latency of the two /17 children
+		samplesB     int
+		wantMerged   bool
+		wantChildren int
+	}{
+		{"indistinguishable", 100, 100, 20, true, 0},
+		{"different latency", 100, 300, 20, false, 2},
+		{"undersampled child", 100, 100, 2, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewArmTree([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/16")}, TreeConfig{
+				SplitStepV4: 1, SplitStepV6: 4, MaxBitsV4: 24, MaxBitsV6: 56, MinSamples: 5,
+			})
+			root := tree.Roots()[0]
+			for i := 0; i < 5; i++ {
+				tree.Update(root.Prefix, true, 100, 1000)
+			}
+			children := tree.SplitNode(root)
+			if len(children) != 2 {
+				t.Fatalf("split into %d children, want 2", len(children))
+			}
+			feed := func(n *ArmNode, mean float64, samples int) {
+				for i := 0; i < samples; i++ {
+					// +-5ms around the mean
+					tree.Update(n.Prefix, true, mean+float64(i%3-1)*5, 1000)
+				}
+			}
+			feed(children[0], tt.latA, 20)
+			feed(children[1], tt.latB, tt.samplesB)
+
+			merged := tree.MergeUniform(5)
+			if got := len(merged) == 1 && merged[0] == root; got != tt.wantMerged {
+				t.Fatalf("merged %v, want the root merged: %v", merged, tt.wantMerged)
+			}
+			st := root.Stats()
+			if len(root.Children) != tt.wantChildren || st.IsSplit == tt.wantMerged {
+				t.Errorf("root has %d children (split %v), want %d", len(root.Children), st.IsSplit, tt.wantChildren)
+			}
+			if tt.wantMerged {
+				if want := 5 + 20 + tt.samplesB; st.Samples != want || tree.Size() != 1 {
+					t.Errorf("merged root has %d samples in a tree of %d nodes, want %d in 1", st.Samples, tree.Size(), want)
+				}
+				if root.CanSplit(5, 24, 56) {
+					t.Error("merged root can be split again")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package bandit
+
+import (
+	"net/netip"
+	"sync"
+)
+
+// sharedStatsNoise is the log-normal sigma of the per-head noise applied to
+// shared draws.
+const sharedStatsNoise = 0.1
+
+// sharedDraws holds one posterior draw per leaf that all heads read, so
+// heads rank prefixes from the same global statistics instead of each
+// drawing independently. Draws are refreshed once every head has selected.
+type sharedDraws struct {
+	mu         sync.Mutex
+	sampler    *ThompsonSampler
+	numHeads   int
+	selections int
+	scores     map[netip.Prefix]float64
+}
+
+func newSharedDraws(sampler *ThompsonSampler, numHeads int) *sharedDraws {
+	return &sharedDraws{
+		sampler:  sampler,
+		numHeads: numHeads,
+		scores:   make(map[netip.Prefix]float64),
+	}
+}
+
+// begin marks the start of one head's selection, starting a new round of
+// draws after every head has selected.
+func (d *sharedDraws) begin() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.selections%d.numHeads == 0 {
+		clear(d.scores)
+	}
+	d.selections++
+}
+
+// score returns the round's shared draw for node.
+func (d *sharedDraws) score(node *ArmNode) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.scores[node.Prefix]
+	if !ok {
+		s = d.sampler.SampleScore(node)
+		d.scores[node.Prefix] = s
+	}
+	return s
+}
+
+// sampleScore scores a candidate for a head: its own Thompson draw, or the
+// shared draw with per-head exploration noise when shared stats are on.
+func (m *HeadManager) sampleScore(head *SearchHead, node *ArmNode) float64 {
+	if m.shared == nil {
+		return head.Sampler.SampleScore(node)
+	}
+	return m.shared.score(node) * head.Sampler.jitter(sharedStatsNoise)
+}
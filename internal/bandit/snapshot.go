@@ -0,0 +1,116 @@
+package bandit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+)
+
+// treeSnapshotVersion is the format version written by ArmTree.Save.
+const treeSnapshotVersion = 1
+
+// treeSnapshot is the on-disk form of an ArmTree.
+type treeSnapshot struct {
+	Version int            `json:"version"`
+	Nodes   []nodeSnapshot `json:"nodes"`
+}
+
+// nodeSnapshot holds the persisted statistics of one ArmNode.
+type nodeSnapshot struct {
+	Prefix     netip.Prefix `json:"prefix"`
+	Split      bool         `json:"split,omitempty"`
+	Merged     bool         `json:"merged,omitempty"`
+	Alpha      float64      `json:"alpha"`
+	Beta       float64      `json:"beta"`
+	Mu         float64      `json:"mu"`
+	Lambda     float64      `json:"lambda"`
+	AlphaNG    float64      `json:"alpha_ng"`
+	BetaNG     float64      `json:"beta_ng"`
+	Samples    int          `json:"samples"`
+	Successes  int          `json:"successes"`
+	Failures   int          `json:"failures"`
+	SumLatency float64      `json:"sum_latency"`
+	SumSqDiff  float64      `json:"sum_sq_diff"`
+	SumSqLat   float64      `json:"sum_sq_lat,omitempty"`
+	Visits     int          `json:"visits"`
+	Value      float64      `json:"value"`
+}
+
+// Save writes every node of the tree (statistics and split state) as JSON,
+// ordered by prefix length so parents precede their children.
+func (t *ArmTree) Save(w io.Writer) error {
+	nodes := t.AllNodes()
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i].Prefix, nodes[j].Prefix
+		if a.Bits() != b.Bits() {
+			return a.Bits() < b.Bits()
+		}
+		return a.Addr().Less(b.Addr())
+	})
+
+	snap := treeSnapshot{Version: treeSnapshotVersion, Nodes: make([]nodeSnapshot, 0, len(nodes))}
+	for _, n := range nodes {
+		n.mu.RLock()
+		snap.Nodes = append(snap.Nodes, nodeSnapshot{
+			Prefix:     n.Prefix,
+			Split:      n.IsSplit,
+			Merged:     n.Merged,
+			Alpha:      n.Alpha,
+			Beta:       n.Beta,
+			Mu:         n.Mu,
+			Lambda:     n.Lambda,
+			AlphaNG:    n.AlphaNG,
+			BetaNG:     n.BetaNG,
+			Samples:    n.Samples,
+			Successes:  n.Successes,
+			Failures:   n.Failures,
+			SumLatency: n.SumLatency,
+			SumSqDiff:  n.SumSqDiff,
+			SumSqLat:   n.SumSqLat,
+			Visits:     n.Visits,
+			Value:      n.Value,
+		})
+		n.mu.RUnlock()
+	}
+	return json.NewEncoder(w).Encode(snap)
+}
+
+// Load merges a tree written by Save into t, so a new run continues to
+// refine the same tree. Only nodes inside t's root prefixes are restored
+// (the input CIDRs may differ between runs); their statistics replace the
+// fresh priors and split nodes keep their children. It returns the number
+// of restored nodes.
+func (t *ArmTree) Load(r io.Reader) (int, error) {
+	var snap treeSnapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return 0, fmt.Errorf("decode tree: %w", err)
+	}
+	if snap.Version != treeSnapshotVersion {
+		return 0, fmt.Errorf("unsupported tree version %d", snap.Version)
+	}
+	sort.SliceStable(snap.Nodes, func(i, j int) bool {
+		return snap.Nodes[i].Prefix.Bits() < snap.Nodes[j].Prefix.Bits()
+	})
+
+	loaded := 0
+	for _, s := range snap.Nodes {
+		if !s.Prefix.IsValid() || !t.Covers(s.Prefix) {
+			continue
+		}
+		n := t.GetOrCreateNode(s.Prefix)
+		n.mu.Lock()
+		n.IsSplit = s.Split
+		n.Merged = s.Merged
+		n.Alpha, n.Beta = s.Alpha, s.Beta
+		n.Mu, n.Lambda = s.Mu, s.Lambda
+		n.AlphaNG, n.BetaNG = s.AlphaNG, s.BetaNG
+		n.Samples, n.Successes, n.Failures = s.Samples, s.Successes, s.Failures
+		n.SumLatency, n.SumSqDiff, n.SumSqLat = s.SumLatency, s.SumSqDiff, s.SumSqLat
+		n.Visits, n.Value = s.Visits, s.Value
+		n.mu.Unlock()
+		loaded++
+	}
+	return loaded, nil
+}
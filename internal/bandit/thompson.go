@@ -18,6 +18,10 @@ type ThompsonSampler struct {
 
 	// Timeout in milliseconds (used for score normalization)
 	timeoutMS float64
+
+	// Standard deviations of observed latency added to sampled latencies
+	// (0 = variance is ignored)
+	variancePenalty float64
 }
 
 // NewThompsonSampler creates a new Thompson Sampler.
@@ -29,12 +33,30 @@ func NewThompsonSampler(seed int64, timeoutMS float64) *ThompsonSampler {
 	}
 }
 
+// SetVariancePenalty makes SampleScore add k standard deviations of a
+// node's observed latency, so steady prefixes beat erratic ones with the
+// same mean.
+func (s *ThompsonSampler) SetVariancePenalty(k float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.variancePenalty = k
+}
+
 // SampleScore samples a score from the arm's posterior distribution.
 // Lower scores are better (represent lower latency with higher success rate).
 func (s *ThompsonSampler) SampleScore(node *ArmNode) float64 {
 	alpha, beta, mu, lambda, alphaNG, betaNG := node.GetPosteriorParams()
 	stats := node.Stats()
 
+	// Cold children inherit the backed-up value of their subtree: a fast
+	// parent narrows the optimistic range so its children are tried first.
+	optimistic := s.timeoutMS * 0.5
+	if node.Parent != nil {
+		if ps := node.Parent.Stats(); ps.Visits > 0 {
+			optimistic = math.Min(optimistic, (1-ps.MeanValue)*s.timeoutMS*s.failurePenalty)
+		}
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -43,7 +65,7 @@ func (s *ThompsonSampler) SampleScore(node *ArmNode) float64 {
 	if stats.Samples < 3 {
 		// Optimistic score: assume it could be good
 		// Random value between 0 and 0.5 * timeout gives unexplored nodes a chance
-		return s.rng.Float64() * s.timeoutMS * 0.5
+		return s.rng.Float64() * optimistic
 	}
 
 	// Sample success rate from Beta distribution
@@ -74,6 +96,10 @@ func (s *ThompsonSampler) SampleScore(node *ArmNode) float64 {
 		latency = 1
 	}
 
+	if s.variancePenalty > 0 && stats.VarLatency > 0 {
+		latency += s.variancePenalty * math.Sqrt(stats.VarLatency)
+	}
+
 	// Combined score: latency + failure penalty
 	failureRate := 1 - successRate
 	score := latency + failureRate*s.timeoutMS*s.failurePenalty
@@ -208,6 +234,13 @@ func (s *ThompsonSampler) sampleNormal(mu, sigma float64) float64 {
 	return mu + sigma*s.rng.NormFloat64()
 }
 
+// jitter returns exp(sigma*N(0,1)), a multiplicative noise factor.
+func (s *ThompsonSampler) jitter(sigma float64) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return math.Exp(s.sampleNormal(0, sigma))
+}
+
 // SampleIP samples a random IP address from the given prefix.
 func (s *ThompsonSampler) SampleIP(prefix netip.Prefix) netip.Addr {
 	s.mu.Lock()
@@ -1,6 +1,7 @@
 package bandit
 
 import (
+	"math"
 	"net/netip"
 	"sort"
 	"sync"
@@ -13,6 +14,7 @@ import (
 type ArmTree struct {
 	roots   []*ArmNode
 	nodeMap map[netip.Prefix]*ArmNode
+	order   []*ArmNode // nodes in creation order, for stable iteration
 	mu      sync.RWMutex
 
 	// Configuration
@@ -21,6 +23,9 @@ type ArmTree struct {
 	maxBitsV4   int
 	maxBitsV6   int
 	minSamples  int
+
+	variancePenalty float64
+	exclude         cidr.Exclusion
 }
 
 // TreeConfig holds configuration for the arm tree.
@@ -30,6 +35,14 @@ type TreeConfig struct {
 	MaxBitsV4   int // Maximum prefix length for IPv4
 	MaxBitsV6   int // Maximum prefix length for IPv6
 	MinSamples  int // Minimum samples before splitting
+
+	// VariancePenalty adds this many standard deviations of a node's
+	// latency to its mean when ranking split candidates (0 = off).
+	VariancePenalty float64
+
+	// Exclude lists prefixes never to probe; children that are fully
+	// excluded are not created when splitting.
+	Exclude cidr.Exclusion
 }
 
 // DefaultTreeConfig returns sensible defaults.
@@ -53,6 +66,9 @@ func NewArmTree(prefixes []netip.Prefix, cfg TreeConfig) *ArmTree {
 		maxBitsV4:   cfg.MaxBitsV4,
 		maxBitsV6:   cfg.MaxBitsV6,
 		minSamples:  cfg.MinSamples,
+
+		variancePenalty: cfg.VariancePenalty,
+		exclude:         cfg.Exclude,
 	}
 
 	for _, p := range prefixes {
@@ -63,6 +79,7 @@ func NewArmTree(prefixes []netip.Prefix, cfg TreeConfig) *ArmTree {
 		node := NewArmNode(p, nil)
 		t.roots = append(t.roots, node)
 		t.nodeMap[p] = node
+		t.order = append(t.order, node)
 	}
 
 	return t
@@ -105,6 +122,7 @@ func (t *ArmTree) GetOrCreateNode(prefix netip.Prefix) *ArmNode {
 
 	node := NewArmNode(prefix, parent)
 	t.nodeMap[prefix] = node
+	t.order = append(t.order, node)
 
 	if parent != nil {
 		parent.AddChild(node)
@@ -142,7 +160,7 @@ func (t *ArmTree) AllNodes() []*ArmNode {
 	defer t.mu.RUnlock()
 
 	nodes := make([]*ArmNode, 0, len(t.nodeMap))
-	for _, node := range t.nodeMap {
+	for _, node := range t.order {
 		nodes = append(nodes, node)
 	}
 	return nodes
@@ -154,7 +172,7 @@ func (t *ArmTree) LeafNodes() []*ArmNode {
 	defer t.mu.RUnlock()
 
 	leaves := make([]*ArmNode, 0)
-	for _, node := range t.nodeMap {
+	for _, node := range t.order {
 		stats := node.Stats()
 		if !stats.IsSplit {
 			leaves = append(leaves, node)
@@ -195,9 +213,13 @@ func (t *ArmTree) SplitNode(node *ArmNode) []*ArmNode {
 		if _, exists := t.nodeMap[childPrefix]; exists {
 			continue
 		}
+		if t.exclude.Covers(childPrefix) {
+			continue
+		}
 
 		childNode := NewArmNode(childPrefix, node)
 		t.nodeMap[childPrefix] = childNode
+		t.order = append(t.order, childNode)
 		node.AddChild(childNode)
 		createdChildren = append(createdChildren, childNode)
 	}
@@ -228,7 +250,7 @@ func (t *ArmTree) GetSplitCandidates(limit int) []*ArmNode {
 			// - High uncertainty = moderate boost (explore unknowns)
 
 			// Base priority is mean latency (lower = better)
-			latencyScore := stats.MeanLatency
+			latencyScore := stats.MeanLatency + t.variancePenalty*math.Sqrt(stats.VarLatency)
 			if stats.Successes == 0 {
 				latencyScore = 10000 // Penalty for no successes
 			}
@@ -264,10 +286,18 @@ func (t *ArmTree) GetSplitCandidates(limit int) []*ArmNode {
 	return result
 }
 
-// Update updates the statistics for a prefix.
+// Update updates the statistics for a prefix and backs the probe's reward
+// up to all its ancestors.
 func (t *ArmTree) Update(prefix netip.Prefix, success bool, latencyMS, timeoutMS float64) {
-	node := t.GetOrCreateNode(prefix)
+	node := t.nodeFor(prefix)
 	node.Update(success, latencyMS, timeoutMS)
+	node.Backup(Reward(success, latencyMS, timeoutMS))
+}
+
+// Penalize down-weights the success rate of a prefix.
+func (t *ArmTree) Penalize(prefix netip.Prefix, weight float64) {
+	node := t.nodeFor(prefix)
+	node.Penalize(weight)
 }
 
 // Roots returns the root nodes.
@@ -279,6 +309,49 @@ func (t *ArmTree) Roots() []*ArmNode {
 	return roots
 }
 
+// Covers reports whether prefix lies inside one of the root prefixes.
+func (t *ArmTree) Covers(prefix netip.Prefix) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, root := range t.roots {
+		if root.Prefix.Bits() <= prefix.Bits() && root.Prefix.Contains(prefix.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Deepest returns the deepest node whose prefix contains addr, or nil if
+// no root prefix does.
+func (t *ArmTree) Deepest(addr netip.Addr) *ArmNode {
+	t.mu.RLock()
+	var node *ArmNode
+	for _, root := range t.roots {
+		if root.Prefix.Contains(addr) {
+			node = root
+			break
+		}
+	}
+	t.mu.RUnlock()
+	for node != nil {
+		node.mu.RLock()
+		children := node.Children
+		node.mu.RUnlock()
+		var next *ArmNode
+		for _, child := range children {
+			if child.Prefix.Contains(addr) {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return node
+		}
+		node = next
+	}
+	return nil
+}
+
 // Size returns the total number of nodes in the tree.
 func (t *ArmTree) Size() int {
 	t.mu.RLock()
@@ -292,9 +365,24 @@ func (t *ArmTree) TotalSamples() int {
 	defer t.mu.RUnlock()
 
 	total := 0
-	for _, node := range t.nodeMap {
+	for _, node := range t.order {
 		stats := node.Stats()
 		total += stats.Samples
 	}
 	return total
 }
+
+// SampledNodes returns the number of nodes that received at least one
+// sample.
+func (t *ArmTree) SampledNodes() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n := 0
+	for _, node := range t.order {
+		if node.Stats().Samples > 0 {
+			n++
+		}
+	}
+	return n
+}
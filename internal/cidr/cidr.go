@@ -8,20 +8,37 @@ import (
 	mrand "math/rand"
 	"net/netip"
 	"os"
+	"strconv"
 	"strings"
 )
 
 func ReadCIDRsFromFile(path string) ([]netip.Prefix, error) {
+	ps, _, err := ReadWeightedCIDRsFromFile(path)
+	return ps, err
+}
+
+// ReadWeightedCIDRsFromFile is ReadWeightedCIDRs on the named file.
+func ReadWeightedCIDRsFromFile(path string) ([]netip.Prefix, []float64, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer func() { _ = f.Close() }()
-	return ReadCIDRs(f)
+	return ReadWeightedCIDRs(f)
 }
 
 func ReadCIDRs(r io.Reader) ([]netip.Prefix, error) {
-	var out []netip.Prefix
+	ps, _, err := ReadWeightedCIDRs(r)
+	return ps, err
+}
+
+// ReadWeightedCIDRs reads one CIDR per line with an optional positive
+// weight as second field ("1.1.1.0/24 3"); lines without one weigh 1.
+func ReadWeightedCIDRs(r io.Reader) ([]netip.Prefix, []float64, error) {
+	var (
+		out     []netip.Prefix
+		weights []float64
+	)
 	sc := bufio.NewScanner(r)
 	for sc.Scan() {
 		line := strings.TrimSpace(sc.Text())
@@ -32,16 +49,27 @@ func ReadCIDRs(r io.Reader) ([]netip.Prefix, error) {
 		if idx := strings.Index(line, "#"); idx >= 0 {
 			line = strings.TrimSpace(line[:idx])
 		}
-		p, err := netip.ParsePrefix(line)
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, nil, fmt.Errorf("parse cidr %q: too many fields", line)
+		}
+		p, err := netip.ParsePrefix(fields[0])
 		if err != nil {
-			return nil, fmt.Errorf("parse cidr %q: %w", line, err)
+			return nil, nil, fmt.Errorf("parse cidr %q: %w", line, err)
+		}
+		w := 1.0
+		if len(fields) == 2 {
+			if w, err = strconv.ParseFloat(fields[1], 64); err != nil || w <= 0 {
+				return nil, nil, fmt.Errorf("parse cidr %q: weight must be a positive number", line)
+			}
 		}
 		out = append(out, p.Masked())
+		weights = append(weights, w)
 	}
 	if err := sc.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return out, nil
+	return out, weights, nil
 }
 
 func ParseCIDRs(strs []string) ([]netip.Prefix, error) {
@@ -136,6 +164,22 @@ func randomAddr6(p netip.Prefix, r *mrand.Rand) netip.Addr {
 	return netip.AddrFrom16(out)
 }
 
+// NthAddr returns the address at offset n (counted from the network
+// address) inside prefix p; n must be below the prefix size.
+func NthAddr(p netip.Prefix, n uint64) netip.Addr {
+	p = p.Masked()
+	if p.Addr().Is4() {
+		a := p.Addr().As4()
+		var out [4]byte
+		binary.BigEndian.PutUint32(out[:], binary.BigEndian.Uint32(a[:])|uint32(n))
+		return netip.AddrFrom4(out)
+	}
+	a := p.Addr().As16()
+	lo := binary.BigEndian.Uint64(a[8:]) | n
+	binary.BigEndian.PutUint64(a[8:], lo)
+	return netip.AddrFrom16(a)
+}
+
 // keepHostBits zeroes the top (128-hostBits) bits.
 func keepHostBits(b *[16]byte, hostBits int) {
 	topBits := 128 - hostBits
@@ -0,0 +1,67 @@
+package cidr
+
+import "net/netip"
+
+// Exclusion is a set of prefixes whose addresses must never be probed.
+type Exclusion []netip.Prefix
+
+// Contains reports whether ip lies inside an excluded prefix.
+func (x Exclusion) Contains(ip netip.Addr) bool {
+	for _, e := range x {
+		if e.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether every address of p is excluded.
+func (x Exclusion) Covers(p netip.Prefix) bool {
+	_, ok := x.Allowed(p, p.Masked().Addr())
+	return !ok
+}
+
+// Allowed returns ip if it is not excluded, otherwise the next address in
+// p (wrapping around to its start once) that is not excluded. ok is false
+// when p is fully excluded.
+func (x Exclusion) Allowed(p netip.Prefix, ip netip.Addr) (netip.Addr, bool) {
+	p = p.Masked()
+	wrapped := false
+	// Every jump skips a whole excluded prefix, so this terminates after
+	// at most two passes over the exclusions.
+	for i := 0; i <= 2*len(x)+1; i++ {
+		var hit netip.Prefix
+		for _, e := range x {
+			if e.Contains(ip) {
+				hit = e
+				break
+			}
+		}
+		if !hit.IsValid() {
+			return ip, true
+		}
+		if hit.Bits() <= p.Bits() && hit.Contains(p.Addr()) {
+			return netip.Addr{}, false
+		}
+		ip = lastAddr(hit).Next()
+		if !ip.IsValid() || !p.Contains(ip) {
+			if wrapped {
+				return netip.Addr{}, false
+			}
+			wrapped = true
+			ip = p.Addr()
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// lastAddr returns the highest address of p.
+func lastAddr(p netip.Prefix) netip.Addr {
+	p = p.Masked()
+	b := p.Addr().AsSlice()
+	for bit := p.Bits(); bit < len(b)*8; bit++ {
+		b[bit/8] |= 0x80 >> (bit % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
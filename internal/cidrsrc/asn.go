@@ -0,0 +1,142 @@
+package cidrsrc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// Announced-prefix APIs, tried in order.
+const (
+	ripestatURL = "https://stat.ripe.net/data/announced-prefixes/data.json?resource=AS%d"
+	bgpviewURL  = "https://api.bgpview.io/asn/%d/prefixes"
+)
+
+// ASN returns the prefixes announced by the autonomous system asn, from
+// RIPEstat or, when that fails, BGPView. Lists are cached like sources.
+func (f *Fetcher) ASN(ctx context.Context, asn uint) ([]netip.Prefix, error) {
+	return f.Cached(ctx, fmt.Sprintf("as%d", asn), func(ctx context.Context) ([]netip.Prefix, error) {
+		ps, err := f.ripestat(ctx, asn)
+		if err == nil && len(ps) > 0 {
+			return ps, nil
+		}
+		ps, berr := f.bgpview(ctx, asn)
+		if berr != nil {
+			return nil, errors.Join(err, berr)
+		}
+		return ps, nil
+	})
+}
+
+func (f *Fetcher) ripestat(ctx context.Context, asn uint) ([]netip.Prefix, error) {
+	var body struct {
+		Status string `json:"status"`
+		Data   struct {
+			Prefixes []struct {
+				Prefix string `json:"prefix"`
+			} `json:"prefixes"`
+		} `json:"data"`
+	}
+	if err := f.getJSON(ctx, fmt.Sprintf(ripestatURL, asn), &body); err != nil {
+		return nil, fmt.Errorf("ripestat: %w", err)
+	}
+	if body.Status != "" && body.Status != "ok" {
+		return nil, fmt.Errorf("ripestat: status %q", body.Status)
+	}
+	var strs []string
+	for _, p := range body.Data.Prefixes {
+		strs = append(strs, p.Prefix)
+	}
+	ps, err := parsePrefixes(strs)
+	if err != nil {
+		return nil, fmt.Errorf("ripestat: %w", err)
+	}
+	return ps, nil
+}
+
+func (f *Fetcher) bgpview(ctx context.Context, asn uint) ([]netip.Prefix, error) {
+	type entry struct {
+		Prefix string `json:"prefix"`
+	}
+	var body struct {
+		Status string `json:"status"`
+		Data   struct {
+			IPv4 []entry `json:"ipv4_prefixes"`
+			IPv6 []entry `json:"ipv6_prefixes"`
+		} `json:"data"`
+	}
+	if err := f.getJSON(ctx, fmt.Sprintf(bgpviewURL, asn), &body); err != nil {
+		return nil, fmt.Errorf("bgpview: %w", err)
+	}
+	if body.Status != "" && body.Status != "ok" {
+		return nil, fmt.Errorf("bgpview: status %q", body.Status)
+	}
+	var strs []string
+	for _, p := range append(body.Data.IPv4, body.Data.IPv6...) {
+		strs = append(strs, p.Prefix)
+	}
+	ps, err := parsePrefixes(strs)
+	if err != nil {
+		return nil, fmt.Errorf("bgpview: %w", err)
+	}
+	return ps, nil
+}
+
+func (f *Fetcher) getJSON(ctx context.Context, url string, v any) error {
+	data, err := f.Get(ctx, url)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", url, err)
+	}
+	return nil
+}
+
+// parsePrefixes parses and masks prefixes, dropping duplicates and the
+// prefixes contained in another one of the list (an ASN often announces a
+// block and its more-specifics, which would otherwise be searched twice).
+func parsePrefixes(strs []string) ([]netip.Prefix, error) {
+	seen := make(map[netip.Prefix]bool, len(strs))
+	ps := make([]netip.Prefix, 0, len(strs))
+	for _, s := range strs {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		if p = p.Masked(); !seen[p] {
+			seen[p] = true
+			ps = append(ps, p)
+		}
+	}
+
+	// Shortest first, so a prefix is only checked against the ones that
+	// can contain it
+	bySize := append([]netip.Prefix(nil), ps...)
+	sort.SliceStable(bySize, func(i, j int) bool { return bySize[i].Bits() < bySize[j].Bits() })
+	var outer []netip.Prefix
+	for _, p := range bySize {
+		contained := false
+		for _, o := range outer {
+			if o.Bits() < p.Bits() && o.Contains(p.Addr()) {
+				contained = true
+				break
+			}
+		}
+		if contained {
+			delete(seen, p)
+		} else {
+			outer = append(outer, p)
+		}
+	}
+	kept := ps[:0]
+	for _, p := range ps {
+		if seen[p] {
+			kept = append(kept, p)
+		}
+	}
+	return kept, nil
+}
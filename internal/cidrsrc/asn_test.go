@@ -0,0 +1,33 @@
+package cidrsrc
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want string
+	}{
+		{[]string{"1.1.1.0/24"}, "[1.1.1.0/24]"},
+		{[]string{"1.1.1.7/24", "1.1.1.0/24"}, "[1.1.1.0/24]"},
+		{[]string{"1.1.1.0/25", "1.1.0.0/16", "1.2.0.0/16"}, "[1.1.0.0/16 1.2.0.0/16]"},
+		{[]string{"104.16.0.0/13", "104.16.0.0/12", "104.24.0.0/14"}, "[104.16.0.0/12]"},
+		{[]string{"2606:4700::/32", "2606:4700:10::/48", "1.1.1.0/24"}, "[2606:4700::/32 1.1.1.0/24]"},
+		{[]string{"1.1.1.0/24", "1.1.1.0/25", "1.1.1.128/25"}, "[1.1.1.0/24]"},
+	}
+	for _, tt := range tests {
+		ps, err := parsePrefixes(tt.in)
+		if err != nil {
+			t.Errorf("parsePrefixes(%v): %v", tt.in, err)
+			continue
+		}
+		if got := fmt.Sprint(ps); got != tt.want {
+			t.Errorf("parsePrefixes(%v) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+	if _, err := parsePrefixes([]string{"1.1.1.0/24", "bogus"}); err == nil {
+		t.Error("parsePrefixes accepted an invalid prefix")
+	}
+}
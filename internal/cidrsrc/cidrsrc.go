@@ -0,0 +1,199 @@
+// Package cidrsrc fetches CIDR lists from public sources and caches them
+// on disk, so searches can start from an up-to-date list and still run
+// offline.
+package cidrsrc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/atomicfile"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/cidr"
+)
+
+// DefaultTTL is how long a cached list is used before it is fetched again.
+const DefaultTTL = 24 * time.Hour
+
+// sources are the lists of Fetcher.Source by name, each the union of
+// plain-text CIDR lists (one per line).
+var sources = map[string][]string{
+	"cloudflare":    {"https://www.cloudflare.com/ips-v4", "https://www.cloudflare.com/ips-v6"},
+	"cloudflare-v4": {"https://www.cloudflare.com/ips-v4"},
+	"cloudflare-v6": {"https://www.cloudflare.com/ips-v6"},
+}
+
+// Sources lists the names accepted by Fetcher.Source.
+func Sources() []string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckSource validates a source name.
+func CheckSource(name string) error {
+	if _, ok := sources[name]; !ok {
+		return fmt.Errorf("unknown CIDR source %q (want %s)", name, strings.Join(Sources(), "|"))
+	}
+	return nil
+}
+
+// Fetcher downloads CIDR lists and keeps them in CacheDir. A cached list
+// younger than TTL is used as is; an older one is refreshed, and used
+// anyway (with a warning to Log) when the refresh fails.
+type Fetcher struct {
+	CacheDir string        // default: <user cache dir>/mcis
+	TTL      time.Duration // default DefaultTTL; negative always fetches
+	Timeout  time.Duration // per request; default 30s
+	Client   *http.Client
+	Log      io.Writer // warnings; nil discards them
+}
+
+// Source returns the prefixes of the named source.
+func (f *Fetcher) Source(ctx context.Context, name string) ([]netip.Prefix, error) {
+	urls, ok := sources[name]
+	if !ok {
+		return nil, CheckSource(name)
+	}
+	return f.Cached(ctx, name, func(ctx context.Context) ([]netip.Prefix, error) {
+		var all []netip.Prefix
+		for _, u := range urls {
+			data, err := f.Get(ctx, u)
+			if err != nil {
+				return nil, err
+			}
+			ps, err := cidr.ReadCIDRs(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", u, err)
+			}
+			all = append(all, ps...)
+		}
+		return all, nil
+	})
+}
+
+// Cached returns the list cached under key, calling fetch for a fresh one
+// when the cache is missing or expired. An empty fetched list is an error,
+// so an upstream outage never replaces a good list.
+func (f *Fetcher) Cached(ctx context.Context, key string, fetch func(ctx context.Context) ([]netip.Prefix, error)) ([]netip.Prefix, error) {
+	path, err := f.cachePath(key)
+	if err != nil {
+		return nil, err
+	}
+	cached, age, cerr := readCache(path)
+	if cerr == nil && age < f.ttl() {
+		return cached, nil
+	}
+
+	ps, err := fetch(ctx)
+	if err == nil && len(ps) == 0 {
+		err = errors.New("empty list")
+	}
+	if err != nil {
+		if cerr != nil {
+			return nil, fmt.Errorf("cidr source %s: %w", key, err)
+		}
+		f.logf("cidr source %s: %v; using the cached list from %s ago\n", key, err, age.Round(time.Minute))
+		return cached, nil
+	}
+	if err := writeCache(path, ps); err != nil {
+		f.logf("cidr source %s: caching: %v\n", key, err)
+	}
+	return ps, nil
+}
+
+// Get fetches url; statuses other than 200 are errors.
+func (f *Fetcher) Get(ctx context.Context, url string) ([]byte, error) {
+	timeout := f.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "mcis")
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+}
+
+func (f *Fetcher) ttl() time.Duration {
+	if f.TTL == 0 {
+		return DefaultTTL
+	}
+	return f.TTL
+}
+
+func (f *Fetcher) cachePath(key string) (string, error) {
+	dir := f.CacheDir
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("cidr cache: %w", err)
+		}
+		dir = filepath.Join(base, "mcis")
+	}
+	return filepath.Join(dir, "cidr-"+key+".txt"), nil
+}
+
+func (f *Fetcher) logf(format string, args ...any) {
+	if f.Log != nil {
+		fmt.Fprintf(f.Log, format, args...)
+	}
+}
+
+// readCache reads a cached list and its age.
+func readCache(path string) ([]netip.Prefix, time.Duration, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	ps, err := cidr.ReadCIDRsFromFile(path)
+	if err == nil && len(ps) == 0 {
+		err = fmt.Errorf("%s: empty list", path)
+	}
+	return ps, time.Since(fi.ModTime()), err
+}
+
+// writeCache replaces the cached list through a temporary file, so
+// concurrent runs never read a partial list.
+func writeCache(path string, ps []netip.Prefix) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# fetched %s\n", time.Now().UTC().Format(time.RFC3339))
+	for _, p := range ps {
+		b.WriteString(p.String())
+		b.WriteByte('\n')
+	}
+	return atomicfile.Write(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, b.String())
+		return err
+	})
+}
@@ -0,0 +1,177 @@
+package cidrsrc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultResolvers are the resolvers of Resolve when none are given: the
+// system resolver and two public DoH services. Their answers for a CDN
+// name often differ, since each is steered by the resolver's location.
+var DefaultResolvers = []string{
+	"system",
+	"https://cloudflare-dns.com/dns-query",
+	"https://dns.google/dns-query",
+}
+
+// Resolve looks up the A and AAAA records of domain with every resolver:
+// "system", a DNS server "ip[:port]" (UDP/TCP) or a DoH URL "https://...".
+// It returns the union of the answers and fails only when no resolver
+// returned an address.
+func (f *Fetcher) Resolve(ctx context.Context, domain string, resolvers []string) ([]netip.Addr, error) {
+	if len(resolvers) == 0 {
+		resolvers = DefaultResolvers
+	}
+	timeout := f.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		seen  = make(map[netip.Addr]bool)
+		addrs []netip.Addr
+		errs  []error
+	)
+	for _, r := range resolvers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			var got []netip.Addr
+			var err error
+			if strings.HasPrefix(r, "https://") {
+				got, err = f.resolveDoH(rctx, r, domain)
+			} else {
+				got, err = resolveDNS(rctx, r, domain)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", r, err))
+				return
+			}
+			for _, a := range got {
+				if a = a.Unmap(); !seen[a] {
+					seen[a] = true
+					addrs = append(addrs, a)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(addrs) == 0 {
+		if len(errs) == 0 {
+			errs = append(errs, errors.New("no A or AAAA records"))
+		}
+		return nil, fmt.Errorf("resolve %s: %w", domain, errors.Join(errs...))
+	}
+	return addrs, nil
+}
+
+// resolveDNS resolves domain with the system resolver or the DNS server
+// at server.
+func resolveDNS(ctx context.Context, server, domain string) ([]netip.Addr, error) {
+	res := net.DefaultResolver
+	if server != "system" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		res = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return res.LookupNetIP(ctx, "ip", domain)
+}
+
+// resolveDoH queries the A and AAAA records of domain from a DoH service
+// (RFC 8484, POST).
+func (f *Fetcher) resolveDoH(ctx context.Context, url, domain string) ([]netip.Addr, error) {
+	if !strings.HasSuffix(domain, ".") {
+		domain += "."
+	}
+	name, err := dnsmessage.NewName(domain)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []netip.Addr
+	var errs []error
+	for _, typ := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		got, err := f.dohQuery(ctx, url, name, typ)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		addrs = append(addrs, got...)
+	}
+	if len(addrs) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return addrs, nil
+}
+
+func (f *Fetcher) dohQuery(ctx context.Context, url string, name dnsmessage.Name, typ dnsmessage.Type) ([]netip.Addr, error) {
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: typ, Class: dnsmessage.ClassINET}},
+	}
+	wire, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(wire))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	if err := msg.Unpack(body); err != nil {
+		return nil, err
+	}
+	if msg.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("rcode %s", msg.RCode)
+	}
+	var addrs []netip.Addr
+	for _, rr := range msg.Answers {
+		switch b := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, netip.AddrFrom4(b.A))
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, netip.AddrFrom16(b.AAAA))
+		}
+	}
+	return addrs, nil
+}
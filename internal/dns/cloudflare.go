@@ -159,6 +159,34 @@ func (p *CloudflareProvider) DeleteRecords(ctx context.Context, subdomain string
 	return nil
 }
 
+// Records returns the addresses of the A or AAAA records for the subdomain.
+func (p *CloudflareProvider) Records(ctx context.Context, subdomain string, ipv6 bool) ([]netip.Addr, error) {
+	recordType := "A"
+	if ipv6 {
+		recordType = "AAAA"
+	}
+
+	fqdn, err := p.buildFQDN(ctx, subdomain)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := p.listRecords(ctx, fqdn, recordType)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]netip.Addr, 0, len(records))
+	for _, rec := range records {
+		ip, err := netip.ParseAddr(rec.Content)
+		if err != nil {
+			return nil, fmt.Errorf("record %s: %w", rec.ID, err)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
 // CreateRecords creates A/AAAA records for the given IPs.
 func (p *CloudflareProvider) CreateRecords(ctx context.Context, subdomain string, ips []netip.Addr) error {
 	// Build full domain name
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net/netip"
 	"os"
+	"slices"
+	"strings"
+	"time"
 )
 
 // Config holds DNS upload configuration.
@@ -21,6 +24,9 @@ type Config struct {
 type Provider interface {
 	// Name returns the provider name.
 	Name() string
+	// Records returns the addresses of the A or AAAA records for the
+	// subdomain.
+	Records(ctx context.Context, subdomain string, ipv6 bool) ([]netip.Addr, error)
 	// DeleteRecords deletes all A or AAAA records for the subdomain.
 	DeleteRecords(ctx context.Context, subdomain string, ipv6 bool) error
 	// CreateRecords creates A/AAAA records for the given IPs.
@@ -70,9 +76,19 @@ func NewProvider(cfg Config) (Provider, error) {
 	}
 }
 
-// Upload uploads the given IPs to the DNS provider.
-// It first deletes existing records for the subdomain, then creates new ones.
-func Upload(ctx context.Context, provider Provider, subdomain string, ips []netip.Addr, verbose bool) error {
+// UploadOptions configures Upload.
+type UploadOptions struct {
+	// DryRun reports the changes Upload would make without making them.
+	DryRun  bool
+	Verbose bool
+}
+
+// Upload points the A and AAAA records of the subdomain at the given IPs:
+// for each address family with IPs, it replaces the existing records with
+// new ones. A family whose records already hold exactly these IPs is left
+// alone. If replacing the records of a family fails, Upload restores the
+// records it found before returning the error.
+func Upload(ctx context.Context, provider Provider, subdomain string, ips []netip.Addr, opts UploadOptions) error {
 	if len(ips) == 0 {
 		return nil
 	}
@@ -87,40 +103,94 @@ func Upload(ctx context.Context, provider Provider, subdomain string, ips []neti
 		}
 	}
 
-	// Delete existing A records and create new ones
-	if len(v4) > 0 {
-		if verbose {
-			fmt.Fprintf(os.Stderr, "dns: deleting existing A records for %s...\n", subdomain)
-		}
-		if err := provider.DeleteRecords(ctx, subdomain, false); err != nil {
-			return fmt.Errorf("delete A records: %w", err)
-		}
-		if verbose {
-			fmt.Fprintf(os.Stderr, "dns: creating %d A records for %s...\n", len(v4), subdomain)
-		}
-		if err := provider.CreateRecords(ctx, subdomain, v4); err != nil {
-			return fmt.Errorf("create A records: %w", err)
-		}
+	if err := replaceRecords(ctx, provider, subdomain, v4, false, opts); err != nil {
+		return err
+	}
+	if err := replaceRecords(ctx, provider, subdomain, v6, true, opts); err != nil {
+		return err
 	}
 
-	// Delete existing AAAA records and create new ones
-	if len(v6) > 0 {
-		if verbose {
-			fmt.Fprintf(os.Stderr, "dns: deleting existing AAAA records for %s...\n", subdomain)
-		}
-		if err := provider.DeleteRecords(ctx, subdomain, true); err != nil {
-			return fmt.Errorf("delete AAAA records: %w", err)
+	if opts.Verbose && !opts.DryRun {
+		fmt.Fprintf(os.Stderr, "dns: upload complete (%d A, %d AAAA records)\n", len(v4), len(v6))
+	}
+	return nil
+}
+
+// replaceRecords replaces the A (or with ipv6, AAAA) records of the
+// subdomain with ips, rolling back to the previous records on failure.
+func replaceRecords(ctx context.Context, provider Provider, subdomain string, ips []netip.Addr, ipv6 bool, opts UploadOptions) error {
+	if len(ips) == 0 {
+		return nil
+	}
+	recordType := "A"
+	if ipv6 {
+		recordType = "AAAA"
+	}
+
+	old, err := provider.Records(ctx, subdomain, ipv6)
+	if err != nil {
+		return fmt.Errorf("list %s records: %w", recordType, err)
+	}
+	if sameAddrs(old, ips) {
+		if opts.Verbose || opts.DryRun {
+			fmt.Fprintf(os.Stderr, "dns: %s records for %s unchanged (%s)\n", recordType, subdomain, joinAddrs(old))
 		}
-		if verbose {
-			fmt.Fprintf(os.Stderr, "dns: creating %d AAAA records for %s...\n", len(v6), subdomain)
+		return nil
+	}
+	if opts.DryRun {
+		fmt.Fprintf(os.Stderr, "dns: dry run: would replace %s records for %s: [%s] -> [%s]\n",
+			recordType, subdomain, joinAddrs(old), joinAddrs(ips))
+		return nil
+	}
+
+	if opts.Verbose {
+		fmt.Fprintf(os.Stderr, "dns: deleting %d existing %s records for %s...\n", len(old), recordType, subdomain)
+	}
+	err = provider.DeleteRecords(ctx, subdomain, ipv6)
+	if err != nil {
+		err = fmt.Errorf("delete %s records: %w", recordType, err)
+	} else {
+		if opts.Verbose {
+			fmt.Fprintf(os.Stderr, "dns: creating %d %s records for %s...\n", len(ips), recordType, subdomain)
 		}
-		if err := provider.CreateRecords(ctx, subdomain, v6); err != nil {
-			return fmt.Errorf("create AAAA records: %w", err)
+		if err = provider.CreateRecords(ctx, subdomain, ips); err != nil {
+			err = fmt.Errorf("create %s records: %w", recordType, err)
 		}
 	}
+	if err == nil {
+		return nil
+	}
 
-	if verbose {
-		fmt.Fprintf(os.Stderr, "dns: upload complete (%d A, %d AAAA records)\n", len(v4), len(v6))
+	// Roll back: drop what was created and restore the previous records.
+	// This runs even if ctx was cancelled midway.
+	fmt.Fprintf(os.Stderr, "dns: %v; restoring previous %s records for %s [%s]\n", err, recordType, subdomain, joinAddrs(old))
+	rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	rerr := provider.DeleteRecords(rctx, subdomain, ipv6)
+	if rerr == nil && len(old) > 0 {
+		rerr = provider.CreateRecords(rctx, subdomain, old)
 	}
-	return nil
+	if rerr != nil {
+		return fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+	}
+	return fmt.Errorf("%w (rolled back)", err)
+}
+
+// sameAddrs reports whether a and b hold the same addresses, in any order.
+func sameAddrs(a, b []netip.Addr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.SortFunc(a, netip.Addr.Compare)
+	slices.SortFunc(b, netip.Addr.Compare)
+	return slices.Equal(a, b)
+}
+
+func joinAddrs(ips []netip.Addr) string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return strings.Join(s, " ")
 }
@@ -87,6 +87,31 @@ func (p *VercelProvider) DeleteRecords(ctx context.Context, subdomain string, ip
 	return nil
 }
 
+// Records returns the addresses of the A or AAAA records for the subdomain.
+func (p *VercelProvider) Records(ctx context.Context, subdomain string, ipv6 bool) ([]netip.Addr, error) {
+	recordType := "A"
+	if ipv6 {
+		recordType = "AAAA"
+	}
+
+	records, err := p.listRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []netip.Addr
+	for _, rec := range records {
+		if rec.Type == recordType && rec.Name == subdomain {
+			ip, err := netip.ParseAddr(rec.Value)
+			if err != nil {
+				return nil, fmt.Errorf("record %s: %w", rec.ID, err)
+			}
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
 // CreateRecords creates A/AAAA records for the given IPs.
 func (p *VercelProvider) CreateRecords(ctx context.Context, subdomain string, ips []netip.Addr) error {
 	for _, ip := range ips {
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/bandit"
+)
+
+// annealState tracks the per-head schedules of the anneal strategy. It is
+// only touched from the scheduling loop.
+type annealState struct {
+	start    []int64   // completed probes when each head's schedule (re)started
+	best     []float64 // best score seen by each head since its last restart
+	lastGain []int64   // completed probes at each head's last improvement
+}
+
+func newAnnealState(heads int) *annealState {
+	a := &annealState{
+		start:    make([]int64, heads),
+		best:     make([]float64, heads),
+		lastGain: make([]int64, heads),
+	}
+	for i := range a.best {
+		a.best[i] = math.Inf(1)
+	}
+	return a
+}
+
+// observe records a result of head for restart detection.
+func (a *annealState) observe(head int, ok bool, score float64, completed int64) {
+	if ok && score < a.best[head] {
+		a.best[head] = score
+		a.lastGain[head] = completed
+	}
+}
+
+// exploreTemperature returns head's current exploration probability,
+// reheating the head first when it has stagnated for Config.AnnealRestart
+// probes. Each schedule spans the budget remaining when it started.
+func (e *Engine) exploreTemperature(head int, completed int64) float64 {
+	a := e.anneal
+	if e.cfg.AnnealRestart > 0 && completed-a.lastGain[head] >= int64(e.cfg.AnnealRestart) {
+		a.start[head], a.lastGain[head] = completed, completed
+		a.best[head] = math.Inf(1)
+		if e.cfg.Verbose {
+			fmt.Fprintf(os.Stderr, "anneal: head %d restarted at %d/%d\n", head, completed, e.cfg.Budget)
+		}
+	}
+	span := int64(e.cfg.Budget) - a.start[head]
+	progress := 1.0
+	if span > 0 {
+		progress = float64(completed-a.start[head]) / float64(span)
+	}
+	return bandit.Temperature(e.cfg.AnnealSchedule, e.cfg.AnnealTemp, e.cfg.AnnealMinTemp, progress)
+}
+
+// explorePrefix picks a uniformly random leaf owned by head, ignoring its
+// statistics, so that early probes keep sampling regions Thompson Sampling
+// has already written off.
+func (e *Engine) explorePrefix(head *bandit.SearchHead) netip.Prefix {
+	var leaves []*bandit.ArmNode
+	for _, node := range e.tree.LeafNodes() {
+		if head.Owns(node.Prefix) {
+			leaves = append(leaves, node)
+		}
+	}
+	if len(leaves) == 0 {
+		return netip.Prefix{}
+	}
+	idx := int(head.Sampler.SampleUniform() * float64(len(leaves)))
+	return leaves[min(idx, len(leaves)-1)].Prefix
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"net/netip"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/bandit"
+)
+
+// Budget split modes (Config.BudgetSplit).
+const (
+	BudgetSplitNone = "none" // the sampler alone decides
+	BudgetSplitEven = "even" // equal share per input CIDR
+	BudgetSplitSize = "size" // share grows with the CIDR's host bits
+	BudgetSplitList = "list" // share from the weights in the CIDR file
+)
+
+// budgetSplitFraction is the part of the budget that Config.BudgetSplit
+// allocates across the input CIDRs before selection is left to the sampler.
+const budgetSplitFraction = 0.25
+
+// budgetSplit hands out the initial probes across the input CIDRs in
+// proportion to their shares, always to the CIDR furthest behind.
+type budgetSplit struct {
+	roots  []netip.Prefix
+	share  []float64 // sums to 1
+	issued []int
+	total  int // probes in the initial phase
+	used   int
+}
+
+// newBudgetSplit returns nil for BudgetSplitNone.
+func newBudgetSplit(mode string, roots []netip.Prefix, weights map[netip.Prefix]float64, budget int) *budgetSplit {
+	if mode == BudgetSplitNone || len(roots) == 0 {
+		return nil
+	}
+	b := &budgetSplit{
+		roots:  roots,
+		share:  make([]float64, len(roots)),
+		issued: make([]int, len(roots)),
+		total:  int(float64(budget) * budgetSplitFraction),
+	}
+	var sum float64
+	for i, r := range roots {
+		w := 1.0
+		switch mode {
+		case BudgetSplitSize:
+			// Host bits + 1: a /12 gets 21 shares against a /24's 9, so
+			// neither starves the other
+			w = float64(r.Addr().BitLen()-r.Bits()) + 1
+		case BudgetSplitList:
+			if lw, ok := weights[r]; ok {
+				w = lw
+			}
+		}
+		b.share[i] = w
+		sum += w
+	}
+	for i := range b.share {
+		b.share[i] /= sum
+	}
+	return b
+}
+
+// next returns the input CIDR owed the next probe among those the head
+// owns, or false once the initial phase is over.
+func (b *budgetSplit) next(head *bandit.SearchHead, completed int64) (netip.Prefix, bool) {
+	if b == nil || completed >= int64(b.total) || b.used >= b.total {
+		return netip.Prefix{}, false
+	}
+	best, bestDeficit := -1, 0.0
+	for i, r := range b.roots {
+		if !head.Owns(r) {
+			continue
+		}
+		if deficit := b.share[i]*float64(b.used+1) - float64(b.issued[i]); best < 0 || deficit > bestDeficit {
+			best, bestDeficit = i, deficit
+		}
+	}
+	if best < 0 {
+		return netip.Prefix{}, false
+	}
+	b.issued[best]++
+	b.used++
+	return b.roots[best], true
+}
+
+// budgetSplitPrefix picks the leaf to probe for the initial budget split:
+// the head's Thompson choice among the leaves of the CIDR that is owed the
+// next probe.
+func (e *Engine) budgetSplitPrefix(head *bandit.SearchHead, completed int64) netip.Prefix {
+	root, ok := e.split.next(head, completed)
+	if !ok {
+		return netip.Prefix{}
+	}
+	var leaves []*bandit.ArmNode
+	for _, node := range e.tree.LeafNodes() {
+		if root.Bits() <= node.Prefix.Bits() && root.Contains(node.Prefix.Addr()) {
+			leaves = append(leaves, node)
+		}
+	}
+	if best, _ := head.Sampler.SelectBest(leaves); best != nil {
+		return best.Prefix
+	}
+	return root
+}
@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// DefaultCalibrationIPs are well-known anycast addresses that answer
+// /cdn-cgi/trace with the SNI/Host CalibrationHost.
+var DefaultCalibrationIPs = []netip.Addr{
+	netip.MustParseAddr("1.1.1.1"),
+	netip.MustParseAddr("1.0.0.1"),
+}
+
+// CalibrationHost is the SNI/Host used with DefaultCalibrationIPs.
+const CalibrationHost = "one.one.one.one"
+
+// Calibration is the outcome of a calibration burst.
+type Calibration struct {
+	Concurrency  int     `json:"concurrency"`
+	ProbesPerSec float64 `json:"probes_per_sec"`
+	BaselineMS   float64 `json:"baseline_ms"` // median latency at the lowest level
+	JitterMS     float64 `json:"jitter_ms"`   // latency stddev at the lowest level
+	SuccessRate  float64 `json:"success_rate"`
+}
+
+// calibrationLevel is the measurement at one concurrency level.
+type calibrationLevel struct {
+	concurrency int
+	perSec      float64
+	success     float64
+	medianMS    float64
+	stdMS       float64
+}
+
+// Calibrate runs short bursts at doubling concurrency against ips to
+// estimate the achievable probe rate and the baseline latency of this
+// uplink. It stops at the first level where the success rate drops below
+// 90% of the baseline, the median latency grows by more than 50%, or the
+// throughput stops improving by at least 10%, and recommends the last
+// good level (capped at maxConcurrency).
+func Calibrate(ctx context.Context, backend probe.Backend, timeout time.Duration, ips []netip.Addr, maxConcurrency int) (Calibration, error) {
+	if len(ips) == 0 {
+		return Calibration{}, errors.New("calibration needs at least one IP")
+	}
+	if maxConcurrency <= 0 {
+		maxConcurrency = 1
+	}
+
+	var base, best calibrationLevel
+	for c := 8; ; c *= 2 {
+		if c > maxConcurrency {
+			c = maxConcurrency
+		}
+		lvl, err := runCalibrationLevel(ctx, backend, timeout, ips, c)
+		if err != nil {
+			return Calibration{}, err
+		}
+
+		if base.concurrency == 0 {
+			if lvl.success == 0 {
+				return Calibration{}, errors.New("calibration failed: no successful probes")
+			}
+			base, best = lvl, lvl
+		} else {
+			if lvl.success < base.success*0.9 ||
+				lvl.medianMS > base.medianMS*1.5 ||
+				lvl.perSec < best.perSec*1.1 {
+				break
+			}
+			best = lvl
+		}
+		if c >= maxConcurrency {
+			break
+		}
+	}
+
+	return Calibration{
+		Concurrency:  best.concurrency,
+		ProbesPerSec: best.perSec,
+		BaselineMS:   base.medianMS,
+		JitterMS:     base.stdMS,
+		SuccessRate:  base.success,
+	}, nil
+}
+
+// runCalibrationLevel probes ips round-robin with the given concurrency.
+func runCalibrationLevel(ctx context.Context, backend probe.Backend, timeout time.Duration, ips []netip.Addr, concurrency int) (calibrationLevel, error) {
+	n := concurrency * 2
+	if n < 16 {
+		n = 16
+	}
+
+	var (
+		mu  sync.Mutex
+		lat []float64
+		ok  int
+		wg  sync.WaitGroup
+	)
+	jobs := make(chan netip.Addr)
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range jobs {
+				pctx, cancel := context.WithTimeout(ctx, timeout)
+				res := backend.Probe(pctx, ip)
+				cancel()
+				if res.OK {
+					mu.Lock()
+					ok++
+					lat = append(lat, float64(res.TotalMS))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- ips[i%len(ips)]:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return calibrationLevel{}, err
+	}
+
+	elapsed := time.Since(start).Seconds()
+	lvl := calibrationLevel{
+		concurrency: concurrency,
+		success:     float64(ok) / float64(n),
+	}
+	if elapsed > 0 {
+		lvl.perSec = float64(n) / elapsed
+	}
+	if len(lat) > 0 {
+		sort.Float64s(lat)
+		lvl.medianMS = lat[len(lat)/2]
+		_, lvl.stdMS = meanStd(lat)
+	}
+	return lvl, nil
+}
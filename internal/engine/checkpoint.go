@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// checkpointVersion is the format version of checkpoint files.
+const checkpointVersion = 1
+
+// checkpoint is the serialized state of a search run (Request.Checkpoint).
+//
+// math/rand generators cannot be serialized, so instead of the RNG state
+// the checkpoint records the seed; a resumed run reseeds its heads with
+// Seed+Completed, which is deterministic for a given checkpoint.
+type checkpoint struct {
+	Version   int             `json:"version"`
+	Seed      int64           `json:"seed"`
+	Budget    int             `json:"budget"`
+	Completed int64           `json:"completed"`
+	Top       []TopResult     `json:"top"`
+	Seen      []netip.Addr    `json:"seen"`
+	Bloom     []uint64        `json:"bloom,omitempty"`
+	Tree      json.RawMessage `json:"tree"`
+}
+
+// readCheckpoint decodes a checkpoint written by writeCheckpoint.
+func readCheckpoint(r io.Reader) (*checkpoint, error) {
+	var cp checkpoint
+	if err := json.NewDecoder(r).Decode(&cp); err != nil {
+		return nil, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d", cp.Version)
+	}
+	return &cp, nil
+}
+
+// restore loads the checkpointed tree, top results and probed IPs and
+// continues the budget where the checkpointed run stopped.
+func (e *Engine) restore(cp *checkpoint) error {
+	if len(cp.Tree) > 0 {
+		if _, err := e.tree.Load(bytes.NewReader(cp.Tree)); err != nil {
+			return err
+		}
+	}
+	for _, r := range cp.Top {
+		e.topN.Consider(r)
+	}
+	for _, ip := range cp.Seen {
+		e.seen.exact[ip] = struct{}{}
+	}
+	if len(cp.Bloom) > 0 {
+		e.seen.bloom.bits = cp.Bloom
+	}
+	atomic.StoreInt64(&e.completed, cp.Completed)
+	atomic.StoreInt64(&e.submitted, cp.Completed)
+	return nil
+}
+
+// writeCheckpoint atomically replaces path with the current search state.
+// It must be called from the scheduling loop (or after it has finished).
+func (e *Engine) writeCheckpoint(path string) error {
+	cp := checkpoint{
+		Version:   checkpointVersion,
+		Seed:      e.cfg.Seed,
+		Budget:    e.cfg.Budget,
+		Completed: atomic.LoadInt64(&e.completed),
+		Top:       e.topN.Snapshot(),
+	}
+	e.seen.mu.Lock()
+	for ip := range e.seen.exact {
+		cp.Seen = append(cp.Seen, ip)
+	}
+	cp.Bloom = append([]uint64(nil), e.seen.bloom.bits...)
+	e.seen.mu.Unlock()
+	var tree bytes.Buffer
+	if err := e.tree.Save(&tree); err != nil {
+		return err
+	}
+	cp.Tree = bytes.TrimSpace(tree.Bytes())
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(cp); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
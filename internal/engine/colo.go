@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// rejectedColo is the error of successful probes outside Config.RequireColo.
+const rejectedColo = "rejected_colo"
+
+// checkColo fails a successful result whose trace colo is not in
+// Config.RequireColo (results without a colo are rejected too).
+func (e *Engine) checkColo(r *probe.Result) {
+	if !r.OK || len(e.cfg.RequireColo) == 0 {
+		return
+	}
+	if !hasColo(e.cfg.RequireColo, r.Trace["colo"]) {
+		r.OK = false
+		r.Error = rejectedColo
+	}
+}
+
+// resultLatency is the Scorer latency of r, reduced by Config.ColoBonus
+// when r landed on a Config.PreferColo colo.
+func (e *Engine) resultLatency(r probe.Result) float64 {
+	latency := e.cfg.Scorer.LatencyMS(r)
+	if len(e.cfg.PreferColo) > 0 && hasColo(e.cfg.PreferColo, r.Trace["colo"]) {
+		latency *= 1 - max(e.cfg.ColoBonus, 0)
+	}
+	return latency
+}
+
+// hasColo reports whether colo is one of colos (case-insensitive).
+func hasColo(colos []string, colo string) bool {
+	if colo == "" {
+		return false
+	}
+	for _, c := range colos {
+		if strings.EqualFold(c, colo) {
+			return true
+		}
+	}
+	return false
+}
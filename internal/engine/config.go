@@ -3,56 +3,174 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"net/netip"
 	"time"
 
 	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/bandit"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/geoip"
 	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
 )
 
 // Config holds all configuration for the search engine.
 type Config struct {
 	// Budget is the total number of probes to perform.
-	Budget int
+	Budget int `json:"budget"`
 
 	// TopN is the number of top results to keep.
-	TopN int
+	TopN int `json:"top_n"`
 
 	// Concurrency is the number of parallel probe workers.
-	Concurrency int
+	Concurrency int `json:"concurrency"`
 
 	// Heads is the number of search heads for diversity.
-	Heads int
+	Heads int `json:"heads"`
 
 	// Beam is the width of the beam search per head.
-	Beam int
+	Beam int `json:"beam"`
 
 	// SplitStepV4 is the prefix bits to add when splitting IPv4.
-	SplitStepV4 int
+	SplitStepV4 int `json:"split_step_v4"`
 
 	// SplitStepV6 is the prefix bits to add when splitting IPv6.
-	SplitStepV6 int
+	SplitStepV6 int `json:"split_step_v6"`
 
 	// MinSamplesSplit is the minimum samples before a prefix can be split.
-	MinSamplesSplit int
+	MinSamplesSplit int `json:"min_samples_split"`
 
 	// MaxBitsV4 is the maximum prefix length for IPv4 drill-down.
-	MaxBitsV4 int
+	MaxBitsV4 int `json:"max_bits_v4"`
 
 	// MaxBitsV6 is the maximum prefix length for IPv6 drill-down.
-	MaxBitsV6 int
+	MaxBitsV6 int `json:"max_bits_v6"`
 
 	// Seed is the random seed (0 = time-based).
-	Seed int64
+	Seed int64 `json:"seed"`
 
 	// Verbose enables progress output to stderr.
-	Verbose bool
+	Verbose bool `json:"verbose"`
 
 	// SplitInterval is how often to check for split opportunities (by samples).
-	SplitInterval int
+	SplitInterval int `json:"split_interval"`
+
+	// VariancePenalty adds this many standard deviations of a prefix's
+	// latency to its mean in selection and split decisions (0 = off).
+	VariancePenalty float64 `json:"variance_penalty"`
 
 	// DiversityWeight controls how much diversity affects arm selection (0-1).
-	DiversityWeight float64
+	DiversityWeight float64 `json:"diversity_weight"`
+
+	// HeadAffinity pins heads to disjoint subsets of the input CIDRs
+	// ("none", "round-robin" or "weight").
+	HeadAffinity string `json:"head_affinity"`
+
+	// SharedStats makes heads rank prefixes from one shared posterior draw
+	// per round (plus small per-head noise) instead of independent draws.
+	SharedStats bool `json:"shared_stats"`
+
+	// BudgetSplit allocates the first quarter of the budget across the
+	// input CIDRs: "none" (the sampler alone decides), "even", "size"
+	// (by host bits) or "list" (by the weights in the CIDR file).
+	BudgetSplit string `json:"budget_split"`
+
+	// Strategy selects how heads pick prefixes ("thompson" or "anneal").
+	Strategy string `json:"strategy"`
+
+	// AnnealTemp and AnnealMinTemp are the start and end exploration
+	// probabilities (0-1) of the anneal strategy's schedule.
+	AnnealTemp    float64 `json:"anneal_temp"`
+	AnnealMinTemp float64 `json:"anneal_min_temp"`
+
+	// AnnealSchedule is the temperature decay ("exp" or "linear").
+	AnnealSchedule string `json:"anneal_schedule"`
+
+	// AnnealRestart reheats a head (restarts its schedule) after this many
+	// probes without improving its best score (0 = never).
+	AnnealRestart int `json:"anneal_restart"`
+
+	// Hedge launches a second probe when the first is slower than the
+	// recent p95 latency, keeping whichever succeeds first.
+	Hedge bool `json:"hedge"`
+
+	// HedgeBudget caps hedge probes as a fraction of Budget (0-1; negative
+	// allows none).
+	HedgeBudget float64 `json:"hedge_budget"`
+
+	// Deterministic processes probe results in submission order so two runs
+	// with the same Seed probe identical IPs (requires a non-zero Seed; not
+	// combinable with Hedge or ICMPFastFail, which depend on timing).
+	Deterministic bool `json:"deterministic"`
+
+	// ICMPFastFail listens for ICMP destination-unreachable messages and
+	// fails matching in-flight probes immediately (needs raw socket privileges).
+	ICMPFastFail bool `json:"icmp_fast_fail"`
+
+	// MergeSiblings merges the children of a split prefix back when they
+	// are statistically indistinguishable, and stops drilling into it.
+	MergeSiblings bool `json:"merge_siblings"`
+
+	// SweepHosts makes prefixes with at most this many addresses enumerate
+	// every address once instead of sampling at random (0 = always sample).
+	SweepHosts int `json:"sweep_hosts"`
+
+	// VerifySamples is the number of extra probes per top candidate after
+	// the search (0 = no verification round).
+	VerifySamples int `json:"verify_samples"`
+
+	// VerifyMinSuccess drops verified candidates whose success rate is
+	// below this fraction (0 = keep all); with VerifyKeepStale they are
+	// kept, marked Stale, after the others.
+	VerifyMinSuccess float64 `json:"verify_min_success"`
+	VerifyKeepStale  bool    `json:"verify_keep_stale"`
+
+	// ReliabilityWeight controls how strongly verified reliability affects
+	// the final ranking (0-1; negative ranks by latency alone).
+	ReliabilityWeight float64 `json:"reliability_weight"`
+
+	// RequireASN and RequireCountry reject probes to addresses outside the
+	// given ASNs/countries during the search (requires Request.GeoIP).
+	RequireASN     []uint   `json:"require_asn"`
+	RequireCountry []string `json:"require_country"`
+
+	// ColoTopN keeps a separate top list of this size for every colo seen
+	// in successful probes (Response.ByColo; 0 = off).
+	ColoTopN int `json:"colo_top_n"`
+
+	// PreferColo discounts the latency of probes that land on these colos
+	// (trace "colo") by ColoBonus (0-1; negative for no discount);
+	// RequireColo fails probes landing anywhere else with "rejected_colo".
+	PreferColo  []string `json:"prefer_colo"`
+	RequireColo []string `json:"require_colo"`
+	ColoBonus   float64  `json:"colo_bonus"`
+
+	// FailureReport collects failed probes grouped by MaxBitsV4/MaxBitsV6
+	// prefixes into Response.Failures.
+	FailureReport bool `json:"failure_report"`
+
+	// LatencyReport records the latency of every probe into
+	// Response.Latency (histogram and per-prefix percentiles).
+	LatencyReport bool `json:"latency_report"`
+
+	// PrefixReport summarizes every explored prefix of the search tree
+	// into Response.Prefixes.
+	PrefixReport bool `json:"prefix_report"`
+
+	// BaselineMS is subtracted from successful latencies when scoring
+	// (see Calibrate), making scores comparable across uplinks.
+	BaselineMS float64 `json:"baseline_ms"`
+
+	// Explain attaches a ScoreExplain to every top result.
+	Explain bool `json:"explain"`
+
+	// Scorer defines the latency a successful probe is scored by
+	// (nil = TotalScorer).
+	Scorer Scorer `json:"scorer"`
+
+	// Objective weights the latency, tail latency, loss and bandwidth
+	// components of the score (zero value = DefaultObjective).
+	Objective Objective `json:"objective"`
 }
 
 // Request holds the input for a search run.
@@ -63,8 +181,57 @@ type Request struct {
 	// CIDRFile is a path to a file containing CIDRs.
 	CIDRFile string
 
+	// IPs, if set, are probed once each instead of searching the CIDRs;
+	// every result is reported (Config.Budget and TopN are ignored).
+	IPs []netip.Addr
+
 	// Probe is the probe configuration.
 	Probe probe.Config
+
+	// Backend, if set, makes the probes (and hedges) instead of a backend
+	// built from Probe; Probe.Timeout still bounds every probe.
+	Backend probe.Backend
+
+	// GeoIP is an optional country/ASN database used for annotation and
+	// for enforcing RequireASN/RequireCountry.
+	GeoIP *geoip.DB
+
+	// ProbeLog, if set, receives every probe result as a JSON line.
+	ProbeLog io.Writer
+
+	// OnProbe, if set, is called with every probe result, and OnTopChange
+	// with the new top results (best first) whenever the search changes
+	// them (verification at the end is reported only in the Response).
+	// Both run on the scheduling goroutine and must return quickly.
+	OnProbe     func(ProbeResult)
+	OnTopChange func([]TopResult)
+
+	// OnProgress, if set, is called with the search progress at most every
+	// progressInterval, on the scheduling goroutine like OnProbe.
+	OnProgress func(Progress)
+
+	// Tree, if set, is a search tree saved by a previous run (ArmTree.Save)
+	// to continue refining instead of starting cold.
+	Tree io.Reader
+
+	// ExcludeCIDRs and ExcludeFile list prefixes whose addresses are never
+	// probed, even inside the searched CIDRs.
+	ExcludeCIDRs []string
+	ExcludeFile  string
+
+	// WarmStart, if set, is a previous run's jsonl output (or probe log)
+	// whose results seed the prefix statistics and the first probes.
+	WarmStart io.Reader
+
+	// Checkpoint, if set, is a file the full search state (tree, top
+	// results, probed IPs, progress) is written to every
+	// CheckpointInterval and when the run ends or is interrupted.
+	Checkpoint         string
+	CheckpointInterval time.Duration
+
+	// Resume, if set, is a checkpoint to continue; the run spends only the
+	// part of Config.Budget the checkpointed run had not used yet.
+	Resume io.Reader
 }
 
 // DefaultConfig returns a configuration with sensible defaults.
@@ -84,9 +251,32 @@ func DefaultConfig() Config {
 		Verbose:         false,
 		SplitInterval:   20, // Check more frequently
 		DiversityWeight: 0.3,
+		HeadAffinity:    bandit.AffinityNone,
+		BudgetSplit:     BudgetSplitNone,
+		Strategy:        bandit.StrategyThompson,
+		AnnealTemp:      0.5,
+		AnnealMinTemp:   0.02,
+		AnnealSchedule:  bandit.ScheduleExp,
+		HedgeBudget:     0.1,
+		SweepHosts:      256,
+		MergeSiblings:   true,
+
+		ReliabilityWeight: 0.5,
+		ColoBonus:         0.3,
 	}
 }
 
+// ErrInvalidConfig matches (errors.Is) the errors of Run caused by its
+// settings rather than by the run: Validate errors, unusable CIDRs and
+// unsatisfiable constraints.
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// configError marks err as an ErrInvalidConfig, keeping its message.
+type configError struct{ error }
+
+func (e configError) Is(target error) bool { return target == ErrInvalidConfig }
+func (e configError) Unwrap() error        { return e.error }
+
 // Validate validates the configuration and returns an error if invalid.
 func (c *Config) Validate() error {
 	if c.Budget <= 0 {
@@ -122,10 +312,84 @@ func (c *Config) Validate() error {
 	if c.DiversityWeight < 0 || c.DiversityWeight > 1 {
 		return fmt.Errorf("diversityWeight must be in [0,1], got %f", c.DiversityWeight)
 	}
+	if c.HedgeBudget < 0 || c.HedgeBudget > 1 {
+		return fmt.Errorf("hedgeBudget must be in [0,1], got %f", c.HedgeBudget)
+	}
+	if c.Deterministic {
+		if c.Seed == 0 {
+			return fmt.Errorf("deterministic mode requires a non-zero seed")
+		}
+		if c.Hedge || c.ICMPFastFail {
+			return fmt.Errorf("deterministic mode cannot be combined with hedge or icmpFastFail")
+		}
+	}
+	if c.VariancePenalty < 0 {
+		return fmt.Errorf("variancePenalty must be >= 0, got %f", c.VariancePenalty)
+	}
+	if c.BaselineMS < 0 {
+		return fmt.Errorf("baselineMS must be >= 0, got %f", c.BaselineMS)
+	}
+	if c.VerifySamples < 0 {
+		return fmt.Errorf("verifySamples must be >= 0, got %d", c.VerifySamples)
+	}
+	if c.ColoTopN < 0 {
+		return fmt.Errorf("coloTopN must be >= 0, got %d", c.ColoTopN)
+	}
+	if c.ColoBonus < 0 || c.ColoBonus >= 1 {
+		return fmt.Errorf("coloBonus must be in [0,1), got %f", c.ColoBonus)
+	}
+	if c.SweepHosts < 0 {
+		return fmt.Errorf("sweepHosts must be >= 0, got %d", c.SweepHosts)
+	}
+	if c.VerifyMinSuccess < 0 || c.VerifyMinSuccess > 1 {
+		return fmt.Errorf("verifyMinSuccess must be in [0,1], got %f", c.VerifyMinSuccess)
+	}
+	if c.ReliabilityWeight < 0 || c.ReliabilityWeight > 1 {
+		return fmt.Errorf("reliabilityWeight must be in [0,1], got %f", c.ReliabilityWeight)
+	}
+	switch c.HeadAffinity {
+	case bandit.AffinityNone, bandit.AffinityRoundRobin, bandit.AffinityWeight:
+	default:
+		return fmt.Errorf("headAffinity must be none|round-robin|weight, got %q", c.HeadAffinity)
+	}
+	if w, ok := c.Scorer.(PhaseWeights); ok {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.Objective.Validate(); err != nil {
+		return err
+	}
+	switch c.BudgetSplit {
+	case BudgetSplitNone, BudgetSplitEven, BudgetSplitSize, BudgetSplitList:
+	default:
+		return fmt.Errorf("budgetSplit must be none|even|size|list, got %q", c.BudgetSplit)
+	}
+	switch c.Strategy {
+	case bandit.StrategyThompson, bandit.StrategyAnneal:
+	default:
+		return fmt.Errorf("strategy must be thompson|anneal, got %q", c.Strategy)
+	}
+	switch c.AnnealSchedule {
+	case bandit.ScheduleExp, bandit.ScheduleLinear:
+	default:
+		return fmt.Errorf("annealSchedule must be exp|linear, got %q", c.AnnealSchedule)
+	}
+	if c.AnnealTemp < 0 || c.AnnealTemp > 1 {
+		return fmt.Errorf("annealTemp must be in [0,1], got %f", c.AnnealTemp)
+	}
+	if c.AnnealMinTemp < 0 || c.AnnealMinTemp > c.AnnealTemp {
+		return fmt.Errorf("annealMinTemp must be in [0,annealTemp], got %f", c.AnnealMinTemp)
+	}
+	if c.AnnealRestart < 0 {
+		return fmt.Errorf("annealRestart must be >= 0, got %d", c.AnnealRestart)
+	}
 	return nil
 }
 
-// ApplyDefaults fills in zero values with defaults.
+// ApplyDefaults fills in zero values with defaults. Fractions that can be
+// turned off (HedgeBudget, ReliabilityWeight, ColoBonus) take a negative
+// value for that, since 0 gets the default.
 func (c *Config) ApplyDefaults() {
 	defaults := DefaultConfig()
 
@@ -165,6 +429,41 @@ func (c *Config) ApplyDefaults() {
 	if c.DiversityWeight <= 0 {
 		c.DiversityWeight = defaults.DiversityWeight
 	}
+	if c.HeadAffinity == "" {
+		c.HeadAffinity = defaults.HeadAffinity
+	}
+	if c.Scorer == nil {
+		c.Scorer = TotalScorer{}
+	}
+	if c.Objective == (Objective{}) {
+		c.Objective = DefaultObjective()
+	}
+	if c.BudgetSplit == "" {
+		c.BudgetSplit = defaults.BudgetSplit
+	}
+	if c.Strategy == "" {
+		c.Strategy = defaults.Strategy
+	}
+	if c.AnnealTemp <= 0 {
+		c.AnnealTemp = defaults.AnnealTemp
+	}
+	if c.AnnealSchedule == "" {
+		c.AnnealSchedule = defaults.AnnealSchedule
+	}
+	if c.HedgeBudget == 0 {
+		c.HedgeBudget = defaults.HedgeBudget
+	}
+	if c.ReliabilityWeight == 0 {
+		c.ReliabilityWeight = defaults.ReliabilityWeight
+	}
+	if c.ColoBonus == 0 {
+		c.ColoBonus = defaults.ColoBonus
+	}
+}
+
+// Constraints returns the ASN/country constraints as a geoip.Constraints.
+func (c *Config) Constraints() geoip.Constraints {
+	return geoip.Constraints{ASNs: c.RequireASN, Countries: c.RequireCountry}
 }
 
 // ToTreeConfig converts to bandit.TreeConfig.
@@ -175,6 +474,8 @@ func (c *Config) ToTreeConfig() bandit.TreeConfig {
 		MaxBitsV4:   c.MaxBitsV4,
 		MaxBitsV6:   c.MaxBitsV6,
 		MinSamples:  c.MinSamplesSplit,
+
+		VariancePenalty: c.VariancePenalty,
 	}
 }
 
@@ -187,6 +488,8 @@ func (c *Config) ToHeadManagerConfig(timeoutMS float64) bandit.HeadManagerConfig
 		HistorySize:     c.Beam,
 		DiversityWeight: c.DiversityWeight,
 		RepulsionDecay:  0.5,
+		VariancePenalty: c.VariancePenalty,
+		SharedStats:     c.SharedStats,
 	}
 }
 
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"hash/fnv"
+	"net/netip"
+	"sync"
+)
+
+// exactHostBits is the largest prefix (in host bits) whose sampled
+// addresses are tracked exactly; addresses drawn from bigger prefixes go
+// into the Bloom filter.
+const exactHostBits = 16
+
+// scanHostBits is the largest prefix (in host bits) that is scanned for a
+// remaining unprobed address once random draws keep hitting probed ones.
+const scanHostBits = 12
+
+// seenSet tracks the addresses probed in a run so no address is probed
+// twice. Addresses from small prefixes are kept exactly, so a small range
+// can be used up without repeats; those from huge prefixes go into a
+// Bloom filter, whose rare false positives only skip an unprobed address.
+type seenSet struct {
+	mu    sync.Mutex
+	exact map[netip.Addr]struct{}
+	bloom *bloomFilter
+}
+
+// newSeenSet sizes the Bloom filter for budget addresses.
+func newSeenSet(budget int) *seenSet {
+	return &seenSet{
+		exact: make(map[netip.Addr]struct{}),
+		bloom: newBloomFilter(budget),
+	}
+}
+
+// has reports whether ip was (probably) probed already.
+func (s *seenSet) has(ip netip.Addr) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hasLocked(ip)
+}
+
+func (s *seenSet) hasLocked(ip netip.Addr) bool {
+	if _, ok := s.exact[ip]; ok {
+		return true
+	}
+	return s.bloom.has(ip)
+}
+
+// claim records ip, sampled from a prefix with hostBits host bits, and
+// reports whether it was new.
+func (s *seenSet) claim(ip netip.Addr, hostBits int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hasLocked(ip) {
+		return false
+	}
+	if hostBits <= exactHostBits {
+		s.exact[ip] = struct{}{}
+	} else {
+		s.bloom.add(ip)
+	}
+	return true
+}
+
+// bloomFilter is a fixed-size Bloom filter over addresses with k hashes
+// derived from one FNV-1a hash (double hashing), so it is deterministic.
+type bloomFilter struct {
+	bits []uint64
+	k    int
+}
+
+// newBloomFilter sizes the filter at 16 bits per expected address
+// (about 0.05% false positives when full).
+func newBloomFilter(n int) *bloomFilter {
+	words := max(n*16/64, 1024)
+	return &bloomFilter{bits: make([]uint64, words), k: 8}
+}
+
+func (b *bloomFilter) positions(ip netip.Addr, fn func(word int, mask uint64) bool) bool {
+	a := ip.As16()
+	h := fnv.New64a()
+	_, _ = h.Write(a[:])
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	m := uint64(len(b.bits)) * 64
+	for i := 0; i < b.k; i++ {
+		pos := (h1 + uint64(i)*h2) % m
+		if !fn(int(pos/64), 1<<(pos%64)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloomFilter) add(ip netip.Addr) {
+	b.positions(ip, func(word int, mask uint64) bool {
+		b.bits[word] |= mask
+		return true
+	})
+}
+
+func (b *bloomFilter) has(ip netip.Addr) bool {
+	return b.positions(ip, func(word int, mask uint64) bool {
+		return b.bits[word]&mask != 0
+	})
+}
@@ -2,8 +2,10 @@ package engine
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/netip"
 	"os"
 	"sync"
@@ -12,6 +14,7 @@ import (
 
 	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/bandit"
 	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/cidr"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/geoip"
 	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
 )
 
@@ -20,10 +23,17 @@ type Engine struct {
 	cfg      Config
 	probeCfg probe.Config
 
+	// Probe backends (hedgeBackend is nil unless hedging is enabled)
+	backend      probe.Backend
+	hedgeBackend probe.Backend
+
 	tree        *bandit.ArmTree
 	headManager *bandit.HeadManager
 	topN        *TopNCollector
 
+	// Per-colo top results (nil unless Config.ColoTopN > 0)
+	coloTop map[string]*TopNCollector
+
 	// Worker coordination
 	tasks chan probeTask
 	done  chan probeDone
@@ -31,20 +41,87 @@ type Engine struct {
 	// Statistics
 	submitted int64
 	completed int64
+	hedges    int64
+
+	// Probes processed in this run, how many succeeded, and the failures
+	// by error kind (probe.ErrorKind)
+	probed     int64
+	succeeded  int64
+	errorKinds map[string]int
+
+	// Addresses rejected by the ASN/country constraints, and how many of
+	// them were not charged to the budget (see freeRejections)
+	rejected  int64
+	uncharged int64
+
+	// Recent successful latencies (for hedging)
+	latencies *latencyWindow
+
+	// ICMP unreachable listener (nil when disabled or unprivileged)
+	unreachable *probe.UnreachableWatcher
+
+	// GeoIP annotation and in-loop constraints
+	geo         *geoip.DB
+	constraints geoip.Constraints
+
+	// Failed-probe report (nil when disabled)
+	failures *failureCollector
+
+	// Latency report (nil when disabled)
+	latency *latencyCollector
+
+	// Successful latencies by probed prefix (nil unless Config.PrefixReport)
+	prefixLatency prefixLatencyLog
+
+	// Probe log (nil when disabled); first write error is reported by Run
+	probeLog    *json.Encoder
+	probeLogErr error
+
+	// Live event callbacks (Request.OnProbe, OnTopChange, OnProgress)
+	onProbe     func(ProbeResult)
+	onTopChange func([]TopResult)
+	onProgress  func(Progress)
+
+	// Warm-start prefixes still to probe, best first
+	warm []netip.Prefix
+
+	// Anneal strategy state (nil unless Config.Strategy is anneal)
+	anneal *annealState
 
-	// Deduplication using atomic map
-	seenIPs sync.Map
+	// Initial budget split across input CIDRs (nil for BudgetSplitNone)
+	split *budgetSplit
+
+	// Excluded prefixes (never probed)
+	exclude cidr.Exclusion
+
+	// Addresses probed so far
+	seen *seenSet
+
+	// Sweep state of small prefixes (Config.SweepHosts)
+	sweeps map[netip.Prefix]*sweep
 }
 
+// unreachablePenalty is the extra pseudo-failure weight applied to a
+// prefix when a probe into it is rejected with ICMP unreachable.
+const unreachablePenalty = 1.0
+
+// freeRejections is how many constraint rejections per unit of budget are
+// not charged to it; past that they count like probes, so a search space
+// entirely outside the constraints still ends.
+const freeRejections = 10
+
 type probeTask struct {
+	seq    int64 // submission order
 	headID int
 	prefix netip.Prefix
 	ip     netip.Addr
 }
 
 type probeDone struct {
-	task   probeTask
-	result probe.Result
+	task     probeTask
+	result   probe.Result
+	geo      geoip.Info
+	rejected bool // by the ASN/country constraints, without a probe
 }
 
 // New creates a new search engine.
@@ -58,30 +135,140 @@ func New(cfg Config, probeCfg probe.Config) *Engine {
 
 // Run executes the search with the given CIDRs.
 func (e *Engine) Run(ctx context.Context, req Request) (Response, error) {
+	started := time.Now()
 	if err := e.cfg.Validate(); err != nil {
-		return Response{}, err
+		return Response{}, configError{err}
 	}
 
 	// Load prefixes
-	prefixes, err := loadPrefixes(req)
+	prefixes, weights, exclude, _, err := inputPrefixes(req)
 	if err != nil {
-		return Response{}, err
+		return Response{}, configError{err}
 	}
-	if len(prefixes) == 0 {
-		return Response{}, errors.New("no CIDR provided (use --cidr or --cidr-file)")
+	e.exclude = exclude
+
+	if len(req.IPs) > 0 {
+		// Every listed address is probed once and reported
+		e.cfg.Budget, e.cfg.TopN = len(prefixes), len(prefixes)
+	}
+
+	e.geo = req.GeoIP
+	if req.ProbeLog != nil {
+		e.probeLog = json.NewEncoder(req.ProbeLog)
+	}
+	e.onProbe, e.onTopChange, e.onProgress = req.OnProbe, req.OnTopChange, req.OnProgress
+	if e.cfg.FailureReport {
+		e.failures = newFailureCollector(e.cfg.MaxBitsV4, e.cfg.MaxBitsV6)
+	}
+	if e.cfg.LatencyReport {
+		e.latency = newLatencyCollector(e.cfg.MaxBitsV4, e.cfg.MaxBitsV6)
+	}
+	if e.cfg.PrefixReport {
+		e.prefixLatency = make(prefixLatencyLog)
+	}
+	e.constraints = e.cfg.Constraints()
+	if !e.constraints.Empty() && e.geo == nil {
+		return Response{}, configError{errors.New("ASN/country constraints require a GeoIP database (use --geoip-db/--asn-db)")}
+	}
+
+	var cp *checkpoint
+	if req.Resume != nil {
+		if cp, err = readCheckpoint(req.Resume); err != nil {
+			return Response{}, err
+		}
+		if e.cfg.Seed == 0 {
+			e.cfg.Seed = cp.Seed
+		}
 	}
 
 	// Initialize seed
-	seed := e.cfg.Seed
-	if seed == 0 {
-		seed = time.Now().UnixNano()
+	if e.cfg.Seed == 0 {
+		e.cfg.Seed = time.Now().UnixNano()
+	}
+
+	if req.Backend != nil {
+		e.backend = req.Backend
+		if e.cfg.Hedge {
+			e.hedgeBackend = req.Backend
+		}
+	} else {
+		if e.backend, err = probe.NewBackend(req.Probe); err != nil {
+			return Response{}, err
+		}
+		defer closeBackend(e.backend)
+		if e.cfg.Hedge {
+			// A separate instance so hedges never queue behind the primary
+			// probe's connection.
+			if e.hedgeBackend, err = probe.NewBackend(req.Probe); err != nil {
+				return Response{}, err
+			}
+			defer closeBackend(e.hedgeBackend)
+		}
 	}
 
 	// Initialize components
 	timeoutMS := req.TimeoutMS()
-	e.tree = bandit.NewArmTree(prefixes, e.cfg.ToTreeConfig())
-	e.headManager = bandit.NewHeadManager(e.cfg.ToHeadManagerConfig(timeoutMS))
+	treeCfg := e.cfg.ToTreeConfig()
+	treeCfg.Exclude = e.exclude
+	e.tree = bandit.NewArmTree(prefixes, treeCfg)
+	if req.Tree != nil {
+		n, err := e.tree.Load(req.Tree)
+		if err != nil {
+			return Response{}, fmt.Errorf("load tree: %w", err)
+		}
+		if e.cfg.Verbose {
+			fmt.Fprintf(os.Stderr, "tree: restored %d nodes\n", n)
+		}
+	}
+	hmCfg := e.cfg.ToHeadManagerConfig(timeoutMS)
+	if cp != nil {
+		hmCfg.BaseSeed += cp.Completed
+	}
+	e.headManager = bandit.NewHeadManager(hmCfg)
+	if e.cfg.HeadAffinity != bandit.AffinityNone {
+		e.headManager.AssignRoots(bandit.AssignRoots(prefixes, e.cfg.Heads, e.cfg.HeadAffinity))
+	}
 	e.topN = NewTopNCollector(e.cfg.TopN)
+	e.seen = newSeenSet(e.cfg.Budget)
+	e.sweeps = make(map[netip.Prefix]*sweep)
+	if e.cfg.ColoTopN > 0 {
+		e.coloTop = make(map[string]*TopNCollector)
+	}
+	e.split = newBudgetSplit(e.cfg.BudgetSplit, prefixes, weights, e.cfg.Budget)
+	if e.cfg.Strategy == bandit.StrategyAnneal {
+		e.anneal = newAnnealState(e.cfg.Heads)
+	}
+	if req.WarmStart != nil {
+		n, err := e.warmStart(req.WarmStart, timeoutMS)
+		if err != nil {
+			return Response{}, fmt.Errorf("warm start: %w", err)
+		}
+		if e.cfg.Verbose {
+			fmt.Fprintf(os.Stderr, "warm start: %d results, %d prefixes queued\n", n, len(e.warm))
+		}
+	}
+	if cp != nil {
+		if err := e.restore(cp); err != nil {
+			return Response{}, fmt.Errorf("resume: %w", err)
+		}
+		if e.cfg.Verbose {
+			fmt.Fprintf(os.Stderr, "resume: %d/%d probes already done\n", cp.Completed, e.cfg.Budget)
+		}
+	}
+	if e.cfg.Hedge {
+		e.latencies = newLatencyWindow(hedgeWindowSize)
+	}
+	if e.cfg.ICMPFastFail {
+		w, err := probe.ListenUnreachable()
+		if err != nil {
+			if e.cfg.Verbose {
+				fmt.Fprintf(os.Stderr, "icmp: fast-fail disabled: %v\n", err)
+			}
+		} else {
+			e.unreachable = w
+			defer func() { _ = w.Close() }()
+		}
+	}
 
 	// Initialize channels
 	e.tasks = make(chan probeTask, e.cfg.Concurrency*2)
@@ -95,7 +282,11 @@ func (e *Engine) Run(ctx context.Context, req Request) (Response, error) {
 	}
 
 	// Run main event-driven scheduling loop
-	err = e.schedule(ctx, timeoutMS)
+	if len(req.IPs) > 0 {
+		err = e.measure(ctx, timeoutMS, prefixes)
+	} else {
+		err = e.schedule(ctx, timeoutMS, req)
+	}
 
 	// Cleanup
 	close(e.tasks)
@@ -104,26 +295,87 @@ func (e *Engine) Run(ctx context.Context, req Request) (Response, error) {
 
 	// Drain any remaining results
 	for d := range e.done {
-		e.processOneResult(d, timeoutMS)
+		e.process(d, timeoutMS)
+	}
+	if req.Checkpoint != "" {
+		if cerr := e.writeCheckpoint(req.Checkpoint); cerr != nil {
+			return Response{}, fmt.Errorf("checkpoint: %w", cerr)
+		}
 	}
 
 	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
 		return Response{}, err
 	}
+	if e.probeLogErr != nil {
+		return Response{}, fmt.Errorf("probe log: %w", e.probeLogErr)
+	}
+
+	top := e.topN.Snapshot()
+	if err == nil {
+		top, err = e.verifyTop(ctx, top, req.Probe, timeoutMS)
+	}
 
-	return Response{Top: e.topN.Snapshot()}, nil
+	elapsed := time.Since(started)
+	resp := Response{
+		Top:    top,
+		Tree:   e.tree,
+		Config: e.cfg,
+		Probe:  summarizeProbe(req.Probe),
+		Stats: RunStats{
+			Started:          started,
+			DurationMS:       elapsed.Milliseconds(),
+			Probes:           e.probed,
+			Successes:        e.succeeded,
+			Failures:         e.probed - e.succeeded,
+			Errors:           e.errorKinds,
+			Hedges:           atomic.LoadInt64(&e.hedges),
+			Rejected:         e.rejected,
+			TreeNodes:        e.tree.Size(),
+			PrefixesExplored: e.tree.SampledNodes(),
+			Partial:          err != nil,
+		},
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		resp.Stats.ProbesPerSec = float64(e.probed) / secs
+	}
+	if e.failures != nil {
+		resp.Failures = e.failures.Groups()
+	}
+	if e.latency != nil {
+		resp.Latency = e.latency.Report()
+	}
+	if e.prefixLatency != nil {
+		resp.Prefixes = e.prefixReport(timeoutMS)
+	}
+	if e.coloTop != nil {
+		resp.ByColo = make(map[string][]TopResult, len(e.coloTop))
+		for colo, c := range e.coloTop {
+			resp.ByColo[colo] = c.Snapshot()
+		}
+	}
+	return resp, nil
+}
+
+// closeBackend releases what a backend built by Run holds, such as the
+// raw socket and reader goroutine of a Pinger.
+func closeBackend(b probe.Backend) {
+	if c, ok := b.(io.Closer); ok {
+		_ = c.Close()
+	}
 }
 
 // schedule is the main event-driven scheduling loop.
-func (e *Engine) schedule(ctx context.Context, timeoutMS float64) error {
+func (e *Engine) schedule(ctx context.Context, timeoutMS float64, req Request) error {
 	start := time.Now()
 	lastLog := time.Now()
-	lastSplit := int64(0)
+	lastProgress := time.Now()
+	lastCheckpoint := time.Now()
+	lastSplit := atomic.LoadInt64(&e.completed)
 
 	// Initial fill - submit initial batch of tasks
 	initialBatch := e.cfg.Concurrency * 2
-	if initialBatch > e.cfg.Budget {
-		initialBatch = e.cfg.Budget
+	if remaining := e.cfg.Budget - int(lastSplit); initialBatch > remaining {
+		initialBatch = max(remaining, 0)
 	}
 
 	for i := 0; i < initialBatch; i++ {
@@ -135,39 +387,92 @@ func (e *Engine) schedule(ctx context.Context, timeoutMS float64) error {
 		}
 	}
 
+	// In deterministic mode results are processed strictly in submission
+	// order, so every decision sees the same tree state regardless of
+	// probe timing.
+	var pending map[int64]probeDone
+	if e.cfg.Deterministic {
+		pending = make(map[int64]probeDone)
+	}
+	next := lastSplit
+	var ready []probeDone
+
 	// Main event loop - process results and submit new tasks
 	for atomic.LoadInt64(&e.completed) < int64(e.cfg.Budget) {
+		// Nothing in flight: every address has been probed
+		if atomic.LoadInt64(&e.submitted) == atomic.LoadInt64(&e.completed)+e.uncharged {
+			if e.cfg.Verbose {
+				fmt.Fprintf(os.Stderr, "search space exhausted after %d probes\n", atomic.LoadInt64(&e.completed))
+			}
+			return nil
+		}
+
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 
 		case d := <-e.done:
-			// Process the completed probe
-			e.processOneResult(d, timeoutMS)
-			completed := atomic.AddInt64(&e.completed, 1)
-
-			// Check if we need to split - more aggressive splitting
-			if completed-lastSplit >= int64(e.cfg.SplitInterval) {
-				e.trySplit()
-				lastSplit = completed
+			ready = append(ready[:0], d)
+			if pending != nil {
+				pending[d.task.seq] = d
+				ready = ready[:0]
+				for {
+					d, ok := pending[next]
+					if !ok {
+						break
+					}
+					delete(pending, next)
+					ready = append(ready, d)
+					next++
+				}
 			}
 
-			// Submit replacement task if we haven't reached budget
-			submitted := atomic.LoadInt64(&e.submitted)
-			if submitted < int64(e.cfg.Budget) {
-				headID := int(submitted) % e.cfg.Heads
-				if err := e.submitOneTask(ctx, headID); err != nil {
-					// Non-fatal, continue
+			for _, d := range ready {
+				// Process the completed probe; rejections are free up
+				// to freeRejections per unit of budget
+				var completed int64
+				e.process(d, timeoutMS)
+				if d.rejected && e.uncharged < int64(e.cfg.Budget)*freeRejections {
+					e.uncharged++
+					completed = atomic.LoadInt64(&e.completed)
+				} else {
+					completed = atomic.AddInt64(&e.completed, 1)
 				}
-			}
 
-			// Verbose logging
-			if e.cfg.Verbose && time.Since(lastLog) > time.Second {
-				best := e.topN.Best()
-				elapsed := time.Since(start).Truncate(100 * time.Millisecond)
-				fmt.Fprintf(os.Stderr, "progress: %d/%d done, best=%.1fms ip=%s prefix=%s elapsed=%s nodes=%d\n",
-					completed, e.cfg.Budget, best.ScoreMS, best.IP.String(), best.Prefix.String(), elapsed, e.tree.Size())
-				lastLog = time.Now()
+				// Check if we need to split - more aggressive splitting
+				if completed-lastSplit >= int64(e.cfg.SplitInterval) {
+					e.trySplit()
+					lastSplit = completed
+				}
+
+				// Submit replacement task if we haven't reached budget
+				submitted := atomic.LoadInt64(&e.submitted)
+				if submitted-e.uncharged < int64(e.cfg.Budget) {
+					headID := int(submitted) % e.cfg.Heads
+					if err := e.submitOneTask(ctx, headID); err != nil {
+						// Non-fatal, continue
+					}
+				}
+
+				if req.Checkpoint != "" && req.CheckpointInterval > 0 && time.Since(lastCheckpoint) >= req.CheckpointInterval {
+					if err := e.writeCheckpoint(req.Checkpoint); err != nil {
+						return fmt.Errorf("checkpoint: %w", err)
+					}
+					lastCheckpoint = time.Now()
+				}
+
+				// Verbose logging
+				if e.cfg.Verbose && time.Since(lastLog) > time.Second {
+					best := e.topN.Best()
+					elapsed := time.Since(start).Truncate(100 * time.Millisecond)
+					fmt.Fprintf(os.Stderr, "progress: %d/%d done, best=%.1fms ip=%s prefix=%s elapsed=%s nodes=%d hedges=%d\n",
+						completed, e.cfg.Budget, best.ScoreMS, best.IP.String(), best.Prefix.String(), elapsed, e.tree.Size(), atomic.LoadInt64(&e.hedges))
+					lastLog = time.Now()
+				}
+				if e.onProgress != nil && time.Since(lastProgress) >= progressInterval {
+					e.onProgress(e.progress(completed, time.Since(start)))
+					lastProgress = time.Now()
+				}
 			}
 		}
 	}
@@ -175,6 +480,77 @@ func (e *Engine) schedule(ctx context.Context, timeoutMS float64) error {
 	return nil
 }
 
+// measure probes the address of every host prefix once, in order, for
+// Request.IPs.
+func (e *Engine) measure(ctx context.Context, timeoutMS float64, hosts []netip.Prefix) error {
+	start := time.Now()
+	lastProgress := start
+
+	fed := make(chan struct{})
+	go func() {
+		defer close(fed)
+		for i, p := range hosts {
+			select {
+			case e.tasks <- probeTask{seq: int64(i), prefix: p, ip: p.Addr()}:
+				atomic.AddInt64(&e.submitted, 1)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	// Run closes e.tasks when this returns
+	defer func() { <-fed }()
+
+	for range hosts {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d := <-e.done:
+			e.process(d, timeoutMS)
+			completed := atomic.AddInt64(&e.completed, 1)
+			if e.onProgress != nil && time.Since(lastProgress) >= progressInterval {
+				e.onProgress(e.progress(completed, time.Since(start)))
+				lastProgress = time.Now()
+			}
+		}
+	}
+	return nil
+}
+
+// progressInterval is the minimum time between Request.OnProgress calls.
+const progressInterval = 250 * time.Millisecond
+
+// progressRecent is the number of recently explored prefixes reported
+// per head in Progress.
+const progressRecent = 4
+
+// progress builds the Progress snapshot for Request.OnProgress.
+func (e *Engine) progress(completed int64, elapsed time.Duration) Progress {
+	p := Progress{
+		Completed: completed,
+		Budget:    e.cfg.Budget,
+		Probes:    e.probed,
+		Successes: e.succeeded,
+		Elapsed:   elapsed,
+		Hedges:    atomic.LoadInt64(&e.hedges),
+		TreeNodes: e.tree.Size(),
+	}
+	for i := 0; i < e.headManager.NumHeads(); i++ {
+		head := e.headManager.GetHead(i)
+		hs := HeadState{ID: head.ID, Focus: head.GetFocus()}
+		history := head.GetHistory()
+		seen := make(map[netip.Prefix]bool)
+		for j := len(history) - 1; j >= 0 && len(hs.Recent) < progressRecent; j-- {
+			if !seen[history[j]] {
+				seen[history[j]] = true
+				hs.Recent = append(hs.Recent, history[j])
+			}
+		}
+		p.Heads = append(p.Heads, hs)
+	}
+	return p
+}
+
 // submitOneTask submits a single probe task for a head.
 func (e *Engine) submitOneTask(ctx context.Context, headID int) error {
 	head := e.headManager.GetHead(headID % e.cfg.Heads)
@@ -196,8 +572,26 @@ func (e *Engine) submitOneTask(ctx context.Context, headID int) error {
 		exploitRate = 0.5
 	}
 
-	if completed > 30 { // Only after initial exploration
-		exploitPrefixes := e.getExploitationPrefixes()
+	// Warm start: probe previously good prefixes first
+	if len(e.warm) > 0 {
+		prefix = e.nextWarm(head)
+	}
+
+	// Initial budget split across the input CIDRs
+	if !prefix.IsValid() && e.split != nil {
+		prefix = e.budgetSplitPrefix(head, completed)
+	}
+
+	// Annealing: with the head's current temperature, explore a random
+	// leaf instead of exploiting or following Thompson Sampling.
+	if !prefix.IsValid() && e.anneal != nil && head.Sampler != nil {
+		if head.Sampler.SampleUniform() < e.exploreTemperature(head.ID, completed) {
+			prefix = e.explorePrefix(head)
+		}
+	}
+
+	if !prefix.IsValid() && completed > 30 { // Only after initial exploration
+		exploitPrefixes := e.getExploitationPrefixes(head)
 		if len(exploitPrefixes) > 0 && head.Sampler != nil {
 			if r := head.Sampler.SampleUniform(); r < exploitRate {
 				// Pick a random prefix from exploit list, weighted toward better ones
@@ -216,8 +610,13 @@ func (e *Engine) submitOneTask(ctx context.Context, headID int) error {
 	}
 
 	if !prefix.IsValid() {
-		// Fallback to any leaf
-		leaves := e.tree.LeafNodes()
+		// Fallback to any leaf the head owns
+		var leaves []*bandit.ArmNode
+		for _, node := range e.tree.LeafNodes() {
+			if head.Owns(node.Prefix) {
+				leaves = append(leaves, node)
+			}
+		}
 		if len(leaves) > 0 {
 			prefix = leaves[headID%len(leaves)].Prefix
 		}
@@ -228,9 +627,27 @@ func (e *Engine) submitOneTask(ctx context.Context, headID int) error {
 	}
 
 	ip := e.sampleIPWithDedup(prefix, head)
+	// A used-up or fully excluded prefix yields no address; fall back to
+	// random leaves of the head, then to any leaf with addresses left.
+	for tries := 0; !ip.IsValid() && tries < 8; tries++ {
+		if prefix = e.explorePrefix(head); prefix.IsValid() {
+			ip = e.sampleIPWithDedup(prefix, head)
+		}
+	}
+	if !ip.IsValid() {
+		for _, node := range e.tree.LeafNodes() {
+			if ip = e.sampleIPWithDedup(node.Prefix, head); ip.IsValid() {
+				prefix = node.Prefix
+				break
+			}
+		}
+	}
+	if !ip.IsValid() {
+		return nil
+	}
 
 	select {
-	case e.tasks <- probeTask{headID: headID, prefix: prefix, ip: ip}:
+	case e.tasks <- probeTask{seq: atomic.LoadInt64(&e.submitted), headID: headID, prefix: prefix, ip: ip}:
 		atomic.AddInt64(&e.submitted, 1)
 		return nil
 	case <-ctx.Done():
@@ -238,10 +655,53 @@ func (e *Engine) submitOneTask(ctx context.Context, headID int) error {
 	}
 }
 
+// process handles a probe result or a constraint rejection.
+func (e *Engine) process(d probeDone, timeoutMS float64) {
+	if d.rejected {
+		e.processRejected(d, timeoutMS)
+	} else {
+		e.processOneResult(d, timeoutMS)
+	}
+}
+
 // processOneResult processes a single probe result.
 func (e *Engine) processOneResult(d probeDone, timeoutMS float64) {
+	e.checkColo(&d.result)
+	e.probed++
+	if d.result.OK {
+		e.succeeded++
+	} else {
+		if e.errorKinds == nil {
+			e.errorKinds = make(map[string]int)
+		}
+		e.errorKinds[probe.ErrorKind(d.result.Error)]++
+	}
+	latency := e.resultLatency(d.result)
+
 	// Update arm tree with result
-	e.tree.Update(d.task.prefix, d.result.OK, float64(d.result.TotalMS), timeoutMS)
+	e.tree.Update(d.task.prefix, d.result.OK, latency, timeoutMS)
+	if d.result.OK && e.latencies != nil {
+		e.latencies.Add(float64(d.result.TotalMS))
+	}
+	if d.result.Error == probe.ErrUnreachable.Error() {
+		e.tree.Penalize(d.task.prefix, unreachablePenalty)
+	}
+	// Lost samples of an otherwise successful multi-sample probe count as
+	// fractional failures of the prefix.
+	lossFrac := 0.0
+	if d.result.OK && d.result.LossPct > 0 {
+		lossFrac = d.result.LossPct / 100
+		e.tree.Penalize(d.task.prefix, lossFrac)
+	}
+	if e.failures != nil {
+		e.failures.Add(d.task.ip, d.result)
+	}
+	if e.latency != nil {
+		e.latency.Add(d.task.ip, d.result)
+	}
+	if e.prefixLatency != nil {
+		e.prefixLatency.add(d.task.prefix, d.result.OK, d.result.TotalMS)
+	}
 
 	// Get arm stats
 	node := e.tree.GetNode(d.task.prefix)
@@ -250,15 +710,42 @@ func (e *Engine) processOneResult(d probeDone, timeoutMS float64) {
 		stats = node.Stats()
 	}
 
-	// Calculate score - use actual latency for success, penalty for failure
-	score := float64(d.result.TotalMS)
-	if !d.result.OK {
-		score = timeoutMS * 2
+	// Calculate score - use the composite of latency, tail latency and the
+	// failure penalty weighted by the loss rate for success, penalty for failure
+	var comp *ScoreComponents
+	score := timeoutMS * 2
+	if d.result.OK {
+		comp = e.scoreComponents(d.result, latency, lossFrac, timeoutMS)
+		score = comp.Total()
+	}
+
+	e.recordProbe(d.task.ip, d.task.prefix, d.task.headID, "", d.result, score, stats)
+
+	if e.anneal != nil {
+		e.anneal.observe(d.task.headID, d.result.OK, score, atomic.LoadInt64(&e.completed))
+	}
+
+	var explain *ScoreExplain
+	if e.cfg.Explain {
+		explain = &ScoreExplain{
+			LatencyStat:       e.latencyStat(d.result),
+			LatencyMS:         e.cfg.Scorer.LatencyMS(d.result),
+			ColoBonusMS:       e.cfg.Scorer.LatencyMS(d.result) - latency,
+			BaselineMS:        e.cfg.BaselineMS,
+			PrefixSuccessRate: stats.SuccessRate,
+			PrefixMeanMS:      stats.MeanLatency,
+			LossPenaltyMS:     lossFrac * timeoutMS * 2,
+			SearchScoreMS:     score,
+		}
+		if !d.result.OK {
+			explain.FailurePenaltyMS = score
+		}
 	}
 
 	// Add to top N
-	e.topN.Consider(TopResult{
+	top := TopResult{
 		IP:            d.task.ip,
+		Port:          d.result.Port,
 		Prefix:        d.task.prefix,
 		OK:            d.result.OK,
 		Status:        d.result.Status,
@@ -269,25 +756,170 @@ func (e *Engine) processOneResult(d probeDone, timeoutMS float64) {
 		TotalMS:       d.result.TotalMS,
 		ScoreMS:       score,
 		Trace:         d.result.Trace,
+		TLSVerify:     d.result.TLSVerify,
+		Cert:          d.result.Cert,
+		ALPN:          d.result.ALPN,
+		TLSVersion:    d.result.TLSVersion,
+		HTTPProto:     d.result.HTTPProto,
+		Attempts:      d.result.Attempts,
+		Samples:       d.result.Samples,
+		SamplesOK:     d.result.SamplesOK,
+		P50MS:         d.result.P50MS,
+		P90MS:         d.result.P90MS,
+		MaxMS:         d.result.MaxMS,
+		LossPct:       d.result.LossPct,
+		JitterMS:      d.result.JitterMS,
 		PrefixSamples: stats.Samples,
 		PrefixOK:      stats.Successes,
 		PrefixFail:    stats.Failures,
-	})
+		Country:       d.geo.Country,
+		ASN:           d.geo.ASN,
+		Explain:       explain,
+		Components:    comp,
+	}
+	if e.topN.Consider(top) && e.onTopChange != nil {
+		e.onTopChange(e.topN.Snapshot())
+	}
+	if e.coloTop != nil && top.OK && top.Trace["colo"] != "" {
+		colo := top.Trace["colo"]
+		c, ok := e.coloTop[colo]
+		if !ok {
+			c = NewTopNCollector(e.cfg.ColoTopN)
+			e.coloTop[colo] = c
+		}
+		c.Consider(top)
+	}
+}
+
+// processRejected feeds an address rejected by the ASN/country
+// constraints to its prefix as a failure, so the search moves away from
+// non-compliant space. It was not probed: it stays out of the probe
+// statistics, the reports and the probe log.
+func (e *Engine) processRejected(d probeDone, timeoutMS float64) {
+	e.rejected++
+	e.tree.Update(d.task.prefix, false, 0, timeoutMS)
+}
+
+// latencyStat describes the latency statistic a result's TotalMS holds.
+func (e *Engine) latencyStat(r probe.Result) string {
+	name := "total_ms"
+	if w, ok := e.cfg.Scorer.(PhaseWeights); ok && w != DefaultPhaseWeights() {
+		name = fmt.Sprintf("total_ms weighted connect=%g tls=%g ttfb=%g transfer=%g", w.Connect, w.TLS, w.TTFB, w.Transfer)
+	}
+	if r.Samples <= 1 {
+		return name + ", single sample"
+	}
+	stat := e.probeCfg.SampleStat
+	if stat == "" {
+		stat = probe.SampleP50
+	}
+	return fmt.Sprintf("%s, %s of %d/%d successful samples", name, stat, r.SamplesOK, r.Samples)
+}
+
+// scoreComponents weights the parts of a successful result's score.
+func (e *Engine) scoreComponents(r probe.Result, latency, lossFrac, timeoutMS float64) *ScoreComponents {
+	o := e.cfg.Objective
+	tail := latency
+	if r.Samples > 1 && r.P90MS > 0 {
+		tail = float64(r.P90MS)
+	}
+	return &ScoreComponents{
+		LatencyMS: o.Latency * e.latencyScore(latency),
+		TailMS:    o.Tail * e.latencyScore(tail),
+		LossMS:    o.Loss * lossFrac * timeoutMS * 2,
+	}
+}
+
+// recordProbe writes one probe result to the probe log and passes it to
+// OnProbe. phase is empty for search probes and "verify" for the re-probes
+// of the verification phase, which belong to no head (headID -1).
+func (e *Engine) recordProbe(ip netip.Addr, prefix netip.Prefix, headID int, phase string, res probe.Result, score float64, stats bandit.ArmStats) {
+	if (e.probeLog == nil || e.probeLogErr != nil) && e.onProbe == nil {
+		return
+	}
+	pr := ProbeResult{
+		IP:            ip,
+		Port:          res.Port,
+		Prefix:        prefix,
+		Phase:         phase,
+		OK:            res.OK,
+		Status:        res.Status,
+		Error:         res.Error,
+		ConnectMS:     res.ConnectMS,
+		TLSMS:         res.TLSMS,
+		TTFBMS:        res.TTFBMS,
+		TotalMS:       res.TotalMS,
+		ScoreMS:       score,
+		Trace:         res.Trace,
+		Body:          res.Body,
+		StreamMS:      res.StreamMS,
+		TLSVerify:     res.TLSVerify,
+		Cert:          res.Cert,
+		ALPN:          res.ALPN,
+		TLSVersion:    res.TLSVersion,
+		HTTPProto:     res.HTTPProto,
+		Attempts:      res.Attempts,
+		Samples:       res.Samples,
+		SamplesOK:     res.SamplesOK,
+		P50MS:         res.P50MS,
+		P90MS:         res.P90MS,
+		MaxMS:         res.MaxMS,
+		LossPct:       res.LossPct,
+		JitterMS:      res.JitterMS,
+		When:          res.When,
+		PrefixSamples: stats.Samples,
+		PrefixOK:      stats.Successes,
+		PrefixFail:    stats.Failures,
+	}
+	if headID >= 0 {
+		pr.HeadID = &headID
+	}
+	if e.probeLog != nil && e.probeLogErr == nil {
+		e.probeLogErr = e.probeLog.Encode(pr)
+	}
+	if e.onProbe != nil {
+		e.onProbe(pr)
+	}
+}
+
+// latencyScore converts a successful latency into a score by removing the
+// calibrated baseline.
+func (e *Engine) latencyScore(ms float64) float64 {
+	ms -= e.cfg.BaselineMS
+	if ms < 0 {
+		return 0
+	}
+	return ms
 }
 
 // worker runs probe tasks.
 func (e *Engine) worker(ctx context.Context, wg *sync.WaitGroup, probeCfg probe.Config) {
 	defer wg.Done()
 
-	prober := probe.NewProber(probeCfg)
-
 	for task := range e.tasks {
-		pctx, cancel := context.WithTimeout(ctx, probeCfg.Timeout)
-		result := prober.ProbeHTTPTrace(pctx, task.ip)
+		pctx, cancel := context.WithTimeout(ctx, probeCfg.ProbeTimeout())
+		release := func() {}
+		if e.unreachable != nil {
+			pctx, release = e.unreachable.Watch(pctx, task.ip)
+		}
+
+		d := probeDone{task: task}
+		if e.geo != nil {
+			d.geo = e.geo.Lookup(task.ip)
+		}
+		// Addresses outside the required ASN/country space are rejected
+		// without touching the network, so the prefix still learns from them.
+		if reason := e.constraints.Check(d.geo); reason != "" {
+			d.result = probe.Result{IP: task.ip, Error: reason, When: time.Now()}
+			d.rejected = true
+		} else {
+			d.result = e.probeHedged(pctx, e.backend, e.hedgeBackend, task.ip)
+		}
+		release()
 		cancel()
 
 		select {
-		case e.done <- probeDone{task: task, result: result}:
+		case e.done <- d:
 		case <-ctx.Done():
 			return
 		}
@@ -297,6 +929,15 @@ func (e *Engine) worker(ctx context.Context, wg *sync.WaitGroup, probeCfg probe.
 // trySplit attempts to split promising prefixes.
 // It prioritizes nodes with good performance (low latency, high success rate).
 func (e *Engine) trySplit() {
+	// Merge uniform siblings back first so their beam slots go elsewhere
+	if e.cfg.MergeSiblings {
+		for _, node := range e.tree.MergeUniform(e.cfg.MinSamplesSplit) {
+			if e.cfg.Verbose {
+				fmt.Fprintf(os.Stderr, "merge: %s (children indistinguishable)\n", node.Prefix)
+			}
+		}
+	}
+
 	// Get more candidates - be more aggressive about splitting
 	candidates := e.tree.GetSplitCandidates(e.cfg.Heads * 4)
 
@@ -319,7 +960,8 @@ func (e *Engine) trySplit() {
 // getExploitationPrefixes returns prefixes that deserve intensive exploitation.
 // These are prefixes containing top-performing IPs that we should sample more from.
 // Returns prefixes sorted by best score (best first), with repeats for weighting.
-func (e *Engine) getExploitationPrefixes() []netip.Prefix {
+// Only prefixes owned by the head are returned.
+func (e *Engine) getExploitationPrefixes(head *bandit.SearchHead) []netip.Prefix {
 	topResults := e.topN.Snapshot()
 	if len(topResults) == 0 {
 		return nil
@@ -330,21 +972,26 @@ func (e *Engine) getExploitationPrefixes() []netip.Prefix {
 	tier1Threshold := bestScore * 1.2 // Within 20% of best
 	tier2Threshold := bestScore * 1.5 // Within 50% of best
 
-	// Track best score per prefix
+	// Track best score per prefix, in rank order
 	prefixBestScore := make(map[netip.Prefix]float64)
+	var ranked []netip.Prefix
 	for _, r := range topResults {
 		if r.ScoreMS > tier2Threshold {
 			break
 		}
+		if !head.Owns(r.Prefix) {
+			continue
+		}
 		if _, exists := prefixBestScore[r.Prefix]; !exists {
 			prefixBestScore[r.Prefix] = r.ScoreMS
+			ranked = append(ranked, r.Prefix)
 		}
 	}
 
 	// Build weighted list: tier1 prefixes appear 3x, tier2 appear 1x
 	var exploitPrefixes []netip.Prefix
-	for prefix, score := range prefixBestScore {
-		if score <= tier1Threshold {
+	for _, prefix := range ranked {
+		if prefixBestScore[prefix] <= tier1Threshold {
 			// Best prefixes get 3x weight
 			exploitPrefixes = append(exploitPrefixes, prefix, prefix, prefix)
 		} else {
@@ -356,7 +1003,9 @@ func (e *Engine) getExploitationPrefixes() []netip.Prefix {
 	return exploitPrefixes
 }
 
-// sampleIPWithDedup samples an IP with deduplication.
+// sampleIPWithDedup samples an address of prefix that was not probed yet.
+// It returns the zero Addr when none is found (the prefix is used up or
+// fully excluded).
 func (e *Engine) sampleIPWithDedup(prefix netip.Prefix, head *bandit.SearchHead) netip.Addr {
 	prefix = prefix.Masked()
 
@@ -367,63 +1016,113 @@ func (e *Engine) sampleIPWithDedup(prefix netip.Prefix, head *bandit.SearchHead)
 	}
 
 	if hostBits <= 0 {
+		if e.exclude.Contains(prefix.Addr()) || !e.seen.claim(prefix.Addr(), hostBits) {
+			return netip.Addr{}
+		}
 		return prefix.Addr()
 	}
+	if e.sweepable(hostBits) {
+		return e.sweepIP(prefix, hostBits, head)
+	}
 
 	const maxTries = 32
 	var last netip.Addr
 
 	for i := 0; i < maxTries; i++ {
 		ip := head.Sampler.SampleIP(prefix)
+		if len(e.exclude) > 0 {
+			var ok bool
+			if ip, ok = e.exclude.Allowed(prefix, ip); !ok {
+				return netip.Addr{}
+			}
+		}
 		last = ip
 
-		// Use uint128 representation for efficient dedup
-		key := ipToKey(ip)
-		if _, loaded := e.seenIPs.LoadOrStore(key, struct{}{}); !loaded {
+		if e.seen.claim(ip, hostBits) {
 			return ip
 		}
 	}
 
-	// Too many duplicates, return last sampled
-	return last
-}
-
-// ipToKey converts an IP to a comparable key.
-// Using the IP directly as netip.Addr is comparable and efficient.
-func ipToKey(ip netip.Addr) netip.Addr {
-	return ip
+	// Random draws keep hitting probed addresses: scan small prefixes for
+	// one that is left, starting after the last draw.
+	if hostBits <= scanHostBits {
+		ip := last
+		for i := 0; i < 1<<hostBits; i++ {
+			if ip = ip.Next(); !ip.IsValid() || !prefix.Contains(ip) {
+				ip = prefix.Addr()
+			}
+			if !e.exclude.Contains(ip) && e.seen.claim(ip, hostBits) {
+				return ip
+			}
+		}
+	}
+	return netip.Addr{}
 }
 
-// loadPrefixes loads and deduplicates CIDR prefixes from the request.
-func loadPrefixes(req Request) ([]netip.Prefix, error) {
-	var pfxs []netip.Prefix
+// loadPrefixes loads and deduplicates CIDR prefixes from the request,
+// along with their weights from the CIDR file (1 for --cidr and lines
+// without one).
+func loadPrefixes(req Request) ([]netip.Prefix, map[netip.Prefix]float64, error) {
+	var (
+		pfxs    []netip.Prefix
+		weights []float64
+	)
+
+	// An address list is measured as host prefixes; CIDRs are ignored
+	if len(req.IPs) > 0 {
+		for _, ip := range req.IPs {
+			pfxs = append(pfxs, netip.PrefixFrom(ip, ip.BitLen()))
+			weights = append(weights, 1)
+		}
+		req.CIDRs, req.CIDRFile = nil, ""
+	}
 
 	if len(req.CIDRs) > 0 {
 		ps, err := cidr.ParseCIDRs(req.CIDRs)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		pfxs = append(pfxs, ps...)
+		for range ps {
+			weights = append(weights, 1)
+		}
 	}
 
 	if req.CIDRFile != "" {
-		ps, err := cidr.ReadCIDRsFromFile(req.CIDRFile)
+		ps, ws, err := cidr.ReadWeightedCIDRsFromFile(req.CIDRFile)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		pfxs = append(pfxs, ps...)
+		weights = append(weights, ws...)
 	}
 
 	// Deduplicate
-	seen := make(map[netip.Prefix]struct{}, len(pfxs))
+	seen := make(map[netip.Prefix]float64, len(pfxs))
 	unique := make([]netip.Prefix, 0, len(pfxs))
-	for _, p := range pfxs {
+	for i, p := range pfxs {
 		p = p.Masked()
 		if _, exists := seen[p]; !exists {
-			seen[p] = struct{}{}
+			seen[p] = weights[i]
 			unique = append(unique, p)
 		}
 	}
 
-	return unique, nil
+	return unique, seen, nil
+}
+
+// loadExclusion parses Request.ExcludeCIDRs and Request.ExcludeFile.
+func loadExclusion(req Request) (cidr.Exclusion, error) {
+	ex, err := cidr.ParseCIDRs(req.ExcludeCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	if req.ExcludeFile != "" {
+		ps, err := cidr.ReadCIDRsFromFile(req.ExcludeFile)
+		if err != nil {
+			return nil, fmt.Errorf("exclude: %w", err)
+		}
+		ex = append(ex, ps...)
+	}
+	return cidr.Exclusion(ex), nil
 }
@@ -0,0 +1,328 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/bandit"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/geoip"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+var testCIDRs = []string{"10.0.0.0/16", "2001:db8::/48"}
+
+func simRun(t *testing.T, cfg Config) Response {
+	t.Helper()
+	e := New(cfg, probe.Config{})
+	resp, err := e.Run(context.Background(), Request{
+		CIDRs: testCIDRs,
+		Probe: probe.Config{Backend: probe.BackendSim, Timeout: time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestRunSim(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget int
+		topN   int
+	}{
+		{"small", 50, 5},
+		{"larger", 400, 10},
+		{"top above budget", 20, 50},
+	}
+	var prefixes []netip.Prefix
+	for _, s := range testCIDRs {
+		prefixes = append(prefixes, netip.MustParsePrefix(s))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Budget, cfg.TopN, cfg.Concurrency = tt.budget, tt.topN, 8
+			resp := simRun(t, cfg)
+
+			if resp.Stats.Probes != int64(tt.budget) {
+				t.Errorf("Probes = %d, want the budget %d", resp.Stats.Probes, tt.budget)
+			}
+			if resp.Stats.Successes+resp.Stats.Failures != resp.Stats.Probes {
+				t.Errorf("Successes %d + Failures %d != Probes %d", resp.Stats.Successes, resp.Stats.Failures, resp.Stats.Probes)
+			}
+			if len(resp.Top) == 0 || len(resp.Top) > tt.topN {
+				t.Fatalf("len(Top) = %d, want 1-%d", len(resp.Top), tt.topN)
+			}
+			for i, r := range resp.Top {
+				in := false
+				for _, p := range prefixes {
+					in = in || p.Contains(r.IP)
+				}
+				if !in {
+					t.Errorf("Top[%d] = %s, outside %v", i, r.IP, testCIDRs)
+				}
+				if i > 0 && r.ScoreMS < resp.Top[i-1].ScoreMS {
+					t.Errorf("Top[%d] scores %.1f, better than Top[%d] (%.1f)", i, r.ScoreMS, i-1, resp.Top[i-1].ScoreMS)
+				}
+			}
+		})
+	}
+}
+
+func TestRunDeterministic(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Budget, cfg.TopN, cfg.Concurrency = 300, 10, 16
+	cfg.Deterministic, cfg.Seed = true, 42
+	a, b := simRun(t, cfg), simRun(t, cfg)
+	if len(a.Top) != len(b.Top) {
+		t.Fatalf("top sizes differ: %d vs %d", len(a.Top), len(b.Top))
+	}
+	for i := range a.Top {
+		if a.Top[i].IP != b.Top[i].IP || a.Top[i].ScoreMS != b.Top[i].ScoreMS {
+			t.Errorf("Top[%d] differs: %s %.1f vs %s %.1f", i, a.Top[i].IP, a.Top[i].ScoreMS, b.Top[i].IP, b.Top[i].ScoreMS)
+		}
+	}
+}
+
+func TestWarmStart(t *testing.T) {
+	cfg := DefaultConfig()
+	e := New(cfg, probe.Config{})
+	treeCfg := e.cfg.ToTreeConfig()
+	treeCfg.MinSamples = 1
+	e.tree = bandit.NewArmTree([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/16")}, treeCfg)
+	root := e.tree.Roots()[0]
+	e.tree.Update(root.Prefix, true, 50, 1000)
+	if len(e.tree.SplitNode(root)) == 0 {
+		t.Fatal("root did not split")
+	}
+	size := e.tree.Size()
+	deepest := e.tree.Deepest(netip.MustParseAddr("10.0.1.2")).Prefix
+	samples := e.tree.TotalSamples()
+
+	// Logged prefixes from a finer split, an IP outside the tree and a
+	// failure: the tree must not grow, only known nodes are credited.
+	log := strings.Join([]string{
+		`{"ip":"10.0.1.2","prefix":"10.0.1.0/28","ok":true,"total_ms":40,"score_ms":42}`,
+		`{"ip":"10.0.1.3","prefix":"10.0.1.0/28","ok":true,"total_ms":60}`,
+		`{"ip":"192.0.2.1","prefix":"192.0.2.0/24","ok":true,"total_ms":10}`,
+		`{"ip":"10.0.200.1","ok":false,"total_ms":1000}`,
+		``,
+	}, "\n")
+	used, err := e.warmStart(strings.NewReader(log), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 3 {
+		t.Errorf("used = %d, want 3", used)
+	}
+	if e.tree.Size() != size {
+		t.Errorf("tree grew from %d to %d nodes", size, e.tree.Size())
+	}
+	if got := e.tree.TotalSamples() - samples; got < 3 {
+		t.Errorf("%d samples credited, want at least 3", got)
+	}
+	if len(e.warm) != 1 || e.warm[0] != deepest {
+		t.Errorf("warm queue = %v, want [%s]", e.warm, deepest)
+	}
+}
+
+func TestApplyDefaultsFractions(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    float64
+		want  float64
+		field func(*Config) *float64
+	}{
+		{"hedge budget default", 0, 0.1, func(c *Config) *float64 { return &c.HedgeBudget }},
+		{"hedge budget set", 0.25, 0.25, func(c *Config) *float64 { return &c.HedgeBudget }},
+		{"hedge budget none", -1, -1, func(c *Config) *float64 { return &c.HedgeBudget }},
+		{"reliability weight default", 0, 0.5, func(c *Config) *float64 { return &c.ReliabilityWeight }},
+		{"reliability weight none", -1, -1, func(c *Config) *float64 { return &c.ReliabilityWeight }},
+		{"colo bonus default", 0, 0.3, func(c *Config) *float64 { return &c.ColoBonus }},
+		{"colo bonus none", -1, -1, func(c *Config) *float64 { return &c.ColoBonus }},
+	}
+	for _, tt := range tests {
+		var cfg Config
+		*tt.field(&cfg) = tt.in
+		cfg.ApplyDefaults()
+		if got := *tt.field(&cfg); got != tt.want {
+			t.Errorf("%s: ApplyDefaults turned %v into %v, want %v", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHedgeLimit(t *testing.T) {
+	tests := []struct {
+		budget      int
+		hedgeBudget float64
+		want        int64
+	}{
+		{1000, 0.1, 100},
+		{1000, 0.5, 500},
+		{1000, -1, 0},
+	}
+	for _, tt := range tests {
+		e := New(Config{Budget: tt.budget, HedgeBudget: tt.hedgeBudget}, probe.Config{})
+		if got := e.hedgeLimit(); got != tt.want {
+			t.Errorf("hedgeLimit() with Budget %d, HedgeBudget %v = %d, want %d", tt.budget, tt.hedgeBudget, got, tt.want)
+		}
+	}
+}
+
+func TestVerificationReliabilityWeight(t *testing.T) {
+	results := []probe.Result{
+		{OK: true, TotalMS: 50},
+		{Error: "timeout"},
+		{OK: true, TotalMS: 70},
+		{Error: "timeout"},
+	}
+	tests := []struct {
+		weight  float64
+		penalty bool
+	}{
+		{0, true}, // the default weight
+		{0.5, true},
+		{-1, false},
+	}
+	for _, tt := range tests {
+		e := New(Config{ReliabilityWeight: tt.weight}, probe.Config{})
+		var r TopResult
+		e.applyVerification(&r, results, 1000)
+		if got := r.ScoreMS > r.VerifyLatencyMS; got != tt.penalty {
+			t.Errorf("weight %v: score %.1f for a verified latency of %.1f, want a penalty: %v", tt.weight, r.ScoreMS, r.VerifyLatencyMS, tt.penalty)
+		}
+	}
+}
+
+func TestResultLatencyColoBonus(t *testing.T) {
+	res := probe.Result{OK: true, TotalMS: 100, Trace: map[string]string{"colo": "HKG"}}
+	tests := []struct {
+		prefer []string
+		bonus  float64
+		want   float64
+	}{
+		{nil, 0, 100},
+		{[]string{"NRT"}, 0, 100},
+		{[]string{"hkg"}, 0, 70}, // the default bonus
+		{[]string{"HKG"}, 0.5, 50},
+		{[]string{"HKG"}, -1, 100},
+	}
+	for _, tt := range tests {
+		e := New(Config{PreferColo: tt.prefer, ColoBonus: tt.bonus}, probe.Config{})
+		if got := e.resultLatency(res); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("PreferColo %v, ColoBonus %v: latency %v, want %v", tt.prefer, tt.bonus, got, tt.want)
+		}
+	}
+}
+
+// testdata/asn.mmdb maps 10.0.0.0/17 to AS13335 and 10.0.128.0/17 to
+// AS64512.
+func TestRunRejected(t *testing.T) {
+	db, err := geoip.Open("testdata/asn.mmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name   string
+		cidr   string
+		budget int
+		probes int64
+		minRej int64
+		maxRej int64
+	}{
+		{"half compliant", "10.0.0.0/16", 200, 200, 1, 200 * freeRejections},
+		// The free rejections, then the whole budget
+		{"none compliant", "10.0.128.0/17", 50, 0, 50 * (freeRejections + 1), 50 * (freeRejections + 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Budget, cfg.TopN, cfg.Concurrency = tt.budget, 5, 8
+			cfg.RequireASN = []uint{13335}
+			cfg.FailureReport = true
+			resp, err := New(cfg, probe.Config{}).Run(context.Background(), Request{
+				CIDRs: []string{tt.cidr},
+				Probe: probe.Config{Backend: probe.BackendSim, Timeout: time.Second},
+				GeoIP: db,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			st := resp.Stats
+			if st.Probes != tt.probes {
+				t.Errorf("Probes = %d, want %d", st.Probes, tt.probes)
+			}
+			if st.Rejected < tt.minRej || st.Rejected > tt.maxRej {
+				t.Errorf("Rejected = %d, want %d-%d", st.Rejected, tt.minRej, tt.maxRej)
+			}
+			if st.Errors["rejected_asn"] != 0 {
+				t.Errorf("rejections counted as %d failures", st.Errors["rejected_asn"])
+			}
+			for _, g := range resp.Failures {
+				if g.Kinds["rejected_asn"] > 0 {
+					t.Errorf("failure report lists rejections under %s", g.Prefix)
+				}
+			}
+			for _, r := range resp.Top {
+				if r.OK && r.ASN != 13335 {
+					t.Errorf("top result %s in AS%d", r.IP, r.ASN)
+				}
+			}
+		})
+	}
+}
+
+// failingBackend fails every probe and cancels the run after a number of
+// probes (0 = never).
+type failingBackend struct {
+	calls, after int64
+	cancel       context.CancelFunc
+}
+
+func (b *failingBackend) Probe(ctx context.Context, ip netip.Addr) probe.Result {
+	if n := atomic.AddInt64(&b.calls, 1); n == b.after {
+		b.cancel()
+	}
+	return probe.Result{IP: ip, Error: "timeout", TotalMS: 1000}
+}
+
+func TestVerifyTopInterrupted(t *testing.T) {
+	tests := []struct {
+		name        string
+		cancelAfter int64
+		kept        int
+		interrupted bool
+	}{
+		{"complete", 0, 0, false},
+		{"interrupted", 2, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			e := New(Config{VerifySamples: 3, VerifyMinSuccess: 1, Concurrency: 1}, probe.Config{})
+			e.backend = &failingBackend{after: tt.cancelAfter, cancel: cancel}
+			e.tree = bandit.NewArmTree(nil, e.cfg.ToTreeConfig())
+			top := []TopResult{
+				{IP: netip.MustParseAddr("10.0.0.1"), OK: true, ScoreMS: 10},
+				{IP: netip.MustParseAddr("10.0.0.2"), OK: true, ScoreMS: 20},
+				{IP: netip.MustParseAddr("10.0.0.3"), OK: true, ScoreMS: 30},
+			}
+			got, err := e.verifyTop(ctx, top, probe.Config{Timeout: time.Second}, 1000)
+			if len(got) != tt.kept {
+				t.Errorf("kept %d candidates, want %d", len(got), tt.kept)
+			}
+			if interrupted := errors.Is(err, context.Canceled); interrupted != tt.interrupted {
+				t.Errorf("err = %v, want interrupted: %v", err, tt.interrupted)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"net/netip"
+	"sort"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// FailedIP is a single failed address in a failure report.
+type FailedIP struct {
+	IP    netip.Addr `json:"ip"`
+	Kind  string     `json:"kind"`
+	Error string     `json:"error"`
+	Count int        `json:"count"`
+}
+
+// FailureGroup aggregates failed probes within one prefix.
+type FailureGroup struct {
+	Prefix netip.Prefix   `json:"prefix"`
+	Probes int            `json:"probes"`
+	Failed int            `json:"failed"`
+	Kinds  map[string]int `json:"kinds"`
+	IPs    []FailedIP     `json:"ips"`
+}
+
+// failureCollector groups failed probes by a fixed-length prefix
+// (MaxBitsV4/MaxBitsV6), independent of how the search tree was split.
+type failureCollector struct {
+	bitsV4, bitsV6 int
+	groups         map[netip.Prefix]*FailureGroup
+	ipIndex        map[netip.Addr]int
+}
+
+func newFailureCollector(bitsV4, bitsV6 int) *failureCollector {
+	return &failureCollector{
+		bitsV4:  bitsV4,
+		bitsV6:  bitsV6,
+		groups:  make(map[netip.Prefix]*FailureGroup),
+		ipIndex: make(map[netip.Addr]int),
+	}
+}
+
+// Add records one probe result. Successful probes only count towards the
+// group's probe total so failure rates can be derived.
+func (c *failureCollector) Add(ip netip.Addr, res probe.Result) {
+	bits := c.bitsV4
+	if ip.Is6() {
+		bits = c.bitsV6
+	}
+	p := netip.PrefixFrom(ip, bits).Masked()
+
+	g := c.groups[p]
+	if g == nil {
+		g = &FailureGroup{Prefix: p, Kinds: make(map[string]int)}
+		c.groups[p] = g
+	}
+	g.Probes++
+	if res.OK {
+		return
+	}
+
+	kind := probe.ErrorKind(res.Error)
+	g.Failed++
+	g.Kinds[kind]++
+	if idx, ok := c.ipIndex[ip]; ok {
+		g.IPs[idx].Count++
+		g.IPs[idx].Kind = kind
+		g.IPs[idx].Error = res.Error
+		return
+	}
+	c.ipIndex[ip] = len(g.IPs)
+	g.IPs = append(g.IPs, FailedIP{IP: ip, Kind: kind, Error: res.Error, Count: 1})
+}
+
+// Groups returns groups with at least one failure, most failures first.
+func (c *failureCollector) Groups() []FailureGroup {
+	out := make([]FailureGroup, 0, len(c.groups))
+	for _, g := range c.groups {
+		if g.Failed > 0 {
+			out = append(out, *g)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Failed != out[j].Failed {
+			return out[i].Failed > out[j].Failed
+		}
+		return out[i].Prefix.String() < out[j].Prefix.String()
+	})
+	return out
+}
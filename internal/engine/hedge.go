@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+const (
+	// hedgeWindowSize is the number of recent successful latencies kept.
+	hedgeWindowSize = 256
+
+	// hedgeMinSamples is the number of latencies needed before hedging starts.
+	hedgeMinSamples = 32
+)
+
+// latencyWindow is a ring buffer of recent successful probe latencies.
+type latencyWindow struct {
+	mu   sync.Mutex
+	buf  []float64
+	next int
+	full bool
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{buf: make([]float64, size)}
+}
+
+// Add records a latency observation.
+func (w *latencyWindow) Add(ms float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf[w.next] = ms
+	w.next++
+	if w.next == len(w.buf) {
+		w.next = 0
+		w.full = true
+	}
+}
+
+// Percentile returns the q-th percentile (0-1) of the window and the
+// number of observations it was computed from.
+func (w *latencyWindow) Percentile(q float64) (float64, int) {
+	w.mu.Lock()
+	n := w.next
+	if w.full {
+		n = len(w.buf)
+	}
+	vals := make([]float64, n)
+	copy(vals, w.buf[:n])
+	w.mu.Unlock()
+
+	if n == 0 {
+		return 0, 0
+	}
+	sort.Float64s(vals)
+	idx := int(q * float64(n-1))
+	return vals[idx], n
+}
+
+// hedgeDelay returns how long to wait before launching a hedge probe.
+// It returns false when hedging is disabled, the latency window is still
+// warming up, or the hedge budget has been spent.
+func (e *Engine) hedgeDelay() (time.Duration, bool) {
+	if !e.cfg.Hedge || e.latencies == nil {
+		return 0, false
+	}
+	if atomic.LoadInt64(&e.hedges) >= e.hedgeLimit() {
+		return 0, false
+	}
+	p95, n := e.latencies.Percentile(0.95)
+	if n < hedgeMinSamples {
+		return 0, false
+	}
+	return time.Duration(p95 * float64(time.Millisecond)), true
+}
+
+// hedgeLimit returns the maximum number of extra probes hedging may spend.
+func (e *Engine) hedgeLimit() int64 {
+	return int64(max(e.cfg.HedgeBudget, 0) * float64(e.cfg.Budget))
+}
+
+// takeHedge reserves one unit of the hedge budget.
+func (e *Engine) takeHedge() bool {
+	if atomic.AddInt64(&e.hedges, 1) > e.hedgeLimit() {
+		atomic.AddInt64(&e.hedges, -1)
+		return false
+	}
+	return true
+}
+
+// probeHedged probes ip and, if the probe is slower than the recent p95,
+// races a second probe on a separate backend instance (and therefore a
+// separate connection pool). The first successful result wins; the loser
+// is canceled.
+func (e *Engine) probeHedged(ctx context.Context, primary, hedger probe.Backend, ip netip.Addr) probe.Result {
+	delay, ok := e.hedgeDelay()
+	if !ok || hedger == nil {
+		return primary.Probe(ctx, ip)
+	}
+
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan probe.Result, 2)
+	go func() { results <- primary.Probe(hctx, ip) }()
+
+	timer := time.NewTimer(delay)
+	select {
+	case r := <-results:
+		timer.Stop()
+		return r
+	case <-timer.C:
+	}
+
+	if !e.takeHedge() {
+		return <-results
+	}
+	go func() {
+		r := hedger.Probe(hctx, ip)
+		r.Hedged = true
+		results <- r
+	}()
+
+	first := <-results
+	if first.OK {
+		return first
+	}
+	if second := <-results; second.OK {
+		return second
+	}
+	return first
+}
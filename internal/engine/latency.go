@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"net/netip"
+	"sort"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// latencyBucketsMS are the upper bounds of the latency histogram buckets;
+// latencies above the last bound fall into a final open-ended bucket.
+var latencyBucketsMS = []int64{10, 20, 30, 50, 75, 100, 150, 200, 300, 500, 750, 1000, 2000}
+
+// LatencyBucket is one histogram bucket: successful probes with a latency
+// in (previous bucket's UpToMS, UpToMS]. UpToMS is 0 for the final
+// open-ended bucket.
+type LatencyBucket struct {
+	UpToMS int64 `json:"up_to_ms"`
+	Count  int   `json:"count"`
+}
+
+// PrefixLatency summarizes the probes of one prefix.
+type PrefixLatency struct {
+	Prefix netip.Prefix `json:"prefix"`
+	Probes int          `json:"probes"`
+	OK     int          `json:"ok"`
+	MeanMS float64      `json:"mean_ms"`
+	P50MS  float64      `json:"p50_ms"`
+	P90MS  float64      `json:"p90_ms"`
+	P99MS  float64      `json:"p99_ms"`
+}
+
+// LatencyReport describes how latency is distributed over the whole
+// searched space, not just the winners (Config.LatencyReport).
+type LatencyReport struct {
+	Probes   int             `json:"probes"`
+	OK       int             `json:"ok"`
+	P50MS    float64         `json:"p50_ms"`
+	P90MS    float64         `json:"p90_ms"`
+	P99MS    float64         `json:"p99_ms"`
+	Buckets  []LatencyBucket `json:"buckets"`
+	Prefixes []PrefixLatency `json:"prefixes"`
+}
+
+// latencyCollector records the latency (TotalMS) of every successful
+// probe, overall and by a fixed-length prefix (MaxBitsV4/MaxBitsV6) like
+// the failure report.
+type latencyCollector struct {
+	bitsV4, bitsV6 int
+	probes         int
+	all            []float64
+	byPrefix       map[netip.Prefix]*prefixLatencies
+}
+
+type prefixLatencies struct {
+	probes int
+	ms     []float64
+}
+
+func newLatencyCollector(bitsV4, bitsV6 int) *latencyCollector {
+	return &latencyCollector{
+		bitsV4:   bitsV4,
+		bitsV6:   bitsV6,
+		byPrefix: make(map[netip.Prefix]*prefixLatencies),
+	}
+}
+
+// Add records one probe result.
+func (c *latencyCollector) Add(ip netip.Addr, res probe.Result) {
+	bits := c.bitsV4
+	if ip.Is6() {
+		bits = c.bitsV6
+	}
+	p := netip.PrefixFrom(ip, bits).Masked()
+	pl := c.byPrefix[p]
+	if pl == nil {
+		pl = &prefixLatencies{}
+		c.byPrefix[p] = pl
+	}
+	c.probes++
+	pl.probes++
+	if res.OK {
+		c.all = append(c.all, float64(res.TotalMS))
+		pl.ms = append(pl.ms, float64(res.TotalMS))
+	}
+}
+
+// Report builds the histogram and the per-prefix table, prefixes with
+// successes first by median latency, then by probe count.
+func (c *latencyCollector) Report() *LatencyReport {
+	r := &LatencyReport{
+		Probes: c.probes,
+		OK:     len(c.all),
+		P50MS:  probe.Percentile(c.all, 0.5),
+		P90MS:  probe.Percentile(c.all, 0.9),
+		P99MS:  probe.Percentile(c.all, 0.99),
+	}
+	r.Buckets = make([]LatencyBucket, len(latencyBucketsMS)+1)
+	for i, up := range latencyBucketsMS {
+		r.Buckets[i].UpToMS = up
+	}
+	for _, ms := range c.all {
+		i := sort.Search(len(latencyBucketsMS), func(i int) bool { return ms <= float64(latencyBucketsMS[i]) })
+		r.Buckets[i].Count++
+	}
+
+	r.Prefixes = make([]PrefixLatency, 0, len(c.byPrefix))
+	for p, pl := range c.byPrefix {
+		row := PrefixLatency{Prefix: p, Probes: pl.probes, OK: len(pl.ms)}
+		if len(pl.ms) > 0 {
+			row.MeanMS, _ = meanStd(pl.ms)
+			row.P50MS = probe.Percentile(pl.ms, 0.5)
+			row.P90MS = probe.Percentile(pl.ms, 0.9)
+			row.P99MS = probe.Percentile(pl.ms, 0.99)
+		}
+		r.Prefixes = append(r.Prefixes, row)
+	}
+	sort.Slice(r.Prefixes, func(i, j int) bool {
+		a, b := r.Prefixes[i], r.Prefixes[j]
+		if (a.OK > 0) != (b.OK > 0) {
+			return a.OK > 0
+		}
+		if a.P50MS != b.P50MS {
+			return a.P50MS < b.P50MS
+		}
+		if a.Probes != b.Probes {
+			return a.Probes > b.Probes
+		}
+		return a.Prefix.String() < b.Prefix.String()
+	})
+	return r
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"errors"
+	"math"
+	"net/netip"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/bandit"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/cidr"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// planProbeMS is the assumed time of a successful probe in a Plan's run
+// time estimate: a fresh connection costs a few round trips.
+const planProbeMS = 300
+
+// Plan is what a run of a request would do, worked out without probing.
+type Plan struct {
+	Config Config // with defaults applied
+
+	// Prefixes are the input CIDRs after deduplication and exclusion;
+	// Excluded counts the ones dropped as entirely excluded.
+	Prefixes []PlanPrefix
+	Excluded int
+	// Addresses is the number of addresses in Prefixes (approximate for
+	// large IPv6 prefixes).
+	Addresses float64
+
+	// Heads lists the input CIDRs each head is pinned to (HeadAffinity);
+	// nil when every head searches all of them.
+	Heads [][]netip.Prefix
+	// SplitProbes is the part of the budget allocated across Prefixes by
+	// BudgetSplit (0 = none).
+	SplitProbes int
+
+	// Probes is the most probes the run makes: Budget, the hedges allowed
+	// by HedgeBudget and the verification of the top results, each IP
+	// measured Samples times.
+	Probes int
+	// MinDuration and MaxDuration estimate the run time, with every probe
+	// taking about planProbeMS or the full probe timeout.
+	MinDuration, MaxDuration time.Duration
+}
+
+// PlanPrefix is an input CIDR of a Plan.
+type PlanPrefix struct {
+	Prefix netip.Prefix
+	Weight float64 // from the CIDR file (1 without one)
+	// SplitProbes is the expected share of Plan.SplitProbes of the prefix.
+	SplitProbes float64
+}
+
+// PlanRun checks cfg and req the way Run does and returns the plan of the
+// run without probing: the input CIDRs, the head layout, the budget
+// allocation and an estimate of the run time. The probe backend is built
+// (and closed) to validate the probe configuration.
+func PlanRun(cfg Config, req Request) (Plan, error) {
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return Plan{}, err
+	}
+	prefixes, weights, _, excluded, err := inputPrefixes(req)
+	if err != nil {
+		return Plan{}, err
+	}
+	if len(req.IPs) > 0 {
+		cfg.Budget, cfg.TopN = len(prefixes), len(prefixes)
+	}
+	if !cfg.Constraints().Empty() && req.GeoIP == nil {
+		return Plan{}, errors.New("ASN/country constraints require a GeoIP database (use --geoip-db/--asn-db)")
+	}
+	if req.Backend == nil {
+		b, err := probe.NewBackend(req.Probe)
+		if err != nil {
+			return Plan{}, err
+		}
+		closeBackend(b)
+	}
+
+	p := Plan{Config: cfg, Excluded: excluded}
+	split := newBudgetSplit(cfg.BudgetSplit, prefixes, weights, cfg.Budget)
+	if split != nil {
+		p.SplitProbes = split.total
+	}
+	for i, pfx := range prefixes {
+		pp := PlanPrefix{Prefix: pfx, Weight: weights[pfx]}
+		if split != nil {
+			pp.SplitProbes = split.share[i] * float64(split.total)
+		}
+		p.Prefixes = append(p.Prefixes, pp)
+		p.Addresses += math.Exp2(float64(pfx.Addr().BitLen() - pfx.Bits()))
+	}
+	if cfg.HeadAffinity != bandit.AffinityNone {
+		p.Heads = bandit.AssignRoots(prefixes, cfg.Heads, cfg.HeadAffinity)
+	}
+
+	// Budget counts measured IPs; hedges and verification come on top
+	ips := cfg.Budget + cfg.TopN*cfg.VerifySamples
+	if cfg.Hedge {
+		ips += int(float64(cfg.Budget) * max(cfg.HedgeBudget, 0))
+	}
+	samples := max(req.Probe.Samples, 1)
+	p.Probes = ips * samples
+	rounds := time.Duration((ips + cfg.Concurrency - 1) / cfg.Concurrency)
+	gaps := time.Duration(samples-1) * req.Probe.SampleInterval
+	timeout := time.Duration(req.TimeoutMS()) * time.Millisecond
+	p.MinDuration = rounds * (time.Duration(samples)*min(planProbeMS*time.Millisecond, timeout) + gaps)
+	p.MaxDuration = rounds * (time.Duration(samples*(req.Probe.Retries+1))*timeout + gaps)
+	return p, nil
+}
+
+// inputPrefixes loads the deduplicated input prefixes of req with their
+// weights, and its exclusion. Input prefixes that are entirely excluded
+// are dropped; excluded counts them.
+func inputPrefixes(req Request) (prefixes []netip.Prefix, weights map[netip.Prefix]float64, exclude cidr.Exclusion, excluded int, err error) {
+	if prefixes, weights, err = loadPrefixes(req); err != nil {
+		return nil, nil, nil, 0, err
+	}
+	if len(prefixes) == 0 {
+		return nil, nil, nil, 0, errors.New("no CIDR provided (use --cidr or --cidr-file)")
+	}
+	if exclude, err = loadExclusion(req); err != nil {
+		return nil, nil, nil, 0, err
+	}
+	if len(exclude) > 0 {
+		kept := prefixes[:0]
+		for _, p := range prefixes {
+			if !exclude.Covers(p) {
+				kept = append(kept, p)
+			}
+		}
+		excluded = len(prefixes) - len(kept)
+		if prefixes = kept; len(prefixes) == 0 {
+			return nil, nil, nil, 0, errors.New("every CIDR is excluded")
+		}
+	}
+	return prefixes, weights, exclude, excluded, nil
+}
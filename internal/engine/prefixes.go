@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"net/netip"
+	"sort"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// PrefixSummary describes one explored prefix of the search tree
+// (Config.PrefixReport). ScoreMS is the search's own quality estimate
+// (posterior latency plus failure rate times the timeout); the mean and
+// percentiles are of the successful latencies observed in this run.
+type PrefixSummary struct {
+	Prefix      netip.Prefix `json:"prefix"`
+	Bits        int          `json:"bits"`
+	Depth       int          `json:"depth"` // levels below its input CIDR
+	Samples     int          `json:"samples"`
+	OK          int          `json:"ok"`
+	Fail        int          `json:"fail"`
+	SuccessRate float64      `json:"success_rate"`
+	ScoreMS     float64      `json:"score_ms"`
+	MeanMS      float64      `json:"mean_ms"`
+	P50MS       float64      `json:"p50_ms"`
+	P90MS       float64      `json:"p90_ms"`
+	Split       bool         `json:"split,omitempty"`
+	Merged      bool         `json:"merged,omitempty"`
+}
+
+// prefixLatencyLog records successful latencies by the tree prefix probed,
+// for the percentiles of the prefix report.
+type prefixLatencyLog map[netip.Prefix][]float64
+
+func (l prefixLatencyLog) add(prefix netip.Prefix, ok bool, totalMS int64) {
+	if ok {
+		l[prefix] = append(l[prefix], float64(totalMS))
+	}
+}
+
+// prefixReport summarizes every tree node that received probes, best
+// score first.
+func (e *Engine) prefixReport(timeoutMS float64) []PrefixSummary {
+	// Latencies of prefixes merged away belong to their merged ancestor
+	latencies := make(map[netip.Prefix][]float64, len(e.prefixLatency))
+	for p, ms := range e.prefixLatency {
+		for bits := p.Bits(); bits >= 0; bits-- {
+			anc, _ := p.Addr().Prefix(bits)
+			if e.tree.GetNode(anc) != nil {
+				latencies[anc] = append(latencies[anc], ms...)
+				break
+			}
+		}
+	}
+
+	var out []PrefixSummary
+	for _, node := range e.tree.AllNodes() {
+		st := node.Stats()
+		if st.Samples == 0 {
+			continue
+		}
+		depth := 0
+		for p := node.Parent; p != nil; p = p.Parent {
+			depth++
+		}
+		ms := latencies[node.Prefix]
+		mean, _ := meanStd(ms)
+		out = append(out, PrefixSummary{
+			Prefix:      node.Prefix,
+			Bits:        node.Prefix.Bits(),
+			Depth:       depth,
+			Samples:     st.Samples,
+			OK:          st.Successes,
+			Fail:        st.Failures,
+			SuccessRate: st.SuccessRate,
+			ScoreMS:     st.Score(timeoutMS),
+			MeanMS:      mean,
+			P50MS:       probe.Percentile(ms, 0.5),
+			P90MS:       probe.Percentile(ms, 0.9),
+			Split:       st.IsSplit,
+			Merged:      st.Merged,
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].ScoreMS != out[j].ScoreMS {
+			return out[i].ScoreMS < out[j].ScoreMS
+		}
+		return out[i].Samples > out[j].Samples
+	})
+	return out
+}
@@ -2,61 +2,304 @@ package engine
 
 import (
 	"container/heap"
+	"fmt"
 	"net/netip"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/bandit"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
 )
 
 // ProbeResult holds the result of a single probe.
+// It is the record format of the probe log.
 type ProbeResult struct {
-	IP     netip.Addr
-	Prefix netip.Prefix
-	HeadID int
-
-	OK        bool
-	Status    int
-	Error     string
-	ConnectMS int64
-	TLSMS     int64
-	TTFBMS    int64
-	TotalMS   int64
-	ScoreMS   float64
-	Trace     map[string]string
+	IP     netip.Addr   `json:"ip"`
+	Port   uint16       `json:"port,omitempty"`
+	Prefix netip.Prefix `json:"prefix"`
+	HeadID *int         `json:"head,omitempty"`  // search head that chose the probe; nil for verification re-probes
+	Phase  string       `json:"phase,omitempty"` // "verify" for verification re-probes
+
+	OK         bool              `json:"ok"`
+	Status     int               `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	ConnectMS  int64             `json:"connect_ms"`
+	TLSMS      int64             `json:"tls_ms"`
+	TTFBMS     int64             `json:"ttfb_ms"`
+	TotalMS    int64             `json:"total_ms"`
+	ScoreMS    float64           `json:"score_ms"`
+	Trace      map[string]string `json:"trace,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	StreamMS   []int64           `json:"stream_ms,omitempty"`
+	TLSVerify  string            `json:"tls_verify,omitempty"`
+	Cert       *probe.CertInfo   `json:"cert,omitempty"`
+	ALPN       string            `json:"alpn,omitempty"`
+	TLSVersion string            `json:"tls_version,omitempty"`
+	HTTPProto  string            `json:"http_proto,omitempty"`
+	Attempts   int               `json:"attempts,omitempty"`
+	When       time.Time         `json:"when"`
+
+	// Multi-sample statistics (-samples-per-ip)
+	Samples   int     `json:"samples,omitempty"`
+	SamplesOK int     `json:"samples_ok,omitempty"`
+	P50MS     int64   `json:"p50_ms,omitempty"`
+	P90MS     int64   `json:"p90_ms,omitempty"`
+	MaxMS     int64   `json:"max_ms,omitempty"`
+	LossPct   float64 `json:"loss_pct,omitempty"`
+	JitterMS  float64 `json:"jitter_ms,omitempty"`
 
 	// Statistics from the prefix at the time of probe
-	PrefixSamples int
-	PrefixOK      int
-	PrefixFail    int
+	PrefixSamples int `json:"prefix_samples"`
+	PrefixOK      int `json:"prefix_ok"`
+	PrefixFail    int `json:"prefix_fail"`
 }
 
 // TopResult is the public result type for output.
 type TopResult struct {
 	IP     netip.Addr   `json:"ip"`
+	Port   uint16       `json:"port,omitempty"`
 	Prefix netip.Prefix `json:"prefix"`
 	OK     bool         `json:"ok"`
 	Status int          `json:"status"`
 	Error  string       `json:"error,omitempty"`
 
-	ConnectMS int64             `json:"connect_ms"`
-	TLSMS     int64             `json:"tls_ms"`
-	TTFBMS    int64             `json:"ttfb_ms"`
-	TotalMS   int64             `json:"total_ms"`
-	ScoreMS   float64           `json:"score_ms"`
-	Trace     map[string]string `json:"trace,omitempty"`
+	ConnectMS  int64             `json:"connect_ms"`
+	TLSMS      int64             `json:"tls_ms"`
+	TTFBMS     int64             `json:"ttfb_ms"`
+	TotalMS    int64             `json:"total_ms"`
+	ScoreMS    float64           `json:"score_ms"`
+	Trace      map[string]string `json:"trace,omitempty"`
+	TLSVerify  string            `json:"tls_verify,omitempty"`
+	Cert       *probe.CertInfo   `json:"cert,omitempty"`
+	ALPN       string            `json:"alpn,omitempty"`
+	TLSVersion string            `json:"tls_version,omitempty"`
+	HTTPProto  string            `json:"http_proto,omitempty"`
+	Attempts   int               `json:"attempts,omitempty"`
+
+	// Multi-sample statistics (-samples-per-ip)
+	Samples   int     `json:"samples,omitempty"`
+	SamplesOK int     `json:"samples_ok,omitempty"`
+	P50MS     int64   `json:"p50_ms,omitempty"`
+	P90MS     int64   `json:"p90_ms,omitempty"`
+	MaxMS     int64   `json:"max_ms,omitempty"`
+	LossPct   float64 `json:"loss_pct,omitempty"`
+	JitterMS  float64 `json:"jitter_ms,omitempty"`
 
 	DownloadOK    bool    `json:"download_ok"`
 	DownloadBytes int64   `json:"download_bytes"`
 	DownloadMS    int64   `json:"download_ms"`
 	DownloadMbps  float64 `json:"download_mbps"`
+	DownloadMBps  float64 `json:"download_mb_per_sec"`
 	DownloadError string  `json:"download_error,omitempty"`
 
+	// Path length (-hops-top)
+	Hops int         `json:"hops,omitempty"`
+	Path []probe.Hop `json:"path,omitempty"`
+
 	PrefixSamples int `json:"prefix_samples"`
 	PrefixOK      int `json:"prefix_ok"`
 	PrefixFail    int `json:"prefix_fail"`
+
+	// GeoIP annotation (only set when a GeoIP database is loaded)
+	Country string `json:"country,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+
+	// Verification round (only set when verification is enabled)
+	VerifySamples   int     `json:"verify_samples,omitempty"`
+	VerifyOK        int     `json:"verify_ok,omitempty"`
+	VerifyStreak    int     `json:"verify_streak,omitempty"`
+	VerifyLatencyMS float64 `json:"verify_latency_ms,omitempty"`
+	VerifyStdMS     float64 `json:"verify_std_ms,omitempty"`
+	Reliability     float64 `json:"reliability,omitempty"`
+	Stale           bool    `json:"stale,omitempty"` // below VerifyMinSuccess (VerifyKeepStale)
+
+	// Components are the weighted parts of ScoreMS (successful results)
+	Components *ScoreComponents `json:"score_components,omitempty"`
+
+	// Explain decomposes ScoreMS (only set with Config.Explain)
+	Explain *ScoreExplain `json:"explain,omitempty"`
+}
+
+// ScoreExplain breaks a result's ScoreMS down into its components.
+type ScoreExplain struct {
+	// Latency statistic the score is based on (e.g. "total_ms, single sample").
+	LatencyStat string `json:"latency_stat"`
+	// LatencyMS is the raw value of that statistic.
+	LatencyMS float64 `json:"latency_ms"`
+	// BaselineMS is the calibrated baseline subtracted from the latency.
+	BaselineMS float64 `json:"baseline_ms"`
+	// FailurePenaltyMS replaces the latency when the probe failed.
+	FailurePenaltyMS float64 `json:"failure_penalty_ms"`
+	// ColoBonusMS is the latency discount for landing on a preferred colo.
+	ColoBonusMS float64 `json:"colo_bonus_ms,omitempty"`
+	// LossPenaltyMS is the failure penalty weighted by the sample loss rate.
+	LossPenaltyMS float64 `json:"loss_penalty_ms,omitempty"`
+
+	// Prefix prior at the time of the probe (informs selection, not the score).
+	PrefixSuccessRate float64 `json:"prefix_success_rate"`
+	PrefixMeanMS      float64 `json:"prefix_mean_ms"`
+
+	// SearchScoreMS is the score before the verification round.
+	SearchScoreMS float64 `json:"search_score_ms"`
+	// ReliabilityPenaltyMS is the reliability surcharge added on top of the
+	// verified latency.
+	ReliabilityPenaltyMS float64 `json:"reliability_penalty_ms,omitempty"`
+	// VerifyAdjustMS is ScoreMS - SearchScoreMS after verification.
+	VerifyAdjustMS float64 `json:"verify_adjust_ms,omitempty"`
 }
 
 // Response holds the complete search response.
 type Response struct {
 	Top []TopResult `json:"top"`
+
+	// Failures lists failed probes grouped by prefix (Config.FailureReport).
+	Failures []FailureGroup `json:"failures,omitempty"`
+
+	// Latency is the latency distribution of all probes
+	// (Config.LatencyReport).
+	Latency *LatencyReport `json:"latency,omitempty"`
+
+	// Prefixes summarizes every explored prefix, best score first
+	// (Config.PrefixReport).
+	Prefixes []PrefixSummary `json:"prefixes,omitempty"`
+
+	// ByColo holds the best Config.ColoTopN successful results of every
+	// observed colo (trace "colo"), best first.
+	ByColo map[string][]TopResult `json:"by_colo,omitempty"`
+
+	// Stats summarizes the run.
+	Stats RunStats `json:"stats"`
+
+	// Config is the configuration the run used, after defaults, and Probe
+	// the probe settings.
+	Config Config       `json:"config"`
+	Probe  ProbeSummary `json:"probe"`
+
+	// Tree is the search tree after the run, for persisting with Save.
+	Tree *bandit.ArmTree `json:"-"`
+}
+
+// ProbeSummary is the probe configuration a run reports in
+// Response.Probe. Secrets (headers, WARP keys, the client certificate,
+// the proxy password) are left out.
+type ProbeSummary struct {
+	Backend          string   `json:"backend,omitempty"`
+	Mode             string   `json:"mode,omitempty"`
+	Scheme           string   `json:"scheme,omitempty"`
+	SNI              string   `json:"sni,omitempty"`
+	Host             string   `json:"host,omitempty"`
+	Path             string   `json:"path,omitempty"`
+	Method           string   `json:"method,omitempty"`
+	Port             uint16   `json:"port,omitempty"`
+	Ports            []uint16 `json:"ports,omitempty"`
+	TimeoutMS        int64    `json:"timeout_ms"`
+	ExpectStatus     string   `json:"expect_status,omitempty"`
+	BodyLimit        int64    `json:"body_limit"`
+	Insecure         bool     `json:"insecure,omitempty"`
+	Proxy            string   `json:"proxy,omitempty"`
+	Timing           string   `json:"timing,omitempty"`
+	NoKeepAlive      bool     `json:"no_keep_alive,omitempty"`
+	TLSFingerprint   string   `json:"tls_fingerprint,omitempty"`
+	TraceParser      string   `json:"trace_parser,omitempty"`
+	Samples          int      `json:"samples,omitempty"`
+	SampleStat       string   `json:"sample_stat,omitempty"`
+	SampleIntervalMS int64    `json:"sample_interval_ms,omitempty"`
+	Retries          int      `json:"retries,omitempty"`
+	RetryBackoffMS   int64    `json:"retry_backoff_ms,omitempty"`
+}
+
+func summarizeProbe(c probe.Config) ProbeSummary {
+	s := ProbeSummary{
+		Backend:          c.Backend,
+		Mode:             c.Mode,
+		Scheme:           c.Scheme,
+		SNI:              c.SNI,
+		Host:             c.HostHeader,
+		Path:             c.Path,
+		Method:           c.Method,
+		Port:             c.Port,
+		Ports:            c.Ports,
+		TimeoutMS:        c.Timeout.Milliseconds(),
+		BodyLimit:        c.BodyLimit,
+		Insecure:         c.Insecure,
+		Timing:           c.Timing,
+		NoKeepAlive:      c.NoKeepAlive,
+		TLSFingerprint:   c.TLSFingerprint,
+		TraceParser:      c.TraceParser,
+		Samples:          c.Samples,
+		SampleStat:       c.SampleStat,
+		SampleIntervalMS: c.SampleInterval.Milliseconds(),
+		Retries:          c.Retries,
+		RetryBackoffMS:   c.RetryBackoff.Milliseconds(),
+	}
+	var codes []string
+	for _, r := range c.ExpectStatus {
+		if r.Lo == r.Hi {
+			codes = append(codes, strconv.Itoa(r.Lo))
+		} else {
+			codes = append(codes, fmt.Sprintf("%d-%d", r.Lo, r.Hi))
+		}
+	}
+	s.ExpectStatus = strings.Join(codes, ",")
+	if c.Proxy != nil {
+		s.Proxy = c.Proxy.Redacted()
+	}
+	return s
+}
+
+// RunStats summarizes a search run. Probes count this run only, not the
+// part of a resumed run done before the checkpoint.
+type RunStats struct {
+	Started      time.Time `json:"started"`
+	DurationMS   int64     `json:"duration_ms"`
+	Probes       int64     `json:"probes"`
+	Successes    int64     `json:"successes"`
+	Failures     int64     `json:"failures"`
+	ProbesPerSec float64   `json:"probes_per_sec"`
+	Hedges       int64     `json:"hedges"`
+
+	// Errors counts failed probes by error kind (probe.ErrorKind).
+	Errors map[string]int `json:"errors,omitempty"`
+
+	// Rejected counts addresses skipped by Config.RequireASN and
+	// RequireCountry. They are not probes: most of them are not charged to
+	// the budget, and none appear in Failures or the failure report.
+	Rejected int64 `json:"rejected,omitempty"`
+
+	// TreeNodes is the size of the search tree; PrefixesExplored counts
+	// its nodes that received at least one probe.
+	TreeNodes        int `json:"tree_nodes"`
+	PrefixesExplored int `json:"prefixes_explored"`
+
+	// Partial marks a run stopped by its context (an interrupt or
+	// deadline) before its budget was spent, or during the verification:
+	// Top is the snapshot at that point, not (fully) verified and without
+	// candidates dropped for failing verification.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// Progress is a snapshot of a running search (Request.OnProgress).
+// Completed counts against Budget and includes a resumed run's earlier
+// probes; Probes and Successes count this run only (like RunStats).
+type Progress struct {
+	Completed int64
+	Budget    int
+	Probes    int64
+	Successes int64
+	Elapsed   time.Duration
+	Hedges    int64
+	TreeNodes int
+	Heads     []HeadState
+}
+
+// HeadState describes what a search head is working on: its current
+// focus and the prefixes it explored most recently (newest first).
+type HeadState struct {
+	ID     int
+	Focus  netip.Prefix
+	Recent []netip.Prefix
 }
 
 // topNHeap is a max-heap of TopResult ordered by ScoreMS.
@@ -100,13 +343,14 @@ func NewTopNCollector(n int) *TopNCollector {
 	}
 }
 
-// Consider adds a result to the collector if it qualifies.
-func (c *TopNCollector) Consider(r TopResult) {
+// Consider adds a result to the collector if it qualifies and reports
+// whether the top results changed.
+func (c *TopNCollector) Consider(r TopResult) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.n <= 0 {
-		return
+		return false
 	}
 
 	// Check for duplicate IP
@@ -116,15 +360,16 @@ func (c *TopNCollector) Consider(r TopResult) {
 			c.heap.items[idx] = r
 			heap.Fix(c.heap, idx)
 			c.rebuildIPMap()
+			return true
 		}
-		return
+		return false
 	}
 
 	// If heap is not full, just add
 	if c.heap.Len() < c.n {
 		heap.Push(c.heap, r)
 		c.rebuildIPMap()
-		return
+		return true
 	}
 
 	// Heap is full, check if new result is better than worst
@@ -136,7 +381,9 @@ func (c *TopNCollector) Consider(r TopResult) {
 		// Add the new one
 		heap.Push(c.heap, r)
 		c.rebuildIPMap()
+		return true
 	}
+	return false
 }
 
 // rebuildIPMap rebuilds the IP -> index map after heap modifications.
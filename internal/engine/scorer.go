@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// Scorer maps a successful probe result to the latency, in milliseconds,
+// that the search optimizes (lower is better). The engine turns it into
+// ScoreMS by subtracting Config.BaselineMS and adding loss/reliability
+// penalties; failed probes always score 2x the timeout.
+type Scorer interface {
+	LatencyMS(r probe.Result) float64
+}
+
+// TotalScorer scores results by TotalMS. It is the default Scorer.
+type TotalScorer struct{}
+
+// LatencyMS implements Scorer.
+func (TotalScorer) LatencyMS(r probe.Result) float64 { return float64(r.TotalMS) }
+
+// PhaseWeights is a Scorer that weights the phases of an HTTP probe:
+// TCP connect (ConnectMS), TLS handshake (TLSMS), waiting for the response
+// after the handshakes (TTFBMS-ConnectMS-TLSMS) and reading it
+// (TotalMS-TTFBMS). With all weights 1 the score equals TotalMS; results
+// without a phase breakdown (e.g. icmp, warp) are scored by TotalMS.
+type PhaseWeights struct {
+	Connect  float64 `json:"connect"`
+	TLS      float64 `json:"tls"`
+	TTFB     float64 `json:"ttfb"`
+	Transfer float64 `json:"transfer"`
+}
+
+// DefaultPhaseWeights weights every phase 1 (the score equals TotalMS).
+func DefaultPhaseWeights() PhaseWeights {
+	return PhaseWeights{Connect: 1, TLS: 1, TTFB: 1, Transfer: 1}
+}
+
+// Validate checks that no weight is negative.
+func (w PhaseWeights) Validate() error {
+	if w.Connect < 0 || w.TLS < 0 || w.TTFB < 0 || w.Transfer < 0 {
+		return fmt.Errorf("phase weights must be >= 0, got connect=%g tls=%g ttfb=%g transfer=%g",
+			w.Connect, w.TLS, w.TTFB, w.Transfer)
+	}
+	return nil
+}
+
+// LatencyMS implements Scorer.
+func (w PhaseWeights) LatencyMS(r probe.Result) float64 {
+	total := float64(r.TotalMS)
+	if r.TTFBMS <= 0 {
+		return total
+	}
+	connect := float64(r.ConnectMS)
+	tls := float64(r.TLSMS)
+	wait := max(float64(r.TTFBMS)-connect-tls, 0)
+	transfer := max(total-float64(r.TTFBMS), 0)
+	// Phases are measured on one sample while TotalMS may be a statistic
+	// over several (-samples-per-ip), so only the weight deltas are applied
+	// on top of TotalMS.
+	score := total + (w.Connect-1)*connect + (w.TLS-1)*tls + (w.TTFB-1)*wait + (w.Transfer-1)*transfer
+	return max(score, 0)
+}
+
+// Objective weights the components of the composite score. Each weighted
+// component is reported in TopResult.Components and ScoreMS is their sum.
+type Objective struct {
+	// Latency weights the Scorer latency minus Config.BaselineMS.
+	Latency float64 `json:"latency"`
+	// Tail weights the p90 latency of -samples-per-ip (the latency itself
+	// for single-sample probes).
+	Tail float64 `json:"tail"`
+	// Loss weights the lost fraction of samples times the failure penalty
+	// (2x timeout).
+	Loss float64 `json:"loss"`
+	// Bandwidth weights the download time per MB of the download test
+	// (see ApplyBandwidth).
+	Bandwidth float64 `json:"bandwidth"`
+}
+
+// DefaultObjective scores by latency and loss only.
+func DefaultObjective() Objective {
+	return Objective{Latency: 1, Loss: 1}
+}
+
+// Validate checks that no weight is negative.
+func (o Objective) Validate() error {
+	if o.Latency < 0 || o.Tail < 0 || o.Loss < 0 || o.Bandwidth < 0 {
+		return fmt.Errorf("objective weights must be >= 0, got latency=%g tail=%g loss=%g bandwidth=%g",
+			o.Latency, o.Tail, o.Loss, o.Bandwidth)
+	}
+	return nil
+}
+
+// ScoreComponents are the weighted parts of a composite ScoreMS.
+type ScoreComponents struct {
+	LatencyMS     float64 `json:"latency_ms"`
+	TailMS        float64 `json:"tail_ms,omitempty"`
+	LossMS        float64 `json:"loss_ms,omitempty"`
+	ReliabilityMS float64 `json:"reliability_ms,omitempty"`
+	BandwidthMS   float64 `json:"bandwidth_ms,omitempty"`
+}
+
+// Total returns the sum of the components.
+func (c ScoreComponents) Total() float64 {
+	return c.LatencyMS + c.TailMS + c.LossMS + c.ReliabilityMS + c.BandwidthMS
+}
+
+// ApplyBandwidth adds the bandwidth component (weight x milliseconds per
+// MB, or failMS for failed downloads) to download-tested rows and re-sorts
+// them by the new ScoreMS. Rows without a download test are left alone.
+func ApplyBandwidth(rows []TopResult, weight, failMS float64) {
+	if weight <= 0 {
+		return
+	}
+	for i := range rows {
+		r := &rows[i]
+		if r.DownloadBytes == 0 && r.DownloadError == "" && !r.DownloadOK {
+			continue
+		}
+		msPerMB := failMS
+		if r.DownloadOK && r.DownloadMbps > 0 {
+			msPerMB = 8000 / r.DownloadMbps
+		}
+		comp := ScoreComponents{LatencyMS: r.ScoreMS}
+		if r.Components != nil {
+			comp = *r.Components
+		}
+		comp.BandwidthMS = weight * msPerMB
+		r.Components = &comp
+		r.ScoreMS = comp.Total()
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].ScoreMS < rows[j].ScoreMS })
+}
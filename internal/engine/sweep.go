@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"net/netip"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/bandit"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/cidr"
+)
+
+// sweep enumerates every address of a small prefix once. Offsets are
+// visited as start + i*stride modulo the prefix size; with an odd stride
+// over a power-of-two size this is a permutation, so probes spread over
+// the prefix instead of walking it in address order.
+type sweep struct {
+	start, stride, next uint64
+}
+
+// sweepable reports whether a prefix with hostBits host bits is small
+// enough to be swept (Config.SweepHosts).
+func (e *Engine) sweepable(hostBits int) bool {
+	return e.cfg.SweepHosts > 0 && hostBits < 31 && 1<<hostBits <= e.cfg.SweepHosts
+}
+
+// sweepIP returns the next unprobed address of prefix in its sweep order,
+// or the zero Addr once the sweep is complete.
+func (e *Engine) sweepIP(prefix netip.Prefix, hostBits int, head *bandit.SearchHead) netip.Addr {
+	size := uint64(1) << hostBits
+	s, ok := e.sweeps[prefix]
+	if !ok {
+		s = &sweep{
+			start:  uint64(head.Sampler.SampleUniform() * float64(size)),
+			stride: uint64(head.Sampler.SampleUniform()*float64(size)) | 1,
+		}
+		e.sweeps[prefix] = s
+	}
+	for s.next < size {
+		ip := cidr.NthAddr(prefix, (s.start+s.next*s.stride)&(size-1))
+		s.next++
+		if !e.exclude.Contains(ip) && e.seen.claim(ip, hostBits) {
+			return ip
+		}
+	}
+	return netip.Addr{}
+}
@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/bandit"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// verifyTop re-probes every top candidate VerifySamples times, computes a
+// reliability score from the outcomes and re-ranks the candidates by a
+// combined reliability+latency score. Candidates whose verified success
+// rate is below VerifyMinSuccess are dropped, unless ctx was cancelled
+// during the verification (returned as its error): their failures may be
+// cut-off re-probes.
+func (e *Engine) verifyTop(ctx context.Context, top []TopResult, probeCfg probe.Config, timeoutMS float64) ([]TopResult, error) {
+	if e.cfg.VerifySamples <= 0 || len(top) == 0 {
+		return top, nil
+	}
+
+	sem := make(chan struct{}, e.cfg.Concurrency)
+	var wg sync.WaitGroup
+	samples := make([][]probe.Result, len(top))
+	for i := range top {
+		wg.Add(1)
+		go func(r *TopResult, results *[]probe.Result) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			*results = make([]probe.Result, 0, e.cfg.VerifySamples)
+			for k := 0; k < e.cfg.VerifySamples; k++ {
+				pctx, cancel := context.WithTimeout(ctx, probeCfg.ProbeTimeout())
+				*results = append(*results, e.backend.Probe(pctx, r.IP))
+				cancel()
+				if ctx.Err() != nil {
+					return
+				}
+			}
+			e.applyVerification(r, *results, timeoutMS)
+		}(&top[i], &samples[i])
+	}
+	wg.Wait()
+	interrupted := ctx.Err()
+
+	// The re-probes are logged here, not by the workers, so that the probe
+	// log is only ever written from one goroutine.
+	for i, results := range samples {
+		var stats bandit.ArmStats
+		if node := e.tree.GetNode(top[i].Prefix); node != nil {
+			stats = node.Stats()
+		}
+		for _, res := range results {
+			score := timeoutMS * 2
+			if res.OK {
+				score = e.scoreComponents(res, e.resultLatency(res), res.LossPct/100, timeoutMS).Total()
+			}
+			e.recordProbe(top[i].IP, top[i].Prefix, -1, "verify", res, score, stats)
+		}
+	}
+
+	kept := top[:0]
+	for _, r := range top {
+		// Candidates left unverified by cancellation are kept as they are.
+		if interrupted == nil && r.VerifySamples > 0 && float64(r.VerifyOK) < e.cfg.VerifyMinSuccess*float64(r.VerifySamples) {
+			if e.cfg.VerifyKeepStale {
+				r.Stale = true
+				kept = append(kept, r)
+				continue
+			}
+			if e.cfg.Verbose {
+				fmt.Fprintf(os.Stderr, "verify: dropped %s (%d/%d ok)\n", r.IP, r.VerifyOK, r.VerifySamples)
+			}
+			continue
+		}
+		kept = append(kept, r)
+	}
+	top = kept
+
+	sort.SliceStable(top, func(i, j int) bool {
+		if top[i].Stale != top[j].Stale {
+			return !top[i].Stale
+		}
+		return top[i].ScoreMS < top[j].ScoreMS
+	})
+	return top, interrupted
+}
+
+// applyVerification fills the verification fields of r and replaces its
+// score with the combined reliability+latency score.
+//
+// Reliability is in [0,1] and multiplies three factors: the success rate,
+// the square root of the longest success streak as a fraction of samples,
+// and 1/(1+cv) where cv is the coefficient of variation of the successful
+// latencies. The combined score inflates the verified median latency by up
+// to ReliabilityWeight for a completely unreliable candidate.
+func (e *Engine) applyVerification(r *TopResult, results []probe.Result, timeoutMS float64) {
+	var (
+		ok, streak, best int
+		lat              []float64
+	)
+	for _, res := range results {
+		e.checkColo(&res)
+		if res.OK {
+			ok++
+			streak++
+			if streak > best {
+				best = streak
+			}
+			lat = append(lat, e.resultLatency(res))
+		} else {
+			streak = 0
+		}
+	}
+
+	n := len(results)
+	r.VerifySamples = n
+	r.VerifyOK = ok
+	r.VerifyStreak = best
+	if n == 0 {
+		return
+	}
+
+	latency := timeoutMS * 2
+	reliability := 0.0
+	if ok > 0 {
+		mean, std := meanStd(lat)
+		latency = e.latencyScore(probe.Percentile(lat, 0.5))
+		r.VerifyStdMS = std
+
+		cv := 0.0
+		if mean > 0 {
+			cv = std / mean
+		}
+		successRate := float64(ok) / float64(n)
+		streakFrac := float64(best) / float64(n)
+		reliability = successRate * math.Sqrt(streakFrac) / (1 + cv)
+	}
+
+	penalty := latency * max(e.cfg.ReliabilityWeight, 0) * (1 - reliability)
+	r.VerifyLatencyMS = latency
+	r.Reliability = reliability
+	r.ScoreMS = latency + penalty
+	if ok > 0 {
+		// Verified reliability replaces the search's loss estimate.
+		comp := ScoreComponents{
+			LatencyMS:     e.cfg.Objective.Latency * latency,
+			TailMS:        e.cfg.Objective.Tail * e.latencyScore(probe.Percentile(lat, 0.9)),
+			ReliabilityMS: penalty,
+		}
+		r.Components = &comp
+		r.ScoreMS = comp.Total()
+	} else {
+		r.Components = nil
+	}
+
+	if r.Explain != nil {
+		ex := *r.Explain
+		ex.ReliabilityPenaltyMS = penalty
+		ex.VerifyAdjustMS = r.ScoreMS - ex.SearchScoreMS
+		r.Explain = &ex
+	}
+}
+
+// meanStd returns the mean and sample standard deviation of xs.
+func meanStd(xs []float64) (float64, float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	mean := sum / float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+	var sq float64
+	for _, x := range xs {
+		sq += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(xs)-1))
+}
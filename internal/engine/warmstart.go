@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/bandit"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/input"
+)
+
+// warmResult is the subset of a TopResult/ProbeResult line used to warm
+// start a run.
+type warmResult struct {
+	IP      netip.Addr `json:"ip"`
+	OK      bool       `json:"ok"`
+	TotalMS int64      `json:"total_ms"`
+	ScoreMS float64    `json:"score_ms"`
+}
+
+// warmStart seeds the tree from a previous run's jsonl output (or probe
+// log, gzip-compressed or not): every result inside the input CIDRs becomes an observation of the
+// deepest existing node containing its IP (the logged prefix may come from
+// a tree split differently), and the nodes of successful results are
+// queued, best first, as the first probes of the run. It returns the
+// number of used results.
+func (e *Engine) warmStart(r io.Reader, timeoutMS float64) (int, error) {
+	r, err := input.Decompress(r)
+	if err != nil {
+		return 0, err
+	}
+	best := make(map[netip.Prefix]float64)
+	used := 0
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		var w warmResult
+		if err := json.Unmarshal([]byte(text), &w); err != nil {
+			return used, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !w.IP.IsValid() || e.exclude.Covers(netip.PrefixFrom(w.IP, w.IP.BitLen())) {
+			continue
+		}
+		node := e.tree.Deepest(w.IP)
+		if node == nil {
+			continue
+		}
+		prefix := node.Prefix
+		e.tree.Update(prefix, w.OK, float64(w.TotalMS), timeoutMS)
+		used++
+		if !w.OK {
+			continue
+		}
+		score := w.ScoreMS
+		if score <= 0 {
+			score = float64(w.TotalMS)
+		}
+		if s, ok := best[prefix]; !ok || score < s {
+			best[prefix] = score
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return used, err
+	}
+
+	e.warm = make([]netip.Prefix, 0, len(best))
+	for p := range best {
+		e.warm = append(e.warm, p)
+	}
+	sort.Slice(e.warm, func(i, j int) bool { return best[e.warm[i]] < best[e.warm[j]] })
+	return used, nil
+}
+
+// nextWarm pops the best queued warm-start prefix owned by head.
+func (e *Engine) nextWarm(head *bandit.SearchHead) netip.Prefix {
+	for i, p := range e.warm {
+		if head.Owns(p) {
+			e.warm = append(e.warm[:i], e.warm[i+1:]...)
+			return p
+		}
+	}
+	return netip.Prefix{}
+}
@@ -0,0 +1,140 @@
+// Package geoip looks up country and ASN information for IP addresses
+// from MaxMind-format (.mmdb) databases.
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Info holds the geo/ASN attributes of an address.
+type Info struct {
+	Country string `json:"country,omitempty"` // ISO 3166-1 alpha-2, upper case
+	ASN     uint   `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+}
+
+// record matches the fields shared by GeoLite2/GeoIP2 Country, City and
+// ASN databases (and compatible DB-IP/IPinfo exports).
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN uint   `maxminddb:"autonomous_system_number"`
+	Org string `maxminddb:"autonomous_system_organization"`
+}
+
+// DB wraps one or more mmdb readers.
+type DB struct {
+	readers []*maxminddb.Reader
+}
+
+// Open opens the given database files. Empty paths are skipped; a country
+// database and an ASN database are typically combined.
+func Open(paths ...string) (*DB, error) {
+	db := &DB{}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		r, err := maxminddb.Open(p)
+		if err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("open geoip db %q: %w", p, err)
+		}
+		db.readers = append(db.readers, r)
+	}
+	if len(db.readers) == 0 {
+		return nil, errors.New("no geoip database given")
+	}
+	return db, nil
+}
+
+// Lookup returns the merged info for ip from all databases.
+func (d *DB) Lookup(ip netip.Addr) Info {
+	var info Info
+	if d == nil {
+		return info
+	}
+	for _, r := range d.readers {
+		var rec record
+		if err := r.Lookup(ip.AsSlice(), &rec); err != nil {
+			continue
+		}
+		if info.Country == "" && rec.Country.ISOCode != "" {
+			info.Country = strings.ToUpper(rec.Country.ISOCode)
+		}
+		if info.ASN == 0 && rec.ASN != 0 {
+			info.ASN = rec.ASN
+			info.Org = rec.Org
+		}
+	}
+	return info
+}
+
+// Close closes all databases.
+func (d *DB) Close() error {
+	var errs []error
+	for _, r := range d.readers {
+		errs = append(errs, r.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Constraints restricts acceptable addresses by ASN and/or country.
+// Empty lists accept everything.
+type Constraints struct {
+	ASNs      []uint
+	Countries []string
+}
+
+// Empty reports whether no constraint is set.
+func (c Constraints) Empty() bool {
+	return len(c.ASNs) == 0 && len(c.Countries) == 0
+}
+
+// Check returns "" if info satisfies the constraints, otherwise a short
+// rejection reason suitable for a probe error string.
+func (c Constraints) Check(info Info) string {
+	if len(c.ASNs) > 0 {
+		ok := false
+		for _, asn := range c.ASNs {
+			if info.ASN == asn {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return "rejected_asn"
+		}
+	}
+	if len(c.Countries) > 0 {
+		ok := false
+		for _, cc := range c.Countries {
+			if strings.EqualFold(info.Country, cc) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return "rejected_country"
+		}
+	}
+	return ""
+}
+
+// ParseASN parses "13335" or "AS13335".
+func ParseASN(s string) (uint, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "AS"), "as")
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("parse asn %q: %w", s, err)
+	}
+	return uint(n), nil
+}
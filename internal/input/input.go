@@ -0,0 +1,45 @@
+// Package input reads the files mcis takes as input (result and probe
+// logs, IP lists), decompressing gzip-compressed ones transparently.
+package input
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// Decompress returns the content of r, gunzipped when it starts with the
+// gzip magic bytes.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// Open opens path ("-" is stdin) for reading through Decompress. Closing
+// the returned reader closes the file.
+func Open(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		r, err := Decompress(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(r), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Decompress(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
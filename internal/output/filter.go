@@ -0,0 +1,340 @@
+package output
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+)
+
+// Filter reports whether a result should be written (see ParseFilter).
+type Filter func(engine.TopResult) bool
+
+// FilterRows returns the rows f keeps, in order.
+func FilterRows(rows []engine.TopResult, f Filter) []engine.TopResult {
+	return filterRows(rows, f)
+}
+
+// sortOrders are the keys accepted by SortRows. Ties keep their previous
+// (score) order.
+var sortOrders = map[string]func(a, b engine.TopResult) bool{
+	"score":    func(a, b engine.TopResult) bool { return a.ScoreMS < b.ScoreMS },
+	"total":    func(a, b engine.TopResult) bool { return a.TotalMS < b.TotalMS },
+	"connect":  func(a, b engine.TopResult) bool { return a.ConnectMS < b.ConnectMS },
+	"tls":      func(a, b engine.TopResult) bool { return a.TLSMS < b.TLSMS },
+	"ttfb":     func(a, b engine.TopResult) bool { return a.TTFBMS < b.TTFBMS },
+	"colo":     func(a, b engine.TopResult) bool { return a.Trace["colo"] < b.Trace["colo"] },
+	"download": func(a, b engine.TopResult) bool { return a.DownloadMbps > b.DownloadMbps },
+}
+
+// SortRows sorts rows in place by key: score, total, connect, tls, ttfb
+// (ascending), colo (alphabetical) or download (fastest first).
+func SortRows(rows []engine.TopResult, key string) error {
+	less, ok := sortOrders[key]
+	if !ok {
+		return fmt.Errorf("unknown sort key %q", key)
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return less(rows[i], rows[j]) })
+	return nil
+}
+
+// filterFields are the result fields a filter expression can use, by
+// their JSON names; "trace.<key>" reads a trace key.
+var filterFields = map[string]func(r engine.TopResult) any{
+	"ip":            func(r engine.TopResult) any { return r.IP.String() },
+	"prefix":        func(r engine.TopResult) any { return r.Prefix.String() },
+	"ok":            func(r engine.TopResult) any { return r.OK },
+	"status":        func(r engine.TopResult) any { return float64(r.Status) },
+	"error":         func(r engine.TopResult) any { return r.Error },
+	"port":          func(r engine.TopResult) any { return float64(r.Port) },
+	"connect_ms":    func(r engine.TopResult) any { return float64(r.ConnectMS) },
+	"tls_ms":        func(r engine.TopResult) any { return float64(r.TLSMS) },
+	"ttfb_ms":       func(r engine.TopResult) any { return float64(r.TTFBMS) },
+	"total_ms":      func(r engine.TopResult) any { return float64(r.TotalMS) },
+	"score_ms":      func(r engine.TopResult) any { return r.ScoreMS },
+	"colo":          func(r engine.TopResult) any { return r.Trace["colo"] },
+	"country":       func(r engine.TopResult) any { return r.Country },
+	"asn":           func(r engine.TopResult) any { return float64(r.ASN) },
+	"loss_pct":      func(r engine.TopResult) any { return r.LossPct },
+	"jitter_ms":     func(r engine.TopResult) any { return r.JitterMS },
+	"reliability":   func(r engine.TopResult) any { return r.Reliability },
+	"stale":         func(r engine.TopResult) any { return r.Stale },
+	"download_ok":   func(r engine.TopResult) any { return r.DownloadOK },
+	"download_mbps": func(r engine.TopResult) any { return r.DownloadMbps },
+	"http_proto":    func(r engine.TopResult) any { return r.HTTPProto },
+	"tls_version":   func(r engine.TopResult) any { return r.TLSVersion },
+	"hops":          func(r engine.TopResult) any { return float64(r.Hops) },
+}
+
+// ParseFilter compiles a filter expression such as
+//
+//	ok && status==200 && score_ms<80 && (colo=="HKG" || colo=="NRT")
+//
+// Operands are result fields (JSON names, or trace.<key>), numbers and
+// quoted strings; operators are == != < <= > >=, &&, || and !, with
+// parentheses for grouping. A bare field is true if it is true, non-zero
+// or non-empty.
+func ParseFilter(expr string) (Filter, error) {
+	toks, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{toks: toks}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("filter: unexpected %q", p.toks[p.pos].text)
+	}
+	return func(r engine.TopResult) bool { return truthy(n(r)) }, nil
+}
+
+type filterTokenKind int
+
+const (
+	tokIdent filterTokenKind = iota
+	tokNumber
+	tokString
+	tokOp
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+}
+
+// filterOps lists the operators, longest first so "<=" wins over "<".
+var filterOps = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+func lexFilter(s string) ([]filterToken, error) {
+	var toks []filterToken
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexRune(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("filter: unterminated string")
+			}
+			toks = append(toks, filterToken{tokString, s[i+1 : i+1+end]})
+			i += end + 2
+		case unicode.IsDigit(c) || c == '.' || (c == '-' && i+1 < len(s) && unicode.IsDigit(rune(s[i+1]))):
+			j := i + 1
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, filterToken{tokNumber, s[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_' || s[j] == '.' || s[j] == '-') {
+				j++
+			}
+			toks = append(toks, filterToken{tokIdent, s[i:j]})
+			i = j
+		default:
+			k := slices.IndexFunc(filterOps, func(op string) bool { return strings.HasPrefix(s[i:], op) })
+			if k < 0 {
+				return nil, fmt.Errorf("filter: unexpected %q", s[i:i+1])
+			}
+			toks = append(toks, filterToken{tokOp, filterOps[k]})
+			i += len(filterOps[k])
+		}
+	}
+	return toks, nil
+}
+
+// filterNode evaluates a parsed (sub)expression to a bool, float64 or
+// string.
+type filterNode func(engine.TopResult) any
+
+type filterParser struct {
+	toks []filterToken
+	pos  int
+}
+
+func (p *filterParser) accept(op string) bool {
+	if p.pos < len(p.toks) && p.toks[p.pos].kind == tokOp && p.toks[p.pos].text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r engine.TopResult) any { return truthy(l(r)) || truthy(right(r)) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r engine.TopResult) any { return truthy(l(r)) && truthy(right(r)) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) unary() (filterNode, error) {
+	if p.accept("!") {
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(r engine.TopResult) any { return !truthy(n(r)) }, nil
+	}
+	return p.comparison()
+}
+
+func (p *filterParser) comparison() (filterNode, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !p.accept(op) {
+			continue
+		}
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return func(r engine.TopResult) any { return compare(left(r), op, right(r)) }, nil
+	}
+	return left, nil
+}
+
+func (p *filterParser) operand() (filterNode, error) {
+	if p.accept("(") {
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("filter: missing )")
+		}
+		return n, nil
+	}
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("filter: unexpected end of expression")
+	}
+	t := p.toks[p.pos]
+	p.pos++
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("filter: bad number %q", t.text)
+		}
+		return func(engine.TopResult) any { return v }, nil
+	case tokString:
+		return func(engine.TopResult) any { return t.text }, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			v := t.text == "true"
+			return func(engine.TopResult) any { return v }, nil
+		}
+		if key, isTrace := strings.CutPrefix(t.text, "trace."); isTrace {
+			return func(r engine.TopResult) any { return r.Trace[key] }, nil
+		}
+		get, ok := filterFields[t.text]
+		if !ok {
+			return nil, fmt.Errorf("filter: unknown field %q", t.text)
+		}
+		return filterNode(get), nil
+	}
+	return nil, fmt.Errorf("filter: unexpected %q", t.text)
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return false
+}
+
+// compare applies op to a and b: numerically if both are numbers (a
+// numeric string counts as a number), as strings otherwise.
+func compare(a any, op string, b any) bool {
+	if x, ok := asNumber(a); ok {
+		if y, ok := asNumber(b); ok {
+			switch op {
+			case "==":
+				return x == y
+			case "!=":
+				return x != y
+			case "<":
+				return x < y
+			case "<=":
+				return x <= y
+			case ">":
+				return x > y
+			case ">=":
+				return x >= y
+			}
+		}
+	}
+	x, y := fmt.Sprint(a), fmt.Sprint(b)
+	switch op {
+	case "==":
+		return strings.EqualFold(x, y)
+	case "!=":
+		return !strings.EqualFold(x, y)
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">":
+		return x > y
+	case ">=":
+		return x >= y
+	}
+	return false
+}
+
+func asNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -1,14 +1,18 @@
 package output
 
 import (
+	"bufio"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
 )
 
 // WriteJSONL writes results as JSON Lines format.
@@ -22,48 +26,95 @@ func WriteJSONL(w io.Writer, rows []engine.TopResult) error {
 	return nil
 }
 
-// WriteCSV writes results as CSV format.
-func WriteCSV(w io.Writer, rows []engine.TopResult) error {
+// CSVColumn is one column of WriteCSV (see CSVColumns).
+type CSVColumn struct {
+	name  string
+	value func(rank int, r engine.TopResult) string // rank is 1-based
+}
+
+// csvColumns are the columns WriteCSV writes by default, in order.
+var csvColumns = []CSVColumn{
+	{"rank", func(rank int, r engine.TopResult) string { return strconv.Itoa(rank) }},
+	{"ip", func(_ int, r engine.TopResult) string { return r.IP.String() }},
+	{"prefix", func(_ int, r engine.TopResult) string { return r.Prefix.String() }},
+	{"ok", func(_ int, r engine.TopResult) string { return strconv.FormatBool(r.OK) }},
+	{"status", func(_ int, r engine.TopResult) string { return strconv.Itoa(r.Status) }},
+	{"connect_ms", func(_ int, r engine.TopResult) string { return strconv.FormatInt(r.ConnectMS, 10) }},
+	{"tls_ms", func(_ int, r engine.TopResult) string { return strconv.FormatInt(r.TLSMS, 10) }},
+	{"ttfb_ms", func(_ int, r engine.TopResult) string { return strconv.FormatInt(r.TTFBMS, 10) }},
+	{"total_ms", func(_ int, r engine.TopResult) string { return strconv.FormatInt(r.TotalMS, 10) }},
+	{"score_ms", func(_ int, r engine.TopResult) string { return fmt.Sprintf("%.2f", r.ScoreMS) }},
+	{"samples_prefix", func(_ int, r engine.TopResult) string { return strconv.Itoa(r.PrefixSamples) }},
+	{"ok_prefix", func(_ int, r engine.TopResult) string { return strconv.Itoa(r.PrefixOK) }},
+	{"fail_prefix", func(_ int, r engine.TopResult) string { return strconv.Itoa(r.PrefixFail) }},
+	{"download_ok", func(_ int, r engine.TopResult) string { return strconv.FormatBool(r.DownloadOK) }},
+	{"download_mbps", func(_ int, r engine.TopResult) string { return fmt.Sprintf("%.2f", r.DownloadMbps) }},
+	{"download_ms", func(_ int, r engine.TopResult) string { return strconv.FormatInt(r.DownloadMS, 10) }},
+	{"download_bytes", func(_ int, r engine.TopResult) string { return strconv.FormatInt(r.DownloadBytes, 10) }},
+	{"download_error", func(_ int, r engine.TopResult) string { return r.DownloadError }},
+	{"colo", func(_ int, r engine.TopResult) string { return r.Trace["colo"] }},
+	{"reliability", func(_ int, r engine.TopResult) string { return fmt.Sprintf("%.3f", r.Reliability) }},
+	{"verify_latency_ms", func(_ int, r engine.TopResult) string { return fmt.Sprintf("%.2f", r.VerifyLatencyMS) }},
+	{"verify_ok", func(_ int, r engine.TopResult) string { return strconv.Itoa(r.VerifyOK) }},
+	{"verify_samples", func(_ int, r engine.TopResult) string { return strconv.Itoa(r.VerifySamples) }},
+	{"download_mb_per_sec", func(_ int, r engine.TopResult) string { return fmt.Sprintf("%.2f", r.DownloadMBps) }},
+	{"loss_pct", func(_ int, r engine.TopResult) string { return fmt.Sprintf("%.1f", r.LossPct) }},
+	{"jitter_ms", func(_ int, r engine.TopResult) string { return fmt.Sprintf("%.2f", r.JitterMS) }},
+	{"port", func(_ int, r engine.TopResult) string { return strconv.Itoa(int(r.Port)) }},
+	{"alpn", func(_ int, r engine.TopResult) string { return r.ALPN }},
+	{"tls_version", func(_ int, r engine.TopResult) string { return r.TLSVersion }},
+	{"http_proto", func(_ int, r engine.TopResult) string { return r.HTTPProto }},
+	{"hops", func(_ int, r engine.TopResult) string { return strconv.Itoa(r.Hops) }},
+	{"stale", func(_ int, r engine.TopResult) string { return strconv.FormatBool(r.Stale) }},
+}
+
+// csvTracePrefix selects a trace key as a column, e.g. "trace.loc".
+const csvTracePrefix = "trace."
+
+// CSVColumns resolves column names for WriteCSV: any default column name
+// or "trace.<key>" for a key of the /cdn-cgi/trace response. An empty list
+// selects all default columns.
+func CSVColumns(names []string) ([]CSVColumn, error) {
+	if len(names) == 0 {
+		return csvColumns, nil
+	}
+	cols := make([]CSVColumn, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if key, isTrace := strings.CutPrefix(name, csvTracePrefix); isTrace && key != "" {
+			cols = append(cols, CSVColumn{name, func(_ int, r engine.TopResult) string { return r.Trace[key] }})
+			continue
+		}
+		i := slices.IndexFunc(csvColumns, func(c CSVColumn) bool { return c.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		cols = append(cols, csvColumns[i])
+	}
+	return cols, nil
+}
+
+// WriteCSV writes results as CSV format with the given columns (from
+// CSVColumns; nil writes all default columns).
+func WriteCSV(w io.Writer, rows []engine.TopResult, cols []CSVColumn) error {
+	if cols == nil {
+		cols = csvColumns
+	}
 	cw := csv.NewWriter(w)
 	defer cw.Flush()
 
-	header := []string{
-		"rank", "ip", "prefix",
-		"ok", "status",
-		"connect_ms", "tls_ms", "ttfb_ms", "total_ms",
-		"score_ms", "samples_prefix", "ok_prefix", "fail_prefix",
-		"download_ok", "download_mbps", "download_ms", "download_bytes", "download_error",
-		"colo",
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.name
 	}
 	if err := cw.Write(header); err != nil {
 		return err
 	}
 
+	rec := make([]string, len(cols))
 	for i, r := range rows {
-		colo := ""
-		if r.Trace != nil {
-			colo = r.Trace["colo"]
-		}
-		rec := []string{
-			strconv.Itoa(i + 1),
-			r.IP.String(),
-			r.Prefix.String(),
-			strconv.FormatBool(r.OK),
-			strconv.Itoa(r.Status),
-			strconv.FormatInt(r.ConnectMS, 10),
-			strconv.FormatInt(r.TLSMS, 10),
-			strconv.FormatInt(r.TTFBMS, 10),
-			strconv.FormatInt(r.TotalMS, 10),
-			fmt.Sprintf("%.2f", r.ScoreMS),
-			strconv.Itoa(r.PrefixSamples),
-			strconv.Itoa(r.PrefixOK),
-			strconv.Itoa(r.PrefixFail),
-			strconv.FormatBool(r.DownloadOK),
-			fmt.Sprintf("%.2f", r.DownloadMbps),
-			strconv.FormatInt(r.DownloadMS, 10),
-			strconv.FormatInt(r.DownloadBytes, 10),
-			r.DownloadError,
-			colo,
+		for j, c := range cols {
+			rec[j] = c.value(i+1, r)
 		}
 		if err := cw.Write(rec); err != nil {
 			return err
@@ -73,25 +124,276 @@ func WriteCSV(w io.Writer, rows []engine.TopResult) error {
 	return cw.Error()
 }
 
-// WriteText writes results as human-readable text format.
+// WriteText writes results as human-readable text format, ranked in the
+// given order (best first from the engine, or as sorted by SortRows).
 func WriteText(w io.Writer, rows []engine.TopResult) error {
-	// Ensure stable output
-	sort.SliceStable(rows, func(i, j int) bool { return rows[i].ScoreMS < rows[j].ScoreMS })
+	for i, r := range rows {
+		if _, err := fmt.Fprintf(w, "%d\t%s\n", i+1, textLine(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTextByColo writes results as text grouped by colo: a header line
+// per colo with its best and median score, followed by its results
+// ranked within the group. Colos appear in the order of their first
+// result. Results without a colo are grouped under "-".
+func WriteTextByColo(w io.Writer, rows []engine.TopResult) error {
+	var colos []string
+	groups := make(map[string][]engine.TopResult)
+	for _, r := range rows {
+		colo := r.Trace["colo"]
+		if colo == "" {
+			colo = "-"
+		}
+		if _, seen := groups[colo]; !seen {
+			colos = append(colos, colo)
+		}
+		groups[colo] = append(groups[colo], r)
+	}
+	for _, colo := range colos {
+		g := groups[colo]
+		scores := make([]float64, len(g))
+		for i, r := range g {
+			scores[i] = r.ScoreMS
+		}
+		sort.Float64s(scores)
+		median := scores[len(scores)/2]
+		if len(scores)%2 == 0 {
+			median = (scores[len(scores)/2-1] + median) / 2
+		}
+		if _, err := fmt.Fprintf(w, "%s\tbest=%.1fms\tmedian=%.1fms\tips=%d\n", colo, scores[0], median, len(g)); err != nil {
+			return err
+		}
+		for i, r := range g {
+			if _, err := fmt.Fprintf(w, "  %d\t%s\n", i+1, textLine(r)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// textLine formats one result for the text outputs, without its rank.
+func textLine(r engine.TopResult) string {
+	colo := ""
+	if r.Trace != nil {
+		colo = r.Trace["colo"]
+	}
+	dl := ""
+	if r.DownloadOK || r.DownloadError != "" || r.DownloadMS != 0 || r.DownloadBytes != 0 {
+		dl = fmt.Sprintf("\tdl_ok=%v\tdl_mbps=%.2f\tdl_MBps=%.2f\tdl_ms=%d", r.DownloadOK, r.DownloadMbps, r.DownloadMBps, r.DownloadMS)
+		if r.DownloadError != "" {
+			dl += "\tdl_err=" + r.DownloadError
+		}
+	}
+	geo := ""
+	if r.Country != "" {
+		geo += "\tcountry=" + r.Country
+	}
+	if r.ASN != 0 {
+		geo += fmt.Sprintf("\tasn=AS%d", r.ASN)
+	}
+	if r.Port != 0 && r.Port != probe.DefaultPort && r.Port != probe.HTTPPort {
+		geo += fmt.Sprintf("\tport=%d", r.Port)
+	}
+	if r.HTTPProto != "" {
+		geo += "\tproto=" + r.HTTPProto
+	}
+	if r.TLSVersion != "" {
+		geo += "\ttls=" + r.TLSVersion
+	}
+	if r.TLSVerify != "" && r.TLSVerify != probe.TLSVerifyOK {
+		geo += "\ttls_verify=" + r.TLSVerify
+	}
+	if r.Hops > 0 {
+		geo += fmt.Sprintf("\thops=%d", r.Hops)
+	}
+	if r.Attempts > 1 {
+		geo += fmt.Sprintf("\tattempts=%d", r.Attempts)
+	}
+	if r.Samples > 1 {
+		geo += fmt.Sprintf("\tloss=%.0f%%\tjitter=%.1fms", r.LossPct, r.JitterMS)
+	}
+	verify := ""
+	if r.VerifySamples > 0 {
+		verify = fmt.Sprintf("\trel=%.3f\tverify_ms=%.1f\tverify_ok=%d/%d",
+			r.Reliability, r.VerifyLatencyMS, r.VerifyOK, r.VerifySamples)
+		if r.Stale {
+			verify += "\tstale"
+		}
+	}
+	return fmt.Sprintf("%s\t%.1fms\tok=%v\tstatus=%d\tprefix=%s\tcolo=%s%s%s%s",
+		r.IP.String(), r.ScoreMS, r.OK, r.Status, r.Prefix.String(), colo, geo, verify, dl)
+}
+
+// WriteSummary writes the run summary as indented JSON: the run
+// statistics (probe counts, error kinds, wall time, throughput, prefixes
+// explored), the search and probe configuration used and the top results.
+func WriteSummary(w io.Writer, res engine.Response) error {
+	summary := struct {
+		Stats  engine.RunStats     `json:"stats"`
+		Config engine.Config       `json:"config"`
+		Probe  engine.ProbeSummary `json:"probe"`
+		Top    []engine.TopResult  `json:"top"`
+	}{res.Stats, res.Config, res.Probe, res.Top}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(summary)
+}
+
+// WriteMarkdown writes results as a GitHub-flavored Markdown table.
+func WriteMarkdown(w io.Writer, rows []engine.TopResult) error {
+	if _, err := fmt.Fprint(w, "| Rank | IP | Score (ms) | Colo | Prefix |\n| ---: | --- | ---: | --- | --- |\n"); err != nil {
+		return err
+	}
 	for i, r := range rows {
 		colo := ""
 		if r.Trace != nil {
-			colo = r.Trace["colo"]
+			colo = strings.ReplaceAll(r.Trace["colo"], "|", `\|`)
+		}
+		if _, err := fmt.Fprintf(w, "| %d | `%s` | %.1f | %s | `%s` |\n",
+			i+1, r.IP.String(), r.ScoreMS, colo, r.Prefix.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteHosts writes the successful results as hosts-file lines mapping
+// each IP to domain. With bestPerFamily only the first (best) IPv4 and
+// IPv6 address are written.
+func WriteHosts(w io.Writer, rows []engine.TopResult, domain string, bestPerFamily bool) error {
+	var have4, have6 bool
+	for _, r := range rows {
+		if !r.OK {
+			continue
+		}
+		if bestPerFamily {
+			if r.IP.Is4() {
+				if have4 {
+					continue
+				}
+				have4 = true
+			} else {
+				if have6 {
+					continue
+				}
+				have6 = true
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s %s\n", r.IP.String(), domain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteZone writes the successful results as DNS resource records
+// ("name ttl IN A ip", AAAA for IPv6), e.g. for a zone file or, prefixed
+// with "update add", for nsupdate.
+func WriteZone(w io.Writer, rows []engine.TopResult, name string, ttl int) error {
+	for _, r := range rows {
+		if !r.OK {
+			continue
+		}
+		typ := "A"
+		if r.IP.Is6() {
+			typ = "AAAA"
+		}
+		if _, err := fmt.Fprintf(w, "%s %d IN %s %s\n", name, ttl, typ, r.IP.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteColoTop writes the per-colo top results as text: a header line per
+// colo (ordered by its best score) followed by its ranked results.
+func WriteColoTop(w io.Writer, byColo map[string][]engine.TopResult) error {
+	colos := make([]string, 0, len(byColo))
+	for colo, rows := range byColo {
+		if len(rows) > 0 {
+			colos = append(colos, colo)
 		}
-		dl := ""
-		if r.DownloadOK || r.DownloadError != "" || r.DownloadMS != 0 || r.DownloadBytes != 0 {
-			dl = fmt.Sprintf("\tdl_ok=%v\tdl_mbps=%.2f\tdl_ms=%d", r.DownloadOK, r.DownloadMbps, r.DownloadMS)
-			if r.DownloadError != "" {
-				dl += "\tdl_err=" + r.DownloadError
+	}
+	sort.Slice(colos, func(i, j int) bool {
+		a, b := byColo[colos[i]][0].ScoreMS, byColo[colos[j]][0].ScoreMS
+		if a != b {
+			return a < b
+		}
+		return colos[i] < colos[j]
+	})
+	for _, colo := range colos {
+		rows := byColo[colo]
+		if _, err := fmt.Fprintf(w, "%s\tbest=%.1fms\tips=%d\n", colo, rows[0].ScoreMS, len(rows)); err != nil {
+			return err
+		}
+		for i, r := range rows {
+			if _, err := fmt.Fprintf(w, "  %d\t%s\t%.1fms\tprefix=%s\n", i+1, r.IP.String(), r.ScoreMS, r.Prefix.String()); err != nil {
+				return err
 			}
 		}
-		_, err := fmt.Fprintf(w, "%d\t%s\t%.1fms\tok=%v\tstatus=%d\tprefix=%s\tcolo=%s%s\n",
-			i+1, r.IP.String(), r.ScoreMS, r.OK, r.Status, r.Prefix.String(), colo, dl)
-		if err != nil {
+	}
+	return nil
+}
+
+// WriteFailures writes a failed-probe report as JSON Lines, one prefix per line.
+func WriteFailures(w io.Writer, groups []engine.FailureGroup) error {
+	enc := json.NewEncoder(w)
+	for _, g := range groups {
+		if err := enc.Encode(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latencyBarLen is the width of the longest histogram bar in WriteLatency.
+const latencyBarLen = 40
+
+// WriteLatency writes a latency report as text: overall percentiles, a
+// histogram of successful probe latencies and the per-prefix percentile
+// table (best median first).
+func WriteLatency(w io.Writer, rep *engine.LatencyReport) error {
+	if rep == nil {
+		return fmt.Errorf("no latency report")
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "probes=%d\tok=%d\tp50=%.0fms\tp90=%.0fms\tp99=%.0fms\n\n", rep.Probes, rep.OK, rep.P50MS, rep.P90MS, rep.P99MS)
+
+	peak := 0
+	for _, b := range rep.Buckets {
+		peak = max(peak, b.Count)
+	}
+	lower := int64(0)
+	for _, b := range rep.Buckets {
+		label := fmt.Sprintf("%d-%dms", lower, b.UpToMS)
+		if b.UpToMS == 0 {
+			label = fmt.Sprintf(">%dms", lower)
+		}
+		bar := 0
+		if peak > 0 {
+			bar = (b.Count*latencyBarLen + peak - 1) / peak
+		}
+		fmt.Fprintf(bw, "%12s %7d %s\n", label, b.Count, strings.Repeat("#", bar))
+		lower = b.UpToMS
+	}
+
+	fmt.Fprintf(bw, "\nprefix\tprobes\tok\tmean_ms\tp50_ms\tp90_ms\tp99_ms\n")
+	for _, p := range rep.Prefixes {
+		fmt.Fprintf(bw, "%s\t%d\t%d\t%.1f\t%.0f\t%.0f\t%.0f\n", p.Prefix, p.Probes, p.OK, p.MeanMS, p.P50MS, p.P90MS, p.P99MS)
+	}
+	return bw.Flush()
+}
+
+// WritePrefixes writes the explored-prefix report as JSON Lines, one
+// prefix per line, best score first.
+func WritePrefixes(w io.Writer, prefixes []engine.PrefixSummary) error {
+	enc := json.NewEncoder(w)
+	for _, p := range prefixes {
+		if err := enc.Encode(p); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,83 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// PolicyLine is the data of one proxy policy line written by WritePolicy.
+type PolicyLine struct {
+	Name    string // mcis-1, mcis-2, ...
+	Rank    int
+	IP      string
+	Port    uint16
+	SNI     string
+	UUID    string
+	Path    string
+	Colo    string
+	ScoreMS float64
+}
+
+// PolicyTemplates are the built-in line templates: a VMess+WebSocket+TLS
+// proxy in Surge ([Proxy]) and Quantumult X ([server_local]) syntax.
+var PolicyTemplates = map[string]string{
+	"surge": `{{.Name}} = vmess, {{.IP}}, {{.Port}}, username={{.UUID}}, ws=true, ws-path={{.Path}}, ws-headers=Host:"{{.SNI}}", tls=true, sni={{.SNI}}`,
+	"quanx": `vmess={{.IP}}:{{.Port}}, method=chacha20-poly1305, password={{.UUID}}, obfs=wss, obfs-host={{.SNI}}, obfs-uri={{.Path}}, tls-verification=true, tag={{.Name}}`,
+}
+
+// ParsePolicyLine parses a line template for WritePolicy: text/template
+// syntax over a PolicyLine, e.g. PolicyTemplates["surge"].
+func ParsePolicyLine(text string) (*template.Template, error) {
+	return template.New("policy").Parse(text)
+}
+
+// WritePolicy writes one proxy policy line per successful top IP by
+// executing line. SNI, UUID and Path come from opts; a placeholder is
+// written for an empty UUID.
+func WritePolicy(w io.Writer, rows []engine.TopResult, line *template.Template, opts XrayOptions) error {
+	uuid := opts.UUID
+	if uuid == "" {
+		uuid = xrayUUIDPlaceholder
+	}
+	path := opts.Path
+	if path == "" {
+		path = "/"
+	}
+
+	n := 0
+	for _, r := range rows {
+		if !r.OK {
+			continue
+		}
+		n++
+		port := r.Port
+		if port == 0 {
+			port = probe.DefaultPort
+		}
+		data := PolicyLine{
+			Name:    fmt.Sprintf("mcis-%d", n),
+			Rank:    n,
+			IP:      r.IP.String(),
+			Port:    port,
+			SNI:     opts.SNI,
+			UUID:    uuid,
+			Path:    path,
+			Colo:    r.Trace["colo"],
+			ScoreMS: r.ScoreMS,
+		}
+		if err := line.Execute(w, data); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	if n == 0 {
+		return fmt.Errorf("no successful top IPs to write")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+)
+
+// promLabelEscaper escapes label values for the Prometheus text format.
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes the top results and run statistics in the
+// Prometheus text exposition format (e.g. for node_exporter's textfile
+// collector). Per-IP gauges carry ip, prefix and colo labels.
+func WritePrometheus(w io.Writer, rows []engine.TopResult, stats engine.RunStats) error {
+	bw := bufio.NewWriter(w)
+
+	labels := make([]string, len(rows))
+	for i, r := range rows {
+		colo := ""
+		if r.Trace != nil {
+			colo = r.Trace["colo"]
+		}
+		labels[i] = fmt.Sprintf(`ip="%s",prefix="%s",colo="%s"`,
+			r.IP.String(), r.Prefix.String(), promLabelEscaper.Replace(colo))
+	}
+
+	perIP := []struct {
+		name, help string
+		value      func(r engine.TopResult) (float64, bool)
+	}{
+		{"mcis_ip_rank", "Rank of the IP in the top results (1 = best).", nil},
+		{"mcis_ip_score_ms", "Search score of the IP in milliseconds (lower is better).",
+			func(r engine.TopResult) (float64, bool) { return r.ScoreMS, true }},
+		{"mcis_ip_latency_ms", "Total probe latency of the IP in milliseconds.",
+			func(r engine.TopResult) (float64, bool) { return float64(r.TotalMS), r.OK }},
+		{"mcis_ip_up", "Whether the IP's probe succeeded (1) or failed (0).",
+			func(r engine.TopResult) (float64, bool) { return boolGauge(r.OK), true }},
+		{"mcis_ip_reliability", "Success rate of the IP's verification probes.",
+			func(r engine.TopResult) (float64, bool) { return r.Reliability, r.VerifySamples > 0 }},
+		{"mcis_ip_download_mbps", "Download speed of the IP in Mbps.",
+			func(r engine.TopResult) (float64, bool) { return r.DownloadMbps, r.DownloadOK }},
+	}
+	for _, m := range perIP {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for i, r := range rows {
+			v, ok := float64(i+1), true
+			if m.value != nil {
+				v, ok = m.value(r)
+			}
+			if ok {
+				fmt.Fprintf(bw, "%s{%s} %s\n", m.name, labels[i], promValue(v))
+			}
+		}
+	}
+
+	run := []struct {
+		name, help string
+		value      float64
+	}{
+		{"mcis_run_probes", "Probes sent by the last run.", float64(stats.Probes)},
+		{"mcis_run_successes", "Successful probes of the last run.", float64(stats.Successes)},
+		{"mcis_run_hedges", "Hedge probes sent by the last run.", float64(stats.Hedges)},
+		{"mcis_run_tree_nodes", "Prefixes in the search tree after the last run.", float64(stats.TreeNodes)},
+		{"mcis_run_duration_seconds", "Duration of the last run in seconds.", float64(stats.DurationMS) / 1000},
+		{"mcis_run_timestamp_seconds", "Unix time the last run started.", float64(stats.Started.Unix())},
+		{"mcis_run_top_results", "Number of IPs in the top results.", float64(len(rows))},
+		{"mcis_run_partial", "Whether the last run was interrupted before spending its budget (1) or not (0).", boolGauge(stats.Partial)},
+	}
+	for _, m := range run {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", m.name, m.help, m.name, m.name, promValue(m.value))
+	}
+	return bw.Flush()
+}
+
+// promValue formats v without an exponent, so timestamps stay readable.
+func promValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,133 @@
+package output
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver (pure Go, no cgo)
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+)
+
+// sqliteSchema creates the results tables on first use. Every run appends
+// one row to runs; probes and top reference it by run_id.
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY,
+	started TEXT NOT NULL,
+	duration_ms INTEGER,
+	probes INTEGER,
+	successes INTEGER,
+	hedges INTEGER,
+	tree_nodes INTEGER
+);
+CREATE TABLE IF NOT EXISTS probes (
+	run_id INTEGER NOT NULL REFERENCES runs(id),
+	ip TEXT NOT NULL,
+	prefix TEXT,
+	head INTEGER,
+	ok INTEGER,
+	status INTEGER,
+	error TEXT,
+	connect_ms INTEGER,
+	tls_ms INTEGER,
+	ttfb_ms INTEGER,
+	total_ms INTEGER,
+	score_ms REAL,
+	colo TEXT,
+	probed_at TEXT
+);
+CREATE TABLE IF NOT EXISTS top (
+	run_id INTEGER NOT NULL REFERENCES runs(id),
+	rank INTEGER NOT NULL,
+	ip TEXT NOT NULL,
+	prefix TEXT,
+	ok INTEGER,
+	total_ms INTEGER,
+	score_ms REAL,
+	colo TEXT,
+	reliability REAL,
+	download_mbps REAL
+);
+CREATE INDEX IF NOT EXISTS probes_run ON probes(run_id);
+CREATE INDEX IF NOT EXISTS probes_ip ON probes(ip);
+CREATE INDEX IF NOT EXISTS top_run ON top(run_id);
+`
+
+// WriteSQLite appends one run (its statistics, every probe result and the
+// top results) to the SQLite database at path in a single transaction,
+// creating the schema if needed.
+func WriteSQLite(path string, stats engine.RunStats, probes []engine.ProbeResult, rows []engine.TopResult) (err error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := db.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("sqlite %s: %w", path, err)
+	}
+	if err := insertRun(tx, stats, probes, rows); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("sqlite %s: %w", path, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite %s: %w", path, err)
+	}
+	return nil
+}
+
+// insertRun creates the schema and inserts one run.
+func insertRun(tx *sql.Tx, stats engine.RunStats, probes []engine.ProbeResult, rows []engine.TopResult) error {
+	if _, err := tx.Exec(sqliteSchema); err != nil {
+		return err
+	}
+	run, err := tx.Exec("INSERT INTO runs (started, duration_ms, probes, successes, hedges, tree_nodes) VALUES (?, ?, ?, ?, ?, ?)",
+		stats.Started.UTC().Format(time.RFC3339Nano), stats.DurationMS,
+		stats.Probes, stats.Successes, stats.Hedges, stats.TreeNodes)
+	if err != nil {
+		return err
+	}
+	runID, err := run.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	insProbe, err := tx.Prepare("INSERT INTO probes VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = insProbe.Close() }()
+	for _, p := range probes {
+		if _, err := insProbe.Exec(runID, p.IP.String(), p.Prefix.String(), p.HeadID,
+			p.OK, p.Status, p.Error,
+			p.ConnectMS, p.TLSMS, p.TTFBMS, p.TotalMS, sqlReal(p.ScoreMS, true),
+			p.Trace["colo"], p.When.UTC().Format(time.RFC3339Nano)); err != nil {
+			return err
+		}
+	}
+
+	insTop, err := tx.Prepare("INSERT INTO top VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = insTop.Close() }()
+	for i, r := range rows {
+		if _, err := insTop.Exec(runID, i+1, r.IP.String(), r.Prefix.String(),
+			r.OK, r.TotalMS, sqlReal(r.ScoreMS, true), r.Trace["colo"],
+			sqlReal(r.Reliability, r.VerifySamples > 0), sqlReal(r.DownloadMbps, r.DownloadOK)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlReal is v if it was measured and is finite, NULL otherwise.
+func sqlReal(v float64, ok bool) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: v, Valid: ok && !math.IsNaN(v) && !math.IsInf(v, 0)}
+}
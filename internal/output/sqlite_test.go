@@ -0,0 +1,87 @@
+package output
+
+import (
+	"database/sql"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+)
+
+func TestWriteSQLiteRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	head := 2
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	stats := engine.RunStats{Started: started, DurationMS: 1500, Probes: 2, Successes: 1, TreeNodes: 7}
+	probes := []engine.ProbeResult{
+		{IP: netip.MustParseAddr("10.0.0.1"), Prefix: netip.MustParsePrefix("10.0.0.0/24"), HeadID: &head,
+			OK: true, Status: 200, TotalMS: 42, ScoreMS: 42, Trace: map[string]string{"colo": "HKG"}, When: started},
+		{IP: netip.MustParseAddr("10.0.0.2"), Prefix: netip.MustParsePrefix("10.0.0.0/24"), Phase: "verify",
+			Error: "timeout", TotalMS: 1000, ScoreMS: 2000, When: started},
+	}
+	top := []engine.TopResult{
+		{IP: netip.MustParseAddr("10.0.0.1"), Prefix: netip.MustParsePrefix("10.0.0.0/24"), OK: true,
+			TotalMS: 42, ScoreMS: 42, Trace: map[string]string{"colo": "HKG"}, VerifySamples: 3, Reliability: 0.9},
+	}
+	// Two runs append to the same database.
+	for i := 0; i < 2; i++ {
+		if err := WriteSQLite(path, stats, probes, top); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	counts := []struct {
+		query string
+		want  int
+	}{
+		{"SELECT count(*) FROM runs", 2},
+		{"SELECT count(*) FROM probes", 4},
+		{"SELECT count(*) FROM top", 2},
+		{"SELECT count(*) FROM probes WHERE head IS NULL", 2},
+		{"SELECT count(*) FROM probes WHERE run_id = (SELECT max(id) FROM runs)", 2},
+		{"SELECT count(*) FROM top WHERE download_mbps IS NULL", 2},
+	}
+	for _, c := range counts {
+		var n int
+		if err := db.QueryRow(c.query).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", c.query, err)
+		}
+		if n != c.want {
+			t.Errorf("%s = %d, want %d", c.query, n, c.want)
+		}
+	}
+
+	var (
+		ip, colo    string
+		okCol, hd   int
+		total       int64
+		reliability float64
+		duration    int64
+	)
+	if err := db.QueryRow("SELECT ip, ok, head, total_ms, colo FROM probes WHERE head IS NOT NULL LIMIT 1").Scan(&ip, &okCol, &hd, &total, &colo); err != nil {
+		t.Fatal(err)
+	}
+	if ip != "10.0.0.1" || okCol != 1 || hd != head || total != 42 || colo != "HKG" {
+		t.Errorf("probe row = %s %d %d %d %s", ip, okCol, hd, total, colo)
+	}
+	if err := db.QueryRow("SELECT ip, reliability FROM top WHERE rank = 1 LIMIT 1").Scan(&ip, &reliability); err != nil {
+		t.Fatal(err)
+	}
+	if ip != "10.0.0.1" || reliability != 0.9 {
+		t.Errorf("top row = %s %v", ip, reliability)
+	}
+	if err := db.QueryRow("SELECT duration_ms FROM runs LIMIT 1").Scan(&duration); err != nil {
+		t.Fatal(err)
+	}
+	if duration != 1500 {
+		t.Errorf("duration_ms = %d, want 1500", duration)
+	}
+}
@@ -0,0 +1,121 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+)
+
+// templateFuncs are the helpers available to -template-file templates.
+// Those taking rows return a new slice and leave their input unchanged, so
+// they can be chained with pipes: {{range .Top | ok | colo "HKG" | first 3}}.
+var templateFuncs = template.FuncMap{
+	// sortBy sorts by a numeric field (see sortKeys); a leading "-" sorts
+	// in descending order.
+	"sortBy": func(key string, rows []engine.TopResult) ([]engine.TopResult, error) {
+		desc := strings.HasPrefix(key, "-")
+		get, found := sortKeys[strings.TrimPrefix(key, "-")]
+		if !found {
+			return nil, fmt.Errorf("sortBy: unknown key %q", key)
+		}
+		out := append([]engine.TopResult(nil), rows...)
+		sort.SliceStable(out, func(i, j int) bool {
+			if desc {
+				return get(out[i]) > get(out[j])
+			}
+			return get(out[i]) < get(out[j])
+		})
+		return out, nil
+	},
+	// ok keeps successful results.
+	"ok": func(rows []engine.TopResult) []engine.TopResult {
+		return filterRows(rows, func(r engine.TopResult) bool { return r.OK })
+	},
+	// colo keeps results whose trace reports one of the given colos.
+	"colo": func(args ...any) ([]engine.TopResult, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("colo: want colo codes and rows")
+		}
+		rows, isRows := args[len(args)-1].([]engine.TopResult)
+		if !isRows {
+			return nil, fmt.Errorf("colo: last argument must be rows")
+		}
+		want := make(map[string]bool)
+		for _, a := range args[:len(args)-1] {
+			want[strings.ToUpper(fmt.Sprint(a))] = true
+		}
+		return filterRows(rows, func(r engine.TopResult) bool { return want[r.Trace["colo"]] }), nil
+	},
+	// v4 and v6 keep results of one address family.
+	"v4": func(rows []engine.TopResult) []engine.TopResult {
+		return filterRows(rows, func(r engine.TopResult) bool { return r.IP.Is4() })
+	},
+	"v6": func(rows []engine.TopResult) []engine.TopResult {
+		return filterRows(rows, func(r engine.TopResult) bool { return r.IP.Is6() })
+	},
+	// maxScore keeps results scoring at most ms.
+	"maxScore": func(ms float64, rows []engine.TopResult) []engine.TopResult {
+		return filterRows(rows, func(r engine.TopResult) bool { return r.ScoreMS <= ms })
+	},
+	// first keeps the first n results.
+	"first": func(n int, rows []engine.TopResult) []engine.TopResult {
+		return rows[:max(0, min(n, len(rows)))]
+	},
+	// ips returns the addresses of rows as strings, e.g. for join.
+	"ips": func(rows []engine.TopResult) []string {
+		out := make([]string, len(rows))
+		for i, r := range rows {
+			out[i] = r.IP.String()
+		}
+		return out
+	},
+	// json encodes a value as JSON, e.g. {{.Top | ips | json}}.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":  func(sep string, s []string) string { return strings.Join(s, sep) },
+	"add":   func(a, b int) int { return a + b },
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// sortKeys maps sortBy keys (the JSON field names) to row values.
+var sortKeys = map[string]func(engine.TopResult) float64{
+	"score_ms":      func(r engine.TopResult) float64 { return r.ScoreMS },
+	"total_ms":      func(r engine.TopResult) float64 { return float64(r.TotalMS) },
+	"connect_ms":    func(r engine.TopResult) float64 { return float64(r.ConnectMS) },
+	"tls_ms":        func(r engine.TopResult) float64 { return float64(r.TLSMS) },
+	"ttfb_ms":       func(r engine.TopResult) float64 { return float64(r.TTFBMS) },
+	"jitter_ms":     func(r engine.TopResult) float64 { return r.JitterMS },
+	"loss_pct":      func(r engine.TopResult) float64 { return r.LossPct },
+	"reliability":   func(r engine.TopResult) float64 { return r.Reliability },
+	"download_mbps": func(r engine.TopResult) float64 { return r.DownloadMbps },
+}
+
+func filterRows(rows []engine.TopResult, keep func(engine.TopResult) bool) []engine.TopResult {
+	var out []engine.TopResult
+	for _, r := range rows {
+		if keep(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// ParseTemplate parses a text/template file for WriteTemplate.
+func ParseTemplate(path string) (*template.Template, error) {
+	return template.New(filepath.Base(path)).Funcs(templateFuncs).ParseFiles(path)
+}
+
+// WriteTemplate executes tmpl with the run's Response as data: .Top (best
+// first), .Stats, .Config and .ByColo.
+func WriteTemplate(w io.Writer, tmpl *template.Template, res engine.Response) error {
+	return tmpl.Execute(w, res)
+}
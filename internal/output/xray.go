@@ -0,0 +1,117 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// XrayOptions configures the Xray outbound fragment and the proxy policy
+// lines of WritePolicy.
+type XrayOptions struct {
+	SNI  string // TLS serverName and WebSocket Host (the probe SNI)
+	UUID string // VLESS/VMess user id; a placeholder is written if empty
+	Path string // WebSocket path
+}
+
+// xrayUUIDPlaceholder marks the user id to fill in when -xray-uuid is unset.
+const xrayUUIDPlaceholder = "REPLACE-WITH-YOUR-UUID"
+
+type xrayConfig struct {
+	Outbounds []xrayOutbound `json:"outbounds"`
+	Routing   xrayRouting    `json:"routing"`
+}
+
+type xrayOutbound struct {
+	Tag            string             `json:"tag"`
+	Protocol       string             `json:"protocol"`
+	Settings       xrayVnextSettings  `json:"settings"`
+	StreamSettings xrayStreamSettings `json:"streamSettings"`
+}
+
+type xrayVnextSettings struct {
+	Vnext []xrayServer `json:"vnext"`
+}
+
+type xrayServer struct {
+	Address string     `json:"address"`
+	Port    uint16     `json:"port"`
+	Users   []xrayUser `json:"users"`
+}
+
+type xrayUser struct {
+	ID         string `json:"id"`
+	Encryption string `json:"encryption"`
+}
+
+type xrayStreamSettings struct {
+	Network     string `json:"network"`
+	Security    string `json:"security"`
+	TLSSettings struct {
+		ServerName string `json:"serverName"`
+	} `json:"tlsSettings"`
+	WSSettings struct {
+		Path string `json:"path"`
+		Host string `json:"host"`
+	} `json:"wsSettings"`
+}
+
+type xrayRouting struct {
+	Balancers []xrayBalancer `json:"balancers"`
+}
+
+type xrayBalancer struct {
+	Tag      string   `json:"tag"`
+	Selector []string `json:"selector"`
+}
+
+// WriteXray writes an Xray config fragment: one VLESS+WebSocket+TLS
+// outbound per successful top IP (tags mcis-1, mcis-2, ...) and a
+// balancer "mcis" rotating across them. Merge it into an existing config
+// and route traffic to the balancer.
+func WriteXray(w io.Writer, rows []engine.TopResult, opts XrayOptions) error {
+	uuid := opts.UUID
+	if uuid == "" {
+		uuid = xrayUUIDPlaceholder
+	}
+	path := opts.Path
+	if path == "" {
+		path = "/"
+	}
+
+	cfg := xrayConfig{Routing: xrayRouting{Balancers: []xrayBalancer{{Tag: "mcis", Selector: []string{"mcis-"}}}}}
+	for _, r := range rows {
+		if !r.OK {
+			continue
+		}
+		port := r.Port
+		if port == 0 {
+			port = probe.DefaultPort
+		}
+		ob := xrayOutbound{
+			Tag:      fmt.Sprintf("mcis-%d", len(cfg.Outbounds)+1),
+			Protocol: "vless",
+			Settings: xrayVnextSettings{Vnext: []xrayServer{{
+				Address: r.IP.String(),
+				Port:    port,
+				Users:   []xrayUser{{ID: uuid, Encryption: "none"}},
+			}}},
+		}
+		ob.StreamSettings.Network = "ws"
+		ob.StreamSettings.Security = "tls"
+		ob.StreamSettings.TLSSettings.ServerName = opts.SNI
+		ob.StreamSettings.WSSettings.Path = path
+		ob.StreamSettings.WSSettings.Host = opts.SNI
+		cfg.Outbounds = append(cfg.Outbounds, ob)
+	}
+	if len(cfg.Outbounds) == 0 {
+		return fmt.Errorf("no successful top IPs to write")
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(cfg)
+}
@@ -0,0 +1,126 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// Backend is implemented by every probe method. Implementations must be
+// safe for concurrent use.
+type Backend interface {
+	Probe(ctx context.Context, ip netip.Addr) Result
+}
+
+// Backend names accepted in Config.Backend.
+const (
+	BackendHTTP   = "http"
+	BackendSim    = "sim"
+	BackendReplay = "replay"
+	BackendH2Mux  = "h2mux"
+	BackendICMP   = "icmp"
+	BackendWarp   = "warp"
+	BackendDoH    = "doh"
+)
+
+// NewBackend creates the probe backend selected by cfg.Backend
+// (default: HTTP trace prober), wrapped in a Retrier when cfg.Retries > 0,
+// in a Sampler when cfg.Samples > 1 and in a MultiPort when several
+// cfg.Ports are given.
+func NewBackend(cfg Config) (Backend, error) {
+	switch len(cfg.Ports) {
+	case 0:
+	case 1:
+		cfg.Port, cfg.Ports = cfg.Ports[0], nil
+	default:
+		return NewMultiPort(cfg)
+	}
+	b, err := newBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Retries > 0 && cfg.Backend != BackendReplay {
+		b = NewRetrier(b, cfg)
+	}
+	if cfg.Samples <= 1 {
+		return b, nil
+	}
+	return NewSampler(b, cfg)
+}
+
+// closeBackend closes b if it holds resources, for the Close of wrappers.
+func closeBackend(b Backend) error {
+	if c, ok := b.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func newBackend(cfg Config) (Backend, error) {
+	if err := cfg.Socket.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.ExpectBody != nil && cfg.BodyLimit <= 0 {
+		return nil, fmt.Errorf("body validation needs a positive body limit")
+	}
+	switch cfg.Scheme {
+	case "", SchemeHTTPS:
+	case SchemeHTTP:
+		if cfg.Mode == ModeH3 || cfg.Backend == BackendH2Mux {
+			return nil, fmt.Errorf("scheme %s cannot be used with HTTP/3 or h2mux", cfg.Scheme)
+		}
+	default:
+		return nil, fmt.Errorf("unknown scheme: %s (want %s|%s)", cfg.Scheme, SchemeHTTPS, SchemeHTTP)
+	}
+	if cfg.Proxy != nil && (cfg.Mode == ModeH3 || (cfg.Backend != "" && cfg.Backend != BackendHTTP && cfg.Backend != BackendDoH)) {
+		return nil, fmt.Errorf("a proxy is only supported by the %s backend over TCP", BackendHTTP)
+	}
+	if err := cfg.validateFingerprint(); err != nil {
+		return nil, err
+	}
+	switch cfg.Timing {
+	case "", TimingPooled:
+	case TimingAccurate:
+		if cfg.Mode == ModeH3 || cfg.Proxy != nil {
+			return nil, fmt.Errorf("timing %s cannot be used with HTTP/3 or a proxy", cfg.Timing)
+		}
+	default:
+		return nil, fmt.Errorf("unknown timing mode: %s (want %s|%s)", cfg.Timing, TimingPooled, TimingAccurate)
+	}
+	switch cfg.Mode {
+	case "", ModeHTTPS:
+	case ModeH3:
+		if cfg.Backend != "" && cfg.Backend != BackendHTTP && cfg.Backend != BackendDoH {
+			return nil, fmt.Errorf("probe mode %s requires the %s backend", cfg.Mode, BackendHTTP)
+		}
+	default:
+		return nil, fmt.Errorf("unknown probe mode: %s (want %s|%s)", cfg.Mode, ModeHTTPS, ModeH3)
+	}
+	switch cfg.Backend {
+	case "", BackendHTTP:
+		return NewProber(cfg), nil
+	case BackendSim:
+		return NewSimulator(cfg)
+	case BackendReplay:
+		return NewReplayer(cfg.ReplayFile)
+	case BackendH2Mux:
+		return NewH2MuxProber(cfg), nil
+	case BackendICMP:
+		if cfg.Socket.Interface != "" {
+			return nil, fmt.Errorf("interface binding is not supported by the %s backend", BackendICMP)
+		}
+		return NewPinger(cfg.Socket.SourceIP)
+	case BackendDoH:
+		return NewDoHProber(cfg)
+	case BackendWarp:
+		return NewWarpProber(cfg)
+	default:
+		return nil, fmt.Errorf("unknown probe backend: %s", cfg.Backend)
+	}
+}
+
+// Probe implements Backend.
+func (p *Prober) Probe(ctx context.Context, ip netip.Addr) Result {
+	return p.ProbeHTTPTrace(ctx, ip)
+}
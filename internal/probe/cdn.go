@@ -0,0 +1,83 @@
+package probe
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Trace parsers for Config.TraceParser: how a CDN's response tells which
+// location (trace "colo") served it.
+const (
+	TraceCloudflare = "cloudflare" // key=value body of /cdn-cgi/trace (default)
+	TraceFastly     = "fastly"     // X-Served-By: cache-nrt-rjtf7700044-NRT
+	TraceCloudFront = "cloudfront" // X-Amz-Cf-Pop: NRT57-P1
+	TraceGcore      = "gcore"      // X-ID: fr5-up-gc31
+	TraceBunny      = "bunny"      // Server: BunnyCDN-DE1-1083
+)
+
+// traceParsers extract the trace of a response by parser name. Besides
+// "colo" they keep the header they read, under its lower-case name.
+var traceParsers = map[string]func(h http.Header, body []byte) map[string]string{
+	TraceCloudflare: func(_ http.Header, body []byte) map[string]string {
+		return parseTrace(string(body))
+	},
+	TraceFastly: func(h http.Header, _ []byte) map[string]string {
+		// One "cache-<pop>-<host>-<POP>" entry per cache hop; the last
+		// one is the edge that answered
+		v := h.Get("X-Served-By")
+		entries := strings.Split(v, ",")
+		last := strings.TrimSpace(entries[len(entries)-1])
+		return headerTrace("x-served-by", v, last[strings.LastIndexByte(last, '-')+1:])
+	},
+	TraceCloudFront: func(h http.Header, _ []byte) map[string]string {
+		v := h.Get("X-Amz-Cf-Pop")
+		return headerTrace("x-amz-cf-pop", v, strings.TrimRight(strings.SplitN(v, "-", 2)[0], "0123456789"))
+	},
+	TraceGcore: func(h http.Header, _ []byte) map[string]string {
+		v := h.Get("X-Id")
+		return headerTrace("x-id", v, strings.SplitN(v, "-", 2)[0])
+	},
+	TraceBunny: func(h http.Header, _ []byte) map[string]string {
+		v := h.Get("Server")
+		parts := strings.Split(v, "-")
+		if len(parts) < 2 || !strings.EqualFold(parts[0], "BunnyCDN") {
+			return headerTrace("server", v, "")
+		}
+		return headerTrace("server", v, parts[1])
+	},
+}
+
+// headerTrace is the trace of a header-based parser: the header value and
+// the colo derived from it, upper-cased. Missing values are left out.
+func headerTrace(name, value, colo string) map[string]string {
+	m := make(map[string]string)
+	if value != "" {
+		m[name] = value
+	}
+	if colo = strings.ToUpper(strings.TrimSpace(colo)); colo != "" && value != "" {
+		m["colo"] = colo
+	}
+	return m
+}
+
+// TraceParsers lists the accepted Config.TraceParser values.
+func TraceParsers() []string {
+	return []string{TraceCloudflare, TraceFastly, TraceCloudFront, TraceGcore, TraceBunny}
+}
+
+// CheckTraceParser validates a Config.TraceParser value ("" is the default).
+func CheckTraceParser(name string) error {
+	if _, ok := traceParsers[name]; !ok && name != "" {
+		return fmt.Errorf("unknown trace parser %q (want %s)", name, strings.Join(TraceParsers(), "|"))
+	}
+	return nil
+}
+
+// trace extracts the trace of a response with the configured parser.
+func (c Config) trace(h http.Header, body []byte) map[string]string {
+	if parse, ok := traceParsers[c.TraceParser]; ok {
+		return parse(h, body)
+	}
+	return parseTrace(string(body))
+}
@@ -0,0 +1,90 @@
+package probe
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrSPKIMismatch is returned by the TLS handshake when the leaf
+// certificate does not match any Config.PinSPKI hash.
+var ErrSPKIMismatch = errors.New("spki_mismatch")
+
+// CertInfo describes the leaf certificate presented by a probed IP.
+type CertInfo struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	SANs     []string  `json:"sans,omitempty"`
+	NotAfter time.Time `json:"not_after"`
+	// SPKI is the base64 SHA-256 hash of the SubjectPublicKeyInfo (the
+	// format used by -pin-spki and HPKP).
+	SPKI string `json:"spki"`
+}
+
+// SPKIHash returns the base64 SHA-256 hash of cert's SubjectPublicKeyInfo.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ParseSPKIPin validates a base64 SHA-256 SPKI hash as accepted by
+// Config.PinSPKI. An optional "sha256/" prefix is stripped.
+func ParseSPKIPin(s string) (string, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "sha256/")
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid SPKI pin: %q (want base64 SHA-256)", s)
+	}
+	return s, nil
+}
+
+// certInfo extracts the leaf certificate of a handshake.
+func certInfo(state *tls.ConnectionState) *CertInfo {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	leaf := state.PeerCertificates[0]
+	info := &CertInfo{
+		Subject:  leaf.Subject.String(),
+		Issuer:   leaf.Issuer.String(),
+		NotAfter: leaf.NotAfter,
+		SPKI:     SPKIHash(leaf),
+	}
+	info.SANs = append(info.SANs, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	return info
+}
+
+// setConnState records the negotiated ALPN, TLS version and leaf
+// certificate of a handshake.
+func (r *Result) setConnState(state *tls.ConnectionState) {
+	if state == nil {
+		return
+	}
+	r.ALPN = state.NegotiatedProtocol
+	r.TLSVersion = strings.ReplaceAll(tls.VersionName(state.Version), " ", "")
+	r.Cert = certInfo(state)
+}
+
+// tlsConfig returns the prober TLS config including SPKI pinning.
+func (c Config) tlsConfig() *tls.Config {
+	cfg := newTLSConfig(c.SNI, c.RootCAs, c.Insecure, c.ClientCert)
+	if len(c.PinSPKI) > 0 {
+		pins := c.PinSPKI
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 || !slices.Contains(pins, SPKIHash(cs.PeerCertificates[0])) {
+				return ErrSPKIMismatch
+			}
+			return nil
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,121 @@
+package probe
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DoHPath is the default request path of the doh backend (RFC 8484).
+const DoHPath = "/dns-query"
+
+// DefaultDoHName is the default name queried by the doh backend.
+const DefaultDoHName = "cloudflare.com"
+
+// dohQuery is the DNS query a doh Prober sends to every IP.
+type dohQuery struct {
+	typ   dnsmessage.Type
+	param string // base64url wire-format query for ?dns=
+}
+
+// newDoHQuery builds the query for cfg.DoHName / cfg.DoHType (A or AAAA).
+func newDoHQuery(cfg Config) (*dohQuery, error) {
+	name := cfg.DoHName
+	if name == "" {
+		name = DefaultDoHName
+	}
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DoH query name %q: %w", cfg.DoHName, err)
+	}
+	var typ dnsmessage.Type
+	switch strings.ToUpper(cfg.DoHType) {
+	case "", "A":
+		typ = dnsmessage.TypeA
+	case "AAAA":
+		typ = dnsmessage.TypeAAAA
+	default:
+		return nil, fmt.Errorf("unsupported DoH query type: %s (want A|AAAA)", cfg.DoHType)
+	}
+
+	// RFC 8484 recommends ID 0 for cache friendliness.
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: typ, Class: dnsmessage.ClassINET}},
+	}
+	wire, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	return &dohQuery{typ: typ, param: base64.RawURLEncoding.EncodeToString(wire)}, nil
+}
+
+// check validates a DoH response; it returns the answered addresses, or
+// the error string when the response is not a correct answer.
+func (q *dohQuery) check(header http.Header, body []byte) (string, string) {
+	if ct := header.Get("Content-Type"); !strings.HasPrefix(ct, "application/dns-message") {
+		return "", "doh_bad_content_type"
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(body); err != nil {
+		return "", "doh_bad_message"
+	}
+	if !msg.Response || msg.ID != 0 {
+		return "", "doh_bad_message"
+	}
+	if msg.RCode != dnsmessage.RCodeSuccess {
+		return "", "doh_rcode_" + strings.ToLower(strings.TrimPrefix(msg.RCode.String(), "RCode"))
+	}
+	var addrs []string
+	for _, rr := range msg.Answers {
+		switch b := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			if q.typ == dnsmessage.TypeA {
+				addrs = append(addrs, netip.AddrFrom4(b.A).String())
+			}
+		case *dnsmessage.AAAAResource:
+			if q.typ == dnsmessage.TypeAAAA {
+				addrs = append(addrs, netip.AddrFrom16(b.AAAA).String())
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return "", "doh_no_answer"
+	}
+	return strings.Join(addrs, ","), ""
+}
+
+// NewDoHProber creates an HTTP prober that sends a DoH query for
+// cfg.DoHName to every IP and only accepts correct DNS answers. The
+// answer (and the colo from the CF-Ray header, if any) is returned in
+// Result.Trace.
+func NewDoHProber(cfg Config) (*Prober, error) {
+	if cfg.BodyLimit <= 0 {
+		return nil, fmt.Errorf("the %s backend needs a positive body limit", BackendDoH)
+	}
+	q, err := newDoHQuery(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Path == "" {
+		cfg.Path = DoHPath
+	}
+	p := NewProber(cfg)
+	p.doh = q
+	return p, nil
+}
+
+// rayColo returns the colo suffix of a CF-Ray header ("8f1c...-SJC").
+func rayColo(ray string) string {
+	if i := strings.LastIndexByte(ray, '-'); i >= 0 {
+		return ray[i+1:]
+	}
+	return ""
+}
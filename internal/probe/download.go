@@ -3,12 +3,14 @@ package probe
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/netip"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -20,6 +22,22 @@ type DownloadConfig struct {
 	SNI      string
 	HostName string
 	Path     string
+
+	// URL overrides the default speed test endpoint (SNI, Host and path
+	// are taken from it and the host is replaced by the probed IP). Bytes
+	// then only caps how much is read.
+	URL *url.URL
+
+	// RootCAs and Insecure control certificate verification (see Config).
+	RootCAs  *x509.CertPool
+	Insecure bool
+	// ClientCert is presented to servers requesting mTLS (see Config).
+	ClientCert *tls.Certificate
+	// Proxy is an explicit upstream proxy (see Config).
+	Proxy *url.URL
+
+	// Socket holds low-level options for the download sockets.
+	Socket SocketOptions
 }
 
 type DownloadResult struct {
@@ -30,6 +48,7 @@ type DownloadResult struct {
 	Bytes   int64      `json:"bytes"`
 	TotalMS int64      `json:"total_ms"`
 	Mbps    float64    `json:"mbps"`
+	MBps    float64    `json:"mb_per_sec"`
 	When    time.Time  `json:"when"`
 }
 
@@ -45,6 +64,14 @@ func NewDownloadProber(cfg DownloadConfig) *DownloadProber {
 	if cfg.Bytes <= 0 {
 		cfg.Bytes = 50_000_000
 	}
+	if cfg.URL != nil {
+		if cfg.SNI == "" {
+			cfg.SNI = cfg.URL.Hostname()
+		}
+		if cfg.HostName == "" {
+			cfg.HostName = cfg.URL.Host
+		}
+	}
 	if cfg.SNI == "" {
 		cfg.SNI = "speed.cloudflare.com"
 	}
@@ -56,11 +83,8 @@ func NewDownloadProber(cfg DownloadConfig) *DownloadProber {
 	}
 
 	transport := &http.Transport{
-		Proxy: nil, // critical: ignore HTTP(S)_PROXY and NO_PROXY env vars
-		DialContext: (&net.Dialer{
-			Timeout:   cfg.Timeout,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		Proxy:                 proxyFunc(cfg.Proxy), // critical: never use HTTP(S)_PROXY and NO_PROXY env vars
+		DialContext:           dialFunc(cfg.Timeout, cfg.Socket),
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          64,
 		MaxIdleConnsPerHost:   8,
@@ -68,9 +92,7 @@ func NewDownloadProber(cfg DownloadConfig) *DownloadProber {
 		TLSHandshakeTimeout:   10 * time.Second,
 		ResponseHeaderTimeout: 20 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
-		TLSClientConfig: &tls.Config{
-			ServerName: cfg.SNI,
-		},
+		TLSClientConfig:       newTLSConfig(cfg.SNI, cfg.RootCAs, cfg.Insecure, cfg.ClientCert),
 	}
 
 	return &DownloadProber{
@@ -95,9 +117,17 @@ func (p *DownloadProber) Download(ctx context.Context, ip netip.Addr) DownloadRe
 	}
 
 	// https://speed.cloudflare.com/__down?bytes=50000000
-	url := "https://" + host + p.cfg.Path + "?bytes=" + strconv.FormatInt(p.cfg.Bytes, 10)
+	target := "https://" + host + p.cfg.Path + "?bytes=" + strconv.FormatInt(p.cfg.Bytes, 10)
+	if p.cfg.URL != nil {
+		u := *p.cfg.URL
+		u.Host = host
+		if port := p.cfg.URL.Port(); port != "" {
+			u.Host = net.JoinHostPort(ip.String(), port)
+		}
+		target = u.String()
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
 	if err != nil {
 		out.Error = err.Error()
 		out.TotalMS = time.Since(start).Milliseconds()
@@ -135,6 +165,7 @@ func (p *DownloadProber) Download(ctx context.Context, ip netip.Addr) DownloadRe
 	// bits per second -> Mbps (10^6)
 	if elapsed > 0 {
 		out.Mbps = (float64(n) * 8) / elapsed.Seconds() / 1e6
+		out.MBps = out.Mbps / 8
 	}
 
 	if err != nil && !errors.Is(err, io.EOF) {
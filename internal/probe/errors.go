@@ -0,0 +1,55 @@
+package probe
+
+import "strings"
+
+// Error kinds returned by ErrorKind.
+const (
+	ErrKindTimeout     = "timeout"
+	ErrKindRefused     = "refused"
+	ErrKindReset       = "reset"
+	ErrKindUnreachable = "unreachable"
+	ErrKindTLS         = "tls"
+	ErrKindEOF         = "eof"
+	ErrKindHTTPStatus  = "http_status"
+	ErrKindOther       = "other"
+)
+
+// ErrorKind classifies a Result.Error string into a coarse error kind.
+// Already-normalized errors (e.g. "icmp_unreachable", "rejected_asn",
+// "tls_verify_expired") are returned unchanged; "" means no error.
+func ErrorKind(err string) string {
+	switch {
+	case err == "":
+		return ""
+	case err == "timeout",
+		strings.Contains(err, "i/o timeout"),
+		strings.Contains(err, "deadline exceeded"),
+		strings.Contains(err, "Client.Timeout"):
+		return ErrKindTimeout
+	case strings.HasPrefix(err, "icmp_"),
+		strings.HasPrefix(err, "rejected_"),
+		strings.HasPrefix(err, "replay_"),
+		strings.HasPrefix(err, "tls_verify_"),
+		strings.HasPrefix(err, "doh_"),
+		err == "body_mismatch":
+		return err
+	case strings.HasPrefix(err, "http_status_"):
+		return ErrKindHTTPStatus
+	case strings.Contains(err, "connection refused"):
+		return ErrKindRefused
+	case strings.Contains(err, "connection reset"):
+		return ErrKindReset
+	case strings.Contains(err, "no route to host"),
+		strings.Contains(err, "network is unreachable"),
+		strings.Contains(err, "host is unreachable"):
+		return ErrKindUnreachable
+	case strings.Contains(err, "tls:"),
+		strings.Contains(err, "x509:"),
+		strings.Contains(err, "certificate"):
+		return ErrKindTLS
+	case strings.HasSuffix(err, "EOF"):
+		return ErrKindEOF
+	default:
+		return ErrKindOther
+	}
+}
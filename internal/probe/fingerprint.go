@@ -0,0 +1,99 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// tlsFingerprints maps Config.TLSFingerprint names to uTLS ClientHellos.
+var tlsFingerprints = map[string]utls.ClientHelloID{
+	"chrome":  utls.HelloChrome_Auto,
+	"firefox": utls.HelloFirefox_Auto,
+	"ios":     utls.HelloIOS_Auto,
+	"safari":  utls.HelloSafari_Auto,
+	"edge":    utls.HelloEdge_Auto,
+	"random":  utls.HelloRandomized,
+}
+
+// TLSFingerprints returns the accepted Config.TLSFingerprint names.
+func TLSFingerprints() []string {
+	names := make([]string, 0, len(tlsFingerprints))
+	for name := range tlsFingerprints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateFingerprint checks Config.TLSFingerprint.
+func (c Config) validateFingerprint() error {
+	if c.TLSFingerprint == "" {
+		return nil
+	}
+	if _, ok := tlsFingerprints[c.TLSFingerprint]; !ok {
+		return fmt.Errorf("unknown TLS fingerprint: %s (want %s)", c.TLSFingerprint, strings.Join(TLSFingerprints(), "|"))
+	}
+	if c.Mode == ModeH3 || c.Proxy != nil || c.scheme() != SchemeHTTPS {
+		return fmt.Errorf("a TLS fingerprint needs HTTPS over TCP without a proxy")
+	}
+	return nil
+}
+
+// tlsClient runs the client handshake on conn, offering nextProtos. With
+// Config.TLSFingerprint set, the ClientHello (including its ALPN list)
+// mimics that browser instead.
+func (c Config) tlsClient(ctx context.Context, conn net.Conn, nextProtos []string) (net.Conn, tls.ConnectionState, error) {
+	id, ok := tlsFingerprints[c.TLSFingerprint]
+	if !ok {
+		cfg := c.tlsConfig()
+		cfg.NextProtos = nextProtos
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return nil, tls.ConnectionState{}, err
+		}
+		return tc, tc.ConnectionState(), nil
+	}
+
+	cfg := &utls.Config{
+		ServerName:         c.SNI,
+		RootCAs:            c.RootCAs,
+		InsecureSkipVerify: c.Insecure,
+	}
+	if c.ClientCert != nil {
+		cfg.Certificates = []utls.Certificate{{
+			Certificate: c.ClientCert.Certificate,
+			PrivateKey:  c.ClientCert.PrivateKey,
+			Leaf:        c.ClientCert.Leaf,
+		}}
+	}
+	if len(c.PinSPKI) > 0 {
+		cfg.VerifyConnection = func(cs utls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 || !slices.Contains(c.PinSPKI, SPKIHash(cs.PeerCertificates[0])) {
+				return ErrSPKIMismatch
+			}
+			return nil
+		}
+	}
+	uc := utls.UClient(conn, cfg, id)
+	if err := uc.HandshakeContext(ctx); err != nil {
+		return nil, tls.ConnectionState{}, err
+	}
+	us := uc.ConnectionState()
+	return uc, tls.ConnectionState{
+		Version:            us.Version,
+		HandshakeComplete:  us.HandshakeComplete,
+		DidResume:          us.DidResume,
+		CipherSuite:        us.CipherSuite,
+		NegotiatedProtocol: us.NegotiatedProtocol,
+		ServerName:         us.ServerName,
+		PeerCertificates:   us.PeerCertificates,
+		VerifiedChains:     us.VerifiedChains,
+	}, nil
+}
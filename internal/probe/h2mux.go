@@ -0,0 +1,182 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// DefaultH2Streams is the default number of concurrent streams per h2mux probe.
+const DefaultH2Streams = 8
+
+// H2MuxProber opens a fresh HTTP/2 connection per probe and issues several
+// concurrent requests over it, to rank edges for workloads made of many
+// parallel small requests.
+//
+// Result fields: ConnectMS/TLSMS are the handshake times, TTFBMS is the
+// median per-stream time to first byte, TotalMS is the time from dial until
+// the last stream finished and StreamMS holds every stream's latency
+// (including failed ones as -1). The probe fails when any stream fails.
+type H2MuxProber struct {
+	cfg Config
+}
+
+// NewH2MuxProber creates an h2mux prober.
+func NewH2MuxProber(cfg Config) *H2MuxProber {
+	if cfg.Path == "" {
+		cfg.Path = "/cdn-cgi/trace"
+	}
+	if !strings.HasPrefix(cfg.Path, "/") {
+		cfg.Path = "/" + cfg.Path
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 3 * time.Second
+	}
+	if cfg.H2Streams <= 0 {
+		cfg.H2Streams = DefaultH2Streams
+	}
+	return &H2MuxProber{cfg: cfg}
+}
+
+// Probe implements Backend.
+func (p *H2MuxProber) Probe(ctx context.Context, ip netip.Addr) Result {
+	start := time.Now()
+	res := Result{IP: ip, Port: p.cfg.port(), When: start}
+	fail := func(err error) Result {
+		switch {
+		case errors.Is(context.Cause(ctx), ErrUnreachable):
+			res.Error = ErrUnreachable.Error()
+		case errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+			res.Error = "timeout"
+		default:
+			res.Error = err.Error()
+		}
+		res.TotalMS = time.Since(start).Milliseconds()
+		return res
+	}
+
+	addr := netip.AddrPortFrom(ip, p.cfg.port()).String()
+	conn, err := dialFunc(p.cfg.Timeout, p.cfg.Socket)(ctx, "tcp", addr)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	res.ConnectMS = time.Since(start).Milliseconds()
+
+	tlsStart := time.Now()
+	tc, state, err := p.cfg.tlsClient(ctx, conn, []string{http2.NextProtoTLS})
+	if err != nil {
+		if v := tlsVerifyFailure(err); v != "" {
+			res.TLSVerify = v
+			return fail(errors.New("tls_verify_" + v))
+		}
+		return fail(err)
+	}
+	res.TLSVerify = tlsVerifyOutcome(&state, p.cfg.Insecure)
+	res.setConnState(&state)
+	res.HTTPProto = "HTTP/2.0"
+	res.TLSMS = time.Since(tlsStart).Milliseconds()
+	if state.NegotiatedProtocol != http2.NextProtoTLS {
+		return fail(errors.New("h2_not_negotiated"))
+	}
+
+	cc, err := (&http2.Transport{}).NewClientConn(tc)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = cc.Close() }()
+
+	url := "https://" + p.cfg.hostPort(ip) + p.cfg.Path
+
+	type stream struct {
+		ttfb, total time.Duration
+		status      int
+		header      http.Header
+		body        []byte
+		err         error
+	}
+	streams := make([]stream, p.cfg.H2Streams)
+	var wg sync.WaitGroup
+	for i := range streams {
+		wg.Add(1)
+		go func(s *stream) {
+			defer wg.Done()
+			t0 := time.Now()
+			req, err := p.cfg.newRequest(ctx, url)
+			if err != nil {
+				s.err = err
+				return
+			}
+
+			httpRes, err := cc.RoundTrip(req)
+			if err != nil {
+				s.err = err
+				return
+			}
+			s.ttfb = time.Since(t0)
+			s.status = httpRes.StatusCode
+			s.header = httpRes.Header
+			if p.cfg.BodyLimit > 0 {
+				s.body, _ = io.ReadAll(io.LimitReader(httpRes.Body, p.cfg.BodyLimit))
+			}
+			_ = httpRes.Body.Close()
+			s.total = time.Since(t0)
+		}(&streams[i])
+	}
+	wg.Wait()
+	res.TotalMS = time.Since(start).Milliseconds()
+
+	ttfbs := make([]time.Duration, 0, len(streams))
+	res.StreamMS = make([]int64, len(streams))
+	var firstErr error
+	for i, s := range streams {
+		if s.err == nil {
+			if reason := p.cfg.checkResponse(s.status, s.body); reason != "" {
+				s.err = errors.New(reason)
+			}
+		}
+		if s.err != nil {
+			res.StreamMS[i] = -1
+			if firstErr == nil {
+				firstErr = s.err
+			}
+			continue
+		}
+		res.StreamMS[i] = s.total.Milliseconds()
+		ttfbs = append(ttfbs, s.ttfb)
+		if res.Status == 0 {
+			res.Status = s.status
+			res.Trace = p.cfg.trace(s.header, s.body)
+			if p.cfg.CaptureBody > 0 {
+				res.Body = string(s.body[:min(len(s.body), p.cfg.CaptureBody)])
+			}
+		}
+	}
+	if len(ttfbs) > 0 {
+		sort.Slice(ttfbs, func(i, j int) bool { return ttfbs[i] < ttfbs[j] })
+		res.TTFBMS = ttfbs[len(ttfbs)/2].Milliseconds()
+	}
+	if firstErr != nil {
+		return fail(firstErr)
+	}
+	res.OK = true
+	return res
+}
+
+// isTimeout reports whether err is a network timeout.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,98 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/netip"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Probe modes accepted in Config.Mode.
+const (
+	ModeHTTPS = "https" // HTTP/1.1 or HTTP/2 over TLS/TCP (default)
+	ModeH3    = "h3"    // HTTP/3 over QUIC
+)
+
+// newH3Transport returns an HTTP/3 round tripper for the trace prober.
+//
+// The QUIC handshake is reported through httptrace as the TLS handshake,
+// so Result.TLSMS holds the full QUIC handshake time and ConnectMS stays 0.
+// Each connection gets its own UDP socket so that SocketOptions apply.
+func newH3Transport(cfg Config) *http3.Transport {
+	lc := net.ListenConfig{Control: cfg.Socket.control()}
+	source := cfg.Socket.sourceFunc()
+	return &http3.Transport{
+		TLSClientConfig: cfg.tlsConfig(),
+		QUICConfig: &quic.Config{
+			HandshakeIdleTimeout: cfg.Timeout,
+			MaxIdleTimeout:       30 * time.Second,
+		},
+		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, qcfg *quic.Config) (*quic.Conn, error) {
+			raddr, err := net.ResolveUDPAddr("udp", addr)
+			if err != nil {
+				return nil, err
+			}
+			network := "udp4"
+			if raddr.IP.To4() == nil {
+				network = "udp6"
+			}
+			laddr := ""
+			if ip, ok := netip.AddrFromSlice(raddr.IP); ok {
+				src, err := source(ip)
+				if err != nil {
+					return nil, err
+				}
+				if src.IsValid() {
+					laddr = netip.AddrPortFrom(src, 0).String()
+				}
+			}
+			pc, err := lc.ListenPacket(ctx, network, laddr)
+			if err != nil {
+				return nil, err
+			}
+			tr := &quic.Transport{Conn: pc}
+
+			trace := httptrace.ContextClientTrace(ctx)
+			if trace != nil && trace.TLSHandshakeStart != nil {
+				trace.TLSHandshakeStart()
+			}
+			conn, err := tr.Dial(ctx, raddr, tlsCfg, qcfg)
+			if trace != nil && trace.TLSHandshakeDone != nil {
+				var state tls.ConnectionState
+				if conn != nil {
+					state = conn.ConnectionState().TLS
+				}
+				trace.TLSHandshakeDone(state, err)
+			}
+			if err != nil {
+				_ = tr.Close()
+				_ = pc.Close()
+				return nil, err
+			}
+			go func() {
+				<-conn.Context().Done()
+				_ = tr.Close()
+				_ = pc.Close()
+			}()
+			return conn, nil
+		},
+	}
+}
+
+// h3Client wraps the HTTP/3 transport like the TCP client in NewProber.
+func h3Client(cfg Config) *http.Client {
+	client := &http.Client{
+		Transport: newH3Transport(cfg),
+		Timeout:   cfg.Timeout,
+	}
+	if cfg.ExpectStatus != nil {
+		client.CheckRedirect = noRedirect
+	}
+	return client
+}
@@ -0,0 +1,183 @@
+package probe
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"sort"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// DefaultMaxHops is the default TTL limit of TraceHops.
+const DefaultMaxHops = 30
+
+// Hop is one answering router (or the target) on the path to an IP.
+type Hop struct {
+	TTL   int        `json:"ttl"`
+	Addr  netip.Addr `json:"addr"`
+	RTTMS int64      `json:"rtt_ms"`
+}
+
+// HopResult is the outcome of TraceHops. Count is the number of hops to
+// the target (the smallest TTL that reached it, 0 if it never answered).
+// Hops lists every TTL that got an answer, in TTL order.
+type HopResult struct {
+	Count int
+	Hops  []Hop
+	Error string
+}
+
+// TraceHops sends ICMP echo requests with TTL 1..maxHops to ip at once and
+// collects the time-exceeded and echo replies until ctx is done or the
+// path is complete. It needs raw socket privileges. A valid source binds
+// the probes to that local address.
+func TraceHops(ctx context.Context, ip netip.Addr, maxHops int, source netip.Addr) HopResult {
+	ip = ip.Unmap()
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+
+	network, laddr, proto := "ip4:icmp", "0.0.0.0", 1
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	if ip.Is6() {
+		network, laddr, proto = "ip6:ipv6-icmp", "::", 58
+		typ = ipv6.ICMPTypeEchoRequest
+	}
+	if source.IsValid() {
+		laddr = source.String()
+	}
+	conn, err := icmp.ListenPacket(network, laddr)
+	if err != nil {
+		return HopResult{Error: "icmp_unavailable"}
+	}
+	defer func() { _ = conn.Close() }()
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetReadDeadline(dl)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	var idb [2]byte
+	_, _ = rand.Read(idb[:])
+	id := int(binary.BigEndian.Uint16(idb[:]))
+
+	sent := make([]time.Time, maxHops+1)
+	dst := &net.IPAddr{IP: ip.AsSlice(), Zone: ip.Zone()}
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		if ip.Is6() {
+			err = conn.IPv6PacketConn().SetHopLimit(ttl)
+		} else {
+			err = conn.IPv4PacketConn().SetTTL(ttl)
+		}
+		if err != nil {
+			return HopResult{Error: err.Error()}
+		}
+		msg := icmp.Message{
+			Type: typ,
+			Body: &icmp.Echo{ID: id, Seq: ttl, Data: []byte("mcis-hop-probe")},
+		}
+		b, err := msg.Marshal(nil)
+		if err != nil {
+			return HopResult{Error: err.Error()}
+		}
+		sent[ttl] = time.Now()
+		if _, err := conn.WriteTo(b, dst); err != nil {
+			return HopResult{Error: err.Error()}
+		}
+	}
+
+	hops := make(map[int]Hop)
+	res := HopResult{}
+	buf := make([]byte, 1500)
+	for !pathComplete(hops, res.Count) {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || ctx.Err() != nil || isTimeout(err) {
+				break
+			}
+			continue
+		}
+		at := time.Now()
+		msg, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		from, _ := netip.AddrFromSlice(peer.(*net.IPAddr).IP)
+		from = from.Unmap()
+
+		var seq int
+		switch body := msg.Body.(type) {
+		case *icmp.Echo:
+			if (msg.Type != ipv4.ICMPTypeEchoReply && msg.Type != ipv6.ICMPTypeEchoReply) ||
+				body.ID != id || from != ip {
+				continue
+			}
+			seq = body.Seq
+			if res.Count == 0 || seq < res.Count {
+				res.Count = seq
+			}
+		case *icmp.TimeExceeded:
+			var ok bool
+			if seq, ok = quotedEcho(body.Data, ip, id); !ok {
+				continue
+			}
+		default:
+			continue
+		}
+		if seq < 1 || seq > maxHops {
+			continue
+		}
+		if _, dup := hops[seq]; !dup {
+			hops[seq] = Hop{TTL: seq, Addr: from, RTTMS: at.Sub(sent[seq]).Milliseconds()}
+		}
+	}
+
+	for ttl, h := range hops {
+		if res.Count == 0 || ttl <= res.Count {
+			res.Hops = append(res.Hops, h)
+		}
+	}
+	sort.Slice(res.Hops, func(i, j int) bool { return res.Hops[i].TTL < res.Hops[j].TTL })
+	if res.Count == 0 {
+		res.Error = "timeout"
+	}
+	return res
+}
+
+// pathComplete reports whether the target answered and every TTL below
+// it got a reply.
+func pathComplete(hops map[int]Hop, count int) bool {
+	if count == 0 {
+		return false
+	}
+	for ttl := 1; ttl < count; ttl++ {
+		if _, ok := hops[ttl]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// quotedEcho returns the sequence number of our echo request to dst
+// quoted inside an ICMP time-exceeded message.
+func quotedEcho(b []byte, dst netip.Addr, id int) (int, bool) {
+	orig, ok := originalDestination(b)
+	if !ok || orig != dst {
+		return 0, false
+	}
+	off := ipv6.HeaderLen
+	if b[0]>>4 == 4 {
+		off = int(b[0]&0x0f) * 4
+	}
+	if len(b) < off+8 || int(binary.BigEndian.Uint16(b[off+4:off+6])) != id {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint16(b[off+6 : off+8])), true
+}
@@ -0,0 +1,147 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ErrUnreachable is the cancellation cause attached to a probe context when
+// an ICMP destination-unreachable message arrives for its target.
+var ErrUnreachable = errors.New("icmp_unreachable")
+
+// UnreachableWatcher listens for ICMP destination-unreachable (including
+// administratively prohibited) messages and cancels in-flight probes to
+// the reported destination, so filtered ranges fail fast instead of
+// waiting out the full timeout. It needs raw socket privileges.
+type UnreachableWatcher struct {
+	conns []*icmp.PacketConn
+
+	mu       sync.Mutex
+	inflight map[netip.Addr]map[int]context.CancelCauseFunc
+	nextID   int
+}
+
+// ListenUnreachable opens raw ICMPv4/ICMPv6 listeners. It succeeds if at
+// least one address family could be opened.
+func ListenUnreachable() (*UnreachableWatcher, error) {
+	w := &UnreachableWatcher{
+		inflight: make(map[netip.Addr]map[int]context.CancelCauseFunc),
+	}
+
+	var errs []error
+	if c, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0"); err == nil {
+		w.conns = append(w.conns, c)
+		go w.readLoop(c, 1)
+	} else {
+		errs = append(errs, err)
+	}
+	if c, err := icmp.ListenPacket("ip6:ipv6-icmp", "::"); err == nil {
+		w.conns = append(w.conns, c)
+		go w.readLoop(c, 58)
+	} else {
+		errs = append(errs, err)
+	}
+	if len(w.conns) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return w, nil
+}
+
+// Watch returns a context that is canceled with ErrUnreachable when an
+// unreachable message for ip is received. The returned release func must
+// be called once the probe finishes.
+func (w *UnreachableWatcher) Watch(ctx context.Context, ip netip.Addr) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	ip = ip.Unmap()
+
+	w.mu.Lock()
+	id := w.nextID
+	w.nextID++
+	if w.inflight[ip] == nil {
+		w.inflight[ip] = make(map[int]context.CancelCauseFunc)
+	}
+	w.inflight[ip][id] = cancel
+	w.mu.Unlock()
+
+	return ctx, func() {
+		w.mu.Lock()
+		delete(w.inflight[ip], id)
+		if len(w.inflight[ip]) == 0 {
+			delete(w.inflight, ip)
+		}
+		w.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// Close stops listening.
+func (w *UnreachableWatcher) Close() error {
+	var errs []error
+	for _, c := range w.conns {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (w *UnreachableWatcher) readLoop(c *icmp.PacketConn, proto int) {
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := c.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		msg, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		if msg.Type != ipv4.ICMPTypeDestinationUnreachable && msg.Type != ipv6.ICMPTypeDestinationUnreachable {
+			continue
+		}
+		body, ok := msg.Body.(*icmp.DstUnreach)
+		if !ok {
+			continue
+		}
+		if dst, ok := originalDestination(body.Data); ok {
+			w.fail(dst)
+		}
+	}
+}
+
+func (w *UnreachableWatcher) fail(ip netip.Addr) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, cancel := range w.inflight[ip] {
+		cancel(ErrUnreachable)
+	}
+}
+
+// originalDestination extracts the destination address of the datagram
+// quoted inside an ICMP error message.
+func originalDestination(b []byte) (netip.Addr, bool) {
+	if len(b) < 1 {
+		return netip.Addr{}, false
+	}
+	switch b[0] >> 4 {
+	case 4:
+		if len(b) < ipv4.HeaderLen {
+			return netip.Addr{}, false
+		}
+		return netip.AddrFrom4([4]byte(b[16:20])), true
+	case 6:
+		if len(b) < ipv6.HeaderLen {
+			return netip.Addr{}, false
+		}
+		return netip.AddrFrom16([16]byte(b[24:40])), true
+	}
+	return netip.Addr{}, false
+}
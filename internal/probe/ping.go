@@ -0,0 +1,215 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Pinger is a Backend that measures ICMP echo round-trip time. It uses raw
+// ICMP sockets when permitted and falls back to unprivileged ICMP datagram
+// sockets ("udp4"/"udp6", Linux net.ipv4.ping_group_range and macOS).
+//
+// Only TotalMS is set on success; Status and Trace stay empty.
+type Pinger struct {
+	v4, v6 *pingConn
+	id     int
+	seq    atomic.Uint32
+
+	mu      sync.Mutex
+	waiting map[pingKey]chan time.Time
+}
+
+type pingConn struct {
+	conn       *icmp.PacketConn
+	proto      int
+	privileged bool
+}
+
+type pingKey struct {
+	ip  netip.Addr
+	seq int
+}
+
+// NewPinger opens ICMPv4/ICMPv6 sockets. It succeeds if at least one
+// address family could be opened. A source address restricts the pinger
+// to its address family.
+func NewPinger(source netip.Addr) (*Pinger, error) {
+	p := &Pinger{
+		id:      os.Getpid() & 0xffff,
+		waiting: make(map[pingKey]chan time.Time),
+	}
+
+	var errs []error
+	if !source.IsValid() || source.Is4() {
+		addr := "0.0.0.0"
+		if source.IsValid() {
+			addr = source.String()
+		}
+		if c, err := listenPing("ip4:icmp", "udp4", addr, 1); err == nil {
+			p.v4 = c
+			go p.readLoop(c)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+	if !source.IsValid() || source.Is6() {
+		addr := "::"
+		if source.IsValid() {
+			addr = source.String()
+		}
+		if c, err := listenPing("ip6:ipv6-icmp", "udp6", addr, 58); err == nil {
+			p.v6 = c
+			go p.readLoop(c)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+	if p.v4 == nil && p.v6 == nil {
+		return nil, errors.Join(errs...)
+	}
+	return p, nil
+}
+
+// listenPing opens a raw ICMP socket, falling back to an unprivileged one.
+func listenPing(raw, dgram, addr string, proto int) (*pingConn, error) {
+	if c, err := icmp.ListenPacket(raw, addr); err == nil {
+		return &pingConn{conn: c, proto: proto, privileged: true}, nil
+	}
+	c, err := icmp.ListenPacket(dgram, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &pingConn{conn: c, proto: proto}, nil
+}
+
+// Probe implements Backend.
+func (p *Pinger) Probe(ctx context.Context, ip netip.Addr) Result {
+	ip = ip.Unmap()
+	start := time.Now()
+	res := Result{IP: ip, When: start}
+
+	pc := p.v4
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	if ip.Is6() {
+		pc = p.v6
+		typ = ipv6.ICMPTypeEchoRequest
+	}
+	if pc == nil {
+		res.Error = "icmp_unavailable"
+		return res
+	}
+
+	seq := int(uint16(p.seq.Add(1)))
+	key := pingKey{ip: ip.WithZone(""), seq: seq}
+	reply := make(chan time.Time, 1)
+	p.mu.Lock()
+	p.waiting[key] = reply
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.waiting, key)
+		p.mu.Unlock()
+	}()
+
+	msg := icmp.Message{
+		Type: typ,
+		Body: &icmp.Echo{ID: p.id, Seq: seq, Data: []byte("mcis-ping-probe")},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: ip.AsSlice(), Zone: ip.Zone()}
+	if pc.privileged {
+		dst = &net.IPAddr{IP: ip.AsSlice(), Zone: ip.Zone()}
+	}
+	start = time.Now()
+	if _, err := pc.conn.WriteTo(b, dst); err != nil {
+		res.Error = err.Error()
+		res.TotalMS = time.Since(start).Milliseconds()
+		return res
+	}
+
+	select {
+	case at := <-reply:
+		res.OK = true
+		res.TotalMS = at.Sub(start).Milliseconds()
+	case <-ctx.Done():
+		res.Error = "timeout"
+		if errors.Is(context.Cause(ctx), ErrUnreachable) {
+			res.Error = ErrUnreachable.Error()
+		}
+		res.TotalMS = time.Since(start).Milliseconds()
+	}
+	return res
+}
+
+func (p *Pinger) readLoop(pc *pingConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := pc.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		at := time.Now()
+		msg, err := icmp.ParseMessage(pc.proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		if msg.Type != ipv4.ICMPTypeEchoReply && msg.Type != ipv6.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok {
+			continue
+		}
+		// Unprivileged sockets have their ID rewritten by the kernel and
+		// only receive their own replies.
+		if pc.privileged && echo.ID != p.id {
+			continue
+		}
+		var from netip.Addr
+		switch a := peer.(type) {
+		case *net.IPAddr:
+			from, _ = netip.AddrFromSlice(a.IP)
+		case *net.UDPAddr:
+			from, _ = netip.AddrFromSlice(a.IP)
+		}
+
+		p.mu.Lock()
+		ch := p.waiting[pingKey{ip: from.Unmap(), seq: echo.Seq}]
+		p.mu.Unlock()
+		if ch != nil {
+			select {
+			case ch <- at:
+			default:
+			}
+		}
+	}
+}
+
+// Close closes the ICMP sockets.
+func (p *Pinger) Close() error {
+	var errs []error
+	for _, pc := range []*pingConn{p.v4, p.v6} {
+		if pc != nil {
+			errs = append(errs, pc.conn.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,129 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"sync"
+)
+
+// DefaultPort is the port probed when Config.Port is not set (HTTPPort for
+// the http scheme).
+const (
+	DefaultPort = 443
+	HTTPPort    = 80
+)
+
+// URL schemes accepted in Config.Scheme.
+const (
+	SchemeHTTPS = "https"
+	SchemeHTTP  = "http"
+)
+
+// scheme returns the URL scheme to probe.
+func (c Config) scheme() string {
+	if c.Scheme == "" {
+		return SchemeHTTPS
+	}
+	return c.Scheme
+}
+
+// defaultPort returns the default port of the scheme (or backend).
+func (c Config) defaultPort() uint16 {
+	if c.Backend == BackendWarp {
+		return WarpPort
+	}
+	if c.scheme() == SchemeHTTP {
+		return HTTPPort
+	}
+	return DefaultPort
+}
+
+// port returns the port to probe.
+func (c Config) port() uint16 {
+	if c.Port != 0 {
+		return c.Port
+	}
+	return c.defaultPort()
+}
+
+// hostPort formats ip (and the port, unless it is the scheme default) for
+// use as a URL host.
+func (c Config) hostPort(ip netip.Addr) string {
+	if c.port() == c.defaultPort() {
+		if ip.Is6() {
+			return "[" + ip.String() + "]"
+		}
+		return ip.String()
+	}
+	return netip.AddrPortFrom(ip, c.port()).String()
+}
+
+// MultiPort is a Backend that probes every IP on several ports concurrently
+// and returns the best result: the fastest successful one, or the first
+// port's failure if none succeeded. Result.Port records the chosen port.
+type MultiPort struct {
+	ports    []uint16
+	backends []Backend
+}
+
+// NewMultiPort creates one backend per port in cfg.Ports.
+func NewMultiPort(cfg Config) (*MultiPort, error) {
+	m := &MultiPort{}
+	for _, p := range cfg.Ports {
+		pc := cfg
+		pc.Port = p
+		pc.Ports = nil
+		b, err := NewBackend(pc)
+		if err != nil {
+			_ = m.Close()
+			return nil, fmt.Errorf("port %d: %w", p, err)
+		}
+		m.ports = append(m.ports, p)
+		m.backends = append(m.backends, b)
+	}
+	return m, nil
+}
+
+// Close closes the per-port backends.
+func (m *MultiPort) Close() error {
+	var errs []error
+	for _, b := range m.backends {
+		errs = append(errs, closeBackend(b))
+	}
+	return errors.Join(errs...)
+}
+
+// Probe implements Backend.
+func (m *MultiPort) Probe(ctx context.Context, ip netip.Addr) Result {
+	results := make([]Result, len(m.backends))
+	var wg sync.WaitGroup
+	for i, b := range m.backends {
+		wg.Add(1)
+		go func(i int, b Backend) {
+			defer wg.Done()
+			results[i] = b.Probe(ctx, ip)
+			results[i].Port = m.ports[i]
+		}(i, b)
+	}
+	wg.Wait()
+
+	best := results[0]
+	for _, r := range results[1:] {
+		if r.OK && (!best.OK || r.TotalMS < best.TotalMS) {
+			best = r
+		}
+	}
+	return best
+}
+
+// ParsePort parses a TCP/UDP port number.
+func ParsePort(s string) (uint16, error) {
+	v, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || v == 0 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return uint16(v), nil
+}
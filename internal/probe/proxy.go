@@ -0,0 +1,35 @@
+package probe
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ParseProxy parses an upstream proxy URL for Config.Proxy. Supported
+// schemes are http, https, socks5 and socks5h.
+func ParseProxy(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", s, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: unsupported scheme (want http|https|socks5|socks5h)", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", s)
+	}
+	return u, nil
+}
+
+// proxyFunc returns the http.Transport.Proxy for an explicit upstream
+// proxy. Without one it returns nil, so HTTP(S)_PROXY and NO_PROXY env
+// vars are never consulted.
+func proxyFunc(u *url.URL) func(*http.Request) (*url.URL, error) {
+	if u == nil {
+		return nil
+	}
+	return http.ProxyURL(u)
+}
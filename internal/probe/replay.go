@@ -0,0 +1,123 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/input"
+)
+
+// Replayer is a Backend that answers probes from a recorded probe log
+// (JSON Lines of Result-compatible objects, as written by --probe-log).
+//
+// An address that was probed in the log gets its recorded results back in
+// order (cycling when asked more often than it was recorded). Other
+// addresses are answered from the recorded distribution of their /24
+// (IPv4) or /48 (IPv6); addresses with no data fail with "replay_miss".
+type Replayer struct {
+	byIP     map[netip.Addr][]Result
+	byPrefix map[netip.Prefix][]Result
+
+	mu       sync.Mutex
+	attempts map[netip.Addr]int
+}
+
+// NewReplayer loads a probe log, gzip-compressed or not.
+func NewReplayer(path string) (*Replayer, error) {
+	if path == "" {
+		return nil, errors.New("replay backend needs a probe log file")
+	}
+	f, err := input.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	r := &Replayer{
+		byIP:     make(map[netip.Addr][]Result),
+		byPrefix: make(map[netip.Prefix][]Result),
+		attempts: make(map[netip.Addr]int),
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var res Result
+		if err := json.Unmarshal(sc.Bytes(), &res); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if !res.IP.IsValid() {
+			continue
+		}
+		r.byIP[res.IP] = append(r.byIP[res.IP], res)
+		p := replayPrefix(res.IP)
+		r.byPrefix[p] = append(r.byPrefix[p], res)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(r.byIP) == 0 {
+		return nil, fmt.Errorf("%s: no probe results", path)
+	}
+	return r, nil
+}
+
+// Probe implements Backend.
+func (r *Replayer) Probe(ctx context.Context, ip netip.Addr) Result {
+	r.mu.Lock()
+	attempt := r.attempts[ip]
+	r.attempts[ip]++
+	r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		res := Result{IP: ip, When: time.Now(), Error: err.Error()}
+		if errors.Is(err, context.DeadlineExceeded) {
+			res.Error = "timeout"
+		}
+		return res
+	}
+
+	var res Result
+	if recs := r.byIP[ip]; len(recs) > 0 {
+		res = recs[attempt%len(recs)]
+	} else if recs := r.byPrefix[replayPrefix(ip)]; len(recs) > 0 {
+		// Deterministic pick from the prefix distribution.
+		h := mix64(uint64(attempt) ^ addrHash(ip))
+		res = recs[h%uint64(len(recs))]
+	} else {
+		return Result{IP: ip, When: time.Now(), Error: "replay_miss"}
+	}
+
+	res.IP = ip
+	res.When = time.Now()
+	return res
+}
+
+// replayPrefix returns the aggregation prefix for the distribution fallback.
+func replayPrefix(ip netip.Addr) netip.Prefix {
+	bits := 24
+	if ip.Is6() {
+		bits = 48
+	}
+	return netip.PrefixFrom(ip, bits).Masked()
+}
+
+// addrHash folds an address into 64 bits.
+func addrHash(ip netip.Addr) uint64 {
+	var h uint64
+	for _, b := range ip.AsSlice() {
+		h = h*131 + uint64(b)
+	}
+	return h
+}
@@ -0,0 +1,131 @@
+package probe
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// recordLog probes ips with the default simulator and writes the results
+// as a probe log.
+func recordLog(t *testing.T, compress bool, ips ...string) (string, map[netip.Addr][]Result) {
+	t.Helper()
+	sim, err := NewSimulator(Config{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "probes.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w io.Writer = f
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(f)
+		w = zw
+	}
+	enc := json.NewEncoder(w)
+	recorded := make(map[netip.Addr][]Result)
+	for _, s := range ips {
+		ip := netip.MustParseAddr(s)
+		res := sim.Probe(context.Background(), ip)
+		if err := enc.Encode(res); err != nil {
+			t.Fatal(err)
+		}
+		recorded[ip] = append(recorded[ip], res)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path, recorded
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		name := "plain"
+		if compress {
+			name = "gzip"
+		}
+		t.Run(name, func(t *testing.T) {
+			path, recorded := recordLog(t, compress,
+				"192.0.2.1", "192.0.2.1", "192.0.2.1", "192.0.2.7", "2001:db8::1")
+			r, err := NewReplayer(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for ip, recs := range recorded {
+				// Twice round, to check that the results cycle.
+				for i := 0; i < 2*len(recs); i++ {
+					want := recs[i%len(recs)]
+					got := r.Probe(context.Background(), ip)
+					if got.IP != ip || got.OK != want.OK || got.TotalMS != want.TotalMS || got.Error != want.Error {
+						t.Errorf("%s probe %d = %+v, want %+v", ip, i, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReplayFallback(t *testing.T) {
+	path, recorded := recordLog(t, false, "192.0.2.1", "192.0.2.7", "2001:db8::1")
+	r, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip   string
+		from []string // recorded IPs the answer may come from; none is a miss
+	}{
+		{"192.0.2.200", []string{"192.0.2.1", "192.0.2.7"}},
+		{"2001:db8::ffff", []string{"2001:db8::1"}},
+		{"192.0.3.1", nil},
+		{"2001:db8:1::1", nil},
+	}
+	for _, tt := range tests {
+		ip := netip.MustParseAddr(tt.ip)
+		got := r.Probe(context.Background(), ip)
+		if got.IP != ip {
+			t.Errorf("%s: IP = %s", tt.ip, got.IP)
+		}
+		if len(tt.from) == 0 {
+			if got.Error != "replay_miss" {
+				t.Errorf("%s: error = %q, want replay_miss", tt.ip, got.Error)
+			}
+			continue
+		}
+		found := false
+		for _, s := range tt.from {
+			want := recorded[netip.MustParseAddr(s)][0]
+			found = found || (got.TotalMS == want.TotalMS && got.OK == want.OK)
+		}
+		if !found {
+			t.Errorf("%s: %+v is not one of the results of %v", tt.ip, got, tt.from)
+		}
+	}
+}
+
+func TestReplayEmptyLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.jsonl")
+	if err := os.WriteFile(path, []byte("\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReplayer(path); err == nil {
+		t.Error("NewReplayer accepted a log without results")
+	}
+	if _, err := NewReplayer(""); err == nil {
+		t.Error("NewReplayer accepted an empty path")
+	}
+}
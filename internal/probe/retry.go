@@ -0,0 +1,84 @@
+package probe
+
+import (
+	"context"
+	"net/netip"
+	"time"
+)
+
+// DefaultRetryBackoff is the pause before the first retry of a probe.
+const DefaultRetryBackoff = 100 * time.Millisecond
+
+// Retrier is a Backend that retries transient failures (timeouts, resets,
+// truncated connections) up to Config.Retries times before reporting the
+// IP as failed. The pause before retry n is RetryBackoff*2^(n-1). Each
+// attempt gets the full per-probe timeout.
+//
+// Definitive failures (refused connections, TLS verification, unexpected
+// status or body) are returned immediately. Result.Attempts holds the
+// number of attempts made.
+type Retrier struct {
+	backend Backend
+	retries int
+	timeout time.Duration
+	backoff time.Duration
+}
+
+// NewRetrier wraps b so that transient failures are retried cfg.Retries times.
+func NewRetrier(b Backend, cfg Config) *Retrier {
+	backoff := cfg.RetryBackoff
+	if backoff < 0 {
+		backoff = 0
+	}
+	return &Retrier{backend: b, retries: cfg.Retries, timeout: cfg.Timeout, backoff: backoff}
+}
+
+// Close closes the wrapped backend.
+func (r *Retrier) Close() error { return closeBackend(r.backend) }
+
+// Probe implements Backend.
+func (r *Retrier) Probe(ctx context.Context, ip netip.Addr) Result {
+	var res Result
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && r.backoff > 0 {
+			t := time.NewTimer(r.backoff << (attempt - 1))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		actx, cancel := context.WithTimeout(ctx, r.timeout)
+		res = r.backend.Probe(actx, ip)
+		cancel()
+		res.Attempts = attempt + 1
+		if res.OK || attempt >= r.retries || ctx.Err() != nil || !transient(res.Error) {
+			break
+		}
+	}
+	return res
+}
+
+// transient reports whether a probe error is worth retrying.
+func transient(err string) bool {
+	switch ErrorKind(err) {
+	case ErrKindTimeout, ErrKindReset, ErrKindEOF:
+		return true
+	}
+	return false
+}
+
+// retryBudget returns the worst-case time of one retried probe.
+func (c Config) retryBudget() time.Duration {
+	if c.Retries <= 0 {
+		return c.Timeout
+	}
+	d := c.Timeout * time.Duration(c.Retries+1)
+	if c.RetryBackoff > 0 {
+		d += c.RetryBackoff * (1<<c.Retries - 1)
+	}
+	return d
+}
@@ -0,0 +1,157 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// Sample statistics accepted in Config.SampleStat.
+const (
+	SampleP50 = "p50"
+	SampleP90 = "p90"
+	SampleMax = "max"
+)
+
+// Sampler is a Backend that measures every IP Config.Samples times in a
+// row and aggregates the outcomes into one Result. Each sample gets the
+// full per-probe timeout (including retries, see Retrier).
+//
+// The aggregated Result is OK when at least one sample succeeded. P50MS,
+// P90MS and MaxMS are computed over the successful samples and TotalMS is
+// set to the statistic selected by Config.SampleStat (default p50), so it
+// is what the search scores. LossPct is the share of failed samples and
+// JitterMS the mean absolute difference between consecutive successful
+// samples. The remaining fields come from the sample closest to the median.
+type Sampler struct {
+	backend  Backend
+	n        int
+	timeout  time.Duration
+	interval time.Duration
+	stat     string
+}
+
+// NewSampler wraps b so that every probe takes cfg.Samples measurements.
+func NewSampler(b Backend, cfg Config) (*Sampler, error) {
+	switch cfg.SampleStat {
+	case "", SampleP50, SampleP90, SampleMax:
+	default:
+		return nil, fmt.Errorf("unknown sample statistic: %s (want %s|%s|%s)", cfg.SampleStat, SampleP50, SampleP90, SampleMax)
+	}
+	stat := cfg.SampleStat
+	if stat == "" {
+		stat = SampleP50
+	}
+	return &Sampler{
+		backend:  b,
+		n:        max(cfg.Samples, 1),
+		timeout:  cfg.retryBudget(),
+		interval: cfg.SampleInterval,
+		stat:     stat,
+	}, nil
+}
+
+// Close closes the wrapped backend.
+func (s *Sampler) Close() error { return closeBackend(s.backend) }
+
+// Probe implements Backend.
+func (s *Sampler) Probe(ctx context.Context, ip netip.Addr) Result {
+	results := make([]Result, 0, s.n)
+	for i := 0; i < s.n; i++ {
+		if i > 0 && s.interval > 0 {
+			t := time.NewTimer(s.interval)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		sctx, cancel := context.WithTimeout(ctx, s.timeout)
+		results = append(results, s.backend.Probe(sctx, ip))
+		cancel()
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return s.aggregate(results)
+}
+
+// aggregate folds the samples of one IP into a single Result.
+func (s *Sampler) aggregate(results []Result) Result {
+	var (
+		ok     []Result
+		jitter float64
+		prev   int64 = -1
+	)
+	for _, r := range results {
+		if !r.OK {
+			continue
+		}
+		if prev >= 0 {
+			jitter += math.Abs(float64(r.TotalMS - prev))
+		}
+		prev = r.TotalMS
+		ok = append(ok, r)
+	}
+	lossPct := 100 * float64(len(results)-len(ok)) / float64(len(results))
+	if len(ok) == 0 {
+		res := results[0]
+		res.Samples = len(results)
+		res.LossPct = lossPct
+		return res
+	}
+	if len(ok) > 1 {
+		jitter /= float64(len(ok) - 1)
+	}
+
+	sort.SliceStable(ok, func(i, j int) bool { return ok[i].TotalMS < ok[j].TotalMS })
+	ms := make([]float64, len(ok))
+	for i, r := range ok {
+		ms[i] = float64(r.TotalMS)
+	}
+	res := ok[len(ok)/2]
+	res.Samples = len(results)
+	res.SamplesOK = len(ok)
+	res.P50MS = ok[len(ok)/2].TotalMS
+	res.P90MS = int64(Percentile(ms, 0.9))
+	res.MaxMS = ok[len(ok)-1].TotalMS
+	res.LossPct = lossPct
+	res.JitterMS = jitter
+	res.When = results[0].When
+
+	switch s.stat {
+	case SampleP90:
+		res.TotalMS = res.P90MS
+	case SampleMax:
+		res.TotalMS = res.MaxMS
+	default:
+		res.TotalMS = res.P50MS
+	}
+	return res
+}
+
+// Percentile returns the q-quantile (nearest rank) of xs.
+func Percentile(xs []float64, q float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	i := int(math.Ceil(q*float64(len(s)))) - 1
+	return s[max(0, min(i, len(s)-1))]
+}
+
+// ProbeTimeout returns the time budget for one (possibly multi-sample,
+// retried) probe of an IP, including the pauses between samples.
+func (c Config) ProbeTimeout() time.Duration {
+	if c.Samples > 1 {
+		return c.retryBudget()*time.Duration(c.Samples) + time.Duration(c.Samples-1)*c.SampleInterval
+	}
+	return c.retryBudget()
+}
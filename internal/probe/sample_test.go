@@ -0,0 +1,54 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		xs   []float64
+		q    float64
+		want float64
+	}{
+		{nil, 0.5, 0},
+		{[]float64{7}, 0.9, 7},
+		{[]float64{3, 1, 2}, 0.5, 2},
+		{[]float64{4, 1, 3, 2}, 0.5, 2},
+		{[]float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, 0.9, 90},
+		{[]float64{5, 1, 4}, 0, 1},
+		{[]float64{5, 1, 4}, 1, 5},
+	}
+	for _, tt := range tests {
+		if got := Percentile(tt.xs, tt.q); got != tt.want {
+			t.Errorf("Percentile(%v, %v) = %v, want %v", tt.xs, tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestPercentileKeepsInput(t *testing.T) {
+	xs := []float64{3, 1, 2}
+	Percentile(xs, 0.5)
+	if xs[0] != 3 || xs[1] != 1 || xs[2] != 2 {
+		t.Errorf("Percentile reordered its input: %v", xs)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want time.Duration
+	}{
+		{"single", Config{Timeout: time.Second}, time.Second},
+		{"retries", Config{Timeout: time.Second, Retries: 2}, 3 * time.Second},
+		{"backoff", Config{Timeout: time.Second, Retries: 2, RetryBackoff: 100 * time.Millisecond}, 3300 * time.Millisecond},
+		{"samples", Config{Timeout: time.Second, Samples: 3, SampleInterval: 50 * time.Millisecond}, 3100 * time.Millisecond},
+		{"samples and retries", Config{Timeout: time.Second, Retries: 1, Samples: 2, SampleInterval: time.Second}, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.ProbeTimeout(); got != tt.want {
+			t.Errorf("%s: ProbeTimeout() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
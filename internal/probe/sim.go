@@ -0,0 +1,203 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/netip"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SimParams describes the synthetic behavior of a prefix.
+type SimParams struct {
+	BaseMS   float64 `json:"base_ms"`   // median latency
+	JitterMS float64 `json:"jitter_ms"` // +/- per-probe jitter
+	Loss     float64 `json:"loss"`      // probability of a failed probe (0-1)
+	Dead     bool    `json:"dead"`      // every probe times out
+	Colo     string  `json:"colo"`      // reported as trace colo
+}
+
+// SimPrefix assigns SimParams to a CIDR.
+type SimPrefix struct {
+	CIDR string `json:"cidr"`
+	SimParams
+}
+
+// Scenario is the JSON scenario file format for the simulator. Prefixes
+// are matched by longest prefix; addresses matching none use Default, or a
+// built-in synthetic landscape when Default is not set.
+type Scenario struct {
+	Seed     int64       `json:"seed"`
+	Default  *SimParams  `json:"default,omitempty"`
+	Prefixes []SimPrefix `json:"prefixes"`
+}
+
+// Simulator is an offline Backend driven by a synthetic latency model.
+// Results are a pure function of (seed, ip, attempt number), so runs are
+// reproducible without network access.
+type Simulator struct {
+	timeout  time.Duration
+	seed     int64
+	def      *SimParams
+	prefixes []simEntry // sorted by prefix length, longest first
+
+	mu       sync.Mutex
+	attempts map[netip.Addr]uint64
+}
+
+type simEntry struct {
+	prefix netip.Prefix
+	params SimParams
+}
+
+// simColos are used by the built-in landscape.
+var simColos = []string{"HKG", "NRT", "SIN", "LAX", "SJC", "FRA", "AMS", "LHR"}
+
+// NewSimulator creates a simulator from cfg.SimScenario (optional).
+func NewSimulator(cfg Config) (*Simulator, error) {
+	s := &Simulator{
+		timeout:  cfg.Timeout,
+		attempts: make(map[netip.Addr]uint64),
+	}
+	if s.timeout <= 0 {
+		s.timeout = 3 * time.Second
+	}
+	if cfg.SimScenario == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(cfg.SimScenario)
+	if err != nil {
+		return nil, err
+	}
+	var sc Scenario
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("parse scenario %q: %w", cfg.SimScenario, err)
+	}
+	s.seed = sc.Seed
+	s.def = sc.Default
+	for _, p := range sc.Prefixes {
+		pfx, err := netip.ParsePrefix(p.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("parse scenario cidr %q: %w", p.CIDR, err)
+		}
+		s.prefixes = append(s.prefixes, simEntry{prefix: pfx.Masked(), params: p.SimParams})
+	}
+	sort.SliceStable(s.prefixes, func(i, j int) bool {
+		return s.prefixes[i].prefix.Bits() > s.prefixes[j].prefix.Bits()
+	})
+	return s, nil
+}
+
+// Probe implements Backend.
+func (s *Simulator) Probe(ctx context.Context, ip netip.Addr) Result {
+	res := Result{IP: ip, When: time.Now()}
+
+	s.mu.Lock()
+	attempt := s.attempts[ip]
+	s.attempts[ip]++
+	s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		if errors.Is(context.Cause(ctx), ErrUnreachable) {
+			res.Error = ErrUnreachable.Error()
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			res.Error = "timeout"
+		} else {
+			res.Error = err.Error()
+		}
+		return res
+	}
+
+	p := s.params(ip)
+	timeoutMS := s.timeout.Milliseconds()
+	if p.Dead {
+		res.Error = "timeout"
+		res.TotalMS = timeoutMS
+		return res
+	}
+
+	// Static per-address offset plus per-attempt jitter.
+	latency := p.BaseMS * (1 + 0.1*s.unit(ip, 0, "host"))
+	latency += (s.unit(ip, attempt, "jitter")*2 - 1) * p.JitterMS
+	if latency < 1 {
+		latency = 1
+	}
+	total := int64(latency)
+
+	if s.unit(ip, attempt, "loss") < p.Loss || total >= timeoutMS {
+		res.Error = "timeout"
+		res.TotalMS = timeoutMS
+		return res
+	}
+
+	res.OK = true
+	res.Status = 200
+	res.ConnectMS = total / 4
+	res.TLSMS = total / 2
+	res.TTFBMS = total
+	res.TotalMS = total
+	res.Trace = map[string]string{"ip": ip.String(), "colo": p.Colo, "sim": "1"}
+	return res
+}
+
+// params returns the model parameters for ip.
+func (s *Simulator) params(ip netip.Addr) SimParams {
+	for _, e := range s.prefixes {
+		if e.prefix.Contains(ip) {
+			return e.params
+		}
+	}
+	if s.def != nil {
+		return *s.def
+	}
+
+	// Built-in landscape: dead zones per /20 (v4) or /40 (v6), latency and
+	// loss per /24 or /48.
+	block, cell := 20, 24
+	if ip.Is6() {
+		block, cell = 40, 48
+	}
+	b := netip.PrefixFrom(ip, block).Masked().Addr()
+	c := netip.PrefixFrom(ip, cell).Masked().Addr()
+
+	u := s.unit(c, 0, "base")
+	base := 20 + 280*u*u
+	loss := s.unit(c, 0, "loss")
+	return SimParams{
+		BaseMS:   base,
+		JitterMS: base * (0.05 + 0.2*s.unit(c, 0, "jitter")),
+		Loss:     0.3 * loss * loss,
+		Dead:     s.unit(b, 0, "dead") < 0.1,
+		Colo:     simColos[int(s.unit(b, 0, "colo")*float64(len(simColos)))],
+	}
+}
+
+// unit hashes (seed, ip, n, salt) to a uniform value in [0, 1).
+func (s *Simulator) unit(ip netip.Addr, n uint64, salt string) float64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(s.seed))
+	_, _ = h.Write(buf[:])
+	_, _ = h.Write(ip.AsSlice())
+	binary.BigEndian.PutUint64(buf[:], n)
+	_, _ = h.Write(buf[:])
+	_, _ = h.Write([]byte(salt))
+	return float64(mix64(h.Sum64())>>11) / float64(1<<53)
+}
+
+// mix64 is the splitmix64 finalizer; it spreads FNV's weakly mixed bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,107 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeScenario(t *testing.T, sc Scenario) string {
+	t.Helper()
+	data, err := json.Marshal(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSimulatorScenario(t *testing.T) {
+	path := writeScenario(t, Scenario{
+		Seed:    7,
+		Default: &SimParams{BaseMS: 500, Colo: "DEF"},
+		Prefixes: []SimPrefix{
+			{CIDR: "10.0.0.0/16", SimParams: SimParams{BaseMS: 40, Colo: "HKG"}},
+			{CIDR: "10.0.1.0/24", SimParams: SimParams{BaseMS: 100, Colo: "NRT"}},
+			{CIDR: "10.0.2.0/24", SimParams: SimParams{Dead: true}},
+			{CIDR: "10.0.3.0/24", SimParams: SimParams{BaseMS: 40, Loss: 1}},
+			{CIDR: "10.0.4.0/24", SimParams: SimParams{BaseMS: 5000}},
+		},
+	})
+	sim, err := NewSimulator(Config{Timeout: time.Second, SimScenario: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		ip     string
+		ok     bool
+		colo   string
+		minMS  int64
+		maxMS  int64
+		errMsg string
+	}{
+		{"shorter prefix", "10.0.9.1", true, "HKG", 36, 44, ""},
+		{"longest prefix wins", "10.0.1.1", true, "NRT", 90, 110, ""},
+		{"default", "192.0.2.1", true, "DEF", 450, 550, ""},
+		{"dead zone", "10.0.2.1", false, "", 1000, 1000, "timeout"},
+		{"lossy", "10.0.3.1", false, "", 1000, 1000, "timeout"},
+		{"slower than the timeout", "10.0.4.1", false, "", 1000, 1000, "timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := sim.Probe(context.Background(), netip.MustParseAddr(tt.ip))
+			if res.OK != tt.ok || res.Error != tt.errMsg {
+				t.Fatalf("ok=%v error=%q, want ok=%v error=%q", res.OK, res.Error, tt.ok, tt.errMsg)
+			}
+			if res.TotalMS < tt.minMS || res.TotalMS > tt.maxMS {
+				t.Errorf("TotalMS = %d, want %d-%d", res.TotalMS, tt.minMS, tt.maxMS)
+			}
+			if tt.ok && res.Trace["colo"] != tt.colo {
+				t.Errorf("colo = %q, want %q", res.Trace["colo"], tt.colo)
+			}
+		})
+	}
+}
+
+func TestSimulatorDeterministic(t *testing.T) {
+	probeAll := func() []Result {
+		sim, err := NewSimulator(Config{Timeout: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []Result
+		for _, ip := range []string{"198.51.100.1", "198.51.100.1", "2001:db8::1", "203.0.113.9"} {
+			res := sim.Probe(context.Background(), netip.MustParseAddr(ip))
+			res.When = time.Time{}
+			out = append(out, res)
+		}
+		return out
+	}
+	a, b := probeAll(), probeAll()
+	for i := range a {
+		if a[i].OK != b[i].OK || a[i].TotalMS != b[i].TotalMS || a[i].Error != b[i].Error {
+			t.Errorf("probe %d differs between runs: %+v vs %+v", i, a[i], b[i])
+		}
+	}
+}
+
+func TestSimulatorCanceled(t *testing.T) {
+	sim, err := NewSimulator(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if res := sim.Probe(ctx, netip.MustParseAddr("10.0.0.1")); res.OK || res.Error != "timeout" {
+		t.Errorf("expired context: ok=%v error=%q, want a timeout", res.OK, res.Error)
+	}
+}
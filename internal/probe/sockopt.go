@@ -0,0 +1,226 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// SocketOptions are applied to every probe socket before it connects.
+// Zero values leave the OS defaults untouched.
+type SocketOptions struct {
+	// FwMark sets SO_MARK for policy routing (Linux only).
+	FwMark int
+	// TOS sets the IPv4 TOS / IPv6 traffic class byte (DSCP << 2).
+	TOS int
+
+	// Nagle re-enables Nagle's algorithm (Go sets TCP_NODELAY by default).
+	Nagle bool
+	// KeepAlive is the TCP keep-alive period (0 = 30s, negative = off).
+	KeepAlive time.Duration
+	// UserTimeout sets TCP_USER_TIMEOUT (Linux only).
+	UserTimeout time.Duration
+	// RecvBuf and SendBuf set SO_RCVBUF / SO_SNDBUF in bytes.
+	RecvBuf int
+	SendBuf int
+
+	// IPv6Prefer selects temporary or stable IPv6 source addresses
+	// (IPv6PreferTemporary / IPv6PreferStable, Linux only).
+	IPv6Prefer string
+	// IPv6Source restricts the IPv6 source address to a local address
+	// inside this prefix (e.g. one of several delegated /64s).
+	IPv6Source netip.Prefix
+	// Zone is the interface used for link-local IPv6 targets without a zone.
+	Zone string
+
+	// SourceIP binds probe sockets to this local address (net.Dialer
+	// LocalAddr). Targets of the other address family fail.
+	SourceIP netip.Addr
+	// Interface binds probe sockets to a network interface
+	// (SO_BINDTODEVICE on Linux, IP_BOUND_IF on macOS).
+	Interface string
+}
+
+// IPv6 source preferences accepted in SocketOptions.IPv6Prefer.
+const (
+	IPv6PreferTemporary = "temporary"
+	IPv6PreferStable    = "stable"
+)
+
+// IsZero reports whether no option is set.
+func (o SocketOptions) IsZero() bool {
+	return o == SocketOptions{}
+}
+
+// Validate reports invalid options and options that are not supported on
+// this platform.
+func (o SocketOptions) Validate() error {
+	switch o.IPv6Prefer {
+	case "", IPv6PreferTemporary, IPv6PreferStable:
+	default:
+		return fmt.Errorf("invalid IPv6 source preference: %s (want %s|%s)", o.IPv6Prefer, IPv6PreferTemporary, IPv6PreferStable)
+	}
+	if o.IPv6Source.IsValid() && !o.IPv6Source.Addr().Is6() {
+		return fmt.Errorf("IPv6 source prefix is not IPv6: %s", o.IPv6Source)
+	}
+	if o.IPv6Source.IsValid() && o.SourceIP.Is6() {
+		return fmt.Errorf("IPv6 source prefix and IPv6 source address are mutually exclusive")
+	}
+	if o.Interface != "" {
+		if _, err := net.InterfaceByName(o.Interface); err != nil {
+			return fmt.Errorf("interface %s: %w", o.Interface, err)
+		}
+	}
+	return validateSockopts(o)
+}
+
+// needsControl reports whether o sets options that must be applied on the
+// raw socket before connecting.
+func (o SocketOptions) needsControl() bool {
+	return o.FwMark != 0 || o.TOS != 0 || o.UserTimeout > 0 || o.RecvBuf > 0 || o.SendBuf > 0 ||
+		o.IPv6Prefer != "" || o.Interface != ""
+}
+
+// control returns a net.Dialer Control hook applying o, or nil if there is
+// nothing to apply.
+func (o SocketOptions) control() func(network, address string, c syscall.RawConn) error {
+	if !o.needsControl() {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var serr error
+		if err := c.Control(func(fd uintptr) {
+			serr = applySockopts(fd, network, o)
+		}); err != nil {
+			return err
+		}
+		return serr
+	}
+}
+
+// dialFunc returns the dial function used for probe connections.
+func dialFunc(timeout time.Duration, opts SocketOptions) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	keepAlive := opts.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = 30 * time.Second
+	}
+	d := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: keepAlive,
+		Control:   opts.control(),
+	}
+	if !opts.Nagle && !opts.bindsSource() && opts.Zone == "" {
+		return d.DialContext
+	}
+	source := opts.sourceFunc()
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialer := d
+		if ap, err := netip.ParseAddrPort(addr); err == nil {
+			ip := ap.Addr()
+			if opts.Zone != "" && ip.Is6() && ip.Zone() == "" && ip.IsLinkLocalUnicast() {
+				addr = netip.AddrPortFrom(ip.WithZone(opts.Zone), ap.Port()).String()
+			}
+			src, err := source(ip)
+			if err != nil {
+				return nil, err
+			}
+			if src.IsValid() {
+				dd := *d
+				dd.LocalAddr = &net.TCPAddr{IP: src.AsSlice()}
+				dialer = &dd
+			}
+		}
+
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if !opts.Nagle {
+			return conn, nil
+		}
+		// TCP_NODELAY is set by the net package after connect, so this
+		// cannot be done in the Control hook.
+		if tc, ok := conn.(*net.TCPConn); ok {
+			if err := tc.SetNoDelay(false); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}
+}
+
+// bindsSource reports whether o selects the local source address.
+func (o SocketOptions) bindsSource() bool {
+	return o.SourceIP.IsValid() || o.IPv6Source.IsValid()
+}
+
+// sourceFunc returns a function choosing the local source address for a
+// target; the zero Addr means "let the OS choose".
+func (o SocketOptions) sourceFunc() func(dst netip.Addr) (netip.Addr, error) {
+	v6source := sync.OnceValues(func() (netip.Addr, error) {
+		return localAddrIn(o.IPv6Source)
+	})
+	return func(dst netip.Addr) (netip.Addr, error) {
+		dst = dst.Unmap()
+		if o.SourceIP.IsValid() {
+			if o.SourceIP.Is4() != dst.Is4() {
+				return netip.Addr{}, fmt.Errorf("source address %s cannot reach %s", o.SourceIP, dst)
+			}
+			return o.SourceIP, nil
+		}
+		if o.IPv6Source.IsValid() && dst.Is6() {
+			return v6source()
+		}
+		return netip.Addr{}, nil
+	}
+}
+
+// localAddrIn returns the first address of a local interface inside p.
+func localAddrIn(p netip.Prefix) (netip.Addr, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip, ok := netip.AddrFromSlice(ipn.IP)
+		if ok && p.Contains(ip.Unmap()) {
+			return ip.Unmap(), nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("no local address in %s", p)
+}
+
+// dscpClasses maps DSCP class names to code points.
+var dscpClasses = map[string]int{
+	"cs0": 0, "cs1": 8, "cs2": 16, "cs3": 24, "cs4": 32, "cs5": 40, "cs6": 48, "cs7": 56,
+	"af11": 10, "af12": 12, "af13": 14,
+	"af21": 18, "af22": 20, "af23": 22,
+	"af31": 26, "af32": 28, "af33": 30,
+	"af41": 34, "af42": 36, "af43": 38,
+	"ef": 46, "le": 1,
+}
+
+// ParseDSCP parses a DSCP code point given as a number (0-63) or a class
+// name such as "ef", "af41" or "cs1".
+func ParseDSCP(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if v, ok := dscpClasses[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseInt(s, 0, 0)
+	if err != nil || v < 0 || v > 63 {
+		return 0, fmt.Errorf("invalid DSCP %q (want 0-63 or a class like ef/af41/cs1)", s)
+	}
+	return int(v), nil
+}
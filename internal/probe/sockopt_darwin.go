@@ -0,0 +1,60 @@
+//go:build darwin
+
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func validateSockopts(o SocketOptions) error {
+	if o.FwMark != 0 {
+		return errors.New("fwmark is only supported on linux")
+	}
+	if o.UserTimeout > 0 {
+		return errors.New("tcp-user-timeout is only supported on linux")
+	}
+	if o.IPv6Prefer != "" {
+		return errors.New("ipv6-prefer is only supported on linux")
+	}
+	return nil
+}
+
+func applySockopts(fd uintptr, network string, o SocketOptions) error {
+	if err := validateSockopts(o); err != nil {
+		return err
+	}
+	if o.Interface != "" {
+		if err := bindInterface(int(fd), network, o.Interface); err != nil {
+			return err
+		}
+	}
+	if o.TOS != 0 {
+		if err := setTOS(int(fd), network, o.TOS); err != nil {
+			return err
+		}
+	}
+	return setBuffers(int(fd), o)
+}
+
+// bindInterface sets IP_BOUND_IF / IPV6_BOUND_IF.
+func bindInterface(fd int, network, name string) error {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(network, "6") {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_BOUND_IF, ifi.Index); err != nil {
+			return fmt.Errorf("set IPV6_BOUND_IF: %w", err)
+		}
+		return nil
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_BOUND_IF, ifi.Index); err != nil {
+		return fmt.Errorf("set IP_BOUND_IF: %w", err)
+	}
+	return nil
+}
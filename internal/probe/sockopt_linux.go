@@ -0,0 +1,55 @@
+//go:build linux
+
+package probe
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// IPV6_ADDR_PREFERENCES values from <linux/in6.h>.
+const (
+	ipv6PreferSrcTmp    = 0x0001
+	ipv6PreferSrcPublic = 0x0002
+)
+
+func validateSockopts(o SocketOptions) error {
+	return nil
+}
+
+func applySockopts(fd uintptr, network string, o SocketOptions) error {
+	if o.Interface != "" {
+		if err := unix.BindToDevice(int(fd), o.Interface); err != nil {
+			return fmt.Errorf("set SO_BINDTODEVICE: %w", err)
+		}
+	}
+	if o.FwMark != 0 {
+		if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, o.FwMark); err != nil {
+			return fmt.Errorf("set SO_MARK: %w", err)
+		}
+	}
+	if o.TOS != 0 {
+		if err := setTOS(int(fd), network, o.TOS); err != nil {
+			return err
+		}
+	}
+	if o.UserTimeout > 0 && strings.HasPrefix(network, "tcp") {
+		ms := int(o.UserTimeout.Milliseconds())
+		if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT, ms); err != nil {
+			return fmt.Errorf("set TCP_USER_TIMEOUT: %w", err)
+		}
+	}
+	if o.IPv6Prefer != "" && strings.HasSuffix(network, "6") {
+		pref := ipv6PreferSrcTmp
+		if o.IPv6Prefer == IPv6PreferStable {
+			pref = ipv6PreferSrcPublic
+		}
+		if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_ADDR_PREFERENCES, pref); err != nil {
+			return fmt.Errorf("set IPV6_ADDR_PREFERENCES: %w", err)
+		}
+	}
+	return setBuffers(int(fd), o)
+}
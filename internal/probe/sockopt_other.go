@@ -0,0 +1,31 @@
+//go:build !linux && !darwin
+
+package probe
+
+import "errors"
+
+func validateSockopts(o SocketOptions) error {
+	if o.FwMark != 0 {
+		return errors.New("fwmark is only supported on linux")
+	}
+	if o.UserTimeout > 0 {
+		return errors.New("tcp-user-timeout is only supported on linux")
+	}
+	if o.IPv6Prefer != "" {
+		return errors.New("ipv6-prefer is only supported on linux")
+	}
+	if o.Interface != "" {
+		return errors.New("interface binding is only supported on linux and macOS")
+	}
+	if o.TOS != 0 {
+		return errors.New("dscp is only supported on linux and macOS")
+	}
+	if o.RecvBuf > 0 || o.SendBuf > 0 {
+		return errors.New("socket buffer sizes are only supported on linux and macOS")
+	}
+	return nil
+}
+
+func applySockopts(fd uintptr, network string, o SocketOptions) error {
+	return validateSockopts(o)
+}
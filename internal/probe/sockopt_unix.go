@@ -0,0 +1,38 @@
+//go:build linux || darwin
+
+package probe
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// setTOS sets the TOS (IPv4) or traffic class (IPv6) byte.
+func setTOS(fd int, network string, tos int) error {
+	if strings.HasSuffix(network, "6") {
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos); err != nil {
+			return fmt.Errorf("set IPV6_TCLASS: %w", err)
+		}
+		return nil
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TOS, tos); err != nil {
+		return fmt.Errorf("set IP_TOS: %w", err)
+	}
+	return nil
+}
+
+// setBuffers sets SO_RCVBUF / SO_SNDBUF when requested.
+func setBuffers(fd int, o SocketOptions) error {
+	if o.RecvBuf > 0 {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, o.RecvBuf); err != nil {
+			return fmt.Errorf("set SO_RCVBUF: %w", err)
+		}
+	}
+	if o.SendBuf > 0 {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_SNDBUF, o.SendBuf); err != nil {
+			return fmt.Errorf("set SO_SNDBUF: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package probe
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusSet is a set of acceptable HTTP status codes.
+type StatusSet []StatusRange
+
+// StatusRange is an inclusive range of status codes.
+type StatusRange struct {
+	Lo, Hi int
+}
+
+// ParseStatusSet parses a comma-separated list of codes and ranges,
+// e.g. "200,204,301-308".
+func ParseStatusSet(s string) (StatusSet, error) {
+	var set StatusSet
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		a, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status %q", part)
+		}
+		b := a
+		if isRange {
+			if b, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+				return nil, fmt.Errorf("invalid status range %q", part)
+			}
+		}
+		if a < 100 || b > 599 || a > b {
+			return nil, fmt.Errorf("invalid status range %q", part)
+		}
+		set = append(set, StatusRange{Lo: a, Hi: b})
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("empty status list")
+	}
+	return set, nil
+}
+
+// Contains reports whether code is in the set.
+func (s StatusSet) Contains(code int) bool {
+	for _, r := range s {
+		if code >= r.Lo && code <= r.Hi {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Timing modes accepted in Config.Timing.
+const (
+	// TimingPooled measures through http.Client and httptrace (default).
+	TimingPooled = "pooled"
+	// TimingAccurate dials, handshakes and sends the request on a
+	// dedicated connection per probe, so ConnectMS/TLSMS/TTFBMS always
+	// describe a fresh connection and never a reused idle one.
+	TimingAccurate = "accurate"
+)
+
+// probeAccurate is ProbeHTTPTrace for TimingAccurate (and for TLS
+// fingerprints, which need their own handshake). TTFBMS is the time from
+// dial until the response headers arrived.
+func (p *Prober) probeAccurate(ctx context.Context, ip netip.Addr) Result {
+	start := time.Now()
+	res := Result{IP: ip, Port: p.cfg.port(), When: start}
+	fail := func(err error) Result {
+		res.Error, res.TLSVerify = probeError(ctx, err)
+		res.TotalMS = time.Since(start).Milliseconds()
+		return res
+	}
+
+	addr := netip.AddrPortFrom(ip, p.cfg.port()).String()
+	conn, err := dialFunc(p.cfg.Timeout, p.cfg.Socket)(ctx, "tcp", addr)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+	res.ConnectMS = time.Since(start).Milliseconds()
+
+	req, err := p.request(ctx, ip)
+	if err != nil {
+		return fail(err)
+	}
+	req.Close = true
+
+	var (
+		rw        net.Conn = conn
+		roundTrip func(*http.Request) (*http.Response, error)
+	)
+	if p.cfg.scheme() == SchemeHTTPS {
+		tlsStart := time.Now()
+		tc, state, err := p.cfg.tlsClient(ctx, conn, []string{http2.NextProtoTLS, "http/1.1"})
+		if err != nil {
+			return fail(err)
+		}
+		res.TLSMS = time.Since(tlsStart).Milliseconds()
+		res.TLSVerify = tlsVerifyOutcome(&state, p.cfg.Insecure)
+		res.setConnState(&state)
+		rw = tc
+
+		if state.NegotiatedProtocol == http2.NextProtoTLS {
+			cc, err := (&http2.Transport{}).NewClientConn(tc)
+			if err != nil {
+				return fail(err)
+			}
+			defer func() { _ = cc.Close() }()
+			roundTrip = cc.RoundTrip
+		}
+	}
+	if roundTrip == nil {
+		roundTrip = func(req *http.Request) (*http.Response, error) {
+			if err := req.Write(rw); err != nil {
+				return nil, err
+			}
+			return http.ReadResponse(bufio.NewReader(rw), req)
+		}
+	}
+
+	httpRes, err := roundTrip(req)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = httpRes.Body.Close() }()
+	res.TTFBMS = time.Since(start).Milliseconds()
+
+	var body []byte
+	if p.cfg.BodyLimit > 0 {
+		body, _ = io.ReadAll(io.LimitReader(httpRes.Body, p.cfg.BodyLimit))
+	}
+	res.Status = httpRes.StatusCode
+	res.HTTPProto = httpRes.Proto
+	res.TotalMS = time.Since(start).Milliseconds()
+	p.checkResult(&res, httpRes, body)
+	return res
+}
@@ -0,0 +1,93 @@
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLS verification outcomes recorded in Result.TLSVerify.
+const (
+	TLSVerifyOK       = "ok"
+	TLSVerifySkipped  = "skipped" // Config.Insecure
+	TLSVerifyUnknown  = "unknown_authority"
+	TLSVerifyHostname = "hostname_mismatch"
+	TLSVerifyExpired  = "expired"
+	TLSVerifyInvalid  = "invalid"
+	TLSVerifySPKI     = "spki_mismatch" // Config.PinSPKI
+)
+
+// LoadCAFile reads a PEM bundle into a certificate pool.
+func LoadCAFile(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", path)
+	}
+	return pool, nil
+}
+
+// LoadClientCert reads a PEM certificate/key pair for mTLS.
+func LoadClientCert(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("client certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// newTLSConfig returns the client TLS config shared by the probers.
+func newTLSConfig(sni string, roots *x509.CertPool, insecure bool, clientCert *tls.Certificate) *tls.Config {
+	cfg := &tls.Config{
+		ServerName:         sni,
+		RootCAs:            roots,
+		InsecureSkipVerify: insecure,
+	}
+	if clientCert != nil {
+		cfg.Certificates = []tls.Certificate{*clientCert}
+	}
+	return cfg
+}
+
+// tlsVerifyOutcome returns the verification outcome of a successful handshake.
+func tlsVerifyOutcome(state *tls.ConnectionState, insecure bool) string {
+	if state == nil {
+		return ""
+	}
+	if insecure {
+		return TLSVerifySkipped
+	}
+	return TLSVerifyOK
+}
+
+// tlsVerifyFailure classifies a certificate verification error; it returns
+// "" when err is not a verification failure.
+func tlsVerifyFailure(err error) string {
+	var (
+		unknown  x509.UnknownAuthorityError
+		hostname x509.HostnameError
+		invalid  x509.CertificateInvalidError
+		verify   *tls.CertificateVerificationError
+	)
+	switch {
+	case errors.Is(err, ErrSPKIMismatch):
+		return TLSVerifySPKI
+	case errors.As(err, &unknown):
+		return TLSVerifyUnknown
+	case errors.As(err, &hostname):
+		return TLSVerifyHostname
+	case errors.As(err, &invalid):
+		if invalid.Reason == x509.Expired {
+			return TLSVerifyExpired
+		}
+		return TLSVerifyInvalid
+	case errors.As(err, &verify):
+		return TLSVerifyInvalid
+	}
+	return ""
+}
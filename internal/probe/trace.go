@@ -3,40 +3,161 @@ package probe
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/http/httptrace"
 	"net/netip"
+	"net/url"
+	"regexp"
 	"strings"
 	"time"
 )
 
+// DefaultBodyLimit is the default number of response body bytes read per probe.
+const DefaultBodyLimit = 64 * 1024
+
 type Config struct {
 	Timeout    time.Duration
 	SNI        string
 	HostHeader string
 	Path       string
+
+	// Method is the HTTP method (default GET).
+	Method string
+	// Headers are added to every probe request (overriding the defaults).
+	Headers http.Header
+
+	// ExpectStatus lists the acceptable status codes (default: any 2xx).
+	// When set, redirects are not followed so 3xx codes can be accepted.
+	ExpectStatus StatusSet
+
+	// ExpectBody, if set, must match the (BodyLimit-truncated) response
+	// body for a probe to succeed.
+	ExpectBody *regexp.Regexp
+
+	// Scheme is SchemeHTTPS (default) or SchemeHTTP (no TLS).
+	Scheme string
+
+	// Port is the port to probe (0 = DefaultPort). Ports probes several
+	// ports per IP and keeps the best (see MultiPort).
+	Port  uint16
+	Ports []uint16
+
+	// Backend selects the probe method (see NewBackend); empty means HTTP.
+	Backend string
+	// Mode selects the HTTP transport of the http backend: ModeHTTPS
+	// (default) or ModeH3.
+	Mode string
+	// SimScenario is an optional scenario file for the sim backend.
+	SimScenario string
+	// ReplayFile is the recorded probe log for the replay backend.
+	ReplayFile string
+
+	// BodyLimit is the maximum number of response body bytes read and parsed
+	// per probe. 0 reads headers only (faster, but no trace data).
+	BodyLimit int64
+
+	// RootCAs overrides the system roots for certificate verification.
+	RootCAs *x509.CertPool
+	// Insecure skips certificate verification (Result.TLSVerify = "skipped").
+	Insecure bool
+	// PinSPKI lists accepted leaf SPKI hashes (base64 SHA-256); any other
+	// certificate fails the handshake with "tls_verify_spki_mismatch".
+	PinSPKI []string
+	// ClientCert is presented when the server requests a client
+	// certificate (mTLS), e.g. Cloudflare Access protected origins.
+	ClientCert *tls.Certificate
+	// Proxy is an explicit upstream proxy (http, https, socks5, socks5h)
+	// used to probe from another vantage point. ConnectMS then measures
+	// the connection to the proxy. Only the http backend over TCP
+	// supports it.
+	Proxy *url.URL
+	// WarpPrivateKey is the base64 private key of a WARP registration,
+	// WarpPeerKey the endpoint public key (default WarpPublicKey) and
+	// WarpReserved the optional 3-byte client id (warp backend).
+	WarpPrivateKey string
+	WarpPeerKey    string
+	WarpReserved   []byte
+	// Timing selects how the http backend measures (TimingPooled or
+	// TimingAccurate).
+	Timing string
+	// NoKeepAlive disables connection pooling in the http backend, so
+	// every probe pays a full TCP+TLS handshake.
+	NoKeepAlive bool
+	// TLSFingerprint makes the ClientHello mimic a browser (uTLS), e.g.
+	// "chrome"; see TLSFingerprints. It implies TimingAccurate.
+	TLSFingerprint string
+	// DoHName and DoHType (A or AAAA) form the query of the doh backend.
+	DoHName string
+	DoHType string
+
+	// Socket holds low-level options for probe sockets.
+	Socket SocketOptions
+
+	// Samples is the number of measurements per IP (see Sampler); <= 1
+	// means a single measurement.
+	Samples int
+	// SampleStat selects the statistic used as TotalMS when Samples > 1.
+	SampleStat string
+	// SampleInterval spaces consecutive samples of one IP.
+	SampleInterval time.Duration
+	// Retries is the number of times a transient failure is retried
+	// (see Retrier); RetryBackoff is the pause before the first retry.
+	Retries      int
+	RetryBackoff time.Duration
+
+	// H2Streams is the number of concurrent streams of the h2mux backend.
+	H2Streams int
+
+	// CaptureBody keeps up to this many bytes of the response body in
+	// Result.Body (0 = don't keep it).
+	CaptureBody int
+
+	// TraceParser selects how the trace (and its colo) is read from a
+	// response: TraceCloudflare (default) or another CDN's (see
+	// TraceParsers).
+	TraceParser string
 }
 
 type Result struct {
-	IP        netip.Addr        `json:"ip"`
-	OK        bool              `json:"ok"`
-	Status    int               `json:"status"`
-	Error     string            `json:"error,omitempty"`
-	ConnectMS int64             `json:"connect_ms"`
-	TLSMS     int64             `json:"tls_ms"`
-	TTFBMS    int64             `json:"ttfb_ms"`
-	TotalMS   int64             `json:"total_ms"`
-	Trace     map[string]string `json:"trace,omitempty"`
-	When      time.Time         `json:"when"`
+	IP         netip.Addr        `json:"ip"`
+	OK         bool              `json:"ok"`
+	Status     int               `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	ConnectMS  int64             `json:"connect_ms"`
+	TLSMS      int64             `json:"tls_ms"`
+	TTFBMS     int64             `json:"ttfb_ms"`
+	TotalMS    int64             `json:"total_ms"`
+	Trace      map[string]string `json:"trace,omitempty"`
+	When       time.Time         `json:"when"`
+	Hedged     bool              `json:"hedged,omitempty"`      // result came from a hedge probe
+	Body       string            `json:"body,omitempty"`        // truncated body (Config.CaptureBody)
+	StreamMS   []int64           `json:"stream_ms,omitempty"`   // per-stream latency (h2mux)
+	TLSVerify  string            `json:"tls_verify,omitempty"`  // certificate verification outcome
+	Port       uint16            `json:"port,omitempty"`        // port of the result (MultiPort)
+	Cert       *CertInfo         `json:"cert,omitempty"`        // leaf certificate
+	ALPN       string            `json:"alpn,omitempty"`        // negotiated ALPN protocol
+	TLSVersion string            `json:"tls_version,omitempty"` // e.g. "TLS1.3"
+	HTTPProto  string            `json:"http_proto,omitempty"`  // http.Response.Proto
+	Attempts   int               `json:"attempts,omitempty"`    // probe attempts (Retrier)
+
+	// Multi-sample statistics (Sampler).
+	Samples   int     `json:"samples,omitempty"`
+	SamplesOK int     `json:"samples_ok,omitempty"`
+	P50MS     int64   `json:"p50_ms,omitempty"`
+	P90MS     int64   `json:"p90_ms,omitempty"`
+	MaxMS     int64   `json:"max_ms,omitempty"`
+	LossPct   float64 `json:"loss_pct,omitempty"`
+	JitterMS  float64 `json:"jitter_ms,omitempty"`
 }
 
 type Prober struct {
 	cfg    Config
 	client *http.Client
+	doh    *dohQuery // set for the doh backend
 }
 
 // NewProber creates a reusable, direct-connection (no proxy) prober.
@@ -51,12 +172,13 @@ func NewProber(cfg Config) *Prober {
 		cfg.Timeout = 3 * time.Second
 	}
 
+	if cfg.Mode == ModeH3 {
+		return &Prober{cfg: cfg, client: h3Client(cfg)}
+	}
+
 	transport := &http.Transport{
-		Proxy: nil, // critical: ignore HTTP(S)_PROXY and NO_PROXY env vars
-		DialContext: (&net.Dialer{
-			Timeout:   cfg.Timeout,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		Proxy:                 proxyFunc(cfg.Proxy), // critical: never use HTTP(S)_PROXY and NO_PROXY env vars
+		DialContext:           dialFunc(cfg.Timeout, cfg.Socket),
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          1024,
 		MaxIdleConnsPerHost:   256,
@@ -64,34 +186,32 @@ func NewProber(cfg Config) *Prober {
 		TLSHandshakeTimeout:   cfg.Timeout,
 		ResponseHeaderTimeout: cfg.Timeout,
 		ExpectContinueTimeout: 1 * time.Second,
-		TLSClientConfig: &tls.Config{
-			ServerName: cfg.SNI,
-		},
+		TLSClientConfig:       cfg.tlsConfig(),
+		DisableKeepAlives:     cfg.NoKeepAlive,
 	}
 	client := &http.Client{
 		Transport: transport,
 		Timeout:   cfg.Timeout,
 	}
+	if cfg.ExpectStatus != nil {
+		client.CheckRedirect = noRedirect
+	}
 
 	return &Prober{cfg: cfg, client: client}
 }
 
-// ProbeHTTPTrace probes https://<ip>/<path> with SNI/HostHeader.
+// ProbeHTTPTrace probes <scheme>://<ip>[:port]/<path> with SNI/HostHeader.
 func (p *Prober) ProbeHTTPTrace(ctx context.Context, ip netip.Addr) Result {
+	if p.cfg.Timing == TimingAccurate || p.cfg.TLSFingerprint != "" {
+		return p.probeAccurate(ctx, ip)
+	}
 	start := time.Now()
 	res := Result{
 		IP:   ip,
+		Port: p.cfg.port(),
 		When: start,
 	}
 
-	targetHost := ip.String()
-	// URL host must wrap IPv6 in brackets.
-	if ip.Is6() {
-		targetHost = "[" + targetHost + "]"
-	}
-
-	url := "https://" + targetHost + p.cfg.Path
-
 	var (
 		connectStart time.Time
 		tlsStart     time.Time
@@ -122,26 +242,16 @@ func (p *Prober) ProbeHTTPTrace(ctx context.Context, ip netip.Addr) Result {
 		},
 	}
 
-	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, url, nil)
+	req, err := p.request(httptrace.WithClientTrace(ctx, trace), ip)
 	if err != nil {
 		res.Error = err.Error()
 		res.TotalMS = time.Since(start).Milliseconds()
 		return res
 	}
-	if p.cfg.HostHeader != "" {
-		req.Host = p.cfg.HostHeader
-	}
-	req.Header.Set("User-Agent", "mcis/0.1")
-	req.Header.Set("Accept", "text/plain")
 
 	httpRes, err := p.client.Do(req)
 	if err != nil {
-		// Normalize common context timeout.
-		if errors.Is(err, context.DeadlineExceeded) {
-			res.Error = "timeout"
-		} else {
-			res.Error = err.Error()
-		}
+		res.Error, res.TLSVerify = probeError(ctx, err)
 		res.TotalMS = time.Since(start).Milliseconds()
 		res.ConnectMS = connectDur.Milliseconds()
 		res.TLSMS = tlsDur.Milliseconds()
@@ -152,23 +262,136 @@ func (p *Prober) ProbeHTTPTrace(ctx context.Context, ip netip.Addr) Result {
 	}
 	defer func() { _ = httpRes.Body.Close() }()
 
-	body, _ := io.ReadAll(io.LimitReader(httpRes.Body, 64*1024))
+	var body []byte
+	if p.cfg.BodyLimit > 0 {
+		body, _ = io.ReadAll(io.LimitReader(httpRes.Body, p.cfg.BodyLimit))
+	}
 	res.Status = httpRes.StatusCode
+	res.TLSVerify = tlsVerifyOutcome(httpRes.TLS, p.cfg.Insecure)
+	res.setConnState(httpRes.TLS)
+	res.HTTPProto = httpRes.Proto
 	res.ConnectMS = connectDur.Milliseconds()
 	res.TLSMS = tlsDur.Milliseconds()
 	if !gotFirstByte.IsZero() {
 		res.TTFBMS = gotFirstByte.Sub(start).Milliseconds()
 	}
 	res.TotalMS = time.Since(start).Milliseconds()
+	p.checkResult(&res, httpRes, body)
+	return res
+}
 
-	if httpRes.StatusCode >= 200 && httpRes.StatusCode < 300 {
-		res.OK = true
-		res.Trace = parseTrace(string(body))
-	} else {
+// request builds the probe request for ip.
+func (p *Prober) request(ctx context.Context, ip netip.Addr) (*http.Request, error) {
+	url := p.cfg.scheme() + "://" + p.cfg.hostPort(ip) + p.cfg.Path
+	if p.doh != nil {
+		url += "?dns=" + p.doh.param
+	}
+	req, err := p.cfg.newRequest(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if p.doh != nil {
+		req.Header.Set("Accept", "application/dns-message")
+	}
+	return req, nil
+}
+
+// probeError normalizes a request error into Result.Error and, for
+// certificate verification failures, Result.TLSVerify.
+func probeError(ctx context.Context, err error) (string, string) {
+	if errors.Is(context.Cause(ctx), ErrUnreachable) {
+		return ErrUnreachable.Error(), ""
+	}
+	if v := tlsVerifyFailure(err); v != "" {
+		return "tls_verify_" + v, v
+	}
+	if errors.Is(err, context.DeadlineExceeded) || isTimeout(err) {
+		return "timeout", ""
+	}
+	return err.Error(), ""
+}
+
+// checkResult validates a response and fills OK, Error, Trace and Body.
+func (p *Prober) checkResult(res *Result, httpRes *http.Response, body []byte) {
+	if p.cfg.CaptureBody > 0 {
+		res.Body = string(body[:min(len(body), p.cfg.CaptureBody)])
+	}
+
+	if reason := p.cfg.checkResponse(httpRes.StatusCode, body); reason != "" {
 		res.OK = false
-		res.Error = fmt.Sprintf("http_status_%d", httpRes.StatusCode)
+		res.Error = reason
+	} else if p.doh != nil {
+		if answer, reason := p.doh.check(httpRes.Header, body); reason != "" {
+			res.OK = false
+			res.Error = reason
+		} else {
+			res.OK = true
+			res.Trace = map[string]string{"answer": answer}
+			if colo := rayColo(httpRes.Header.Get("Cf-Ray")); colo != "" {
+				res.Trace["colo"] = colo
+			}
+		}
+	} else {
+		res.OK = true
+		res.Trace = p.cfg.trace(httpRes.Header, body)
 	}
-	return res
+}
+
+// noRedirect makes an http.Client return redirect responses as-is.
+func noRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// checkResponse validates a response; it returns "" when the response is
+// acceptable and the error string otherwise.
+func (c Config) checkResponse(status int, body []byte) string {
+	if c.ExpectStatus != nil {
+		if !c.ExpectStatus.Contains(status) {
+			return fmt.Sprintf("http_status_%d", status)
+		}
+	} else if status < 200 || status >= 300 {
+		return fmt.Sprintf("http_status_%d", status)
+	}
+	if c.ExpectBody != nil && !c.ExpectBody.Match(body) {
+		return "body_mismatch"
+	}
+	return ""
+}
+
+// newRequest builds a probe request with the configured method, Host and
+// headers.
+func (c Config) newRequest(ctx context.Context, url string) (*http.Request, error) {
+	method := c.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.HostHeader != "" {
+		req.Host = c.HostHeader
+	}
+	req.Header.Set("User-Agent", "mcis/0.1")
+	req.Header.Set("Accept", "text/plain")
+	for k, vs := range c.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = vs[len(vs)-1]
+			continue
+		}
+		req.Header[k] = vs
+	}
+	return req, nil
+}
+
+// ParseHeader parses a "Key: Value" header line.
+func ParseHeader(s string) (string, string, error) {
+	k, v, ok := strings.Cut(s, ":")
+	k = strings.TrimSpace(k)
+	if !ok || k == "" {
+		return "", "", fmt.Errorf("invalid header %q (want \"Key: Value\")", s)
+	}
+	return http.CanonicalHeaderKey(k), strings.TrimSpace(v), nil
 }
 
 func parseTrace(s string) map[string]string {
@@ -0,0 +1,304 @@
+package probe
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// WarpPort is the default port of the warp backend. Cloudflare WARP
+// endpoints also listen on e.g. 500, 1701, 4500 and 2408-2409.
+const WarpPort = 2408
+
+// WarpPublicKey is the WireGuard public key of Cloudflare WARP endpoints.
+const WarpPublicKey = "bmXOC+F1FxEMF9dyiK2H5/1SUtzH0JuVo51h2wPfgyo="
+
+// WireGuard message layout (https://www.wireguard.com/protocol/).
+const (
+	wgInitiationType = 1
+	wgResponseType   = 2
+	wgInitiationSize = 148
+	wgResponseSize   = 92
+)
+
+var (
+	wgConstruction = []byte("Noise_IKpsk2_25519_ChaChaPoly_BLAKE2s")
+	wgIdentifier   = []byte("WireGuard v1 zx2c4 Jason@zx2c4.com")
+	wgLabelMAC1    = []byte("mac1----")
+)
+
+// WarpProber is a Backend that validates WARP (WireGuard over UDP)
+// endpoints: it sends a WireGuard handshake initiation and waits for the
+// handshake response. TotalMS is the handshake round-trip time; Status and
+// Trace stay empty.
+//
+// Cloudflare only answers initiations from registered devices, so the
+// private key of a WARP registration (e.g. from a wgcf profile) is needed.
+type WarpProber struct {
+	cfg      Config
+	priv     *ecdh.PrivateKey
+	peer     *ecdh.PublicKey
+	reserved [3]byte
+	lc       net.ListenConfig
+	source   func(netip.Addr) (netip.Addr, error)
+}
+
+// NewWarpProber creates a warp prober from cfg.WarpPrivateKey,
+// cfg.WarpPeerKey (default WarpPublicKey) and cfg.WarpReserved.
+func NewWarpProber(cfg Config) (*WarpProber, error) {
+	if cfg.WarpPrivateKey == "" {
+		return nil, errors.New("the warp backend needs the private key of a WARP registration")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 3 * time.Second
+	}
+	privRaw, err := parseWGKey(cfg.WarpPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("warp private key: %w", err)
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(privRaw)
+	if err != nil {
+		return nil, fmt.Errorf("warp private key: %w", err)
+	}
+	peerKey := cfg.WarpPeerKey
+	if peerKey == "" {
+		peerKey = WarpPublicKey
+	}
+	peerRaw, err := parseWGKey(peerKey)
+	if err != nil {
+		return nil, fmt.Errorf("warp public key: %w", err)
+	}
+	peer, err := ecdh.X25519().NewPublicKey(peerRaw)
+	if err != nil {
+		return nil, fmt.Errorf("warp public key: %w", err)
+	}
+	p := &WarpProber{
+		cfg:    cfg,
+		priv:   priv,
+		peer:   peer,
+		lc:     net.ListenConfig{Control: cfg.Socket.control()},
+		source: cfg.Socket.sourceFunc(),
+	}
+	copy(p.reserved[:], cfg.WarpReserved)
+	return p, nil
+}
+
+// parseWGKey decodes a base64 WireGuard key.
+func parseWGKey(s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != 32 {
+		return nil, errors.New("want a base64 32-byte key")
+	}
+	return b, nil
+}
+
+// ParseWarpReserved parses the 3 reserved header bytes ("client_id" of a
+// WARP registration) given as "a,b,c" or base64.
+func ParseWarpReserved(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if parts := strings.Split(s, ","); len(parts) == 3 {
+		b := make([]byte, 3)
+		for i, part := range parts {
+			v, err := strconv.ParseUint(strings.TrimSpace(part), 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid warp reserved bytes: %q", s)
+			}
+			b[i] = byte(v)
+		}
+		return b, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != 3 {
+		return nil, fmt.Errorf("invalid warp reserved bytes: %q (want a,b,c or base64)", s)
+	}
+	return b, nil
+}
+
+// Probe implements Backend.
+func (p *WarpProber) Probe(ctx context.Context, ip netip.Addr) Result {
+	ip = ip.Unmap()
+	start := time.Now()
+	res := Result{IP: ip, Port: p.cfg.port(), When: start}
+	fail := func(err error) Result {
+		switch {
+		case errors.Is(context.Cause(ctx), ErrUnreachable):
+			res.Error = ErrUnreachable.Error()
+		case errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+			res.Error = "timeout"
+		default:
+			res.Error = err.Error()
+		}
+		res.TotalMS = time.Since(start).Milliseconds()
+		return res
+	}
+
+	network, laddr := "udp4", ""
+	if ip.Is6() {
+		network = "udp6"
+	}
+	src, err := p.source(ip)
+	if err != nil {
+		return fail(err)
+	}
+	if src.IsValid() {
+		laddr = netip.AddrPortFrom(src, 0).String()
+	}
+	pc, err := p.lc.ListenPacket(ctx, network, laddr)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = pc.Close() }()
+	deadline := start.Add(p.cfg.Timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	_ = pc.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { _ = pc.SetDeadline(time.Now()) })
+	defer stop()
+
+	msg, sender, err := p.initiation()
+	if err != nil {
+		return fail(err)
+	}
+	dst := net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, p.cfg.port()))
+	start = time.Now()
+	if _, err := pc.WriteTo(msg, dst); err != nil {
+		return fail(err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return fail(err)
+		}
+		ua, ok := from.(*net.UDPAddr)
+		if !ok || ua.AddrPort().Addr().Unmap() != ip {
+			continue
+		}
+		if n != wgResponseSize || buf[0] != wgResponseType ||
+			binary.LittleEndian.Uint32(buf[8:12]) != sender {
+			continue
+		}
+		res.OK = true
+		res.TotalMS = time.Since(start).Milliseconds()
+		return res
+	}
+}
+
+// initiation builds a WireGuard handshake initiation message and returns
+// it with its sender index.
+func (p *WarpProber) initiation() ([]byte, uint32, error) {
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	var idx [4]byte
+	if _, err := rand.Read(idx[:]); err != nil {
+		return nil, 0, err
+	}
+	sender := binary.LittleEndian.Uint32(idx[:])
+
+	msg := make([]byte, wgInitiationSize)
+	msg[0] = wgInitiationType
+	copy(msg[1:4], p.reserved[:])
+	binary.LittleEndian.PutUint32(msg[4:8], sender)
+
+	peerPub := p.peer.Bytes()
+	ck := blake2s.Sum256(wgConstruction)
+	h := wgHash(ck[:], wgIdentifier)
+	h = wgHash(h[:], peerPub)
+
+	ephPub := eph.PublicKey().Bytes()
+	copy(msg[8:40], ephPub)
+	ck = wgKDF1(ck[:], ephPub)
+	h = wgHash(h[:], ephPub)
+
+	ss, err := eph.ECDH(p.peer)
+	if err != nil {
+		return nil, 0, err
+	}
+	var key [32]byte
+	ck, key = wgKDF2(ck[:], ss)
+	static := wgSeal(key[:], p.priv.PublicKey().Bytes(), h[:])
+	copy(msg[40:88], static)
+	h = wgHash(h[:], static)
+
+	ss, err = p.priv.ECDH(p.peer)
+	if err != nil {
+		return nil, 0, err
+	}
+	_, key = wgKDF2(ck[:], ss)
+	stamp := wgSeal(key[:], tai64n(time.Now()), h[:])
+	copy(msg[88:116], stamp)
+
+	macKey := wgHash(wgLabelMAC1, peerPub)
+	mac, _ := blake2s.New128(macKey[:])
+	mac.Write(msg[:116])
+	copy(msg[116:132], mac.Sum(nil))
+	// mac2 stays zero: it is only required under load (cookie reply).
+	return msg, sender, nil
+}
+
+func wgHash(a, b []byte) [32]byte {
+	h, _ := blake2s.New256(nil)
+	h.Write(a)
+	h.Write(b)
+	var out [32]byte
+	h.Sum(out[:0])
+	return out
+}
+
+func wgHMAC(key []byte, data ...[]byte) [32]byte {
+	m := hmac.New(func() hash.Hash { h, _ := blake2s.New256(nil); return h }, key)
+	for _, d := range data {
+		m.Write(d)
+	}
+	var out [32]byte
+	m.Sum(out[:0])
+	return out
+}
+
+func wgKDF1(ck, input []byte) [32]byte {
+	t0 := wgHMAC(ck, input)
+	return wgHMAC(t0[:], []byte{1})
+}
+
+func wgKDF2(ck, input []byte) ([32]byte, [32]byte) {
+	t0 := wgHMAC(ck, input)
+	t1 := wgHMAC(t0[:], []byte{1})
+	t2 := wgHMAC(t0[:], t1[:], []byte{2})
+	return t1, t2
+}
+
+// wgSeal encrypts plaintext with counter 0.
+func wgSeal(key, plaintext, ad []byte) []byte {
+	aead, _ := chacha20poly1305.New(key)
+	var nonce [chacha20poly1305.NonceSize]byte
+	return aead.Seal(nil, nonce[:], plaintext, ad)
+}
+
+// tai64n encodes t as a TAI64N timestamp.
+func tai64n(t time.Time) []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint64(b[:8], 0x400000000000000a+uint64(t.Unix()))
+	binary.BigEndian.PutUint32(b[8:], uint32(t.Nanosecond()))
+	return b
+}
@@ -0,0 +1,191 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+)
+
+const telegramAPIBase = "https://api.telegram.org"
+
+// Best is the best result of a run, as remembered between runs for the
+// change reported by a Notifier.
+type Best struct {
+	IP      netip.Addr `json:"ip"`
+	ScoreMS float64    `json:"score_ms"`
+	Colo    string     `json:"colo,omitempty"`
+	When    time.Time  `json:"when"`
+}
+
+// Notifier sends a summary message to Slack and/or Telegram when a run
+// completes: the best IP, its score and colo, and the change against the
+// previous run.
+type Notifier struct {
+	SlackWebhook  string // Slack incoming webhook URL
+	TelegramToken string // bot token
+	TelegramChat  string // chat id or @channel
+	// OnChange sends a message only when the best IP differs from the
+	// previous run's.
+	OnChange bool
+	// StatePath, if set, keeps the previous best IP in this file so runs
+	// in separate processes (e.g. from cron) see each other.
+	StatePath string
+	Timeout   time.Duration
+	Client    *http.Client
+
+	last *Best
+}
+
+// Notify sends the message for res, the run's final results (best first).
+func (n *Notifier) Notify(ctx context.Context, res engine.Response) error {
+	if n.last == nil && n.StatePath != "" {
+		if err := n.loadState(); err != nil {
+			return fmt.Errorf("notify: %w", err)
+		}
+	}
+	var best *Best
+	for _, r := range res.Top {
+		if r.OK {
+			best = &Best{IP: r.IP, ScoreMS: r.ScoreMS, Colo: r.Trace["colo"], When: time.Now()}
+			break
+		}
+	}
+	prev := n.last
+	if n.OnChange && best != nil && prev != nil && prev.IP == best.IP {
+		return nil
+	}
+
+	msg := message(best, prev, res.Stats)
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+		defer cancel()
+	}
+	var (
+		errs []error
+		sent bool
+	)
+	if n.SlackWebhook != "" {
+		if err := n.post(ctx, n.SlackWebhook, map[string]string{"text": msg}); err != nil {
+			errs = append(errs, fmt.Errorf("notify slack: %w", err))
+		} else {
+			sent = true
+		}
+	}
+	if n.TelegramToken != "" {
+		u := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPIBase, n.TelegramToken)
+		if err := n.post(ctx, u, map[string]string{"chat_id": n.TelegramChat, "text": msg}); err != nil {
+			errs = append(errs, fmt.Errorf("notify telegram: %w", err))
+		} else {
+			sent = true
+		}
+	}
+	// Remember the best IP only once a message about it went out, so a
+	// change whose messages all failed is reported again next time
+	if sent && best != nil {
+		n.last = best
+		if n.StatePath != "" {
+			if err := n.saveState(); err != nil {
+				errs = append(errs, fmt.Errorf("notify: %w", err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// message formats the summary of a run.
+func message(best, prev *Best, stats engine.RunStats) string {
+	var b strings.Builder
+	if best == nil {
+		b.WriteString("mcis: no successful IPs")
+	} else {
+		fmt.Fprintf(&b, "mcis: best %s %.1fms", best.IP, best.ScoreMS)
+		if best.Colo != "" {
+			fmt.Fprintf(&b, " (%s)", best.Colo)
+		}
+	}
+	switch {
+	case prev == nil:
+	case best != nil && prev.IP == best.IP:
+		fmt.Fprintf(&b, ", unchanged (%+.1fms)", best.ScoreMS-prev.ScoreMS)
+	default:
+		fmt.Fprintf(&b, ", was %s %.1fms", prev.IP, prev.ScoreMS)
+		if prev.Colo != "" {
+			fmt.Fprintf(&b, " (%s)", prev.Colo)
+		}
+	}
+	fmt.Fprintf(&b, "\n%d probes, %d ok, %.1fs", stats.Probes, stats.Successes, float64(stats.DurationMS)/1000)
+	return b.String()
+}
+
+func (n *Notifier) post(ctx context.Context, target string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return hideURL(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return hideURL(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// hideURL drops the URL from err: the Slack webhook URL and the Telegram
+// bot URL are secrets.
+func hideURL(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return fmt.Errorf("%s: %w", uerr.Op, uerr.Err)
+	}
+	return err
+}
+
+func (n *Notifier) loadState() error {
+	data, err := os.ReadFile(n.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var last Best
+	if err := json.Unmarshal(data, &last); err != nil {
+		return fmt.Errorf("%s: %w", n.StatePath, err)
+	}
+	n.last = &last
+	return nil
+}
+
+func (n *Notifier) saveState() error {
+	data, err := json.Marshal(n.last)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(n.StatePath, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,83 @@
+// Package publish sends the results of a run to external services.
+package publish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+)
+
+// Webhook sends the results of a run to an HTTP endpoint (-publish-url),
+// for DDNS providers and home-grown services alike.
+type Webhook struct {
+	URL    string
+	Method string      // default POST
+	Header http.Header // e.g. Authorization
+	// Body is executed over the run's Response to build the request body;
+	// without one the body is {"top": [...], "stats": {...}} as JSON.
+	Body    *template.Template
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+// Publish sends res. A response status other than 2xx is an error.
+func (w *Webhook) Publish(ctx context.Context, res engine.Response) error {
+	var body bytes.Buffer
+	if w.Body != nil {
+		if err := w.Body.Execute(&body, res); err != nil {
+			return fmt.Errorf("publish: %w", err)
+		}
+	} else {
+		payload := struct {
+			Top   []engine.TopResult `json:"top"`
+			Stats engine.RunStats    `json:"stats"`
+		}{res.Top, res.Stats}
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return fmt.Errorf("publish: %w", err)
+		}
+	}
+
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+	}
+	method := w.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, w.URL, &body)
+	if err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+	for k, v := range w.Header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("publish: %s: %s %s", w.URL, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
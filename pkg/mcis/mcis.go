@@ -0,0 +1,190 @@
+// Package mcis is the library API of the Monte Carlo IP searcher: it finds
+// the fastest addresses in a set of CIDRs with the same hierarchical
+// Thompson Sampling search as the mcis command.
+//
+// A minimal search:
+//
+//	cfg := mcis.DefaultConfig()
+//	cfg.CIDRs = []string{"104.16.0.0/13", "2606:4700::/32"}
+//	cfg.Host = "your.domain.com"
+//	res, err := mcis.Search(ctx, cfg)
+//	if err != nil {
+//		return err
+//	}
+//	for _, r := range res.Top {
+//		fmt.Println(r.IP, r.ScoreMS, r.Colo)
+//	}
+//
+// The types of this package are stable; the search itself lives in
+// internal packages that may change between releases.
+package mcis
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/probe"
+)
+
+// Prober measures one address. Implementations must be safe for
+// concurrent use and should return once ctx is done; the search cancels
+// ctx after Config.Timeout.
+type Prober interface {
+	Probe(ctx context.Context, ip netip.Addr) ProbeResult
+}
+
+// ProberFunc adapts a function to the Prober interface.
+type ProberFunc func(ctx context.Context, ip netip.Addr) ProbeResult
+
+// Probe implements Prober.
+func (f ProberFunc) Probe(ctx context.Context, ip netip.Addr) ProbeResult { return f(ctx, ip) }
+
+// Built-in probe methods for Config.Method.
+const (
+	MethodHTTP  = probe.BackendHTTP  // HTTPS request to Host/Path (default)
+	MethodH2Mux = probe.BackendH2Mux // concurrent streams on one HTTP/2 connection
+	MethodICMP  = probe.BackendICMP  // ping latency only (needs raw sockets)
+	MethodWarp  = probe.BackendWarp  // WireGuard handshake on UDP
+	MethodDoH   = probe.BackendDoH   // DNS-over-HTTPS query
+	MethodSim   = probe.BackendSim   // offline synthetic model, for tests
+)
+
+// ErrInvalidConfig matches (errors.Is) the errors of Search caused by its
+// Config, such as unparsable CIDRs or an unknown Method, as opposed to
+// failures of the run itself.
+var ErrInvalidConfig = engine.ErrInvalidConfig
+
+// Config configures a search. Start from DefaultConfig.
+type Config struct {
+	// CIDRs are the prefixes to search; Exclude lists prefixes whose
+	// addresses are never probed.
+	CIDRs   []string
+	Exclude []string
+
+	// IPs, if set, are probed once each instead of searching CIDRs, and
+	// all of them are returned (Budget and TopN are ignored).
+	IPs []netip.Addr
+
+	// Budget is the total number of probes, TopN the number of results
+	// returned, Concurrency the number of probes in flight and Heads the
+	// number of independent search heads.
+	Budget      int
+	TopN        int
+	Concurrency int
+	Heads       int
+
+	// Seed is the random seed (0 = time-based).
+	Seed int64
+
+	// Host is the TLS SNI and HTTP Host header, Path the requested path
+	// and Port the probed port (0 = 443) of the built-in probers.
+	Host string
+	Path string
+	Port uint16
+
+	// Timeout bounds every probe.
+	Timeout time.Duration
+
+	// Method selects a built-in prober (MethodHTTP if empty). Prober, if
+	// set, is used instead.
+	Method string
+	Prober Prober
+
+	// OnProbe, if set, is called with every probe result, and OnTopChange
+	// with the current best results whenever they change. Both are called
+	// from the scheduling goroutine and must return quickly.
+	OnProbe     func(ProbeResult)
+	OnTopChange func([]IP)
+}
+
+// DefaultConfig returns the defaults of the mcis command.
+func DefaultConfig() Config {
+	ec := engine.DefaultConfig()
+	return Config{
+		Budget:      ec.Budget,
+		TopN:        ec.TopN,
+		Concurrency: ec.Concurrency,
+		Heads:       ec.Heads,
+		Host:        "example.com",
+		Path:        "/cdn-cgi/trace",
+		Timeout:     3 * time.Second,
+		Method:      MethodHTTP,
+	}
+}
+
+// Search runs one search over cfg.CIDRs and returns the best addresses.
+// Cancelling ctx stops the search early; the results found so far are
+// still returned.
+func Search(ctx context.Context, cfg Config) (Result, error) {
+	if len(cfg.CIDRs) == 0 && len(cfg.IPs) == 0 {
+		return Result{}, fmt.Errorf("mcis: no CIDRs to search: %w", ErrInvalidConfig)
+	}
+	if cfg.Prober == nil {
+		switch cfg.Method {
+		case "", MethodHTTP, MethodH2Mux, MethodICMP, MethodWarp, MethodDoH, MethodSim:
+		default:
+			return Result{}, fmt.Errorf("mcis: unknown method %q: %w", cfg.Method, ErrInvalidConfig)
+		}
+	}
+
+	ec := engine.DefaultConfig()
+	ec.Budget = cfg.Budget
+	ec.TopN = cfg.TopN
+	ec.Concurrency = cfg.Concurrency
+	ec.Heads = cfg.Heads
+	ec.Seed = cfg.Seed
+
+	pc := probe.Config{
+		Timeout:    cfg.Timeout,
+		SNI:        cfg.Host,
+		HostHeader: cfg.Host,
+		Path:       cfg.Path,
+		Port:       cfg.Port,
+		Backend:    cfg.Method,
+		BodyLimit:  probe.DefaultBodyLimit,
+	}
+	req := engine.Request{
+		CIDRs:        cfg.CIDRs,
+		IPs:          cfg.IPs,
+		ExcludeCIDRs: cfg.Exclude,
+		Probe:        pc,
+	}
+	if cfg.Prober != nil {
+		req.Backend = proberBackend{cfg.Prober}
+	}
+	if cfg.OnProbe != nil {
+		req.OnProbe = func(pr engine.ProbeResult) { cfg.OnProbe(fromEngineProbe(pr)) }
+	}
+	if cfg.OnTopChange != nil {
+		req.OnTopChange = func(top []engine.TopResult) { cfg.OnTopChange(fromEngineTop(top)) }
+	}
+
+	res, err := engine.New(ec, pc).Run(ctx, req)
+	if err != nil {
+		return Result{}, err
+	}
+	return fromEngineResponse(res), nil
+}
+
+// proberBackend runs a Prober as a probe backend of the engine.
+type proberBackend struct{ p Prober }
+
+func (b proberBackend) Probe(ctx context.Context, ip netip.Addr) probe.Result {
+	pr := b.p.Probe(ctx, ip)
+	return probe.Result{
+		IP:        ip,
+		OK:        pr.OK,
+		Status:    pr.Status,
+		Error:     pr.Error,
+		ConnectMS: pr.ConnectMS,
+		TLSMS:     pr.TLSMS,
+		TTFBMS:    pr.TTFBMS,
+		TotalMS:   pr.TotalMS,
+		Trace:     pr.Trace,
+		Port:      pr.Port,
+		When:      pr.When,
+	}
+}
@@ -0,0 +1,113 @@
+package mcis
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/Leo-Mu/montecarlo-ip-searcher/internal/engine"
+)
+
+// ProbeResult is the outcome of one probe. A Prober fills the measured
+// fields; the search fills IP and Prefix of the results it reports.
+type ProbeResult struct {
+	IP     netip.Addr   `json:"ip"`
+	Prefix netip.Prefix `json:"prefix"`
+	Port   uint16       `json:"port,omitempty"`
+
+	OK        bool              `json:"ok"`
+	Status    int               `json:"status"`
+	Error     string            `json:"error,omitempty"`
+	ConnectMS int64             `json:"connect_ms"`
+	TLSMS     int64             `json:"tls_ms"`
+	TTFBMS    int64             `json:"ttfb_ms"`
+	TotalMS   int64             `json:"total_ms"` // the latency the search minimizes
+	Trace     map[string]string `json:"trace,omitempty"`
+	When      time.Time         `json:"when"`
+}
+
+// IP is one result of a search.
+type IP struct {
+	IP     netip.Addr   `json:"ip"`
+	Prefix netip.Prefix `json:"prefix"`
+	Port   uint16       `json:"port,omitempty"`
+
+	OK        bool    `json:"ok"`
+	Status    int     `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	ConnectMS int64   `json:"connect_ms"`
+	TLSMS     int64   `json:"tls_ms"`
+	TTFBMS    int64   `json:"ttfb_ms"`
+	TotalMS   int64   `json:"total_ms"`
+	ScoreMS   float64 `json:"score_ms"` // lower is better
+	Colo      string  `json:"colo,omitempty"`
+
+	Trace map[string]string `json:"trace,omitempty"`
+}
+
+// Stats summarizes a search. DurationMS is Duration in milliseconds, for
+// JSON readers.
+type Stats struct {
+	Probes     int64         `json:"probes"`
+	Successes  int64         `json:"successes"`
+	Failures   int64         `json:"failures"`
+	Duration   time.Duration `json:"duration"`
+	DurationMS int64         `json:"duration_ms"`
+}
+
+// Result is the outcome of Search.
+type Result struct {
+	Top   []IP  `json:"top"` // best first
+	Stats Stats `json:"stats"`
+}
+
+func fromEngineResponse(res engine.Response) Result {
+	return Result{
+		Top: fromEngineTop(res.Top),
+		Stats: Stats{
+			Probes:     res.Stats.Probes,
+			Successes:  res.Stats.Successes,
+			Failures:   res.Stats.Failures,
+			Duration:   time.Duration(res.Stats.DurationMS) * time.Millisecond,
+			DurationMS: res.Stats.DurationMS,
+		},
+	}
+}
+
+func fromEngineTop(top []engine.TopResult) []IP {
+	out := make([]IP, len(top))
+	for i, r := range top {
+		out[i] = IP{
+			IP:        r.IP,
+			Prefix:    r.Prefix,
+			Port:      r.Port,
+			OK:        r.OK,
+			Status:    r.Status,
+			Error:     r.Error,
+			ConnectMS: r.ConnectMS,
+			TLSMS:     r.TLSMS,
+			TTFBMS:    r.TTFBMS,
+			TotalMS:   r.TotalMS,
+			ScoreMS:   r.ScoreMS,
+			Colo:      r.Trace["colo"],
+			Trace:     r.Trace,
+		}
+	}
+	return out
+}
+
+func fromEngineProbe(pr engine.ProbeResult) ProbeResult {
+	return ProbeResult{
+		IP:        pr.IP,
+		Prefix:    pr.Prefix,
+		Port:      pr.Port,
+		OK:        pr.OK,
+		Status:    pr.Status,
+		Error:     pr.Error,
+		ConnectMS: pr.ConnectMS,
+		TLSMS:     pr.TLSMS,
+		TTFBMS:    pr.TTFBMS,
+		TotalMS:   pr.TotalMS,
+		Trace:     pr.Trace,
+		When:      pr.When,
+	}
+}
@@ -0,0 +1,5 @@
+// Package mcispb holds the protobuf messages and gRPC service of the
+// "mcis grpc" API, generated from mcis.proto.
+package mcispb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative mcis.proto
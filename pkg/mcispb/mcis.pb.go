@@ -0,0 +1,953 @@
+// gRPC API of "mcis grpc": the search and probe operations of package
+// pkg/mcis, streaming every probe while they run.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: mcis.proto
+
+package mcispb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ProbeOptions configures the prober. Zero fields keep the defaults of the
+// mcis command.
+type ProbeOptions struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Host          string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`                             // TLS SNI and HTTP Host header
+	Path          string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`                             // requested path
+	Port          uint32                 `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`                            // probed port (0 = 443)
+	TimeoutMs     int64                  `protobuf:"varint,4,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"` // per-probe timeout
+	Method        string                 `protobuf:"bytes,5,opt,name=method,proto3" json:"method,omitempty"`                         // http|h2mux|icmp|warp|doh|sim
+	Concurrency   int32                  `protobuf:"varint,6,opt,name=concurrency,proto3" json:"concurrency,omitempty"`              // probes in flight
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProbeOptions) Reset() {
+	*x = ProbeOptions{}
+	mi := &file_mcis_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProbeOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProbeOptions) ProtoMessage() {}
+
+func (x *ProbeOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_mcis_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProbeOptions.ProtoReflect.Descriptor instead.
+func (*ProbeOptions) Descriptor() ([]byte, []int) {
+	return file_mcis_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ProbeOptions) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *ProbeOptions) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ProbeOptions) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *ProbeOptions) GetTimeoutMs() int64 {
+	if x != nil {
+		return x.TimeoutMs
+	}
+	return 0
+}
+
+func (x *ProbeOptions) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *ProbeOptions) GetConcurrency() int32 {
+	if x != nil {
+		return x.Concurrency
+	}
+	return 0
+}
+
+type SearchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cidrs         []string               `protobuf:"bytes,1,rep,name=cidrs,proto3" json:"cidrs,omitempty"`
+	Exclude       []string               `protobuf:"bytes,2,rep,name=exclude,proto3" json:"exclude,omitempty"`
+	Budget        int32                  `protobuf:"varint,3,opt,name=budget,proto3" json:"budget,omitempty"`
+	Top           int32                  `protobuf:"varint,4,opt,name=top,proto3" json:"top,omitempty"`
+	Heads         int32                  `protobuf:"varint,5,opt,name=heads,proto3" json:"heads,omitempty"`
+	Seed          int64                  `protobuf:"varint,6,opt,name=seed,proto3" json:"seed,omitempty"` // 0 = time-based
+	Probe         *ProbeOptions          `protobuf:"bytes,7,opt,name=probe,proto3" json:"probe,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchRequest) Reset() {
+	*x = SearchRequest{}
+	mi := &file_mcis_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchRequest) ProtoMessage() {}
+
+func (x *SearchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mcis_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchRequest.ProtoReflect.Descriptor instead.
+func (*SearchRequest) Descriptor() ([]byte, []int) {
+	return file_mcis_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SearchRequest) GetCidrs() []string {
+	if x != nil {
+		return x.Cidrs
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetExclude() []string {
+	if x != nil {
+		return x.Exclude
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetBudget() int32 {
+	if x != nil {
+		return x.Budget
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetTop() int32 {
+	if x != nil {
+		return x.Top
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetHeads() int32 {
+	if x != nil {
+		return x.Heads
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetSeed() int64 {
+	if x != nil {
+		return x.Seed
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetProbe() *ProbeOptions {
+	if x != nil {
+		return x.Probe
+	}
+	return nil
+}
+
+type ProbeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ips           []string               `protobuf:"bytes,1,rep,name=ips,proto3" json:"ips,omitempty"`
+	Probe         *ProbeOptions          `protobuf:"bytes,2,opt,name=probe,proto3" json:"probe,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProbeRequest) Reset() {
+	*x = ProbeRequest{}
+	mi := &file_mcis_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProbeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProbeRequest) ProtoMessage() {}
+
+func (x *ProbeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mcis_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProbeRequest.ProtoReflect.Descriptor instead.
+func (*ProbeRequest) Descriptor() ([]byte, []int) {
+	return file_mcis_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ProbeRequest) GetIps() []string {
+	if x != nil {
+		return x.Ips
+	}
+	return nil
+}
+
+func (x *ProbeRequest) GetProbe() *ProbeOptions {
+	if x != nil {
+		return x.Probe
+	}
+	return nil
+}
+
+// Event is one message of a Search or Probe stream.
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*Event_Probe
+	//	*Event_Top
+	//	*Event_Result
+	Event         isEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_mcis_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_mcis_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_mcis_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Event) GetEvent() isEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *Event) GetProbe() *ProbeResult {
+	if x != nil {
+		if x, ok := x.Event.(*Event_Probe); ok {
+			return x.Probe
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetTop() *TopUpdate {
+	if x != nil {
+		if x, ok := x.Event.(*Event_Top); ok {
+			return x.Top
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetResult() *Result {
+	if x != nil {
+		if x, ok := x.Event.(*Event_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isEvent_Event interface {
+	isEvent_Event()
+}
+
+type Event_Probe struct {
+	Probe *ProbeResult `protobuf:"bytes,1,opt,name=probe,proto3,oneof"`
+}
+
+type Event_Top struct {
+	Top *TopUpdate `protobuf:"bytes,2,opt,name=top,proto3,oneof"`
+}
+
+type Event_Result struct {
+	Result *Result `protobuf:"bytes,3,opt,name=result,proto3,oneof"`
+}
+
+func (*Event_Probe) isEvent_Event() {}
+
+func (*Event_Top) isEvent_Event() {}
+
+func (*Event_Result) isEvent_Event() {}
+
+type ProbeResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Prefix        string                 `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Port          uint32                 `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`
+	Ok            bool                   `protobuf:"varint,4,opt,name=ok,proto3" json:"ok,omitempty"`
+	Status        int32                  `protobuf:"varint,5,opt,name=status,proto3" json:"status,omitempty"`
+	Error         string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	ConnectMs     int64                  `protobuf:"varint,7,opt,name=connect_ms,json=connectMs,proto3" json:"connect_ms,omitempty"`
+	TlsMs         int64                  `protobuf:"varint,8,opt,name=tls_ms,json=tlsMs,proto3" json:"tls_ms,omitempty"`
+	TtfbMs        int64                  `protobuf:"varint,9,opt,name=ttfb_ms,json=ttfbMs,proto3" json:"ttfb_ms,omitempty"`
+	TotalMs       int64                  `protobuf:"varint,10,opt,name=total_ms,json=totalMs,proto3" json:"total_ms,omitempty"`
+	Trace         map[string]string      `protobuf:"bytes,11,rep,name=trace,proto3" json:"trace,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	WhenUnixMs    int64                  `protobuf:"varint,12,opt,name=when_unix_ms,json=whenUnixMs,proto3" json:"when_unix_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProbeResult) Reset() {
+	*x = ProbeResult{}
+	mi := &file_mcis_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProbeResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProbeResult) ProtoMessage() {}
+
+func (x *ProbeResult) ProtoReflect() protoreflect.Message {
+	mi := &file_mcis_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProbeResult.ProtoReflect.Descriptor instead.
+func (*ProbeResult) Descriptor() ([]byte, []int) {
+	return file_mcis_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ProbeResult) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *ProbeResult) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *ProbeResult) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *ProbeResult) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ProbeResult) GetConnectMs() int64 {
+	if x != nil {
+		return x.ConnectMs
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetTlsMs() int64 {
+	if x != nil {
+		return x.TlsMs
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetTtfbMs() int64 {
+	if x != nil {
+		return x.TtfbMs
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetTotalMs() int64 {
+	if x != nil {
+		return x.TotalMs
+	}
+	return 0
+}
+
+func (x *ProbeResult) GetTrace() map[string]string {
+	if x != nil {
+		return x.Trace
+	}
+	return nil
+}
+
+func (x *ProbeResult) GetWhenUnixMs() int64 {
+	if x != nil {
+		return x.WhenUnixMs
+	}
+	return 0
+}
+
+type IP struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Prefix        string                 `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Port          uint32                 `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`
+	Ok            bool                   `protobuf:"varint,4,opt,name=ok,proto3" json:"ok,omitempty"`
+	Status        int32                  `protobuf:"varint,5,opt,name=status,proto3" json:"status,omitempty"`
+	Error         string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	ConnectMs     int64                  `protobuf:"varint,7,opt,name=connect_ms,json=connectMs,proto3" json:"connect_ms,omitempty"`
+	TlsMs         int64                  `protobuf:"varint,8,opt,name=tls_ms,json=tlsMs,proto3" json:"tls_ms,omitempty"`
+	TtfbMs        int64                  `protobuf:"varint,9,opt,name=ttfb_ms,json=ttfbMs,proto3" json:"ttfb_ms,omitempty"`
+	TotalMs       int64                  `protobuf:"varint,10,opt,name=total_ms,json=totalMs,proto3" json:"total_ms,omitempty"`
+	ScoreMs       float64                `protobuf:"fixed64,11,opt,name=score_ms,json=scoreMs,proto3" json:"score_ms,omitempty"` // lower is better
+	Colo          string                 `protobuf:"bytes,12,opt,name=colo,proto3" json:"colo,omitempty"`
+	Trace         map[string]string      `protobuf:"bytes,13,rep,name=trace,proto3" json:"trace,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IP) Reset() {
+	*x = IP{}
+	mi := &file_mcis_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IP) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IP) ProtoMessage() {}
+
+func (x *IP) ProtoReflect() protoreflect.Message {
+	mi := &file_mcis_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IP.ProtoReflect.Descriptor instead.
+func (*IP) Descriptor() ([]byte, []int) {
+	return file_mcis_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *IP) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *IP) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *IP) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *IP) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *IP) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *IP) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *IP) GetConnectMs() int64 {
+	if x != nil {
+		return x.ConnectMs
+	}
+	return 0
+}
+
+func (x *IP) GetTlsMs() int64 {
+	if x != nil {
+		return x.TlsMs
+	}
+	return 0
+}
+
+func (x *IP) GetTtfbMs() int64 {
+	if x != nil {
+		return x.TtfbMs
+	}
+	return 0
+}
+
+func (x *IP) GetTotalMs() int64 {
+	if x != nil {
+		return x.TotalMs
+	}
+	return 0
+}
+
+func (x *IP) GetScoreMs() float64 {
+	if x != nil {
+		return x.ScoreMs
+	}
+	return 0
+}
+
+func (x *IP) GetColo() string {
+	if x != nil {
+		return x.Colo
+	}
+	return ""
+}
+
+func (x *IP) GetTrace() map[string]string {
+	if x != nil {
+		return x.Trace
+	}
+	return nil
+}
+
+// TopUpdate holds the current best results, best first.
+type TopUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Top           []*IP                  `protobuf:"bytes,1,rep,name=top,proto3" json:"top,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopUpdate) Reset() {
+	*x = TopUpdate{}
+	mi := &file_mcis_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopUpdate) ProtoMessage() {}
+
+func (x *TopUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_mcis_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopUpdate.ProtoReflect.Descriptor instead.
+func (*TopUpdate) Descriptor() ([]byte, []int) {
+	return file_mcis_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TopUpdate) GetTop() []*IP {
+	if x != nil {
+		return x.Top
+	}
+	return nil
+}
+
+type Stats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Probes        int64                  `protobuf:"varint,1,opt,name=probes,proto3" json:"probes,omitempty"`
+	Successes     int64                  `protobuf:"varint,2,opt,name=successes,proto3" json:"successes,omitempty"`
+	Failures      int64                  `protobuf:"varint,3,opt,name=failures,proto3" json:"failures,omitempty"`
+	DurationMs    int64                  `protobuf:"varint,4,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Stats) Reset() {
+	*x = Stats{}
+	mi := &file_mcis_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stats) ProtoMessage() {}
+
+func (x *Stats) ProtoReflect() protoreflect.Message {
+	mi := &file_mcis_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stats.ProtoReflect.Descriptor instead.
+func (*Stats) Descriptor() ([]byte, []int) {
+	return file_mcis_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Stats) GetProbes() int64 {
+	if x != nil {
+		return x.Probes
+	}
+	return 0
+}
+
+func (x *Stats) GetSuccesses() int64 {
+	if x != nil {
+		return x.Successes
+	}
+	return 0
+}
+
+func (x *Stats) GetFailures() int64 {
+	if x != nil {
+		return x.Failures
+	}
+	return 0
+}
+
+func (x *Stats) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+type Result struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Top           []*IP                  `protobuf:"bytes,1,rep,name=top,proto3" json:"top,omitempty"` // best first
+	Stats         *Stats                 `protobuf:"bytes,2,opt,name=stats,proto3" json:"stats,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_mcis_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_mcis_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_mcis_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Result) GetTop() []*IP {
+	if x != nil {
+		return x.Top
+	}
+	return nil
+}
+
+func (x *Result) GetStats() *Stats {
+	if x != nil {
+		return x.Stats
+	}
+	return nil
+}
+
+var File_mcis_proto protoreflect.FileDescriptor
+
+const file_mcis_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"mcis.proto\x12\amcis.v1\"\xa3\x01\n" +
+	"\fProbeOptions\x12\x12\n" +
+	"\x04host\x18\x01 \x01(\tR\x04host\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x12\n" +
+	"\x04port\x18\x03 \x01(\rR\x04port\x12\x1d\n" +
+	"\n" +
+	"timeout_ms\x18\x04 \x01(\x03R\ttimeoutMs\x12\x16\n" +
+	"\x06method\x18\x05 \x01(\tR\x06method\x12 \n" +
+	"\vconcurrency\x18\x06 \x01(\x05R\vconcurrency\"\xc0\x01\n" +
+	"\rSearchRequest\x12\x14\n" +
+	"\x05cidrs\x18\x01 \x03(\tR\x05cidrs\x12\x18\n" +
+	"\aexclude\x18\x02 \x03(\tR\aexclude\x12\x16\n" +
+	"\x06budget\x18\x03 \x01(\x05R\x06budget\x12\x10\n" +
+	"\x03top\x18\x04 \x01(\x05R\x03top\x12\x14\n" +
+	"\x05heads\x18\x05 \x01(\x05R\x05heads\x12\x12\n" +
+	"\x04seed\x18\x06 \x01(\x03R\x04seed\x12+\n" +
+	"\x05probe\x18\a \x01(\v2\x15.mcis.v1.ProbeOptionsR\x05probe\"M\n" +
+	"\fProbeRequest\x12\x10\n" +
+	"\x03ips\x18\x01 \x03(\tR\x03ips\x12+\n" +
+	"\x05probe\x18\x02 \x01(\v2\x15.mcis.v1.ProbeOptionsR\x05probe\"\x91\x01\n" +
+	"\x05Event\x12,\n" +
+	"\x05probe\x18\x01 \x01(\v2\x14.mcis.v1.ProbeResultH\x00R\x05probe\x12&\n" +
+	"\x03top\x18\x02 \x01(\v2\x12.mcis.v1.TopUpdateH\x00R\x03top\x12)\n" +
+	"\x06result\x18\x03 \x01(\v2\x0f.mcis.v1.ResultH\x00R\x06resultB\a\n" +
+	"\x05event\"\x84\x03\n" +
+	"\vProbeResult\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x16\n" +
+	"\x06prefix\x18\x02 \x01(\tR\x06prefix\x12\x12\n" +
+	"\x04port\x18\x03 \x01(\rR\x04port\x12\x0e\n" +
+	"\x02ok\x18\x04 \x01(\bR\x02ok\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\x05R\x06status\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"connect_ms\x18\a \x01(\x03R\tconnectMs\x12\x15\n" +
+	"\x06tls_ms\x18\b \x01(\x03R\x05tlsMs\x12\x17\n" +
+	"\attfb_ms\x18\t \x01(\x03R\x06ttfbMs\x12\x19\n" +
+	"\btotal_ms\x18\n" +
+	" \x01(\x03R\atotalMs\x125\n" +
+	"\x05trace\x18\v \x03(\v2\x1f.mcis.v1.ProbeResult.TraceEntryR\x05trace\x12 \n" +
+	"\fwhen_unix_ms\x18\f \x01(\x03R\n" +
+	"whenUnixMs\x1a8\n" +
+	"\n" +
+	"TraceEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xff\x02\n" +
+	"\x02IP\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x16\n" +
+	"\x06prefix\x18\x02 \x01(\tR\x06prefix\x12\x12\n" +
+	"\x04port\x18\x03 \x01(\rR\x04port\x12\x0e\n" +
+	"\x02ok\x18\x04 \x01(\bR\x02ok\x12\x16\n" +
+	"\x06status\x18\x05 \x01(\x05R\x06status\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"connect_ms\x18\a \x01(\x03R\tconnectMs\x12\x15\n" +
+	"\x06tls_ms\x18\b \x01(\x03R\x05tlsMs\x12\x17\n" +
+	"\attfb_ms\x18\t \x01(\x03R\x06ttfbMs\x12\x19\n" +
+	"\btotal_ms\x18\n" +
+	" \x01(\x03R\atotalMs\x12\x19\n" +
+	"\bscore_ms\x18\v \x01(\x01R\ascoreMs\x12\x12\n" +
+	"\x04colo\x18\f \x01(\tR\x04colo\x12,\n" +
+	"\x05trace\x18\r \x03(\v2\x16.mcis.v1.IP.TraceEntryR\x05trace\x1a8\n" +
+	"\n" +
+	"TraceEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"*\n" +
+	"\tTopUpdate\x12\x1d\n" +
+	"\x03top\x18\x01 \x03(\v2\v.mcis.v1.IPR\x03top\"z\n" +
+	"\x05Stats\x12\x16\n" +
+	"\x06probes\x18\x01 \x01(\x03R\x06probes\x12\x1c\n" +
+	"\tsuccesses\x18\x02 \x01(\x03R\tsuccesses\x12\x1a\n" +
+	"\bfailures\x18\x03 \x01(\x03R\bfailures\x12\x1f\n" +
+	"\vduration_ms\x18\x04 \x01(\x03R\n" +
+	"durationMs\"M\n" +
+	"\x06Result\x12\x1d\n" +
+	"\x03top\x18\x01 \x03(\v2\v.mcis.v1.IPR\x03top\x12$\n" +
+	"\x05stats\x18\x02 \x01(\v2\x0e.mcis.v1.StatsR\x05stats2p\n" +
+	"\bSearcher\x122\n" +
+	"\x06Search\x12\x16.mcis.v1.SearchRequest\x1a\x0e.mcis.v1.Event0\x01\x120\n" +
+	"\x05Probe\x12\x15.mcis.v1.ProbeRequest\x1a\x0e.mcis.v1.Event0\x01B5Z3github.com/Leo-Mu/montecarlo-ip-searcher/pkg/mcispbb\x06proto3"
+
+var (
+	file_mcis_proto_rawDescOnce sync.Once
+	file_mcis_proto_rawDescData []byte
+)
+
+func file_mcis_proto_rawDescGZIP() []byte {
+	file_mcis_proto_rawDescOnce.Do(func() {
+		file_mcis_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_mcis_proto_rawDesc), len(file_mcis_proto_rawDesc)))
+	})
+	return file_mcis_proto_rawDescData
+}
+
+var file_mcis_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_mcis_proto_goTypes = []any{
+	(*ProbeOptions)(nil),  // 0: mcis.v1.ProbeOptions
+	(*SearchRequest)(nil), // 1: mcis.v1.SearchRequest
+	(*ProbeRequest)(nil),  // 2: mcis.v1.ProbeRequest
+	(*Event)(nil),         // 3: mcis.v1.Event
+	(*ProbeResult)(nil),   // 4: mcis.v1.ProbeResult
+	(*IP)(nil),            // 5: mcis.v1.IP
+	(*TopUpdate)(nil),     // 6: mcis.v1.TopUpdate
+	(*Stats)(nil),         // 7: mcis.v1.Stats
+	(*Result)(nil),        // 8: mcis.v1.Result
+	nil,                   // 9: mcis.v1.ProbeResult.TraceEntry
+	nil,                   // 10: mcis.v1.IP.TraceEntry
+}
+var file_mcis_proto_depIdxs = []int32{
+	0,  // 0: mcis.v1.SearchRequest.probe:type_name -> mcis.v1.ProbeOptions
+	0,  // 1: mcis.v1.ProbeRequest.probe:type_name -> mcis.v1.ProbeOptions
+	4,  // 2: mcis.v1.Event.probe:type_name -> mcis.v1.ProbeResult
+	6,  // 3: mcis.v1.Event.top:type_name -> mcis.v1.TopUpdate
+	8,  // 4: mcis.v1.Event.result:type_name -> mcis.v1.Result
+	9,  // 5: mcis.v1.ProbeResult.trace:type_name -> mcis.v1.ProbeResult.TraceEntry
+	10, // 6: mcis.v1.IP.trace:type_name -> mcis.v1.IP.TraceEntry
+	5,  // 7: mcis.v1.TopUpdate.top:type_name -> mcis.v1.IP
+	5,  // 8: mcis.v1.Result.top:type_name -> mcis.v1.IP
+	7,  // 9: mcis.v1.Result.stats:type_name -> mcis.v1.Stats
+	1,  // 10: mcis.v1.Searcher.Search:input_type -> mcis.v1.SearchRequest
+	2,  // 11: mcis.v1.Searcher.Probe:input_type -> mcis.v1.ProbeRequest
+	3,  // 12: mcis.v1.Searcher.Search:output_type -> mcis.v1.Event
+	3,  // 13: mcis.v1.Searcher.Probe:output_type -> mcis.v1.Event
+	12, // [12:14] is the sub-list for method output_type
+	10, // [10:12] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_mcis_proto_init() }
+func file_mcis_proto_init() {
+	if File_mcis_proto != nil {
+		return
+	}
+	file_mcis_proto_msgTypes[3].OneofWrappers = []any{
+		(*Event_Probe)(nil),
+		(*Event_Top)(nil),
+		(*Event_Result)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_mcis_proto_rawDesc), len(file_mcis_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_mcis_proto_goTypes,
+		DependencyIndexes: file_mcis_proto_depIdxs,
+		MessageInfos:      file_mcis_proto_msgTypes,
+	}.Build()
+	File_mcis_proto = out.File
+	file_mcis_proto_goTypes = nil
+	file_mcis_proto_depIdxs = nil
+}
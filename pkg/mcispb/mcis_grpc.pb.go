@@ -0,0 +1,178 @@
+// gRPC API of "mcis grpc": the search and probe operations of package
+// pkg/mcis, streaming every probe while they run.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: mcis.proto
+
+package mcispb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Searcher_Search_FullMethodName = "/mcis.v1.Searcher/Search"
+	Searcher_Probe_FullMethodName  = "/mcis.v1.Searcher/Probe"
+)
+
+// SearcherClient is the client API for Searcher service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SearcherClient interface {
+	// Search searches the CIDRs of the request. It streams a probe event per
+	// probe and a top event whenever the best results change, and ends with
+	// a result event. Cancelling the call stops the search.
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+	// Probe measures each listed address once, streaming a probe event per
+	// address and ending with a result event holding all of them.
+	Probe(ctx context.Context, in *ProbeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type searcherClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSearcherClient(cc grpc.ClientConnInterface) SearcherClient {
+	return &searcherClient{cc}
+}
+
+func (c *searcherClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Searcher_ServiceDesc.Streams[0], Searcher_Search_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SearchRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Searcher_SearchClient = grpc.ServerStreamingClient[Event]
+
+func (c *searcherClient) Probe(ctx context.Context, in *ProbeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Searcher_ServiceDesc.Streams[1], Searcher_Probe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ProbeRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Searcher_ProbeClient = grpc.ServerStreamingClient[Event]
+
+// SearcherServer is the server API for Searcher service.
+// All implementations must embed UnimplementedSearcherServer
+// for forward compatibility.
+type SearcherServer interface {
+	// Search searches the CIDRs of the request. It streams a probe event per
+	// probe and a top event whenever the best results change, and ends with
+	// a result event. Cancelling the call stops the search.
+	Search(*SearchRequest, grpc.ServerStreamingServer[Event]) error
+	// Probe measures each listed address once, streaming a probe event per
+	// address and ending with a result event holding all of them.
+	Probe(*ProbeRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedSearcherServer()
+}
+
+// UnimplementedSearcherServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSearcherServer struct{}
+
+func (UnimplementedSearcherServer) Search(*SearchRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedSearcherServer) Probe(*ProbeRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Probe not implemented")
+}
+func (UnimplementedSearcherServer) mustEmbedUnimplementedSearcherServer() {}
+func (UnimplementedSearcherServer) testEmbeddedByValue()                  {}
+
+// UnsafeSearcherServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SearcherServer will
+// result in compilation errors.
+type UnsafeSearcherServer interface {
+	mustEmbedUnimplementedSearcherServer()
+}
+
+func RegisterSearcherServer(s grpc.ServiceRegistrar, srv SearcherServer) {
+	// If the following call pancis, it indicates UnimplementedSearcherServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Searcher_ServiceDesc, srv)
+}
+
+func _Searcher_Search_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SearchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SearcherServer).Search(m, &grpc.GenericServerStream[SearchRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Searcher_SearchServer = grpc.ServerStreamingServer[Event]
+
+func _Searcher_Probe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ProbeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SearcherServer).Probe(m, &grpc.GenericServerStream[ProbeRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Searcher_ProbeServer = grpc.ServerStreamingServer[Event]
+
+// Searcher_ServiceDesc is the grpc.ServiceDesc for Searcher service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Searcher_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mcis.v1.Searcher",
+	HandlerType: (*SearcherServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Search",
+			Handler:       _Searcher_Search_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Probe",
+			Handler:       _Searcher_Probe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "mcis.proto",
+}